@@ -27,12 +27,16 @@ const configPath string = "./.env"
 type (
 	// Config -.
 	Config struct {
-		App   `yaml:"app"`
-		HTTP  `yaml:"http"`
-		Log   `yaml:"logger"`
-		PG    `yaml:"pgdb"`
-		GRPC  `yaml:"grpc"`
-		Kafka `yaml:"kafka"`
+		App           `yaml:"app"`
+		HTTP          `yaml:"http"`
+		Log           `yaml:"logger"`
+		PG            `yaml:"pgdb"`
+		GRPC          `yaml:"grpc"`
+		Kafka         `yaml:"kafka"`
+		RateLimit     `yaml:"rate_limit"`
+		ResponseCache `yaml:"response_cache"`
+		MailOutbox    `yaml:"mail_outbox"`
+		Birthdays     `yaml:"birthdays"`
 	}
 
 	// App -.
@@ -46,6 +50,11 @@ type (
 		HTTPAddr         string `yaml:"addr" env:"HTTP_ADDR" env-default:"localhost:8080"`
 		HTTPReadTimeout  int    `env-required:"true" yaml:"read_timeout"  env:"HTTP_READTIMEOUT"`
 		HTTPWriteTimeout int    `env-required:"true" yaml:"write_timeout" env:"HTTP_WRITETIMEOUT"`
+
+		// потоковые маршруты (/changes, /events/stream) - на отдельном адресе, без таймаута записи;
+		// stream_addr не задан - хост из addr, порт 8081. Соединение держим не дольше stream_max_duration секунд (клиент переподключится сам)
+		HTTPStreamAddr        string `yaml:"stream_addr"         env:"HTTP_STREAM_ADDR"`
+		HTTPStreamMaxDuration int    `yaml:"stream_max_duration" env:"HTTP_STREAM_MAX_DURATION" env-default:"600"`
 	}
 
 	// Log -.
@@ -64,17 +73,68 @@ type (
 		DBName      string `env-required:"true" yaml:"dbname"       env:"PG_DBNAME"`
 		ConnTimeout int    `env-required:"true" yaml:"conn_timeout" env:"PG_CONN_TIMEOUT"`
 		PoolMax     int    `env-required:"true" yaml:"pool_max"     env:"PG_POOL_MAX"     env-default:"5"`
+
+		// миграции (goose) при запуске; по умолчанию выключены - применяются вручную:
+		// goose -dir migrations postgres "<строка подключения>" up
+		MigrateOnStart bool   `yaml:"migrate_on_start" env:"PG_MIGRATE_ON_START" env-default:"false"`
+		MigrationsDir  string `yaml:"migrations_dir"   env:"PG_MIGRATIONS_DIR"   env-default:"migrations"`
 	}
 
-	// grpc
+	// grpc - без авторизации, поэтому включается явно (GRPC_ENABLED) и по умолчанию слушает только localhost
 	GRPC struct {
-		GRPCAddress string `yaml:"grpc_addr" env:"GRPC_ADDR" env-default:":50051"`
+		GRPCEnabled bool   `yaml:"grpc_enabled" env:"GRPC_ENABLED" env-default:"false"`
+		GRPCAddress string `yaml:"grpc_addr"    env:"GRPC_ADDR"    env-default:"localhost:50051"`
 	}
 
-	// kafka
+	// kafka: KafkaAddress - адреса брокеров через запятую.
+	// KafkaEnabled - публиковать события master data (user-ы, сотрудники, подразделения) в KafkaTopicEvents,
+	// KafkaMailJobs - письма не отправлять через SMTP, а публиковать заданиями в KafkaTopicMail (для почтового сервиса)
 	Kafka struct {
-		KafkaAddress   string `yaml:"kafka_addr" env:"KAFKA_ADDR" env-default:":9092"`
-		KafkaTopicMail string `yaml:"kafka_topic_mail" env:"KAFKA_TOPIC_MAIL" env-default:"md-topic-mail"`
+		KafkaAddress     string `yaml:"kafka_addr" env:"KAFKA_ADDR" env-default:":9092"`
+		KafkaTopicMail   string `yaml:"kafka_topic_mail" env:"KAFKA_TOPIC_MAIL" env-default:"md-topic-mail"`
+		KafkaTopicEvents string `yaml:"kafka_topic_events" env:"KAFKA_TOPIC_EVENTS" env-default:"md-topic-events"`
+		KafkaEnabled     bool   `yaml:"kafka_enabled" env:"KAFKA_ENABLED" env-default:"false"`
+		KafkaMailJobs    bool   `yaml:"kafka_mail_jobs" env:"KAFKA_MAIL_JOBS" env-default:"false"`
+	}
+
+	// ограничение частоты запросов от одного клиента (token bucket): RPS - запросов в секунду, Burst - подряд.
+	// Search - поиск сотрудника (1С дергает его на каждый ввод символа), Bulk - выгрузки всех сотрудников, Default - остальные.
+	// RPS = 0 - без ограничения
+	RateLimit struct {
+		RateLimitMaxClients   int     `yaml:"max_clients"   env:"RATE_LIMIT_MAX_CLIENTS"   env-default:"10000"`
+		RateLimitTrustProxy   bool    `yaml:"trust_proxy"   env:"RATE_LIMIT_TRUST_PROXY"   env-default:"false"`
+		RateLimitSearchRPS    float64 `yaml:"search_rps"    env:"RATE_LIMIT_SEARCH_RPS"    env-default:"2"`
+		RateLimitSearchBurst  int     `yaml:"search_burst"  env:"RATE_LIMIT_SEARCH_BURST"  env-default:"10"`
+		RateLimitBulkRPS      float64 `yaml:"bulk_rps"      env:"RATE_LIMIT_BULK_RPS"      env-default:"0.2"`
+		RateLimitBulkBurst    int     `yaml:"bulk_burst"    env:"RATE_LIMIT_BULK_BURST"    env-default:"3"`
+		RateLimitDefaultRPS   float64 `yaml:"default_rps"   env:"RATE_LIMIT_DEFAULT_RPS"   env-default:"20"`
+		RateLimitDefaultBurst int     `yaml:"default_burst" env:"RATE_LIMIT_DEFAULT_BURST" env-default:"40"`
+	}
+
+	// кэш ответов выгрузок в памяти (сбрасывается при загрузке данных из 1С). TTL - сколько хранить ответ, сек (0 - до сброса)
+	ResponseCache struct {
+		ResponseCacheEnabled    bool  `yaml:"enabled"     env:"RESPONSE_CACHE_ENABLED"     env-default:"true"`
+		ResponseCacheMaxEntries int   `yaml:"max_entries" env:"RESPONSE_CACHE_MAX_ENTRIES" env-default:"500"`
+		ResponseCacheMaxBytes   int64 `yaml:"max_bytes"   env:"RESPONSE_CACHE_MAX_BYTES"   env-default:"134217728"` // тела ответов всего, байт
+		ResponseCacheTTL        int   `yaml:"ttl"         env:"RESPONSE_CACHE_TTL"         env-default:"3600"`
+	}
+
+	// очередь исходящих писем: письма записываются в БД и отправляются в фоне с повторами.
+	// MaxAttempts - попыток до статуса failed, RetryMin/RetryMax - пауза между попытками (удваивается), сек; Poll - опрос очереди, сек
+	MailOutbox struct {
+		MailOutboxEnabled     bool `yaml:"enabled"      env:"MAIL_OUTBOX_ENABLED"      env-default:"true"`
+		MailOutboxMaxAttempts int  `yaml:"max_attempts" env:"MAIL_OUTBOX_MAX_ATTEMPTS" env-default:"10"`
+		MailOutboxRetryMin    int  `yaml:"retry_min"    env:"MAIL_OUTBOX_RETRY_MIN"    env-default:"60"`
+		MailOutboxRetryMax    int  `yaml:"retry_max"    env:"MAIL_OUTBOX_RETRY_MAX"    env-default:"3600"`
+		MailOutboxPoll        int  `yaml:"poll"         env:"MAIL_OUTBOX_POLL"         env-default:"30"`
+	}
+
+	// рассылка о днях рождения. Feb29Policy - когда в невисокосный год оповещать о родившихся 29 февраля:
+	// feb28 - 28 февраля, mar1 - 1 марта, skip - не оповещать.
+	// BdCalendarBaseURL - адрес MD для ссылок на календарь ДР (https://md.example.ru); пусто - по запросу (Host, X-Forwarded-Proto)
+	Birthdays struct {
+		BdFeb29Policy     string `yaml:"feb29_policy"      env:"BD_FEB29_POLICY"      env-default:"feb28"`
+		BdCalendarBaseURL string `yaml:"calendar_base_url" env:"BD_CALENDAR_BASE_URL"`
 	}
 )
 
@@ -75,3 +75,17 @@ const StatusSuccess = "Success"
 
 // записываем в таблицу exchange, когда обмен прошёл успешно
 const Response200ok = "200(ok)"
+
+// типы рассылок (users_for_notifications.notitype)
+const (
+	NotiTypeAdmin              = 1 // администраторы MD (скрытая копия всех рассылок)
+	NotiTypeBuch               = 2 // в бухгалтерию о загрузке email-ов в 1С:ЗУП
+	NotiType1CCreateUser       = 3 // в 1C:CreateUser о новом user-е с email
+	NotiTypeClosedDepartaments = 4 // в отдел кадров о сотрудниках в расформированных подразделениях
+	NotiTypeWorkAnniversaries  = 5 // в отдел кадров о годовщинах работы
+	NotiTypeStaffChanges       = 6 // в отдел кадров о принятых и уволенных за неделю
+
+	// id до NotiTypeCustomMin зарезервированы за встроенными рассылками, типы из api получают id от него
+	// (последовательность notifications_custom_id_seq, миграция 00008 - при изменении поменять и там)
+	NotiTypeCustomMin = 100
+)
@@ -9,8 +9,11 @@ require (
 	github.com/jackc/pgx/v4 v4.17.0
 	github.com/lib/pq v1.10.6
 	github.com/pressly/goose/v3 v3.7.0
+	github.com/segmentio/kafka-go v0.4.35
 	github.com/sirupsen/logrus v1.9.0
 	github.com/spf13/viper v1.8.1
+	google.golang.org/grpc v1.46.2
+	google.golang.org/protobuf v1.28.1
 	gopkg.in/alexcesaro/quotedprintable.v3 v3.0.0-20150716171945-2caba252f4dc // indirect
 	gopkg.in/asn1-ber.v1 v1.0.0-20181015200546-f715ec2f112d // indirect
 	gopkg.in/mail.v2 v2.3.1 // indirect
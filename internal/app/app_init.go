@@ -4,8 +4,12 @@ import (
 	"database/sql"
 	"fmt"
 	config "mdata/configs"
+	"mdata/internal/grpcapi"
+	"mdata/internal/handlers"
 	"mdata/internal/repository"
 	"mdata/internal/routes"
+	"mdata/pkg/broker"
+	"mdata/pkg/grpcserver"
 	"mdata/pkg/httpserver"
 	"mdata/pkg/logging"
 	"mdata/pkg/pg"
@@ -29,25 +33,64 @@ func Run(cfg *config.Config) {
 		defer insPgDB.Close()
 	}
 
-	// HTTP Server
+	// HTTP Server (потоковые маршруты - на отдельном сервере без таймаута записи)
 	mux := http.NewServeMux()
+	streamMux := http.NewServeMux()
 
 	ins := &repository.PostgreInstance{Db: insPgDB.Pool}
 
-	routes.InitializeRoutes(mux, ins)
+	routes.InitializeRoutes(mux, streamMux, ins, cfg)
+
+	// рассылка о днях рождения
+	if err := repository.SetBdFeb29Policy(cfg.BdFeb29Policy); err != nil {
+		log.Errorf("app - Run - birthdays: %v", err)
+	}
+
+	// Kafka: события master data и задания на отправку почты
+	var producer broker.Producer
+	var changesPublisher *handlers.ChangesPublisher
+	if cfg.KafkaEnabled || cfg.KafkaMailJobs {
+		producer = broker.NewKafka(cfg.KafkaAddress)
+		log.Infof("app - Run - kafka producer on addr %v", cfg.KafkaAddress)
+	}
+	if cfg.KafkaEnabled {
+		changesPublisher = handlers.StartChangesPublisher(ins, producer, cfg.KafkaTopicEvents)
+	}
+	if cfg.KafkaMailJobs {
+		repository.SetMailProducer(producer, cfg.KafkaTopicMail, ins)
+	}
+
+	// очередь исходящих писем
+	var mailWorker *handlers.MailWorker
+	if cfg.MailOutboxEnabled {
+		repository.SetMailOutbox(ins)
+		mailWorker = handlers.StartMailWorker(ins, cfg.MailOutbox)
+	}
 
 	// addr := flag.String("addr", ":8080", "Сетевой адрес веб-сервера MD")
 	// flag.Parse()
 	// err := http.ListenAndServe(*addr, mux)
 	// log.Errorf("main: srv.ListenAndServe() error: %v", err)
 
-	// v1.NewRouter(mux, inUseCase, grpcClient, log)
-
 	httpServer := httpserver.New(mux, cfg.HTTP)
 	if httpServer != nil {
 		log.Infof("app - Run - httpServer has run on addr %v", httpServer.GetAddr())
 	}
 
+	streamServer := httpserver.NewStream(streamMux, cfg.HTTP)
+	if streamServer != nil {
+		log.Infof("app - Run - streamServer has run on addr %v", streamServer.GetAddr())
+	}
+
+	// gRPC Server (те же данные, что и в rest)
+	var grpcServer *grpcserver.Server
+	var grpcNotify <-chan error // nil - сервер не запущен, в select не срабатывает
+	if cfg.GRPCEnabled {
+		grpcServer = grpcserver.New(cfg.GRPC, grpcapi.NewServer(ins).Register)
+		grpcNotify = grpcServer.Notify()
+		log.Infof("app - Run - grpcServer has run on addr %v", grpcServer.GetAddr())
+	}
+
 	//------------------------------------
 
 	interrupt := make(chan os.Signal, 1)
@@ -58,6 +101,10 @@ func Run(cfg *config.Config) {
 		log.Infof("app - Run - signal: " + s.String())
 	case err := <-httpServer.Notify():
 		log.Errorf("app - Run - httpServer.Notify: %w", err)
+	case err := <-streamServer.Notify():
+		log.Errorf("app - Run - streamServer.Notify: %v", err)
+	case err := <-grpcNotify:
+		log.Errorf("app - Run - grpcServer.Notify: %v", err)
 	}
 
 	// Shutdown
@@ -65,6 +112,28 @@ func Run(cfg *config.Config) {
 	if err != nil {
 		log.Errorf("app - Run - httpServer.Shutdown: %w", err)
 	}
+	err = streamServer.Shutdown()
+	if err != nil {
+		log.Errorf("app - Run - streamServer.Shutdown: %v", err)
+	}
+	if grpcServer != nil {
+		err = grpcServer.Shutdown()
+		if err != nil {
+			log.Errorf("app - Run - grpcServer.Shutdown: %v", err)
+		}
+	}
+	if mailWorker != nil {
+		mailWorker.Stop()
+	}
+	if changesPublisher != nil {
+		changesPublisher.Stop()
+	}
+	if producer != nil {
+		err = producer.Close()
+		if err != nil {
+			log.Errorf("app - Run - producer.Close: %v", err)
+		}
+	}
 
 }
 
@@ -85,18 +154,22 @@ func includePg(cfg *config.Config, log *logging.MDLogger) *pg.DB {
 		return nil
 	}
 
-	// migrationUp(strurl, log)
+	if cfg.PG.MigrateOnStart {
+		migrationUp(strurl, cfg.PG.MigrationsDir, log)
+	}
 
 	return insPgDB
 }
 
-func migrationUp(strurl string, log *logging.MDLogger) {
+// migrationUp - миграции из dir (путь - от рабочего каталога или абсолютный)
+func migrationUp(strurl, dir string, log *logging.MDLogger) {
 	conn, err := sql.Open("postgres", strurl)
 	if err != nil {
 		log.Fatalf("Can't sql.Open migrarion: %v", err)
 	}
-	err = goose.Up(conn, "migrations")
+	defer conn.Close()
+	err = goose.Up(conn, dir)
 	if err != nil {
-		log.Fatalf("Can't create migrarion: %v", err)
+		log.Fatalf("Can't create migrarion from %s: %v", dir, err)
 	}
 }
@@ -1,5 +1,10 @@
 package domain
 
+import (
+	"encoding/json"
+	"time"
+)
+
 //Структура конфига, которая включает в себя необходимые нам настройки соединения (сюда можно добавить любые другие поля для postgres типа ssl и т.д.)
 type Config struct {
 	DBHost       string
@@ -52,6 +57,58 @@ type EmployeeFilterData struct {
 	Tabno string `mapper:"tabno" json:"tabno"`
 }
 
+// фильтр и постраничная выдача для выборки user-ов (физ.лиц) с сотрудниками
+type EmployeesFilter struct {
+	TabNo           string   // табельный номер (like)
+	Name            string   // ФИО (like)
+	DepartamentGUID string   // подразделение (guid)
+	Position        string   // должность (like)
+	Employment      string   // тип работы (like)
+	State           string   // состояние сотрудника (like), по умолчанию - "Работ"
+	HasEmail        *bool    // есть email / нет email, nil - не важно
+	BirthdayMonth   int      // месяц рождения (1-12), 0 - не важно
+	Fields          []string // отдаваемые поля (fields=), пусто - все
+	Limit           int      // размер страницы, 0 - без ограничения
+	Offset          int      // смещение от начала
+	Cursor          string   // guid последнего user-а предыдущей страницы
+}
+
+// страница выборки user-ов
+// Users - []User, либо (при fields=) user-ы только с запрошенными полями
+type EmployeesPage struct {
+	Users      interface{} `json:"users"`
+	Total      int         `json:"total"`
+	Limit      int         `json:"limit,omitempty"`
+	Offset     int         `json:"offset,omitempty"`
+	NextCursor string      `json:"nextCursor,omitempty"`
+}
+
+// критерии поиска user-ов (все заданные - через "и")
+type EmployeesSearch struct {
+	TabNo       string // табельный номер (начало)
+	Name        string // ФИО, нечётко: "Кабанов", "кобанов андрей", "Кабанов А.И."
+	Email       string // email (like)
+	Departament string // guid подразделения или часть наименования
+	Position    string // должность (like)
+	Limit       int
+}
+
+// найденный user с оценкой совпадения (1 - точное)
+type UserSearchResult struct {
+	User
+	Rank float64 `json:"rank"`
+}
+
+type UsersSearchResult struct {
+	Users []UserSearchResult `json:"users"`
+}
+
+// должность с количеством работающих на ней сотрудников
+type PositionCount struct {
+	PositionDescr  string `json:"positionDescr"`
+	EmployeesCount int    `json:"employeesCount"`
+}
+
 //--------------------------------------------
 // Инициализация обмена:
 type ExchangeStruct struct {
@@ -61,16 +118,283 @@ type ExchangeStruct struct {
 	RowData    string `json:"rowData"`
 }
 
+// строка таблицы exchanges (для просмотра через api)
+type ExchangeRecord struct {
+	ExchangeId      int       `json:"exID"`
+	BaseID          int       `json:"baseID"`
+	ReasonID        int       `json:"reasonID"`
+	RowData         string    `json:"rowData"`
+	DateInit        time.Time `json:"dateInit"`
+	AttemptCount    int       `json:"attemptCount"`
+	LastAttemptDate time.Time `json:"lastAttemptDate"`
+	RespStatus      string    `json:"respStatus"`
+}
+
+//--------------------------------------------
+// лента изменений (GET /changes?since=)
+const (
+	ChangeEntityUser        = "user"
+	ChangeEntityEmployee    = "employee"
+	ChangeEntityDepartament = "departament"
+
+	ChangeTypeCreate = "create"
+	ChangeTypeUpdate = "update"
+	ChangeTypeEmail  = "email" // user-у назначен email
+	ChangeTypeFire   = "fire"  // сотрудник уволен
+)
+
+// событие ленты: Data - сущность после изменения
+type ChangeEvent struct {
+	ChangeID   int64           `json:"changeId"`
+	Entity     string          `json:"entity"`
+	EntityGUID string          `json:"entityGuid"`
+	ChangeType string          `json:"changeType"`
+	ChangeDate time.Time       `json:"changeDate"`
+	Data       json.RawMessage `json:"data,omitempty"`
+}
+
+// страница ленты: NextCursor - передать в since= следующего запроса (даже если изменений пока нет)
+type ChangesFeed struct {
+	Changes    []ChangeEvent `json:"changes"`
+	NextCursor string        `json:"nextCursor"`
+	HasMore    bool          `json:"hasMore"`
+}
+
+// сотрудник в событии ленты (с guid его user-а)
+type EmployeeChange struct {
+	UserGUID string `json:"userGuid"`
+	Employee
+}
+
+// задание на отправку письма для почтового сервиса (публикуется в топик почты Kafka вместо отправки через SMTP)
+type MailJob struct {
+	To             []string `json:"to"`
+	Bcc            string   `json:"bcc,omitempty"`
+	Subject        string   `json:"subject"`
+	Body           string   `json:"body"`
+	AttachmentName string   `json:"attachmentName,omitempty"`
+	HTMLBody       string   `json:"htmlBody,omitempty"`   // html-версия письма (Body - текстовая)
+	Attachment     []byte   `json:"attachment,omitempty"` // содержимое файла (в json - base64)
+}
+
+// статусы письма в очереди исходящих (mail_outbox)
+const (
+	MailStatusPending = "pending"
+	MailStatusSent    = "sent"
+	MailStatusFailed  = "failed"
+)
+
+// письмо в очереди исходящих (для просмотра через api - без вложения)
+type MailOutboxRecord struct {
+	MailID         int64      `json:"mailId"`
+	To             []string   `json:"to"`
+	Bcc            string     `json:"bcc,omitempty"`
+	Subject        string     `json:"subject"`
+	Body           string     `json:"body"`
+	AttachmentName string     `json:"attachmentName,omitempty"`
+	Status         string     `json:"status"`
+	AttemptCount   int        `json:"attemptCount"`
+	LastError      string     `json:"lastError,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	NextAttemptAt  time.Time  `json:"nextAttemptAt"`
+	SentAt         *time.Time `json:"sentAt,omitempty"`
+}
+
+//--------------------------------------------
+// рассылки: типы (таблица notifications) и подписчики (users_for_notifications) - user по guid или произвольный email
+type NotificationType struct {
+	ID               int    `json:"id"`
+	Name             string `json:"name"`
+	BuiltIn          bool   `json:"builtIn"` // рассылку отправляет MD (config.NotiType...) - тип нельзя удалить
+	SubscribersCount int    `json:"subscribersCount"`
+}
+
+type NotificationSubscriber struct {
+	SubscriberID int64  `json:"subscriberId"`
+	NotiType     int    `json:"notiType"`
+	UserGUID     string `json:"userGuid,omitempty"`
+	UserName     string `json:"userName,omitempty"`
+	Email        string `json:"email"` // для подписки по user-у - его текущий email
+}
+
+//--------------------------------------------
+// шаблоны писем (тема, html и текст); по умолчанию - в коде (repository), изменённые через api - в таблице mail_templates
+const (
+	MailTemplateBirthdays          = "birthdays"             // наблюдателям о днях рождения
+	MailTemplateBuchEmails         = "buch-emails"           // в бухгалтерию о загрузке email-ов в 1С:ЗУП
+	MailTemplate1CCreateUser       = "1c-create-user"        // в 1C:CreateUser о выгрузке новых user-ов (итог или ошибка)
+	MailTemplate1CCreateUserStatus = "1c-create-user-status" // в 1C:CreateUser о статусах выгрузки новых user-ов
+	MailTemplateClosedDepartaments = "closed-departaments"   // в отдел кадров о сотрудниках в расформированных подразделениях
+	MailTemplateWorkAnniversaries  = "work-anniversaries"    // в отдел кадров о годовщинах работы
+	MailTemplateStaffChanges       = "staff-changes"         // в отдел кадров о принятых и уволенных за неделю
+)
+
+type MailTemplate struct {
+	Key         string `json:"key"`
+	Description string `json:"description"`
+	NotiType    int    `json:"notiType,omitempty"` // тип рассылки получателей (users_for_notifications.notitype), 0 - свои получатели
+	Subject     string `json:"subject"`
+	HTML        string `json:"html"`
+	Text        string `json:"text"`
+	// Custom - шаблон изменён через api (иначе - по умолчанию)
+	Custom    bool       `json:"custom"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+}
+
+// данные для шаблонов писем
+type MailBirthdaysData struct {
+	Periods []MailBirthdaysPeriod
+}
+
+type MailBirthdaysPeriod struct {
+	Title  string // "Завтра день рождения у: "
+	Owners []MailBirthdayOwner
+}
+
+type MailBirthdayOwner struct {
+	Name     string
+	Birthday string // 02-01-2006
+}
+
+type MailBuchEmailsData struct {
+	Week string // номер недели
+	Date string // 02.01.2006
+}
+
+type Mail1CCreateUserData struct {
+	Users []Mail1CUser
+	Error string // пусто - выгрузка завершилась успехом
+}
+
+type Mail1CUser struct {
+	Name   string
+	ID     string
+	Status string // статус из ответа 1С (для 1c-create-user-status)
+}
+
+type MailClosedDepartamentsData struct {
+	Departaments []MailClosedDepartament
+}
+
+type MailClosedDepartament struct {
+	Title     string // "Отдел (расформировано 01.02.2022)"
+	Employees []string
+}
+
+type MailWorkAnniversariesData struct {
+	Period       string // "06.03.2023 - 12.03.2023"
+	Departaments []MailClosedDepartament
+}
+
+type MailStaffChangesData struct {
+	Period       string
+	Departaments []MailStaffChangesDepartament
+}
+
+type MailStaffChangesDepartament struct {
+	Title string
+	Hired []string
+	Fired []string
+}
+
+//--------------------------------------------
+// Ошибка api: {"error": {"status": 404, "code": "not_found", "message": "..."}}
+type APIError struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type APIErrorEnvelope struct {
+	Error APIError `json:"error"`
+}
+
+//--------------------------------------------
+// правила рассылки о днях рождения (таблица bd_rules): общее (observerGuid пуст) или для конкретного observer-а
+type BdRule struct {
+	ObserverGUID    string     `json:"observerGuid,omitempty"`
+	ObserverName    string     `json:"observerName,omitempty"`
+	LeadDays        []int      `json:"leadDays"`        // за сколько дней до ДР оповещать (1 - завтра)
+	WeeklyDay       int        `json:"weeklyDay"`       // день недели дайджеста на следующую неделю: 0 - вс ... 6 - сб, -1 - без дайджеста
+	MonthlyLeadDays int        `json:"monthlyLeadDays"` // за сколько дней до начала месяца - дайджест на следующий месяц, 0 - без дайджеста
+	SkipWeekends    bool       `json:"skipWeekends"`    // в сб и вс не рассылать: их оповещения уходят в пятницу
+	TimeZone        string     `json:"timeZone"`        // IANA (Europe/Moscow); пусто - время сервера
+	UpdatedAt       *time.Time `json:"updatedAt,omitempty"`
+}
+
+// подписка observer-а на ДР сотрудников подразделения (таблица bd_dep_subscriptions); именинники определяются при рассылке
+type BdDepartamentSubscription struct {
+	SubscriptionID   int64  `json:"subscriptionId"`
+	ObserverGUID     string `json:"observerGuid"`
+	ObserverName     string `json:"observerName,omitempty"`
+	DepartamentGUID  string `json:"departamentGuid,omitempty"` // пусто - подразделения, где работает observer
+	DepartamentDescr string `json:"departamentDescr,omitempty"`
+	Recursive        bool   `json:"recursive"` // вместе с подчиненными подразделениями
+}
+
+// подписки observer-а на ДР (/bd-subscriptions): именинники поштучно (bd_notifications), подразделения и отказ от рассылки
+type BdSubscriptions struct {
+	ObserverGUID string                      `json:"observerGuid"`
+	ObserverName string                      `json:"observerName"`
+	OptedOut     bool                        `json:"optedOut"` // отказался от рассылки о ДР
+	Owners       []BdSubscriptionOwner       `json:"owners"`
+	Departaments []BdDepartamentSubscription `json:"departaments"`
+}
+
+type BdSubscriptionOwner struct {
+	UserGUID string `json:"userGuid"`
+	UserName string `json:"userName"`
+	UserID   string `json:"userId"` // табельный номер
+}
+
+// тело POST /bd-subscriptions: именинник - по guid или по точному табельному номеру
+type BdSubscriptionRequest struct {
+	ObserverGUID   string `json:"observerGuid"`
+	OwnerGUID      string `json:"ownerGuid,omitempty"`
+	OwnerTabNumber string `json:"ownerTabNumber,omitempty"`
+}
+
 //--------------------------------------------
-// Шаблон дней недели для организации поиска ДР:
-type NextWeekStruct struct {
-	Monday    string
-	Tuesday   string
-	Wednesday string
-	Thursday  string
-	Friday    string
-	Saturday  string
-	Sunday    string
+// дайджесты отдела кадров (годовщины работы, принятые и уволенные): сотрудник с подразделением и датой состояния
+type StaffDigestEmployee struct {
+	UserGUID         string    `json:"userGuid"`
+	UserName         string    `json:"userName"`
+	TabNumber        string    `json:"tabNumber"`
+	DepartamentGUID  string    `json:"departamentGuid"`
+	DepartamentDescr string    `json:"departamentDescr"`
+	PositionDescr    string    `json:"positionDescr"`
+	StateDate        CastDate  `json:"stateDate"`      // дата приёма (в годовщинах - employee_hire_date) или увольнения
+	Date             *CastDate `json:"date,omitempty"` // годовщина: когда отмечается в периоде
+	Years            int       `json:"years,omitempty"`
+}
+
+type WorkAnniversaries struct {
+	From      string                `json:"from"`
+	To        string                `json:"to"`
+	Employees []StaffDigestEmployee `json:"employees"`
+}
+
+type StaffChanges struct {
+	From  string                `json:"from"`
+	To    string                `json:"to"`
+	Hired []StaffDigestEmployee `json:"hired"`
+	Fired []StaffDigestEmployee `json:"fired"`
+}
+
+// ссылка на календарь ДР observer-а (.ics): кто знает токен, видит календарь без авторизации
+type BdCalendarToken struct {
+	ObserverGUID string     `json:"observerGuid"`
+	Token        string     `json:"token"`
+	URL          string     `json:"url"` // для подписки из Outlook
+	CreatedAt    *time.Time `json:"createdAt,omitempty"`
+}
+
+// observer (оповещаемый) и именинники, о ДР которых его оповещаем
+type BdObserver struct {
+	ObserverGUID string
+	ObserverName string
+	Email        string
+	Owners       []User
 }
 
 // Departaments types
@@ -85,4 +409,57 @@ type Departament struct {
 	DepartamentIdZUP       string   `json:"departamentId"`
 	DepartamentParentIdZUP string   `json:"departamentParentId"`
 	DepartamentNotUsedFrom CastDate `json:"dateClose"`
+	// руководитель подразделения (guid сотрудника) - из 1С:ЗУП или назначенный через api
+	DepartamentHeadGUID        string `json:"departamentHeadGuid,omitempty"`
+	DepartamentHeadSetManually bool   `json:"-"`
+}
+
+// узел дерева подразделений
+type DepartamentNode struct {
+	Departament
+	Children []*DepartamentNode `json:"children"`
+}
+
+type DepartamentsTree struct {
+	Departaments []*DepartamentNode `json:"departaments"`
+}
+
+// карточка подразделения: само подразделение, цепочка родителей (от корня) и дерево потомков
+type DepartamentCard struct {
+	Departament Departament        `json:"departament"`
+	Ancestors   []Departament      `json:"ancestors"`
+	Descendants []*DepartamentNode `json:"descendants"`
+}
+
+// численность подразделения:
+// Headcount - работающие сотрудники непосредственно в подразделении,
+// TotalHeadcount - вместе со всеми подчиненными подразделениями
+type DepartamentHeadcount struct {
+	Departament
+	Headcount      int                     `json:"headcount"`
+	TotalHeadcount int                     `json:"totalHeadcount"`
+	Children       []*DepartamentHeadcount `json:"children"`
+}
+
+// результат сверки иерархии подразделений после загрузки из 1С:ЗУП
+type DepartamentsReconcileResult struct {
+	ParentsFixed int64           `json:"parentsFixed"` // сколько строк исправлено по departament_parent_guid
+	Orphans      []Departament   `json:"orphans"`      // родитель (zup_parent_id) не найден
+	Cycles       [][]Departament `json:"cycles"`       // зацикленные цепочки родителей
+}
+
+// цепочка руководителей сотрудника (для согласований): от руководителя его подразделения вверх по оргструктуре
+type ManagerChain struct {
+	EmployeeGUID string             `json:"employeeGuid"`
+	Managers     []ManagerChainLink `json:"managers"`
+}
+
+type ManagerChainLink struct {
+	Departament Departament `json:"departament"` // подразделение, которым руководит Manager
+	Manager     User        `json:"manager"`     // у Manager-а в Employees - только сотрудник-руководитель
+}
+
+// тело запроса на назначение руководителя подразделения
+type DepartamentHeadStruct struct {
+	EmployeeGUID string `json:"employeeGuid"`
 }
@@ -0,0 +1,405 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: mdata/v1/mdata.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// MasterDataClient is the client API for MasterData service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type MasterDataClient interface {
+	GetUser(ctx context.Context, in *GetUserRequest, opts ...grpc.CallOption) (*User, error)
+	GetUserByEmployee(ctx context.Context, in *GetUserByEmployeeRequest, opts ...grpc.CallOption) (*User, error)
+	// массовые выборки - потоком, по одному user-у / подразделению
+	ListUsers(ctx context.Context, in *ListUsersRequest, opts ...grpc.CallOption) (MasterData_ListUsersClient, error)
+	SearchUsers(ctx context.Context, in *SearchUsersRequest, opts ...grpc.CallOption) (*SearchUsersResponse, error)
+	GetDepartament(ctx context.Context, in *GetDepartamentRequest, opts ...grpc.CallOption) (*Departament, error)
+	ListDepartaments(ctx context.Context, in *ListDepartamentsRequest, opts ...grpc.CallOption) (MasterData_ListDepartamentsClient, error)
+	ListDepartamentEmployees(ctx context.Context, in *ListDepartamentEmployeesRequest, opts ...grpc.CallOption) (MasterData_ListDepartamentEmployeesClient, error)
+}
+
+type masterDataClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMasterDataClient(cc grpc.ClientConnInterface) MasterDataClient {
+	return &masterDataClient{cc}
+}
+
+func (c *masterDataClient) GetUser(ctx context.Context, in *GetUserRequest, opts ...grpc.CallOption) (*User, error) {
+	out := new(User)
+	err := c.cc.Invoke(ctx, "/mdata.v1.MasterData/GetUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *masterDataClient) GetUserByEmployee(ctx context.Context, in *GetUserByEmployeeRequest, opts ...grpc.CallOption) (*User, error) {
+	out := new(User)
+	err := c.cc.Invoke(ctx, "/mdata.v1.MasterData/GetUserByEmployee", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *masterDataClient) ListUsers(ctx context.Context, in *ListUsersRequest, opts ...grpc.CallOption) (MasterData_ListUsersClient, error) {
+	stream, err := c.cc.NewStream(ctx, &MasterData_ServiceDesc.Streams[0], "/mdata.v1.MasterData/ListUsers", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &masterDataListUsersClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type MasterData_ListUsersClient interface {
+	Recv() (*User, error)
+	grpc.ClientStream
+}
+
+type masterDataListUsersClient struct {
+	grpc.ClientStream
+}
+
+func (x *masterDataListUsersClient) Recv() (*User, error) {
+	m := new(User)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *masterDataClient) SearchUsers(ctx context.Context, in *SearchUsersRequest, opts ...grpc.CallOption) (*SearchUsersResponse, error) {
+	out := new(SearchUsersResponse)
+	err := c.cc.Invoke(ctx, "/mdata.v1.MasterData/SearchUsers", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *masterDataClient) GetDepartament(ctx context.Context, in *GetDepartamentRequest, opts ...grpc.CallOption) (*Departament, error) {
+	out := new(Departament)
+	err := c.cc.Invoke(ctx, "/mdata.v1.MasterData/GetDepartament", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *masterDataClient) ListDepartaments(ctx context.Context, in *ListDepartamentsRequest, opts ...grpc.CallOption) (MasterData_ListDepartamentsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &MasterData_ServiceDesc.Streams[1], "/mdata.v1.MasterData/ListDepartaments", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &masterDataListDepartamentsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type MasterData_ListDepartamentsClient interface {
+	Recv() (*Departament, error)
+	grpc.ClientStream
+}
+
+type masterDataListDepartamentsClient struct {
+	grpc.ClientStream
+}
+
+func (x *masterDataListDepartamentsClient) Recv() (*Departament, error) {
+	m := new(Departament)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *masterDataClient) ListDepartamentEmployees(ctx context.Context, in *ListDepartamentEmployeesRequest, opts ...grpc.CallOption) (MasterData_ListDepartamentEmployeesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &MasterData_ServiceDesc.Streams[2], "/mdata.v1.MasterData/ListDepartamentEmployees", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &masterDataListDepartamentEmployeesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type MasterData_ListDepartamentEmployeesClient interface {
+	Recv() (*User, error)
+	grpc.ClientStream
+}
+
+type masterDataListDepartamentEmployeesClient struct {
+	grpc.ClientStream
+}
+
+func (x *masterDataListDepartamentEmployeesClient) Recv() (*User, error) {
+	m := new(User)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// MasterDataServer is the server API for MasterData service.
+// All implementations must embed UnimplementedMasterDataServer
+// for forward compatibility
+type MasterDataServer interface {
+	GetUser(context.Context, *GetUserRequest) (*User, error)
+	GetUserByEmployee(context.Context, *GetUserByEmployeeRequest) (*User, error)
+	// массовые выборки - потоком, по одному user-у / подразделению
+	ListUsers(*ListUsersRequest, MasterData_ListUsersServer) error
+	SearchUsers(context.Context, *SearchUsersRequest) (*SearchUsersResponse, error)
+	GetDepartament(context.Context, *GetDepartamentRequest) (*Departament, error)
+	ListDepartaments(*ListDepartamentsRequest, MasterData_ListDepartamentsServer) error
+	ListDepartamentEmployees(*ListDepartamentEmployeesRequest, MasterData_ListDepartamentEmployeesServer) error
+	mustEmbedUnimplementedMasterDataServer()
+}
+
+// UnimplementedMasterDataServer must be embedded to have forward compatible implementations.
+type UnimplementedMasterDataServer struct {
+}
+
+func (UnimplementedMasterDataServer) GetUser(context.Context, *GetUserRequest) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUser not implemented")
+}
+func (UnimplementedMasterDataServer) GetUserByEmployee(context.Context, *GetUserByEmployeeRequest) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUserByEmployee not implemented")
+}
+func (UnimplementedMasterDataServer) ListUsers(*ListUsersRequest, MasterData_ListUsersServer) error {
+	return status.Errorf(codes.Unimplemented, "method ListUsers not implemented")
+}
+func (UnimplementedMasterDataServer) SearchUsers(context.Context, *SearchUsersRequest) (*SearchUsersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SearchUsers not implemented")
+}
+func (UnimplementedMasterDataServer) GetDepartament(context.Context, *GetDepartamentRequest) (*Departament, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDepartament not implemented")
+}
+func (UnimplementedMasterDataServer) ListDepartaments(*ListDepartamentsRequest, MasterData_ListDepartamentsServer) error {
+	return status.Errorf(codes.Unimplemented, "method ListDepartaments not implemented")
+}
+func (UnimplementedMasterDataServer) ListDepartamentEmployees(*ListDepartamentEmployeesRequest, MasterData_ListDepartamentEmployeesServer) error {
+	return status.Errorf(codes.Unimplemented, "method ListDepartamentEmployees not implemented")
+}
+func (UnimplementedMasterDataServer) mustEmbedUnimplementedMasterDataServer() {}
+
+// UnsafeMasterDataServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MasterDataServer will
+// result in compilation errors.
+type UnsafeMasterDataServer interface {
+	mustEmbedUnimplementedMasterDataServer()
+}
+
+func RegisterMasterDataServer(s grpc.ServiceRegistrar, srv MasterDataServer) {
+	s.RegisterService(&MasterData_ServiceDesc, srv)
+}
+
+func _MasterData_GetUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MasterDataServer).GetUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/mdata.v1.MasterData/GetUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MasterDataServer).GetUser(ctx, req.(*GetUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MasterData_GetUserByEmployee_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetUserByEmployeeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MasterDataServer).GetUserByEmployee(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/mdata.v1.MasterData/GetUserByEmployee",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MasterDataServer).GetUserByEmployee(ctx, req.(*GetUserByEmployeeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MasterData_ListUsers_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListUsersRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MasterDataServer).ListUsers(m, &masterDataListUsersServer{stream})
+}
+
+type MasterData_ListUsersServer interface {
+	Send(*User) error
+	grpc.ServerStream
+}
+
+type masterDataListUsersServer struct {
+	grpc.ServerStream
+}
+
+func (x *masterDataListUsersServer) Send(m *User) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _MasterData_SearchUsers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchUsersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MasterDataServer).SearchUsers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/mdata.v1.MasterData/SearchUsers",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MasterDataServer).SearchUsers(ctx, req.(*SearchUsersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MasterData_GetDepartament_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetDepartamentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MasterDataServer).GetDepartament(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/mdata.v1.MasterData/GetDepartament",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MasterDataServer).GetDepartament(ctx, req.(*GetDepartamentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MasterData_ListDepartaments_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListDepartamentsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MasterDataServer).ListDepartaments(m, &masterDataListDepartamentsServer{stream})
+}
+
+type MasterData_ListDepartamentsServer interface {
+	Send(*Departament) error
+	grpc.ServerStream
+}
+
+type masterDataListDepartamentsServer struct {
+	grpc.ServerStream
+}
+
+func (x *masterDataListDepartamentsServer) Send(m *Departament) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _MasterData_ListDepartamentEmployees_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListDepartamentEmployeesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MasterDataServer).ListDepartamentEmployees(m, &masterDataListDepartamentEmployeesServer{stream})
+}
+
+type MasterData_ListDepartamentEmployeesServer interface {
+	Send(*User) error
+	grpc.ServerStream
+}
+
+type masterDataListDepartamentEmployeesServer struct {
+	grpc.ServerStream
+}
+
+func (x *masterDataListDepartamentEmployeesServer) Send(m *User) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// MasterData_ServiceDesc is the grpc.ServiceDesc for MasterData service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var MasterData_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "mdata.v1.MasterData",
+	HandlerType: (*MasterDataServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetUser",
+			Handler:    _MasterData_GetUser_Handler,
+		},
+		{
+			MethodName: "GetUserByEmployee",
+			Handler:    _MasterData_GetUserByEmployee_Handler,
+		},
+		{
+			MethodName: "SearchUsers",
+			Handler:    _MasterData_SearchUsers_Handler,
+		},
+		{
+			MethodName: "GetDepartament",
+			Handler:    _MasterData_GetDepartament_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ListUsers",
+			Handler:       _MasterData_ListUsers_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ListDepartaments",
+			Handler:       _MasterData_ListDepartaments_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ListDepartamentEmployees",
+			Handler:       _MasterData_ListDepartamentEmployees_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "mdata/v1/mdata.proto",
+}
@@ -0,0 +1,293 @@
+package grpcapi
+
+// gRPC api Master Data (описание - api/proto/mdata/v1/mdata.proto).
+// Отдаёт те же данные, что и rest: user-ы (физ.лица) с сотрудниками и подразделения.
+// Массовые выборки (ListUsers, ListDepartaments, ListDepartamentEmployees) - потоком, по одной записи в сообщении.
+
+import (
+	"context"
+	"strings"
+
+	dom "mdata/internal/domain"
+	"mdata/internal/grpcapi/pb"
+	"mdata/internal/repository"
+	log "mdata/pkg/logging"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	listUsersChunk     = 500 // сколько user-ов выбираем из БД за раз при отдаче потоком
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// методы репозитория, которые использует api (*repository.PostgreInstance; в тестах - заглушка)
+type repo interface {
+	GetCastomUserListAllAttributes(userGUIDSlice []string) ([]dom.User, error)
+	GetUserByEmployeeGUIDAllAttributes(emplGUID string) (dom.User, error)
+	GetUsersByFilter(f dom.EmployeesFilter) ([]dom.User, int, error)
+	SearchActualUsers(s dom.EmployeesSearch) ([]dom.UserSearchResult, error)
+	SelectDepByGUID(DepGUID string) (*dom.Departament, error)
+	GetAllDepartaments() ([]dom.Departament, error)
+	GetActualDepartaments() ([]dom.Departament, error)
+	GetActualUsersByDepartamentAllAttributes(depGUID string, recursive bool) ([]dom.User, error)
+}
+
+// Server -.
+type Server struct {
+	pb.UnimplementedMasterDataServer
+	ins repo
+}
+
+// NewServer -.
+func NewServer(ins *repository.PostgreInstance) *Server {
+	return &Server{ins: ins}
+}
+
+// Register - зарегистрировать сервис на grpc-сервере
+func (s *Server) Register(grpcServer *grpc.Server) {
+	pb.RegisterMasterDataServer(grpcServer, s)
+}
+
+//***************************************************************************************
+// user-ы
+
+func (s *Server) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.User, error) {
+	guid := strings.TrimSpace(req.GetGuid())
+	if guid == "" {
+		return nil, status.Error(codes.InvalidArgument, "guid is required")
+	}
+	usersSlice, err := s.ins.GetCastomUserListAllAttributes([]string{guid})
+	if err != nil {
+		return nil, statusFromError("GetUser", err)
+	}
+	if len(usersSlice) == 0 {
+		return nil, status.Errorf(codes.NotFound, "user %s not found", guid)
+	}
+	return userToPb(&usersSlice[0]), nil
+}
+
+func (s *Server) GetUserByEmployee(ctx context.Context, req *pb.GetUserByEmployeeRequest) (*pb.User, error) {
+	emplGUID := strings.TrimSpace(req.GetEmployeeGuid())
+	if emplGUID == "" {
+		return nil, status.Error(codes.InvalidArgument, "employee_guid is required")
+	}
+	user, err := s.ins.GetUserByEmployeeGUIDAllAttributes(emplGUID)
+	if err != nil {
+		return nil, statusFromError("GetUserByEmployee", err)
+	}
+	return userToPb(&user), nil
+}
+
+// ListUsers - user-ы по фильтру потоком. Без limit отдаём всех подходящих, выбирая из БД порциями по курсору
+func (s *Server) ListUsers(req *pb.ListUsersRequest, stream pb.MasterData_ListUsersServer) error {
+	if req.GetBirthdayMonth() < 0 || req.GetBirthdayMonth() > 12 {
+		return status.Error(codes.InvalidArgument, "wrong birthday_month: 1-12 expected")
+	}
+	if req.GetLimit() < 0 || req.GetOffset() < 0 {
+		return status.Error(codes.InvalidArgument, "wrong limit or offset: positive number expected")
+	}
+
+	filter := dom.EmployeesFilter{
+		TabNo:           strings.TrimSpace(req.GetTabNo()),
+		Name:            strings.TrimSpace(req.GetName()),
+		DepartamentGUID: strings.TrimSpace(req.GetDepartamentGuid()),
+		Position:        strings.TrimSpace(req.GetPosition()),
+		Employment:      strings.TrimSpace(req.GetEmployment()),
+		State:           strings.TrimSpace(req.GetState()),
+		BirthdayMonth:   int(req.GetBirthdayMonth()),
+		Offset:          int(req.GetOffset()),
+		Cursor:          strings.TrimSpace(req.GetCursor()),
+	}
+	if req.HasEmail != nil {
+		hasEmail := req.GetHasEmail()
+		filter.HasEmail = &hasEmail
+	}
+
+	// сколько ещё отдать, 0 - всех
+	remain := int(req.GetLimit())
+	for {
+		filter.Limit = listUsersChunk
+		if remain > 0 && remain < listUsersChunk {
+			filter.Limit = remain
+		}
+		usersSlice, _, err := s.ins.GetUsersByFilter(filter)
+		if err != nil {
+			return statusFromError("ListUsers", err)
+		}
+		for k := range usersSlice {
+			if err = stream.Send(userToPb(&usersSlice[k])); err != nil {
+				return err
+			}
+		}
+		if remain > 0 {
+			remain -= len(usersSlice)
+			if remain <= 0 {
+				return nil
+			}
+		}
+		if len(usersSlice) < filter.Limit {
+			return nil
+		}
+		// следующая порция - после последнего отданного user-а
+		filter.Cursor = usersSlice[len(usersSlice)-1].UserGUID
+		filter.Offset = 0
+		if err = stream.Context().Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+	}
+}
+
+func (s *Server) SearchUsers(ctx context.Context, req *pb.SearchUsersRequest) (*pb.SearchUsersResponse, error) {
+	search := dom.EmployeesSearch{
+		TabNo:       strings.TrimSpace(req.GetTabNo()),
+		Name:        strings.TrimSpace(req.GetName()),
+		Email:       strings.TrimSpace(req.GetEmail()),
+		Departament: strings.TrimSpace(req.GetDepartament()),
+		Position:    strings.TrimSpace(req.GetPosition()),
+		Limit:       int(req.GetLimit()),
+	}
+	if search.TabNo == "" && search.Name == "" && search.Email == "" && search.Departament == "" && search.Position == "" {
+		return nil, status.Error(codes.InvalidArgument, "at least one of tab_no, name, email, departament, position is required")
+	}
+	switch {
+	case search.Limit < 0:
+		return nil, status.Error(codes.InvalidArgument, "wrong limit: positive number expected")
+	case search.Limit == 0:
+		search.Limit = defaultSearchLimit
+	case search.Limit > maxSearchLimit:
+		search.Limit = maxSearchLimit
+	}
+
+	foundUsers, err := s.ins.SearchActualUsers(search)
+	if err != nil {
+		return nil, statusFromError("SearchUsers", err)
+	}
+	resp := &pb.SearchUsersResponse{Users: make([]*pb.UserSearchResult, 0, len(foundUsers))}
+	for k := range foundUsers {
+		resp.Users = append(resp.Users, &pb.UserSearchResult{User: userToPb(&foundUsers[k].User), Rank: foundUsers[k].Rank})
+	}
+	return resp, nil
+}
+
+//***************************************************************************************
+// подразделения
+
+func (s *Server) GetDepartament(ctx context.Context, req *pb.GetDepartamentRequest) (*pb.Departament, error) {
+	guid := strings.TrimSpace(req.GetGuid())
+	if guid == "" {
+		return nil, status.Error(codes.InvalidArgument, "guid is required")
+	}
+	dep, err := s.ins.SelectDepByGUID(guid)
+	if err != nil {
+		return nil, statusFromError("GetDepartament", err)
+	}
+	return departamentToPb(dep), nil
+}
+
+func (s *Server) ListDepartaments(req *pb.ListDepartamentsRequest, stream pb.MasterData_ListDepartamentsServer) error {
+	var depsSlice []dom.Departament
+	var err error
+	if req.GetIncludeClosed() {
+		depsSlice, err = s.ins.GetAllDepartaments()
+	} else {
+		depsSlice, err = s.ins.GetActualDepartaments()
+	}
+	if err != nil {
+		return statusFromError("ListDepartaments", err)
+	}
+	for k := range depsSlice {
+		if err = stream.Send(departamentToPb(&depsSlice[k])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) ListDepartamentEmployees(req *pb.ListDepartamentEmployeesRequest, stream pb.MasterData_ListDepartamentEmployeesServer) error {
+	depGUID := strings.TrimSpace(req.GetDepartamentGuid())
+	if depGUID == "" {
+		return status.Error(codes.InvalidArgument, "departament_guid is required")
+	}
+	if _, err := s.ins.SelectDepByGUID(depGUID); err != nil {
+		return statusFromError("ListDepartamentEmployees", err)
+	}
+	usersSlice, err := s.ins.GetActualUsersByDepartamentAllAttributes(depGUID, req.GetRecursive())
+	if err != nil {
+		return statusFromError("ListDepartamentEmployees", err)
+	}
+	for k := range usersSlice {
+		if err = stream.Send(userToPb(&usersSlice[k])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//***************************************************************************************
+
+// ошибка репозитория -> статус grpc: "no rows" - NotFound, неверный guid - InvalidArgument, остальное - Internal (в лог)
+func statusFromError(method string, err error) error {
+	switch {
+	case strings.Contains(err.Error(), "no rows"):
+		return status.Error(codes.NotFound, "not found")
+	case strings.Contains(err.Error(), "invalid input syntax"):
+		return status.Error(codes.InvalidArgument, "wrong guid")
+	}
+	log.Error("grpcapi.%s error: %v", method, err)
+	return status.Error(codes.Internal, "something bad happened")
+}
+
+func castDateToPb(d dom.CastDate) string {
+	if d.IsZero() {
+		return ""
+	}
+	return d.DateToString()
+}
+
+func userToPb(u *dom.User) *pb.User {
+	user := &pb.User{
+		Guid:      u.UserGUID,
+		Name:      u.UserName,
+		Id:        u.UserID,
+		Birthday:  castDateToPb(u.UserBirthday),
+		Email:     u.UserEmail,
+		Employees: make([]*pb.Employee, 0, len(u.Employees)),
+	}
+	for k := range u.Employees {
+		user.Employees = append(user.Employees, employeeToPb(&u.Employees[k]))
+	}
+	return user
+}
+
+func employeeToPb(e *dom.Employee) *pb.Employee {
+	return &pb.Employee{
+		Guid:        e.EmployeeGUID,
+		Id:          e.EmployeeId,
+		TabNumber:   e.EmpTabNumber,
+		Employment:  e.Employment,
+		Adress:      e.EmployeeAdress,
+		Departament: departamentToPb(&e.EmployeeDepartament),
+		Position:    &pb.Position{Guid: e.EmployeePosition.PositionGUID, Descr: e.EmployeePosition.PositionDescr},
+		PositionShr: &pb.PositionShr{Guid: e.EmployeePshr.PshrGUID, Id: e.EmployeePshr.PshrId, Descr: e.EmployeePshr.PshrDescr},
+		CurrentState: &pb.EmployeeState{
+			Name:     e.EmployeeCurrentState.StateName,
+			DateFrom: castDateToPb(e.EmployeeCurrentState.DateFrom),
+		},
+	}
+}
+
+func departamentToPb(d *dom.Departament) *pb.Departament {
+	return &pb.Departament{
+		Guid:        d.DepartamentGUID,
+		Descr:       d.DepartamentDescr,
+		ParentGuid:  d.DepartamentParentGUID,
+		ZupId:       d.DepartamentIdZUP,
+		ZupParentId: d.DepartamentParentIdZUP,
+		DateClose:   castDateToPb(d.DepartamentNotUsedFrom),
+		HeadGuid:    d.DepartamentHeadGUID,
+	}
+}
@@ -0,0 +1,196 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"testing"
+
+	dom "mdata/internal/domain"
+	"mdata/internal/grpcapi/pb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// заглушка репозитория: user-ы по возрастанию guid, выборка по курсору/смещению/лимиту как в GetUsersByFilter
+type fakeRepo struct {
+	repo // остальные методы в тестах не вызываются
+
+	users   []dom.User
+	err     error
+	filters []dom.EmployeesFilter // с какими фильтрами вызывали GetUsersByFilter
+	lasts   []string              // guid последнего user-а в каждом ответе
+}
+
+func newFakeRepo(count int) *fakeRepo {
+	f := &fakeRepo{}
+	for k := 1; k <= count; k++ {
+		f.users = append(f.users, dom.User{UserGUID: fmt.Sprintf("u%05d", k)})
+	}
+	return f
+}
+
+func (f *fakeRepo) GetUsersByFilter(filter dom.EmployeesFilter) ([]dom.User, int, error) {
+	f.filters = append(f.filters, filter)
+	if f.err != nil {
+		return nil, 0, f.err
+	}
+	from := 0
+	if filter.Cursor != "" {
+		from = sort.Search(len(f.users), func(k int) bool { return f.users[k].UserGUID > filter.Cursor })
+	}
+	from += filter.Offset
+	if from > len(f.users) {
+		from = len(f.users)
+	}
+	to := len(f.users)
+	if filter.Limit > 0 && from+filter.Limit < to {
+		to = from + filter.Limit
+	}
+	if to > from {
+		f.lasts = append(f.lasts, f.users[to-1].UserGUID)
+	} else {
+		f.lasts = append(f.lasts, "")
+	}
+	return f.users[from:to], len(f.users), nil
+}
+
+// клиент к серверу api через bufconn (без сети)
+func newTestClient(t *testing.T, r repo) pb.MasterDataClient {
+	listener := bufconn.Listen(1 << 20)
+	grpcServer := grpc.NewServer()
+	(&Server{ins: r}).Register(grpcServer)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewMasterDataClient(conn)
+}
+
+// guid-ы всех user-ов потока и код завершения
+func receiveUsers(t *testing.T, client pb.MasterDataClient, req *pb.ListUsersRequest) ([]string, codes.Code) {
+	stream, err := client.ListUsers(context.Background(), req)
+	if err != nil {
+		t.Fatalf("ListUsers error: %v", err)
+	}
+	guids := make([]string, 0)
+	for {
+		user, err := stream.Recv()
+		if err == io.EOF {
+			return guids, codes.OK
+		}
+		if err != nil {
+			return guids, status.Code(err)
+		}
+		guids = append(guids, user.GetGuid())
+	}
+}
+
+func TestListUsersPaging(t *testing.T) {
+	const count = 1203 // две полные порции по listUsersChunk и неполная
+
+	cases := []struct {
+		name       string
+		req        *pb.ListUsersRequest
+		wantFirst  string
+		wantLast   string
+		wantCount  int
+		wantLimits []int // Limit в запросах к БД
+	}{
+		{"все, порциями", &pb.ListUsersRequest{}, "u00001", "u01203", count, []int{500, 500, 500}},
+		{"limit меньше порции", &pb.ListUsersRequest{Limit: 10}, "u00001", "u00010", 10, []int{10}},
+		{"limit равен порции", &pb.ListUsersRequest{Limit: 500}, "u00001", "u00500", 500, []int{500}},
+		{"limit больше порции - остаток во втором запросе", &pb.ListUsersRequest{Limit: 700}, "u00001", "u00700", 700, []int{500, 200}},
+		{"limit больше, чем есть", &pb.ListUsersRequest{Limit: 2000}, "u00001", "u01203", count, []int{500, 500, 500}},
+		{"offset только в первом запросе", &pb.ListUsersRequest{Offset: 5, Limit: 600}, "u00006", "u00605", 600, []int{500, 100}},
+		{"с курсора клиента", &pb.ListUsersRequest{Cursor: "u01000"}, "u01001", "u01203", 203, []int{500}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fake := newFakeRepo(count)
+			guids, code := receiveUsers(t, newTestClient(t, fake), c.req)
+			if code != codes.OK {
+				t.Fatalf("code = %v", code)
+			}
+			if len(guids) != c.wantCount || guids[0] != c.wantFirst || guids[len(guids)-1] != c.wantLast {
+				t.Fatalf("got %d users %s..%s, want %d users %s..%s",
+					len(guids), guids[0], guids[len(guids)-1], c.wantCount, c.wantFirst, c.wantLast)
+			}
+			for k := 1; k < len(guids); k++ {
+				if guids[k] <= guids[k-1] {
+					t.Fatalf("user %s after %s", guids[k], guids[k-1])
+				}
+			}
+
+			limits := make([]int, 0, len(fake.filters))
+			for k, filter := range fake.filters {
+				limits = append(limits, filter.Limit)
+				// следующая порция - после последнего отданного, без смещения
+				if k > 0 && (filter.Offset != 0 || filter.Cursor != fake.lasts[k-1]) {
+					t.Errorf("request %d: offset %d, cursor %q; want 0, %q", k, filter.Offset, filter.Cursor, fake.lasts[k-1])
+				}
+			}
+			if fmt.Sprint(limits) != fmt.Sprint(c.wantLimits) {
+				t.Errorf("limits = %v, want %v", limits, c.wantLimits)
+			}
+		})
+	}
+}
+
+func TestListUsersErrors(t *testing.T) {
+	cases := []struct {
+		name     string
+		req      *pb.ListUsersRequest
+		repoErr  error
+		wantCode codes.Code
+	}{
+		{"месяц рождения", &pb.ListUsersRequest{BirthdayMonth: 13}, nil, codes.InvalidArgument},
+		{"отрицательный limit", &pb.ListUsersRequest{Limit: -1}, nil, codes.InvalidArgument},
+		{"отрицательный offset", &pb.ListUsersRequest{Offset: -1}, nil, codes.InvalidArgument},
+		{"ошибка БД", &pb.ListUsersRequest{}, errors.New("repository.GetUsersByFilter error: conn closed"), codes.Internal},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fake := newFakeRepo(3)
+			fake.err = c.repoErr
+			if _, code := receiveUsers(t, newTestClient(t, fake), c.req); code != c.wantCode {
+				t.Errorf("code = %v, want %v", code, c.wantCode)
+			}
+		})
+	}
+}
+
+func TestStatusFromError(t *testing.T) {
+	cases := []struct {
+		name    string
+		err     error
+		want    codes.Code
+		wantMsg string
+	}{
+		{"no rows", errors.New("repository.SelectDepByGUID error: no rows in result set"), codes.NotFound, "not found"},
+		{"неверный guid", errors.New(`repository.SelectDepByGUID error: ERROR: invalid input syntax for type uuid: "x"`),
+			codes.InvalidArgument, "wrong guid"},
+		{"остальное - без подробностей", errors.New("repository.SelectDepByGUID error: conn closed"), codes.Internal, "something bad happened"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			st := status.Convert(statusFromError("Test", c.err))
+			if st.Code() != c.want || st.Message() != c.wantMsg {
+				t.Errorf("status = %v %q, want %v %q", st.Code(), st.Message(), c.want, c.wantMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"mdata/internal/domain"
+	"mdata/internal/repository"
+	"mdata/pkg/ical"
+	log "mdata/pkg/logging"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+//********************
+// Календарь ДР observer-а (.ics) для подписки из Outlook: именинники те же, что в рассылке (bd_notifications и
+// подписки на подразделения), каждый - событие на весь день, повторяющееся ежегодно. Доступ - по токену в ссылке
+
+const bdCalendarPath = "/bd-calendar/"
+
+var bdCalendarTokenRegexp = regexp.MustCompile(`^[0-9a-f]{16,64}$`)
+
+// год первого повторения: високосный, чтобы 29 февраля было допустимой датой; год рождения в календарь не попадает
+const bdCalendarStartYear = 2000
+
+//------------------------------------------------------------
+// GET /bd-calendar/<token>.ics - календарь ДР observer-а (text/calendar)
+func RestBdCalendar(ins *repository.PostgreInstance) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAPIMethod(w, r, http.MethodGet) {
+			return
+		}
+		token := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, bdCalendarPath), ".ics")
+		if !bdCalendarTokenRegexp.MatchString(token) {
+			writeAPIError(w, http.StatusNotFound, apiErrNotFound, "calendar not found")
+			return
+		}
+		observer, err := ins.GetBdCalendarByToken(token)
+		if err != nil {
+			writeAPIErrorFrom(w, "RestBdCalendar", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		w.Header().Set("Content-Disposition", `inline; filename="birthdays.ics"`)
+		w.Header().Set("Cache-Control", "no-cache")
+		err = ical.Write(w, buildBdCalendar(observer, repository.BdFeb29Policy()), time.Now())
+		if err != nil {
+			log.Error("RestBdCalendar error: %v", err)
+		}
+	}
+}
+
+// календарь по именинникам observer-а; без даты рождения - пропускаем
+func buildBdCalendar(observer domain.BdObserver, feb29Policy string) ical.Calendar {
+	cal := ical.Calendar{
+		ProdID: "-//mdata//birthdays//RU",
+		Name:   "Дни рождения коллег",
+		Events: make([]ical.Event, 0, len(observer.Owners)),
+	}
+	for _, owner := range observer.Owners {
+		birthday := owner.UserBirthday.Time
+		if birthday.Year() <= 1 {
+			continue
+		}
+		cal.Events = append(cal.Events, ical.Event{
+			UID:     owner.UserGUID + "@bd.mdata",
+			Summary: "День рождения: " + owner.UserName,
+			Date:    time.Date(bdCalendarStartYear, birthday.Month(), birthday.Day(), 0, 0, 0, 0, time.UTC),
+			RRule:   bdCalendarRRule(birthday, feb29Policy),
+		})
+	}
+	return cal
+}
+
+// ежегодное повторение; родившимся 29 февраля в невисокосный год - по той же политике, что и в рассылке
+func bdCalendarRRule(birthday time.Time, feb29Policy string) string {
+	if birthday.Month() != time.February || birthday.Day() != 29 {
+		return "FREQ=YEARLY"
+	}
+	switch feb29Policy {
+	case repository.BdFeb29OnFeb28:
+		return "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=-1" // последний день февраля
+	case repository.BdFeb29OnMar1:
+		return "FREQ=YEARLY;BYYEARDAY=60" // 29 февраля в високосный год, 1 марта - в остальные
+	}
+	return "FREQ=YEARLY" // несуществующие даты пропускаются (RFC 5545) - только в високосные годы
+}
+
+// ссылка на календарь: baseURL из конфига, иначе - адрес, по которому пришёл запрос
+func bdCalendarURL(r *http.Request, baseURL, token string) string {
+	if token == "" {
+		return ""
+	}
+	baseURL = strings.TrimRight(strings.TrimSpace(baseURL), "/")
+	if baseURL == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+			scheme = strings.TrimSpace(strings.Split(proto, ",")[0])
+		}
+		baseURL = scheme + "://" + r.Host
+	}
+	return baseURL + bdCalendarPath + token + ".ics"
+}
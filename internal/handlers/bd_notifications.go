@@ -7,220 +7,217 @@ import (
 	"mdata/internal/repository"
 	"mdata/internal/utils"
 	log "mdata/pkg/logging"
+	"sort"
 	"strconv"
 	"sync"
 	"time"
 )
 
 //********************
+// заголовки периодов в письме (для оповещений за N дней - см. bdLeadTitle)
 const typeTomorrow string = "Завтра день рождения у: "
-const typeIn3Days string = "Через три дня день рождения у: "
+const typeDayAfterTomorrow string = "Послезавтра день рождения у: "
 const typeNextWeek string = "На следующей неделе день рождения у: "
 const typeNextMonth string = "В следующем месяце день рождения у: "
 
+// общее правило, если его нет в bd_rules (как рассылали до правил)
+var defaultBdRule = domain.BdRule{LeadDays: []int{1, 3}, WeeklyDay: int(time.Friday), MonthlyLeadDays: 4}
+
 //********************
-//  KEY - recipient - получатель рассылки, VALUE - slice map - (key: тип ("завтра", "след. месяц и т.д."), value: слайс bd_owners)
+//  KEY - recipient - получатель рассылки, VALUE - периоды ("завтра", "след. месяц" и т.д.) с именинниками по порядку
 type sendList struct {
-	mapRecipientPeriodsOwners map[string]map[string][]domain.User
-	mu                        sync.RWMutex
+	mapRecipientPeriods map[string][]domain.MailBirthdaysPeriod
+	recipients          []string // порядок рассылки
 }
 
-func newSendList(initMapRPO map[string]map[string][]domain.User) *sendList {
-	if initMapRPO != nil {
-		return &sendList{
-			mapRecipientPeriodsOwners: initMapRPO,
-		}
-	}
+func newSendList() *sendList {
 	return &sendList{
-		mapRecipientPeriodsOwners: make(map[string]map[string][]domain.User),
+		mapRecipientPeriods: make(map[string][]domain.MailBirthdaysPeriod),
 	}
 }
 
-func (sl *sendList) GetValue(keyEmail string) map[string][]domain.User {
-	sl.mu.RLock()
-	defer sl.mu.RUnlock()
-	val, ok := sl.mapRecipientPeriodsOwners[keyEmail]
-	if ok {
-		return val
+func (sl *sendList) Add(keyEmail, title string, bdOwnersSlice []domain.User) {
+	periods, ok := sl.mapRecipientPeriods[keyEmail]
+	if !ok {
+		sl.recipients = append(sl.recipients, keyEmail)
 	}
-	return map[string][]domain.User{}
-
+	k := -1
+	for i := range periods {
+		if periods[i].Title == title {
+			k = i
+			break
+		}
+	}
+	if k < 0 {
+		periods = append(periods, domain.MailBirthdaysPeriod{Title: title})
+		k = len(periods) - 1
+	}
+	for _, userData := range bdOwnersSlice {
+		periods[k].Owners = append(periods[k].Owners, domain.MailBirthdayOwner{Name: userData.UserName, Birthday: userData.UserBirthday.Format("02-01-2006")})
+	}
+	sl.mapRecipientPeriods[keyEmail] = periods
 }
 
-func (sl *sendList) SetValue(keyEmail string, value map[string][]domain.User) {
-	sl.mu.Lock()
-	defer sl.mu.Unlock()
-	sl.mapRecipientPeriodsOwners[keyEmail] = value
+// период рассылки: именинники с ДР с from по to включительно
+type bdPeriod struct {
+	title    string
+	from, to time.Time
 }
 
 //********************
 
-// все рассылки делаем до наступления рабочего дня
+// все рассылки делаем до наступления рабочего дня. Что и когда рассылать observer-у - по его правилу (bd_rules) или общему
 func sendBdNotifications(ins *repository.PostgreInstance) {
-	// создаём общий список рассылки. В него будем набивать адресатов и именинников в разрезе периодов
-	commonSendList := newSendList(map[string]map[string][]domain.User{})
-	var wg sync.WaitGroup
-	// завтра
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		getBdTomorrow(ins, commonSendList)
-	}()
-
-	// через три дня (за три дня до...)
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		getBdInThreeDays(ins, commonSendList)
-	}()
-
-	// на следующей неделе (за три дня до...)
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		getBdOnNextWeek(ins, commonSendList)
-	}()
-
-	// в следующем месяце (за три дня до...)
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		getBdOnNextMonth(ins, commonSendList)
-	}()
-
-	wg.Wait()
-
-	admins, err := ins.GetUserEmailsByNotificationsTypes(1)
+	rulesSlice, err := ins.GetBdRules()
 	if err != nil {
-		log.Error("bd_notifications handlers.sendBdNotifications GetBccAdmin error: %v", err)
+		log.Error("bd_notifications handlers.sendBdNotifications GetBdRules error: %v", err)
+		return
 	}
-	bccAdmin := admins[0]
-	if bccAdmin == "" {
-		log.Error("bd_notifications handlers.sendBdNotifications GetBccAdmin error: no bccAdmin", err)
+	globalRule := defaultBdRule
+	hasGlobalRule := false
+	observerRules := make(map[string]domain.BdRule)
+	for _, rule := range rulesSlice {
+		if rule.ObserverGUID == "" {
+			globalRule, hasGlobalRule = rule, true
+		} else {
+			observerRules[rule.ObserverGUID] = rule
+		}
 	}
-
-	// цикл по мапе по адресатам
-	for keyEmail, mapPeriodOwners := range *&commonSendList.mapRecipientPeriodsOwners {
-		prepareSendLetterToSingleMail(bccAdmin, keyEmail, mapPeriodOwners)
+	if !hasGlobalRule {
+		log.Error("bd_notifications handlers.sendBdNotifications error: no global rule in bd_rules, default is used")
 	}
-}
-
-// Отправка писем:
-func SendEmail(bccAdmin, recipient, body string) error {
-	// адресаты
-	recipients := []string{recipient}
 
-	// тема
-	subject := "Birthdays notification"
-	// тело
-	// отправка
-	err := repository.SendMailToRecipient(recipients, bccAdmin, subject, body, "")
-	if err != nil {
-		return err
+	// выборка за период одна для всех правил
+	foundByPeriod := make(map[string]map[string]domain.BdObserver)
+	getObservers := func(p bdPeriod) map[string]domain.BdObserver {
+		key := p.from.Format("2006-01-02") + " " + p.to.Format("2006-01-02")
+		if found, ok := foundByPeriod[key]; ok {
+			return found
+		}
+		found, err := ins.GetBdObserversOwnersByDates(p.from, p.to)
+		if err != nil {
+			log.Error("bd_notifications handlers.sendBdNotifications %s GetBdObserversOwnersByDates error: %v", key, err)
+		}
+		foundByPeriod[key] = found
+		return found
 	}
 
-	return nil
-}
-
-func getBdTomorrow(ins *repository.PostgreInstance, csl *sendList) { // каждый день в 8:00
-	now := time.Now()
-	tomorrow := now.AddDate(0, 0, 1)
-	layout := "2006-01-02"
-	templTomorrow := tomorrow.Format(layout)[4:10]
-	_ = templTomorrow
-
-	// mapBdOO map[string][]domain.User - одному observer-у (key) сопоставлено много bd_owner-ов (value)
-	mapBdOO, err := ins.GetBdObserversOwnersByTempl(templTomorrow) // ins.GetBdOwnersOneDayDebug("-02-24") //
-	if err != nil {
-		log.Error("bd_notifications handlers.getBdTomorrow GetBdOwnersOneDay error: %v", err)
+	// создаём общий список рассылки. В него будем набивать адресатов и именинников в разрезе периодов
+	commonSendList := newSendList()
+	// общее правило - observer-ам без своего
+	for _, p := range bdRulePeriodsToday(globalRule) {
+		for observerGUID, observer := range getObservers(p) {
+			if _, ok := observerRules[observerGUID]; !ok {
+				commonSendList.Add(observer.Email, p.title, observer.Owners)
+			}
+		}
 	}
-
-	for keyEmail, bdOwnersSlice := range mapBdOO {
-		currentMapPeriodOwners := csl.GetValue(keyEmail)
-		currentMapPeriodOwners[typeTomorrow] = bdOwnersSlice
-		csl.SetValue(keyEmail, currentMapPeriodOwners)
+	for observerGUID, rule := range observerRules {
+		for _, p := range bdRulePeriodsToday(rule) {
+			if observer, ok := getObservers(p)[observerGUID]; ok {
+				commonSendList.Add(observer.Email, p.title, observer.Owners)
+			}
+		}
 	}
-}
 
-func getBdInThreeDays(ins *repository.PostgreInstance, csl *sendList) { // каждый день в 8:00
-	now := time.Now()
-	in3Days := now.AddDate(0, 0, 3)
-	layout := "2006-01-02"
-	templIn3Days := in3Days.Format(layout)[4:10]
+	bccAdmin := ins.GetBccAdmin()
 
-	// mapBdOO map[string][]domain.User - одному observer-у (key) сопоставлено много bd_owner-ов (value)
-	mapBdOO, err := ins.GetBdObserversOwnersByTempl(templIn3Days)
-	if err != nil {
-		log.Error("bd_notifications handlers.getBdInThreeDays GetBdObserversOwnersByTempl error: %v", err)
+	// цикл по адресатам
+	for _, keyEmail := range commonSendList.recipients {
+		prepareSendLetterToSingleMail(ins, bccAdmin, keyEmail, commonSendList.mapRecipientPeriods[keyEmail])
 	}
+}
 
-	for keyEmail, bdOwnersSlice := range mapBdOO {
-		currentMapPeriodOwners := csl.GetValue(keyEmail)
-		currentMapPeriodOwners[typeIn3Days] = bdOwnersSlice
-		csl.SetValue(keyEmail, currentMapPeriodOwners)
+// периоды правила на сегодня (по часовому поясу правила)
+func bdRulePeriodsToday(rule domain.BdRule) []bdPeriod {
+	loc, err := repository.BdRuleLocation(rule)
+	if err != nil {
+		log.Error("bd_notifications handlers.bdRulePeriodsToday observer %s error: %v", rule.ObserverGUID, err)
+		loc = time.Local
 	}
+	return bdRulePeriods(rule, utils.StartOfThisDay(time.Now().In(loc)))
 }
 
-func getBdOnNextWeek(ins *repository.PostgreInstance, csl *sendList) {
-	now := time.Now()
-	if now.Weekday() == time.Friday { // по пятницам в 8:00
-		nextWeek := utils.GetNextWeekTemplStruct(now)
-
-		// mapBdOO map[string][]domain.User - одному observer-у (key) сопоставлено много bd_owner-ов (value)
-		mapBdOO, err := ins.GetBdObserversOwnersnextWeek(nextWeek)
-		if err != nil {
-			log.Error("bd_notifications handlers.getBdOnNextWeek GetBdOwnersByTempl error: %v", err)
+// периоды правила на день today. При skipWeekends в сб и вс не рассылаем, а в пятницу - всё, что пришлось бы на пт, сб и вс
+func bdRulePeriods(rule domain.BdRule, today time.Time) []bdPeriod {
+	sendDays := []time.Time{today}
+	if rule.SkipWeekends {
+		switch today.Weekday() {
+		case time.Saturday, time.Sunday:
+			return nil
+		case time.Friday:
+			sendDays = append(sendDays, today.AddDate(0, 0, 1), today.AddDate(0, 0, 2))
 		}
+	}
 
-		for keyEmail, bdOwnersSlice := range mapBdOO {
-			currentMapPeriodOwners := csl.GetValue(keyEmail)
-			currentMapPeriodOwners[typeNextWeek] = bdOwnersSlice
-
-			csl.SetValue(keyEmail, currentMapPeriodOwners)
+	periods := make([]bdPeriod, 0, len(rule.LeadDays)+2)
+	// за N дней: дни рассылки идут подряд - один период. В пятницу периоды соседних N могут пересечься
+	// (за 1 и за 3 дня: сб - пн и пн - ср) - дни, которые уже попали в период меньшего N, не повторяем
+	leadDays := append([]int(nil), rule.LeadDays...)
+	sort.Ints(leadDays)
+	span := len(sendDays) - 1
+	coveredTo := -1 // последний день (от today), уже попавший в период
+	for _, days := range leadDays {
+		start, end := days, days+span
+		if start <= coveredTo {
+			start = coveredTo + 1
+		}
+		if start > end {
+			continue
 		}
+		from, to := today.AddDate(0, 0, start), today.AddDate(0, 0, end)
+		periods = append(periods, bdPeriod{title: bdLeadTitle(start, from, to), from: from, to: to})
+		coveredTo = end
 	}
-}
-
-func getBdOnNextMonth(ins *repository.PostgreInstance, csl *sendList) {
-	// TODO
-	now := time.Now()
-	firstOfNextMonth, _ := utils.NextMonth(now)
-	threeDaysBefore := firstOfNextMonth.AddDate(0, 0, -4) // за четыре дня до наступления след. месяца в 8:00
-
 	layout := "2006-01-02"
-	nowFormat := now.Format(layout)
-	threeDaysBeforeFormat := threeDaysBefore.Format(layout)
-	if nowFormat == threeDaysBeforeFormat {
-		templNextMonth := firstOfNextMonth.Format(layout)[4:8]
-		// mapBdOO map[string][]domain.User - одному observer-у (key) сопоставлено много bd_owner-ов (value)
-		mapBdOO, err := ins.GetBdObserversOwnersByTempl(templNextMonth)
-		if err != nil {
-			log.Error("bd_notifications handlers.getBdOnNextMonth GetBdOwnersByTempl error: %v", err)
+	for _, day := range sendDays {
+		// на следующую неделю - в день недели правила
+		if rule.WeeklyDay >= 0 && int(day.Weekday()) == rule.WeeklyDay {
+			from, to := utils.NextWeek(day)
+			periods = append(periods, bdPeriod{title: typeNextWeek, from: from, to: to})
 		}
-
-		for keyEmail, bdOwnersSlice := range mapBdOO {
-			currentMapPeriodOwners := csl.GetValue(keyEmail)
-			currentMapPeriodOwners[typeNextMonth] = bdOwnersSlice
-			csl.SetValue(keyEmail, currentMapPeriodOwners)
+		// на следующий месяц - за MonthlyLeadDays дней до его начала
+		if rule.MonthlyLeadDays > 0 {
+			from, to := utils.NextMonth(day)
+			if from.AddDate(0, 0, -rule.MonthlyLeadDays).Format(layout) == day.Format(layout) {
+				periods = append(periods, bdPeriod{title: typeNextMonth, from: from, to: to})
+			}
 		}
 	}
+	return periods
 }
 
-// prepare letters //подготовка письма
-func prepareSendLetterToSingleMail(bccAdmin, keyEmail string, mapPeriodOwners map[string][]domain.User) {
-	var body string
-	//fmt.Println("keyEmail ======= ", keyEmail)
-	orderSlice := []string{typeTomorrow, typeIn3Days, typeNextWeek, typeNextMonth}
-	for _, v := range orderSlice {
-		if bdOwnersSlice, ok := mapPeriodOwners[v]; ok {
-			body = body + "-------------------------- \n"
-			body = body + v + "\n"
-			for _, userData := range bdOwnersSlice {
-				body = body + "        " + userData.UserName + " (" + userData.UserBirthday.Format("02-01-2006") + ")" + " \r\n"
-			}
-		}
+func bdLeadTitle(days int, from, to time.Time) string {
+	if from.Format("2006-01-02") != to.Format("2006-01-02") {
+		return "С " + from.Format("02.01") + " по " + to.Format("02.01") + " день рождения у: "
+	}
+	switch days {
+	case 1:
+		return typeTomorrow
+	case 2:
+		return typeDayAfterTomorrow
+	}
+	return "Через " + strconv.Itoa(days) + " " + daysWord(days) + " день рождения у: "
+}
+
+// "день", "дня", "дней" для числа n
+func daysWord(n int) string {
+	switch {
+	case n%10 == 1 && n%100 != 11:
+		return "день"
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return "дня"
+	}
+	return "дней"
+}
+
+// prepare letters //подготовка письма (шаблон domain.MailTemplateBirthdays)
+func prepareSendLetterToSingleMail(ins *repository.PostgreInstance, bccAdmin, keyEmail string, periods []domain.MailBirthdaysPeriod) {
+	data := domain.MailBirthdaysData{Periods: periods}
+	err := ins.SendMailByTemplate(domain.MailTemplateBirthdays, []string{keyEmail}, bccAdmin, data, "")
+	if err != nil {
+		log.Error("bd_notifications handlers.prepareSendLetterToSingleMail %s error: %v", keyEmail, err)
 	}
-	SendEmail(bccAdmin, keyEmail, body)
 }
 
 // установка пар observer - bd_owner (оповещаемый - о ДР кого будем оповещать)
@@ -244,35 +241,34 @@ func handleSetOOCoupleForBdNotifications(ins *repository.PostgreInstance, data [
 
 	bdObserverId := bdOOwners.BdObserverId
 
+	// счётчик записанных пар и признак ошибок меняются из горутин - только под lock
 	type Count struct {
-		iCount int
-		lock   sync.RWMutex
+		iCount    int
+		hasErrors bool
+		lock      sync.Mutex
 	}
 	iCount := new(Count)
-	hasErrors := false
 
 	var wg sync.WaitGroup
 	for _, bdOwner := range bdOOwners.BdOwners {
 		wg.Add(1)
-		iCount.lock.Lock()
-		iCount.iCount++
-		iCount.lock.Unlock()
 		bdOwnerId := bdOwner.BdOwnerId
 		go func(iCount1 *Count) {
 			defer wg.Done()
 			err := ins.InsertBdObsOwners(bdObserverId, bdOwnerId)
+			iCount1.lock.Lock()
+			defer iCount1.lock.Unlock()
 			if err != nil {
-				iCount1.lock.Lock()
-				iCount1.iCount--
-				iCount1.lock.Unlock()
 				log.Error("handlers.handleSetOOCoupleForBdNotifications запись в базу error: %v", err)
-				hasErrors = true
+				iCount1.hasErrors = true
+				return
 			}
+			iCount1.iCount++
 		}(iCount)
 	}
 	wg.Wait()
 	strAnswer = "Для user-а с таб. номером " + bdObserverId + " произведено записей: " + strconv.Itoa(iCount.iCount)
-	if hasErrors {
+	if iCount.hasErrors {
 		strAnswer += ". Детализацию ошибок смотрите в логах."
 	}
 	return strAnswer, nil
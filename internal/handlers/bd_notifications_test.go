@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"mdata/internal/domain"
+)
+
+func TestBdRulePeriodsLeadDays(t *testing.T) {
+	friday := time.Date(2024, time.March, 15, 0, 0, 0, 0, time.UTC)
+	wednesday := time.Date(2024, time.March, 13, 0, 0, 0, 0, time.UTC)
+
+	type period struct{ from, to, title string }
+	cases := []struct {
+		name         string
+		today        time.Time
+		leadDays     []int
+		skipWeekends bool
+		want         []period
+	}{
+		{"будни", wednesday, []int{1, 3}, true, []period{
+			{"14.03", "14.03", typeTomorrow},
+			{"16.03", "16.03", "Через 3 дня день рождения у: "},
+		}},
+		{"пятница, за 1 и за 3 дня: понедельник один раз", friday, []int{1, 3}, true, []period{
+			{"16.03", "18.03", "С 16.03 по 18.03 день рождения у: "},
+			{"19.03", "20.03", "С 19.03 по 20.03 день рождения у: "},
+		}},
+		{"пятница, за 1 и за 2 дня: остаётся один день", friday, []int{2, 1}, true, []period{
+			{"16.03", "18.03", "С 16.03 по 18.03 день рождения у: "},
+			{"19.03", "19.03", "Через 4 дня день рождения у: "},
+		}},
+		{"пятница, период целиком внутри предыдущего", friday, []int{1, 1}, true, []period{
+			{"16.03", "18.03", "С 16.03 по 18.03 день рождения у: "},
+		}},
+		{"пятница без skipWeekends", friday, []int{1, 3}, false, []period{
+			{"16.03", "16.03", typeTomorrow},
+			{"18.03", "18.03", "Через 3 дня день рождения у: "},
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rule := domain.BdRule{LeadDays: c.leadDays, WeeklyDay: -1, SkipWeekends: c.skipWeekends}
+			got := bdRulePeriods(rule, c.today)
+			if len(got) != len(c.want) {
+				t.Fatalf("got %d periods, want %d: %+v", len(got), len(c.want), got)
+			}
+			for k, p := range got {
+				gotPeriod := period{p.from.Format("02.01"), p.to.Format("02.01"), p.title}
+				if gotPeriod != c.want[k] {
+					t.Errorf("period %d = %+v, want %+v", k, gotPeriod, c.want[k])
+				}
+			}
+		})
+	}
+}
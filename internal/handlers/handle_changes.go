@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	dom "mdata/internal/domain"
+	"mdata/internal/repository"
+	log "mdata/pkg/logging"
+	"mdata/pkg/pubsub"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//------------------------------------------------------------
+// лента изменений: события пишутся там же, где загрузка из 1С решает, добавлять или обновлять
+// (handleSingleUserForCRUD, handleSingleEmployeeForCRUD, handleEmployeeStateForCRUD, handleSingleDepartamentForCRUD)
+
+const (
+	defaultChangesLimit = 500
+	maxChangesLimit     = 5000
+)
+
+// события ленты рассылаются и подписчикам в реальном времени (/events/stream, ожидание в /changes?wait=)
+var changesHub = pubsub.New(256)
+
+// запишем событие в ленту и разошлём подписчикам. Ошибку только логируем - из-за ленты загрузку не останавливаем
+func recordChange(ins *repository.PostgreInstance, entity, entityGUID, changeType string, data interface{}) {
+	change, err := ins.AddChange(entity, entityGUID, changeType, data)
+	if err != nil {
+		log.Error("handlers.recordChange %s %s %s error: %v", entity, changeType, entityGUID, err)
+		return
+	}
+	changesHub.Publish(change)
+}
+
+// user в событии ленты - без сотрудников (по ним отдельные события)
+func userChangeData(usr *dom.User, currEmail string) dom.User {
+	userData := *usr
+	userData.UserEmail = currEmail
+	userData.Employees = nil
+	return userData
+}
+
+// параметры ленты
+type changesParams struct {
+	sinceID  int64
+	sinceNow bool // с текущего места, без истории
+	limit    int
+	wait     time.Duration // сколько ждать новых событий, если их пока нет (long-poll)
+}
+
+// разбор параметров ленты: ?since=<курсор>|now&limit=&wait=<сек>
+// since пустой - с начала ленты, now - с текущего места. wait ограничиваем maxWait (config: http.stream_max_duration)
+func parseChangesParams(params url.Values, maxWait time.Duration) (changesParams, error) {
+	p := changesParams{limit: defaultChangesLimit}
+	var err error
+
+	since := strings.TrimSpace(params.Get("since"))
+	switch since {
+	case "":
+	case "now":
+		p.sinceNow = true
+	default:
+		p.sinceID, err = strconv.ParseInt(since, 10, 64)
+		if err != nil || p.sinceID < 0 {
+			return p, errors.New("wrong parametr since: cursor from nextCursor expected")
+		}
+	}
+
+	if param := strings.TrimSpace(params.Get("limit")); param != "" {
+		p.limit, err = strconv.Atoi(param)
+		if err != nil || p.limit < 1 {
+			return p, errors.New("wrong parametr limit: positive number expected")
+		}
+		if p.limit > maxChangesLimit {
+			p.limit = maxChangesLimit
+		}
+	}
+
+	if param := strings.TrimSpace(params.Get("wait")); param != "" {
+		seconds, err := strconv.Atoi(param)
+		if err != nil || seconds < 0 {
+			return p, errors.New("wrong parametr wait: seconds expected")
+		}
+		p.wait = time.Duration(seconds) * time.Second
+		if p.wait > maxWait {
+			p.wait = maxWait
+		}
+	}
+	return p, nil
+}
+
+// Отдаем события ленты после курсора. Если событий нет и задан wait - ждём первого нового события не дольше wait
+func GetChangesFeed(ins *repository.PostgreInstance, p changesParams) ([]byte, error) {
+	// подписываемся до запроса в БД, чтобы не пропустить событие между запросом и ожиданием
+	var sub *pubsub.Subscriber
+	if p.wait > 0 {
+		sub = changesHub.Subscribe()
+		defer sub.Close()
+	}
+
+	if p.sinceNow {
+		lastID, err := ins.GetLastChangeID()
+		if err != nil {
+			return nil, fmt.Errorf("handlers.GetChangesFeed error: %v", err)
+		}
+		p.sinceID = lastID
+	}
+
+	// берём на одно событие больше, чтобы знать, есть ли продолжение
+	changesSlice, err := ins.GetChangesSince(p.sinceID, p.limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("handlers.GetChangesFeed error: %v", err)
+	}
+	if len(changesSlice) == 0 && sub != nil {
+		timer := time.NewTimer(p.wait)
+		select {
+		case <-sub.C:
+		case <-timer.C:
+		}
+		timer.Stop()
+		changesSlice, err = ins.GetChangesSince(p.sinceID, p.limit+1)
+		if err != nil {
+			return nil, fmt.Errorf("handlers.GetChangesFeed error: %v", err)
+		}
+	}
+
+	feed := dom.ChangesFeed{Changes: changesSlice, NextCursor: strconv.FormatInt(p.sinceID, 10)}
+	if len(changesSlice) > p.limit {
+		feed.Changes = changesSlice[:p.limit]
+		feed.HasMore = true
+	}
+	if len(feed.Changes) > 0 {
+		feed.NextCursor = strconv.FormatInt(feed.Changes[len(feed.Changes)-1].ChangeID, 10)
+	}
+
+	sliceOfByte, err := json.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("handlers.GetChangesFeed marshal error: %v", err)
+	}
+	return sliceOfByte, nil
+}
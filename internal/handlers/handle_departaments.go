@@ -2,11 +2,14 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 
+	config "mdata/configs"
 	dom "mdata/internal/domain"
 	"mdata/internal/repository"
 	log "mdata/pkg/logging"
@@ -44,9 +47,101 @@ func handleAllDepartamentForCRUD(ins *repository.PostgreInstance, data []byte) (
 	}
 
 	strAnswer = "AllDepartaments - " + strconv.Itoa(depsCount)
+
+	// вторым проходом проставим родителей тем, кто загрузился раньше своего родителя, и проверим иерархию
+	reconcileResult, err := reconcileDepartamentsHierarchy(ins)
+	if err != nil {
+		log.Error("handlers.handleAllDepartamentForCRUD reconcile error: %v", err)
+		strAnswer += "; сверка иерархии не выполнена: " + err.Error()
+		return strAnswer, nil
+	}
+	strAnswer += fmt.Sprintf("; исправлено родителей - %d, сирот - %d, циклов - %d",
+		reconcileResult.ParentsFixed, len(reconcileResult.Orphans), len(reconcileResult.Cycles))
+
 	return strAnswer, nil // TODO: error := "some(count) errors occure"
 }
 
+// Сверка иерархии подразделений после загрузки: исправляем departament_parent_guid по zup_parent_id,
+// ищем подразделения без родителя ("сирот") и зацикленные цепочки родителей
+func reconcileDepartamentsHierarchy(ins *repository.PostgreInstance) (dom.DepartamentsReconcileResult, error) {
+	result := dom.DepartamentsReconcileResult{}
+
+	parentsFixed, err := ins.ReconcileDepartamentParents()
+	if err != nil {
+		return result, err
+	}
+	result.ParentsFixed = parentsFixed
+
+	result.Orphans, err = ins.GetOrphanDepartaments()
+	if err != nil {
+		return result, err
+	}
+	for _, dep := range result.Orphans {
+		log.Warn("подразделение %s с кодом %s: не найден родитель с кодом %s", dep.DepartamentDescr, dep.DepartamentIdZUP, dep.DepartamentParentIdZUP)
+	}
+
+	allDeps, err := ins.GetAllDepartaments()
+	if err != nil {
+		return result, fmt.Errorf("handlers.reconcileDepartamentsHierarchy error: %v", err)
+	}
+	result.Cycles = findDepartamentsCycles(allDeps)
+	for _, cycle := range result.Cycles {
+		descrs := make([]string, 0, len(cycle))
+		for _, dep := range cycle {
+			descrs = append(descrs, dep.DepartamentDescr+" ("+dep.DepartamentIdZUP+")")
+		}
+		log.Error("подразделения зациклены по родителю: %s", strings.Join(descrs, " -> "))
+	}
+
+	return result, nil
+}
+
+// Ищем циклы в цепочках departament_parent_guid. Каждый цикл возвращаем один раз.
+func findDepartamentsCycles(depsSlice []dom.Departament) [][]dom.Departament {
+	const (
+		notVisited = iota
+		inPath
+		done
+	)
+
+	depsMap := make(map[string]dom.Departament, len(depsSlice))
+	for _, dep := range depsSlice {
+		depsMap[strings.TrimSpace(dep.DepartamentGUID)] = dep
+	}
+
+	cycles := make([][]dom.Departament, 0)
+	state := make(map[string]int, len(depsSlice))
+	for _, dep := range depsSlice {
+		path := make([]string, 0)
+		pathIndex := make(map[string]int)
+
+		curGUID := strings.TrimSpace(dep.DepartamentGUID)
+		for {
+			if _, ok := depsMap[curGUID]; !ok || state[curGUID] == done {
+				break
+			}
+			if state[curGUID] == inPath {
+				cycle := make([]dom.Departament, 0, len(path)-pathIndex[curGUID])
+				for _, guid := range path[pathIndex[curGUID]:] {
+					cycle = append(cycle, depsMap[guid])
+				}
+				cycles = append(cycles, cycle)
+				break
+			}
+			state[curGUID] = inPath
+			pathIndex[curGUID] = len(path)
+			path = append(path, curGUID)
+			curGUID = strings.TrimSpace(depsMap[curGUID].DepartamentParentGUID)
+		}
+
+		for _, guid := range path {
+			state[guid] = done
+		}
+	}
+
+	return cycles
+}
+
 // Функция для записи подразделения в базу, если не нашли такого по GUID, либо обновления, если нашли
 func handleSingleDepartamentForCRUD(ins *repository.PostgreInstance, dep dom.Departament) (string, error) {
 	var str string
@@ -67,6 +162,7 @@ func handleSingleDepartamentForCRUD(ins *repository.PostgreInstance, dep dom.Dep
 		}
 		str = fmt.Sprintf("%s - создано подразделение %s с кодом %s", str, dep.DepartamentDescr, dep.DepartamentIdZUP) // TODO: здесь ли нужно логирование?
 		log.Info(str)
+		recordChange(ins, dom.ChangeEntityDepartament, dep.DepartamentGUID, dom.ChangeTypeCreate, dep)
 	case 1:
 		// нашли (ничего не делаем)
 	case 2: // need for update
@@ -77,6 +173,7 @@ func handleSingleDepartamentForCRUD(ins *repository.PostgreInstance, dep dom.Dep
 		}
 		str = fmt.Sprintf("%s - обновлено подразделение %s с кодом %s", str, dep.DepartamentDescr, dep.DepartamentIdZUP) // TODO: здесь ли нужно логирование?
 		log.Info(str)
+		recordChange(ins, dom.ChangeEntityDepartament, dep.DepartamentGUID, dom.ChangeTypeUpdate, dep)
 	}
 
 	return str, nil
@@ -105,6 +202,10 @@ func checkSingleDepartamentForCRUD(ins *repository.PostgreInstance, dep *dom.Dep
 		log.Info("NUpdt DepParentIdZUP for Dep: %v  with ZUP id: %v в базе MD : %v,  надо: %v", dep.DepartamentDescr, dep.DepartamentIdZUP, gottenDep.DepartamentParentIdZUP, dep.DepartamentParentIdZUP)
 		needUpdate = true
 	}
+	if !gottenDep.DepartamentHeadSetManually && strings.TrimSpace(gottenDep.DepartamentHeadGUID) != strings.TrimSpace(dep.DepartamentHeadGUID) {
+		log.Info("NUpdt DepHeadGUID for Dep: %v  with ZUP id: %v в базе MD : %v,  надо: %v", dep.DepartamentDescr, dep.DepartamentIdZUP, gottenDep.DepartamentHeadGUID, dep.DepartamentHeadGUID)
+		needUpdate = true
+	}
 	if gottenDep.DepartamentNotUsedFrom != dep.DepartamentNotUsedFrom {
 		log.Info("NUpdt DepNotUsedFrom for Dep: %v  with ZUP id: %v в базе MD : %v,  надо: %v", dep.DepartamentDescr, dep.DepartamentIdZUP, gottenDep.DepartamentNotUsedFrom, dep.DepartamentNotUsedFrom)
 		needUpdate = true
@@ -115,3 +216,325 @@ func checkSingleDepartamentForCRUD(ins *repository.PostgreInstance, dep *dom.Dep
 
 	return 1, nil // просто нашли, обновлять не нужно, добавлять тем более )
 }
+
+//*********************************************************************************
+// иерархия подразделений (для оргструктуры на портале)
+
+// Отдаем список подразделений плоским массивом или деревом (asTree).
+// Расформированные подразделения отдаем только при includeClosed.
+func GetDepartaments(ins *repository.PostgreInstance, includeClosed, asTree bool) ([]byte, error) {
+	var depsSlice []dom.Departament
+	var err error
+	if includeClosed {
+		depsSlice, err = ins.GetAllDepartaments()
+	} else {
+		depsSlice, err = ins.GetActualDepartaments()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("handlers.GetDepartaments error: %v", err)
+	}
+
+	var data interface{}
+	if asTree {
+		data = dom.DepartamentsTree{Departaments: buildDepartamentsTree(depsSlice, "")}
+	} else {
+		data = dom.Departaments{Departaments: depsSlice}
+	}
+
+	sliceOfByte, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("handlers.GetDepartaments marshal error: %v", err)
+	}
+	return sliceOfByte, nil
+}
+
+// Отдаем карточку подразделения: само подразделение, его родителей (от корня) и дерево потомков
+func GetDepartamentCard(ins *repository.PostgreInstance, depGUID string, includeClosed bool) ([]byte, error) {
+	dep, err := ins.SelectDepByGUID(depGUID)
+	if err != nil {
+		return nil, err // "no rows" - по ним в rest определяем 404
+	}
+
+	ancestors, err := ins.GetDepartamentAncestors(depGUID)
+	if err != nil {
+		return nil, fmt.Errorf("handlers.GetDepartamentCard error: %v", err)
+	}
+
+	descendants, err := ins.GetDepartamentDescendants(depGUID, includeClosed)
+	if err != nil {
+		return nil, fmt.Errorf("handlers.GetDepartamentCard error: %v", err)
+	}
+
+	depCard := dom.DepartamentCard{
+		Departament: *dep,
+		Ancestors:   ancestors,
+		Descendants: buildDepartamentsTree(descendants, depGUID),
+	}
+
+	sliceOfByte, err := json.MarshalIndent(&depCard, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("handlers.GetDepartamentCard marshal error: %v", err)
+	}
+	return sliceOfByte, nil
+}
+
+// Собираем дерево из плоского списка подразделений по departament_parent_guid.
+// Корнями считаем подразделения, родитель которых равен rootGUID или не попал в список
+// (например, расформирован, а includeClosed не задан).
+func buildDepartamentsTree(depsSlice []dom.Departament, rootGUID string) []*dom.DepartamentNode {
+	nodesMap := make(map[string]*dom.DepartamentNode, len(depsSlice))
+	for _, dep := range depsSlice {
+		nodesMap[strings.TrimSpace(dep.DepartamentGUID)] = &dom.DepartamentNode{Departament: dep, Children: []*dom.DepartamentNode{}}
+	}
+
+	roots := make([]*dom.DepartamentNode, 0)
+	for _, dep := range depsSlice {
+		node := nodesMap[strings.TrimSpace(dep.DepartamentGUID)]
+		parentGUID := strings.TrimSpace(dep.DepartamentParentGUID)
+		parent, ok := nodesMap[parentGUID]
+		if !ok || parentGUID == rootGUID || parent == node {
+			roots = append(roots, node)
+			continue
+		}
+		parent.Children = append(parent.Children, node)
+	}
+
+	sortDepartamentNodes(roots)
+	return roots
+}
+
+func sortDepartamentNodes(nodes []*dom.DepartamentNode) {
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].DepartamentDescr < nodes[j].DepartamentDescr
+	})
+	for _, node := range nodes {
+		sortDepartamentNodes(node.Children)
+	}
+}
+
+// Отдаем работающих сотрудников подразделения, а при recursive - и всех подчиненных ему подразделений (все аттрибуты)
+func GetDepartamentEmployees(ins *repository.PostgreInstance, depGUID string, recursive bool) ([]byte, error) {
+	_, err := ins.SelectDepByGUID(depGUID)
+	if err != nil {
+		return nil, err // "no rows" - по ним в rest определяем 404
+	}
+
+	usersSlice, err := ins.GetActualUsersByDepartamentAllAttributes(depGUID, recursive)
+	if err != nil {
+		return nil, fmt.Errorf("handlers.GetDepartamentEmployees error: %v", err)
+	}
+
+	depEmployees := dom.AGUsers{}
+	depEmployees.Users = usersSlice
+
+	sliceOfByte, err := json.MarshalIndent(depEmployees, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("handlers.GetDepartamentEmployees marshal error: %v", err)
+	}
+	return sliceOfByte, nil
+}
+
+// Отдаем численность по каждому узлу поддерева подразделения (само подразделение - корень)
+func GetDepartamentHeadcount(ins *repository.PostgreInstance, depGUID string, includeClosed bool) ([]byte, error) {
+	depsSlice, headcountMap, err := ins.GetDepartamentSubtreeHeadcount(depGUID, includeClosed)
+	if err != nil {
+		return nil, fmt.Errorf("handlers.GetDepartamentHeadcount error: %v", err)
+	}
+	if len(depsSlice) == 0 {
+		return nil, fmt.Errorf("handlers.GetDepartamentHeadcount error: no rows for departament %s", depGUID)
+	}
+
+	// корень поддерева всегда первый (lvl = 0)
+	roots := buildDepartamentsTree(depsSlice, depsSlice[0].DepartamentParentGUID)
+	headcountTree := buildHeadcountTree(roots, headcountMap)
+
+	sliceOfByte, err := json.MarshalIndent(headcountTree[0], "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("handlers.GetDepartamentHeadcount marshal error: %v", err)
+	}
+	return sliceOfByte, nil
+}
+
+// переносим дерево подразделений в дерево численности, суммируя численность потомков снизу вверх
+func buildHeadcountTree(nodes []*dom.DepartamentNode, headcountMap map[string]int) []*dom.DepartamentHeadcount {
+	headcountNodes := make([]*dom.DepartamentHeadcount, 0, len(nodes))
+	for _, node := range nodes {
+		headcountNode := &dom.DepartamentHeadcount{
+			Departament: node.Departament,
+			Headcount:   headcountMap[node.DepartamentGUID],
+			Children:    buildHeadcountTree(node.Children, headcountMap),
+		}
+		headcountNode.TotalHeadcount = headcountNode.Headcount
+		for _, child := range headcountNode.Children {
+			headcountNode.TotalHeadcount += child.TotalHeadcount
+		}
+		headcountNodes = append(headcountNodes, headcountNode)
+	}
+	return headcountNodes
+}
+
+//*********************************************************************************
+// руководители подразделений и цепочка согласования
+
+// Отдаем руководителя подразделения (пользователь с сотрудником-руководителем, все аттрибуты)
+func GetDepartamentHead(ins *repository.PostgreInstance, depGUID string) ([]byte, error) {
+	dep, err := ins.SelectDepByGUID(depGUID)
+	if err != nil {
+		return nil, err // "no rows" - по ним в rest определяем 404
+	}
+	if strings.TrimSpace(dep.DepartamentHeadGUID) == "" {
+		return nil, fmt.Errorf("handlers.GetDepartamentHead error: no rows - руководитель подразделения %s не назначен", dep.DepartamentDescr)
+	}
+
+	head, err := ins.GetUserByEmployeeGUIDAllAttributes(dep.DepartamentHeadGUID)
+	if err != nil {
+		return nil, err
+	}
+
+	sliceOfByte, err := json.MarshalIndent(&head, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("handlers.GetDepartamentHead marshal error: %v", err)
+	}
+	return sliceOfByte, nil
+}
+
+// Назначаем руководителя подразделения через api (тело - {"employeeGuid": "..."}).
+// При clear снимаем ручное назначение - руководитель снова будет браться из 1С:ЗУП
+func SetDepartamentHead(ins *repository.PostgreInstance, depGUID string, data []byte, clear bool) (string, error) {
+	var headEmployeeGUID string
+	if !clear {
+		var depHead dom.DepartamentHeadStruct
+		err := json.Unmarshal(data, &depHead)
+		if err != nil {
+			return "", fmt.Errorf("handlers.SetDepartamentHead unmarshal error: %v", err)
+		}
+		headEmployeeGUID = strings.TrimSpace(depHead.EmployeeGUID)
+		if headEmployeeGUID == "" {
+			return "", errors.New("handlers.SetDepartamentHead error: не задан employeeGuid")
+		}
+		// руководителем может быть только существующий сотрудник
+		_, err = ins.SelectSingleEmployeeWithAttribsByGUID(headEmployeeGUID)
+		if err != nil {
+			return "", fmt.Errorf("handlers.SetDepartamentHead error: сотрудник %s не найден: %v", headEmployeeGUID, err)
+		}
+	}
+
+	str, err := ins.SetDepartamentHead(depGUID, headEmployeeGUID)
+	if err != nil {
+		return str, err
+	}
+	if clear {
+		str = fmt.Sprintf("%s - снято ручное назначение руководителя подразделения %s", str, depGUID)
+	} else {
+		str = fmt.Sprintf("%s - назначен руководитель %s подразделения %s", str, headEmployeeGUID, depGUID)
+	}
+	log.Info(str)
+	if dep, err := ins.SelectDepByGUID(depGUID); err == nil {
+		recordChange(ins, dom.ChangeEntityDepartament, depGUID, dom.ChangeTypeUpdate, dep)
+	}
+	return str, nil
+}
+
+// Отдаем цепочку руководителей сотрудника: идём вверх по departament_parent_guid от его подразделения и собираем руководителей.
+// Самого сотрудника (когда он сам руководит подразделением) и повторы пропускаем.
+func GetEmployeeManagerChain(ins *repository.PostgreInstance, emplGUID string) ([]byte, error) {
+	empl, err := ins.SelectSingleEmployeeWithAttribsByGUID(emplGUID)
+	if err != nil {
+		return nil, err // "no rows" - по ним в rest определяем 404
+	}
+
+	depsChain, err := ins.GetDepartamentWithParents(empl.EmployeeDepartament.DepartamentGUID)
+	if err != nil {
+		return nil, fmt.Errorf("handlers.GetEmployeeManagerChain error: %v", err)
+	}
+
+	managerChain := dom.ManagerChain{EmployeeGUID: emplGUID, Managers: make([]dom.ManagerChainLink, 0)}
+	seenHeads := map[string]bool{strings.TrimSpace(emplGUID): true}
+	for _, dep := range depsChain {
+		headGUID := strings.TrimSpace(dep.DepartamentHeadGUID)
+		if headGUID == "" || seenHeads[headGUID] {
+			continue
+		}
+		seenHeads[headGUID] = true
+		head, err := ins.GetUserByEmployeeGUIDAllAttributes(headGUID)
+		if err != nil {
+			log.Error("handlers.GetEmployeeManagerChain: не найден руководитель %s подразделения %s: %v", headGUID, dep.DepartamentDescr, err)
+			continue
+		}
+		managerChain.Managers = append(managerChain.Managers, dom.ManagerChainLink{Departament: dep, Manager: head})
+	}
+
+	sliceOfByte, err := json.MarshalIndent(&managerChain, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("handlers.GetEmployeeManagerChain marshal error: %v", err)
+	}
+	return sliceOfByte, nil
+}
+
+//*********************************************************************************
+// сотрудники в расформированных подразделениях (нужно перевести в ЗУП)
+
+// Отдаем работающих сотрудников, которые числятся в подразделениях, расформированных сегодня или раньше (все аттрибуты)
+func GetEmployeesInClosedDepartaments(ins *repository.PostgreInstance) ([]byte, error) {
+	usersSlice, err := ins.GetActualUsersInClosedDepartaments()
+	if err != nil {
+		return nil, fmt.Errorf("handlers.GetEmployeesInClosedDepartaments error: %v", err)
+	}
+
+	closedDepEmployees := dom.AGUsers{}
+	closedDepEmployees.Users = usersSlice
+
+	sliceOfByte, err := json.MarshalIndent(closedDepEmployees, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("handlers.GetEmployeesInClosedDepartaments marshal error: %v", err)
+	}
+	return sliceOfByte, nil
+}
+
+// Ищем работающих сотрудников в расформированных подразделениях и отправляем их список в отдел кадров. Возвращаем количество найденных.
+func sendClosedDepartamentsNotifications(ins *repository.PostgreInstance) (int, error) {
+	usersSlice, err := ins.GetActualUsersInClosedDepartaments()
+	if err != nil {
+		return 0, fmt.Errorf("handlers.sendClosedDepartamentsNotifications error: %v", err)
+	}
+	if len(usersSlice) == 0 {
+		return 0, nil
+	}
+
+	// адресаты
+	recipients, err := ins.GetNotificationRecipients(config.NotiTypeClosedDepartaments)
+	if err != nil {
+		return len(usersSlice), fmt.Errorf("handlers.sendClosedDepartamentsNotifications GetRecipients error: %v", err)
+	}
+	// скрытая копия
+	bccAdmin := ins.GetBccAdmin()
+
+	// тело: сгруппируем сотрудников по подразделениям
+	depsOrder := make([]string, 0)
+	depsMap := make(map[string][]string)
+	for _, user := range usersSlice {
+		for _, empl := range user.Employees {
+			dep := empl.EmployeeDepartament
+			depKey := dep.DepartamentDescr + " (расформировано " + dep.DepartamentNotUsedFrom.Format("02.01.2006") + ")"
+			if _, ok := depsMap[depKey]; !ok {
+				depsOrder = append(depsOrder, depKey)
+			}
+			depsMap[depKey] = append(depsMap[depKey], user.UserName+" (таб. № "+empl.EmpTabNumber+")")
+		}
+	}
+	sort.Strings(depsOrder)
+
+	data := dom.MailClosedDepartamentsData{}
+	for _, depKey := range depsOrder {
+		data.Departaments = append(data.Departaments, dom.MailClosedDepartament{Title: depKey, Employees: depsMap[depKey]})
+	}
+
+	// отправка
+	err = ins.SendMailByTemplate(dom.MailTemplateClosedDepartaments, recipients, bccAdmin, data, "")
+	if err != nil {
+		return len(usersSlice), fmt.Errorf("handlers.sendClosedDepartamentsNotifications SendMailByTemplate error: %v", err)
+	}
+
+	log.Info("notifications handlers.sendClosedDepartamentsNotifications OK: %d users", len(usersSlice))
+	return len(usersSlice), nil
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	dom "mdata/internal/domain"
+)
+
+func testDeps(parents map[string]string) []dom.Departament {
+	// порядок - по имени, чтобы обход (и порядок циклов) не зависел от map
+	guids := []string{"a", "b", "c", "d", "e"}
+	depsSlice := make([]dom.Departament, 0, len(parents))
+	for _, guid := range guids {
+		if parentGUID, ok := parents[guid]; ok {
+			depsSlice = append(depsSlice, dom.Departament{DepartamentGUID: guid, DepartamentParentGUID: parentGUID, DepartamentDescr: guid})
+		}
+	}
+	return depsSlice
+}
+
+func TestFindDepartamentsCycles(t *testing.T) {
+	cases := []struct {
+		name    string
+		parents map[string]string // guid -> guid родителя
+		want    [][]string
+	}{
+		{"без циклов", map[string]string{"a": "", "b": "a", "c": "b", "d": "a"}, [][]string{}},
+		{"родитель вне списка", map[string]string{"a": "x", "b": "a"}, [][]string{}},
+		{"сам себе родитель", map[string]string{"a": "a", "b": ""}, [][]string{{"a"}}},
+		{"цикл из двух", map[string]string{"a": "b", "b": "a", "c": ""}, [][]string{{"a", "b"}}},
+		{"цепочка, ведущая в цикл", map[string]string{"a": "b", "b": "c", "c": "d", "d": "c"}, [][]string{{"c", "d"}}},
+		{"два цикла", map[string]string{"a": "b", "b": "a", "c": "d", "d": "e", "e": "c"}, [][]string{{"a", "b"}, {"c", "d", "e"}}},
+		{"пробелы в guid", map[string]string{"a": "b ", "b": " a"}, [][]string{{"a", "b"}}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := make([][]string, 0)
+			for _, cycle := range findDepartamentsCycles(testDeps(c.parents)) {
+				guids := make([]string, 0, len(cycle))
+				for _, dep := range cycle {
+					guids = append(guids, dep.DepartamentGUID)
+				}
+				got = append(got, guids)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("findDepartamentsCycles = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
@@ -36,6 +36,13 @@ func handleEmployeeStateForCRUD(ins *repository.PostgreInstance, usr *dom.User,
 			return err
 		}
 		log.Info("%v - updated EmployeeState %v for user %v : with EmployeeId: %v, with EmpTabNumber: %v", str, empl.EmployeeCurrentState, usr.UserName, empl.EmployeeId, empl.EmpTabNumber)
+
+		// смена состояния на "Увольнение" - отдельное событие ленты
+		changeType := dom.ChangeTypeUpdate
+		if strings.Contains(empl.EmployeeCurrentState.StateName, "Увол") {
+			changeType = dom.ChangeTypeFire
+		}
+		recordChange(ins, dom.ChangeEntityEmployee, empl.EmployeeGUID, changeType, dom.EmployeeChange{UserGUID: usr.UserGUID, Employee: *empl})
 	}
 	return nil
 }
@@ -2,10 +2,14 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	dom "mdata/internal/domain"
 	"mdata/internal/repository"
 	log "mdata/pkg/logging"
+	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -70,6 +74,198 @@ func GetAllEmailEmployeesLightVersionAttributes(ins *repository.PostgreInstance)
 	return sliceOfByte, nil
 }
 
+//------------------------------------------------------------
+// постраничная выдача, фильтры и выбор полей
+const maxEmployeesPageLimit = 1000
+
+var uuidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// разбор параметров запроса:
+// ?tabno=&name=&departament=<guid>&position=&employment=&state=&hasEmail=true|false&bdMonth=1..12&limit=&offset=&cursor=<guid>&fields=userName,tabNumber,...
+func parseEmployeesFilter(params url.Values) (dom.EmployeesFilter, error) {
+	filter := dom.EmployeesFilter{}
+
+	filter.TabNo = strings.TrimSpace(params.Get("tabno"))
+	filter.Name = strings.TrimSpace(params.Get("name"))
+	filter.DepartamentGUID = strings.TrimSpace(params.Get("departament"))
+	if filter.DepartamentGUID != "" && !uuidRegexp.MatchString(filter.DepartamentGUID) {
+		return filter, errors.New("wrong parametr departament: guid expected")
+	}
+	filter.Position = strings.TrimSpace(params.Get("position"))
+	filter.Employment = strings.TrimSpace(params.Get("employment"))
+	filter.State = strings.TrimSpace(params.Get("state"))
+
+	if param := strings.TrimSpace(params.Get("hasEmail")); param != "" {
+		hasEmail, err := parseBoolParam(param)
+		if err != nil {
+			return filter, errors.New("wrong parametr hasEmail: true or false expected")
+		}
+		filter.HasEmail = &hasEmail
+	}
+	if param := strings.TrimSpace(params.Get("bdMonth")); param != "" {
+		month, err := strconv.Atoi(param)
+		if err != nil || month < 1 || month > 12 {
+			return filter, errors.New("wrong parametr bdMonth: 1..12 expected")
+		}
+		filter.BirthdayMonth = month
+	}
+
+	if param := strings.TrimSpace(params.Get("limit")); param != "" {
+		limit, err := strconv.Atoi(param)
+		if err != nil || limit < 1 {
+			return filter, errors.New("wrong parametr limit: positive number expected")
+		}
+		if limit > maxEmployeesPageLimit {
+			limit = maxEmployeesPageLimit
+		}
+		filter.Limit = limit
+	}
+	if param := strings.TrimSpace(params.Get("offset")); param != "" {
+		offset, err := strconv.Atoi(param)
+		if err != nil || offset < 0 {
+			return filter, errors.New("wrong parametr offset: non-negative number expected")
+		}
+		filter.Offset = offset
+	}
+	filter.Cursor = strings.TrimSpace(params.Get("cursor"))
+	if filter.Cursor != "" {
+		if !uuidRegexp.MatchString(filter.Cursor) {
+			return filter, errors.New("wrong parametr cursor: guid expected")
+		}
+		if filter.Offset > 0 {
+			return filter, errors.New("parametrs cursor and offset can't be used together")
+		}
+	}
+
+	if param := strings.TrimSpace(params.Get("fields")); param != "" {
+		filter.Fields = strings.Split(param, ",")
+		if err := repository.ValidateUsersFields(filter.Fields); err != nil {
+			return filter, fmt.Errorf("wrong parametr fields: %v", err)
+		}
+	}
+
+	return filter, nil
+}
+
+// Отдаем страницу user-ов по фильтру
+func GetEmployeesPage(ins *repository.PostgreInstance, filter dom.EmployeesFilter) ([]byte, error) {
+	usersSlice, total, err := ins.GetUsersByFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("handlers.GetEmployeesPage error: %v", err)
+	}
+
+	page := dom.EmployeesPage{Total: total, Limit: filter.Limit, Offset: filter.Offset}
+	if filter.Limit > 0 && len(usersSlice) == filter.Limit {
+		page.NextCursor = usersSlice[len(usersSlice)-1].UserGUID
+	}
+	if len(filter.Fields) > 0 {
+		page.Users, err = projectUsersFields(usersSlice, filter.Fields)
+		if err != nil {
+			return nil, fmt.Errorf("handlers.GetEmployeesPage error: %v", err)
+		}
+	} else {
+		page.Users = usersSlice
+	}
+
+	sliceOfByte, err := json.MarshalIndent(page, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("handlers.GetEmployeesPage marshal error: %v", err)
+	}
+	return sliceOfByte, nil
+}
+
+// поиск работающих user-ов сразу по нескольким критериям: ?tabno=&name=&email=&departament=&position=&limit=
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+func parseEmployeesSearch(params url.Values) (dom.EmployeesSearch, error) {
+	search := dom.EmployeesSearch{
+		TabNo:       strings.TrimSpace(params.Get("tabno")),
+		Name:        strings.TrimSpace(params.Get("name")),
+		Email:       strings.TrimSpace(params.Get("email")),
+		Departament: strings.TrimSpace(params.Get("departament")),
+		Position:    strings.TrimSpace(params.Get("position")),
+		Limit:       defaultSearchLimit,
+	}
+	if search.TabNo == "" && search.Name == "" && search.Email == "" && search.Departament == "" && search.Position == "" {
+		return search, errors.New("at least one of parametrs tabno, name, email, departament, position is required")
+	}
+	if param := strings.TrimSpace(params.Get("limit")); param != "" {
+		limit, err := strconv.Atoi(param)
+		if err != nil || limit < 1 {
+			return search, errors.New("wrong parametr limit: positive number expected")
+		}
+		if limit > maxSearchLimit {
+			limit = maxSearchLimit
+		}
+		search.Limit = limit
+	}
+	return search, nil
+}
+
+func SearchEmployees(ins *repository.PostgreInstance, search dom.EmployeesSearch) ([]byte, error) {
+	foundUsers, err := ins.SearchActualUsers(search)
+	if err != nil {
+		return nil, fmt.Errorf("handlers.SearchEmployees error: %v", err)
+	}
+
+	sliceOfByte, err := json.MarshalIndent(dom.UsersSearchResult{Users: foundUsers}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("handlers.SearchEmployees marshal error: %v", err)
+	}
+	return sliceOfByte, nil
+}
+
+// оставим у user-ов (и их сотрудников) только запрошенные поля; "employees" - все поля сотрудников
+func projectUsersFields(usersSlice []dom.User, fields []string) ([]map[string]interface{}, error) {
+	fieldsMap := make(map[string]bool)
+	for _, field := range fields {
+		fieldsMap[strings.TrimSpace(field)] = true
+	}
+
+	sliceOfByte, err := json.Marshal(usersSlice)
+	if err != nil {
+		return nil, err
+	}
+	projected := make([]map[string]interface{}, 0, len(usersSlice))
+	err = json.Unmarshal(sliceOfByte, &projected)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, user := range projected {
+		needEmployees := fieldsMap["employees"]
+		for key := range user {
+			if key == "employees" {
+				continue
+			}
+			if !fieldsMap[key] {
+				delete(user, key)
+			}
+		}
+		employees, _ := user["employees"].([]interface{})
+		for _, empl := range employees {
+			emplMap, ok := empl.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for key := range emplMap {
+				if fieldsMap[key] {
+					needEmployees = true
+				} else if !fieldsMap["employees"] {
+					delete(emplMap, key)
+				}
+			}
+		}
+		if !needEmployees {
+			delete(user, "employees")
+		}
+	}
+	return projected, nil
+}
+
 //------------------------------------------------------------
 // переберем всех сотрудников пользователя проверим каждого на предмет: нужно ли его обновить (или может, добавить...) и произведем нужное действие:
 func handleAllUserEmployeesForCRUD(ins *repository.PostgreInstance, usr *dom.User) error {
@@ -96,6 +292,7 @@ func handleSingleEmployeeForCRUD(ins *repository.PostgreInstance, usr *dom.User,
 		if err != nil {
 			return err
 		}
+		recordChange(ins, dom.ChangeEntityEmployee, empl.EmployeeGUID, dom.ChangeTypeCreate, dom.EmployeeChange{UserGUID: usr.UserGUID, Employee: *empl})
 
 	case 1:
 		// нашли
@@ -105,6 +302,7 @@ func handleSingleEmployeeForCRUD(ins *repository.PostgreInstance, usr *dom.User,
 		if err != nil {
 			return err
 		}
+		recordChange(ins, dom.ChangeEntityEmployee, empl.EmployeeGUID, dom.ChangeTypeUpdate, dom.EmployeeChange{UserGUID: usr.UserGUID, Employee: *empl})
 		log.Info("updated employee for user %v : %v, %v, %v, %v, %v", usr.UserName, empl.EmployeeGUID, empl.EmployeeId, empl.EmpTabNumber, empl.EmployeeAdress, empl.Employment)
 	}
 	// check for update departament: подразделение добавлять не будем. Таблица подразделений заполнянтся не зависимо от сотрудников. У сотрудника есть ссылка (GUID) на подразделение.
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	dom "mdata/internal/domain"
+	"mdata/internal/repository"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//------------------------------------------------------------
+// поток событий (Server-Sent Events) - те же события, что и в ленте /changes, но в реальном времени.
+// Тип события - "<сущность>.<изменение>": user.create, user.email, employee.fire, departament.update и т.д.
+// id события - курсор ленты, поэтому после обрыва клиент (EventSource) переподключается с Last-Event-ID
+// и получает пропущенное из таблицы changes.
+
+const (
+	eventsHeartbeat   = 15 * time.Second
+	eventsRetryMillis = 3000 // через сколько клиенту переподключаться
+)
+
+// тип события для потока
+func changeEventType(change dom.ChangeEvent) string {
+	return change.Entity + "." + change.ChangeType
+}
+
+// фильтр ?types=user.create,employee.fire или по сущности (?types=user) или по изменению (?types=fire); пусто - все события
+type eventTypesFilter map[string]bool
+
+func parseEventTypesFilter(param string) eventTypesFilter {
+	filter := make(eventTypesFilter)
+	for _, eventType := range strings.Split(param, ",") {
+		if eventType = strings.TrimSpace(eventType); eventType != "" {
+			filter[eventType] = true
+		}
+	}
+	return filter
+}
+
+func (f eventTypesFilter) match(change dom.ChangeEvent) bool {
+	return len(f) == 0 || f[changeEventType(change)] || f[change.Entity] || f[change.ChangeType]
+}
+
+// курсор, с которого продолжить: заголовок Last-Event-ID (переподключение EventSource) или ?lastEventId=
+// ok = false - курсора нет, отдаём только новые события
+func parseLastEventID(r *http.Request) (int64, bool, error) {
+	lastEventID := strings.TrimSpace(r.Header.Get("Last-Event-ID"))
+	if lastEventID == "" {
+		lastEventID = strings.TrimSpace(r.URL.Query().Get("lastEventId"))
+	}
+	if lastEventID == "" {
+		return 0, false, nil
+	}
+	sinceID, err := strconv.ParseInt(lastEventID, 10, 64)
+	if err != nil || sinceID < 0 {
+		return 0, false, fmt.Errorf("wrong Last-Event-ID: cursor expected")
+	}
+	return sinceID, true, nil
+}
+
+func writeSSEEvent(w http.ResponseWriter, change dom.ChangeEvent) error {
+	data, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", change.ChangeID, changeEventType(change), data)
+	return err
+}
+
+// поток событий в w до отключения клиента или maxDuration (после него клиент переподключится сам).
+// События берём из ленты (changes): уведомление changesHub только будит поток, а отдаём всё после lastSentID -
+// так события, разосланные, пока поток писал клиенту, не пропадают
+func streamChanges(ins *repository.PostgreInstance, w http.ResponseWriter, r *http.Request, flusher http.Flusher,
+	filter eventTypesFilter, sinceID int64, replay bool, maxDuration time.Duration) error {
+	// подписываемся до выборки из БД, чтобы не пропустить событие между ними
+	sub := changesHub.Subscribe()
+	defer sub.Close()
+
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", eventsRetryMillis); err != nil {
+		return err
+	}
+	flusher.Flush()
+
+	// без Last-Event-ID - только новые события
+	lastSentID := sinceID
+	if !replay {
+		lastID, err := ins.GetLastChangeID()
+		if err != nil {
+			return fmt.Errorf("handlers.streamChanges error: %v", err)
+		}
+		lastSentID = lastID
+	}
+
+	// отдаём всё после lastSentID
+	sendPending := func() error {
+		for {
+			changesSlice, err := ins.GetChangesSince(lastSentID, maxChangesLimit)
+			if err != nil {
+				return fmt.Errorf("handlers.streamChanges error: %v", err)
+			}
+			for _, change := range changesSlice {
+				lastSentID = change.ChangeID
+				if !filter.match(change) {
+					continue
+				}
+				if err = writeSSEEvent(w, change); err != nil {
+					return err
+				}
+			}
+			flusher.Flush()
+			if len(changesSlice) < maxChangesLimit {
+				return nil
+			}
+		}
+	}
+
+	// догоняем пропущенное с Last-Event-ID
+	if replay {
+		if err := sendPending(); err != nil {
+			return err
+		}
+	}
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	deadline := time.NewTimer(maxDuration)
+	defer deadline.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil
+		case <-deadline.C:
+			return nil
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return err
+			}
+			flusher.Flush()
+		case _, ok := <-sub.C:
+			if !ok {
+				return nil // отстали - клиент переподключится и догонит по Last-Event-ID
+			}
+			if err := sendPending(); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	dom "mdata/internal/domain"
+)
+
+func TestParseLastEventID(t *testing.T) {
+	cases := []struct {
+		name    string
+		header  string
+		query   string
+		wantID  int64
+		wantOK  bool
+		wantErr bool
+	}{
+		{"нет курсора", "", "", 0, false, false},
+		{"заголовок", "42", "", 42, true, false},
+		{"заголовок важнее параметра", " 42 ", "7", 42, true, false},
+		{"параметр", "", "7", 7, true, false},
+		{"ноль", "0", "", 0, true, false},
+		{"не число", "abc", "", 0, false, true},
+		{"отрицательный", "-1", "", 0, false, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			target := "/events/stream"
+			if c.query != "" {
+				target += "?lastEventId=" + c.query
+			}
+			r := httptest.NewRequest(http.MethodGet, target, nil)
+			if c.header != "" {
+				r.Header.Set("Last-Event-ID", c.header)
+			}
+			gotID, gotOK, err := parseLastEventID(r)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, c.wantErr)
+			}
+			if gotID != c.wantID || gotOK != c.wantOK {
+				t.Errorf("parseLastEventID = %d, %v; want %d, %v", gotID, gotOK, c.wantID, c.wantOK)
+			}
+		})
+	}
+}
+
+func TestEventTypesFilter(t *testing.T) {
+	userCreate := dom.ChangeEvent{Entity: dom.ChangeEntityUser, ChangeType: "create"}
+	employeeFire := dom.ChangeEvent{Entity: dom.ChangeEntityEmployee, ChangeType: "fire"}
+	depUpdate := dom.ChangeEvent{Entity: dom.ChangeEntityDepartament, ChangeType: "update"}
+
+	cases := []struct {
+		name  string
+		param string
+		want  []bool // userCreate, employeeFire, depUpdate
+	}{
+		{"пусто - все", "", []bool{true, true, true}},
+		{"только запятые и пробелы - все", " , ,", []bool{true, true, true}},
+		{"тип события", "user.create", []bool{true, false, false}},
+		{"сущность", "employee", []bool{false, true, false}},
+		{"изменение", "update", []bool{false, false, true}},
+		{"список с пробелами", " user.create , fire", []bool{true, true, false}},
+		{"неизвестный тип", "user.fire", []bool{false, false, false}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			filter := parseEventTypesFilter(c.param)
+			for k, change := range []dom.ChangeEvent{userCreate, employeeFire, depUpdate} {
+				if got := filter.match(change); got != c.want[k] {
+					t.Errorf("match(%s) = %v, want %v", changeEventType(change), got, c.want[k])
+				}
+			}
+		})
+	}
+}
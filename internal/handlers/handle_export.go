@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	dom "mdata/internal/domain"
+	"mdata/internal/repository"
+	"mdata/pkg/export"
+	log "mdata/pkg/logging"
+	"net/http"
+	"strings"
+)
+
+//------------------------------------------------------------
+// выгрузка списков сотрудников и подразделений в CSV / XLSX (для отдела кадров и бухгалтерии)
+// формат - параметром ?format=csv|xlsx|json или заголовком Accept (text/csv, ...spreadsheetml.sheet)
+
+const (
+	exportFormatJSON = "json"
+	exportFormatCSV  = "csv"
+	exportFormatXLSX = "xlsx"
+
+	mimeCSV  = "text/csv"
+	mimeXLSX = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+// определим формат ответа. Параметр format убираем из запроса - дальше параметры разбираются как обычно
+func takeExportFormat(r *http.Request) (string, error) {
+	params := r.URL.Query()
+	if _, ok := params["format"]; ok {
+		format := strings.ToLower(strings.TrimSpace(params.Get("format")))
+		params.Del("format")
+		r.URL.RawQuery = params.Encode()
+
+		switch format {
+		case exportFormatJSON, exportFormatCSV, exportFormatXLSX:
+			return format, nil
+		}
+		return "", errors.New("wrong parametr format: json, csv or xlsx expected")
+	}
+
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, mimeCSV):
+		return exportFormatCSV, nil
+	case strings.Contains(accept, mimeXLSX):
+		return exportFormatXLSX, nil
+	}
+	return exportFormatJSON, nil
+}
+
+// колонка выгрузки сотрудников: поле (как в json, для fields=), заголовок и значение
+type exportColumn struct {
+	field string
+	title string
+	value func(u *dom.User, e *dom.Employee) string
+}
+
+var employeesExportColumns = []exportColumn{
+	{"userGuid", "GUID физ.лица", func(u *dom.User, e *dom.Employee) string { return u.UserGUID }},
+	{"userName", "ФИО", func(u *dom.User, e *dom.Employee) string { return u.UserName }},
+	{"userId", "Код физ.лица", func(u *dom.User, e *dom.Employee) string { return u.UserID }},
+	{"userBirthday", "Дата рождения", func(u *dom.User, e *dom.Employee) string { return exportDate(u.UserBirthday) }},
+	{"userEmail", "Email", func(u *dom.User, e *dom.Employee) string { return u.UserEmail }},
+
+	{"employeeGuid", "GUID сотрудника", func(u *dom.User, e *dom.Employee) string { return e.EmployeeGUID }},
+	{"employeeId", "Код сотрудника", func(u *dom.User, e *dom.Employee) string { return e.EmployeeId }},
+	{"tabNumber", "Табельный номер", func(u *dom.User, e *dom.Employee) string { return e.EmpTabNumber }},
+	{"employment", "Вид занятости", func(u *dom.User, e *dom.Employee) string { return e.Employment }},
+	{"employeeAdress", "Адрес", func(u *dom.User, e *dom.Employee) string { return e.EmployeeAdress }},
+	{"departament", "Подразделение", func(u *dom.User, e *dom.Employee) string { return e.EmployeeDepartament.DepartamentDescr }},
+	{"departament", "Код подразделения", func(u *dom.User, e *dom.Employee) string { return e.EmployeeDepartament.DepartamentIdZUP }},
+	{"position", "Должность", func(u *dom.User, e *dom.Employee) string { return e.EmployeePosition.PositionDescr }},
+	{"positionShr", "Штатная позиция", func(u *dom.User, e *dom.Employee) string { return e.EmployeePshr.PshrDescr }},
+	{"currentState", "Состояние", func(u *dom.User, e *dom.Employee) string { return e.EmployeeCurrentState.StateName }},
+	{"currentState", "Дата состояния", func(u *dom.User, e *dom.Employee) string {
+		return exportDate(e.EmployeeCurrentState.DateFrom)
+	}},
+}
+
+func exportDate(d dom.CastDate) string {
+	if d.IsZero() {
+		return ""
+	}
+	return d.Format("02.01.2006")
+}
+
+// таблица сотрудников: строка на каждого сотрудника (у физ.лица их может быть несколько), поля - как в fields= (пусто - все)
+func employeesExportTable(usersSlice []dom.User, fields []string) export.Table {
+	fieldsMap := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		if field == "employees" {
+			for _, col := range employeesExportColumns {
+				if !strings.HasPrefix(col.field, "user") { // поля сотрудника
+					fieldsMap[col.field] = true
+				}
+			}
+			continue
+		}
+		fieldsMap[field] = true
+	}
+
+	cols := make([]exportColumn, 0, len(employeesExportColumns))
+	for _, col := range employeesExportColumns {
+		if len(fields) == 0 || fieldsMap[col.field] {
+			cols = append(cols, col)
+		}
+	}
+
+	t := export.Table{Headers: make([]string, 0, len(cols)), Rows: make([][]string, 0, len(usersSlice))}
+	for _, col := range cols {
+		t.Headers = append(t.Headers, col.title)
+	}
+	for k := range usersSlice {
+		user := &usersSlice[k]
+		employees := user.Employees
+		if len(employees) == 0 {
+			employees = []dom.Employee{{}}
+		}
+		for n := range employees {
+			row := make([]string, 0, len(cols))
+			for _, col := range cols {
+				row = append(row, col.value(user, &employees[n]))
+			}
+			t.Rows = append(t.Rows, row)
+		}
+	}
+	return t
+}
+
+// таблица подразделений (всегда плоская)
+func departamentsExportTable(depsSlice []dom.Departament) export.Table {
+	t := export.Table{
+		Headers: []string{"GUID подразделения", "Наименование", "Код", "GUID родителя", "Код родителя", "Дата расформирования", "GUID руководителя"},
+		Rows:    make([][]string, 0, len(depsSlice)),
+	}
+	for _, dep := range depsSlice {
+		t.Rows = append(t.Rows, []string{dep.DepartamentGUID, dep.DepartamentDescr, dep.DepartamentIdZUP,
+			dep.DepartamentParentGUID, dep.DepartamentParentIdZUP, exportDate(dep.DepartamentNotUsedFrom), dep.DepartamentHeadGUID})
+	}
+	return t
+}
+
+// пишем таблицу в ответ файлом fileName (без расширения)
+func writeExport(w http.ResponseWriter, format, fileName string, t export.Table) {
+	var err error
+	switch format {
+	case exportFormatXLSX:
+		w.Header().Set("Content-Type", mimeXLSX)
+		w.Header().Set("Content-Disposition", `attachment; filename="`+fileName+`.xlsx"`)
+		w.WriteHeader(http.StatusOK)
+		err = export.WriteXLSX(w, t, fileName)
+	default:
+		w.Header().Set("Content-Type", mimeCSV+"; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+fileName+`.csv"`)
+		w.WriteHeader(http.StatusOK)
+		err = export.WriteCSV(w, t)
+	}
+	if err != nil {
+		// заголовок уже отправлен - остаётся только записать в лог
+		log.Error("handlers.writeExport %s error: %v", fileName, err)
+	}
+}
+
+// сотрудники для выгрузки: без параметров - весь список loadAll (все или облегчённые аттрибуты),
+// с параметрами - по фильтру, как постраничная выдача (onlyWithEmail, defaultFields - как в restSendEmployeesPage)
+func getEmployeesForExport(ins *repository.PostgreInstance, r *http.Request, loadAll func() ([]dom.User, error),
+	onlyWithEmail bool, defaultFields []string) (export.Table, error) {
+	if len(r.URL.Query()) == 0 {
+		usersSlice, err := loadAll()
+		if err != nil {
+			return export.Table{}, fmt.Errorf("handlers.getEmployeesForExport error: %v", err)
+		}
+		return employeesExportTable(usersSlice, defaultFields), nil
+	}
+
+	filter, err := parseEmployeesFilter(r.URL.Query())
+	if err != nil {
+		return export.Table{}, errBadExportRequest{err}
+	}
+	if onlyWithEmail {
+		hasEmail := true
+		filter.HasEmail = &hasEmail
+	}
+	if len(filter.Fields) == 0 {
+		filter.Fields = defaultFields
+	}
+	usersSlice, _, err := ins.GetUsersByFilter(filter)
+	if err != nil {
+		return export.Table{}, fmt.Errorf("handlers.getEmployeesForExport error: %v", err)
+	}
+	return employeesExportTable(usersSlice, filter.Fields), nil
+}
+
+// ошибка в параметрах запроса выгрузки (400, а не 500)
+type errBadExportRequest struct {
+	err error
+}
+
+func (e errBadExportRequest) Error() string {
+	return e.err.Error()
+}
+
+// выгрузка сотрудников в CSV / XLSX для старых маршрутов (ошибки - текстом)
+func restExportEmployees(ins *repository.PostgreInstance, w http.ResponseWriter, r *http.Request, format, fileName string,
+	loadAll func() ([]dom.User, error), onlyWithEmail bool, defaultFields []string) {
+	t, err := getEmployeesForExport(ins, r, loadAll, onlyWithEmail, defaultFields)
+	if err != nil {
+		if _, ok := err.(errBadExportRequest); ok {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		log.Error("handlers.restExportEmployees error: %v", err)
+		http.Error(w, "500 - Something bad happened!", 500)
+		return
+	}
+	writeExport(w, format, fileName, t)
+}
+
+// подразделения для выгрузки
+func getDepartamentsForExport(ins *repository.PostgreInstance, includeClosed bool) (export.Table, error) {
+	var depsSlice []dom.Departament
+	var err error
+	if includeClosed {
+		depsSlice, err = ins.GetAllDepartaments()
+	} else {
+		depsSlice, err = ins.GetActualDepartaments()
+	}
+	if err != nil {
+		return export.Table{}, fmt.Errorf("handlers.getDepartamentsForExport error: %v", err)
+	}
+	return departamentsExportTable(depsSlice), nil
+}
+
+// работающие сотрудники подразделения для выгрузки ("no rows" - нет такого подразделения)
+func getDepartamentEmployeesForExport(ins *repository.PostgreInstance, depGUID string, recursive bool) (export.Table, error) {
+	_, err := ins.SelectDepByGUID(depGUID)
+	if err != nil {
+		return export.Table{}, err
+	}
+	usersSlice, err := ins.GetActualUsersByDepartamentAllAttributes(depGUID, recursive)
+	if err != nil {
+		return export.Table{}, fmt.Errorf("handlers.getDepartamentEmployeesForExport error: %v", err)
+	}
+	return employeesExportTable(usersSlice, nil), nil
+}
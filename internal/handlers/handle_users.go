@@ -27,6 +27,7 @@ func handleSingleUserForCRUD(ins *repository.PostgreInstance, currEmail string,
 		if err != nil {
 			return str, err
 		}
+		recordChange(ins, dom.ChangeEntityUser, usr.UserGUID, dom.ChangeTypeCreate, userChangeData(usr, currEmail))
 		// если добавляем user-а с email-ом (только в этом случае), зрегистрируем его к обмену с 1С:ЗУП
 		if strings.TrimSpace(currEmail) != "" {
 			usr.UserEmail = currEmail
@@ -61,11 +62,17 @@ func handleSingleUserForCRUD(ins *repository.PostgreInstance, currEmail string,
 		if err != nil {
 			return str, err
 		}
+		recordChange(ins, dom.ChangeEntityUser, usr.UserGUID, dom.ChangeTypeUpdate, userChangeData(usr, currEmail))
 	case 22: // need for update email. Обработаем этот case отдельно, т.к. нужно зарегистрировать user-а к обмену с 1С:ЗУП
 		str, err = updateUser(ins, currEmail, usr)
 		if err != nil {
 			return str, err
 		}
+		if strings.TrimSpace(currEmail) != "" {
+			recordChange(ins, dom.ChangeEntityUser, usr.UserGUID, dom.ChangeTypeEmail, userChangeData(usr, currEmail))
+		} else {
+			recordChange(ins, dom.ChangeEntityUser, usr.UserGUID, dom.ChangeTypeUpdate, userChangeData(usr, currEmail))
+		}
 		// т.к. нужно обновить email, запишем это в файлик, который в пятницу уйдет в бухгалтерию
 		if strings.TrimSpace(currEmail) == "" {
 			log.InfoBuch("Удалён email у сотрудника: %v c таб. № %v", usr.UserName, usr.UserID)
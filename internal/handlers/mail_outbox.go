@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	config "mdata/configs"
+	"mdata/internal/repository"
+	log "mdata/pkg/logging"
+	"time"
+)
+
+//------------------------------------------------------------
+// обработчик очереди исходящих писем (mail_outbox): SendMailToRecipient только записывает письмо,
+// отправляет его этот обработчик - с повторами через нарастающую паузу, пока не исчерпает попытки (тогда письмо - failed,
+// его видно в GET /api/v1/mail-outbox). Так письма о днях рождения и админам 1С не теряются, если почтовый сервер недоступен
+
+const (
+	mailOutboxBatch = 50
+	mailOutboxLease = 5 * time.Minute // на сколько откладываем повтор взятого в отправку письма (если процесс упадёт посреди отправки)
+)
+
+// MailWorker -.
+type MailWorker struct {
+	ins         *repository.PostgreInstance
+	maxAttempts int
+	retryMin    time.Duration
+	retryMax    time.Duration
+	poll        time.Duration
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// StartMailWorker - отправляем письма в фоне до Stop
+func StartMailWorker(ins *repository.PostgreInstance, cfg config.MailOutbox) *MailWorker {
+	mw := &MailWorker{
+		ins:         ins,
+		maxAttempts: cfg.MailOutboxMaxAttempts,
+		retryMin:    time.Duration(cfg.MailOutboxRetryMin) * time.Second,
+		retryMax:    time.Duration(cfg.MailOutboxRetryMax) * time.Second,
+		poll:        time.Duration(cfg.MailOutboxPoll) * time.Second,
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	if mw.maxAttempts < 1 {
+		mw.maxAttempts = 1
+	}
+	if mw.retryMin < time.Second {
+		mw.retryMin = time.Second
+	}
+	if mw.retryMax < mw.retryMin {
+		mw.retryMax = mw.retryMin
+	}
+	if mw.poll < time.Second {
+		mw.poll = time.Second
+	}
+	go mw.run()
+	return mw
+}
+
+// Stop - дожидается отправки текущего письма
+func (mw *MailWorker) Stop() {
+	close(mw.stop)
+	<-mw.done
+}
+
+func (mw *MailWorker) run() {
+	defer close(mw.done)
+
+	for {
+		sent, err := mw.sendDue()
+		if err != nil {
+			log.Error("handlers.MailWorker error: %v", err)
+		}
+		if err == nil && sent == mailOutboxBatch {
+			continue // в очереди есть ещё
+		}
+
+		timer := time.NewTimer(mw.poll)
+		select {
+		case <-mw.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		case <-repository.MailEnqueued():
+			timer.Stop()
+		}
+	}
+}
+
+// отправим письма, время которых подошло; вернём, сколько взяли в отправку
+func (mw *MailWorker) sendDue() (int, error) {
+	mailsSlice, jobsSlice, err := mw.ins.ClaimDueMails(mailOutboxBatch, mailOutboxLease)
+	if err != nil {
+		return 0, err
+	}
+	for k, mail := range mailsSlice {
+		select {
+		case <-mw.stop:
+			// остальные взятые письма отправятся после перезапуска (по истечении mailOutboxLease)
+			return k, nil
+		default:
+		}
+
+		sendErr := repository.DeliverMail(jobsSlice[k])
+		if sendErr == nil {
+			if err = mw.ins.MarkMailSent(mail.MailID); err != nil {
+				return k + 1, err
+			}
+			log.Info("handlers.MailWorker mail %d \"%s\" sent", mail.MailID, mail.Subject)
+			continue
+		}
+
+		attempt := mail.AttemptCount + 1
+		final := attempt >= mw.maxAttempts
+		err = mw.ins.MarkMailAttemptFailed(mail.MailID, sendErr.Error(), mw.retryAfter(attempt), final)
+		if err != nil {
+			return k + 1, err
+		}
+		if final {
+			log.Error("handlers.MailWorker mail %d \"%s\" failed after %d attempts: %v", mail.MailID, mail.Subject, attempt, sendErr)
+		} else {
+			log.Error("handlers.MailWorker mail %d \"%s\" attempt %d error: %v", mail.MailID, mail.Subject, attempt, sendErr)
+		}
+	}
+	return len(mailsSlice), nil
+}
+
+// пауза перед попыткой attempt+1: retryMin, 2*retryMin, 4*retryMin ... но не больше retryMax
+func (mw *MailWorker) retryAfter(attempt int) time.Duration {
+	retry := mw.retryMin
+	for k := 1; k < attempt && retry < mw.retryMax; k++ {
+		retry *= 2
+	}
+	if retry > mw.retryMax {
+		retry = mw.retryMax
+	}
+	return retry
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	dom "mdata/internal/domain"
+	"mdata/internal/repository"
+	"mdata/pkg/broker"
+	log "mdata/pkg/logging"
+	"strconv"
+	"time"
+)
+
+//------------------------------------------------------------
+// публикация ленты изменений во внешний брокер (Kafka), чтобы другие сервисы получали изменения master data без опроса /changes.
+// Публикуем из таблицы changes по курсору (publish_cursors), курсор сдвигаем после подтверждения записи брокером:
+// если брокер недоступен - повторяем с нарастающей паузой, события не теряются (но после сбоя возможны повторы -
+// потребитель отсеивает их по changeId). Ключ сообщения - guid user-а, поэтому события одного user-а и его сотрудников
+// попадают в одну партицию по порядку (для подразделений - guid подразделения).
+
+const (
+	publishChangesBatch   = 500
+	publishChangesTimeout = 30 * time.Second
+	publishChangesPoll    = 30 * time.Second // проверка ленты, если уведомлений о новых событиях нет
+	publishRetryMin       = time.Second
+	publishRetryMax       = time.Minute
+)
+
+// ChangesPublisher -.
+type ChangesPublisher struct {
+	ins      *repository.PostgreInstance
+	producer broker.Producer
+	topic    string
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// StartChangesPublisher - публикуем в фоне до Stop
+func StartChangesPublisher(ins *repository.PostgreInstance, producer broker.Producer, topic string) *ChangesPublisher {
+	p := &ChangesPublisher{
+		ins:      ins,
+		producer: producer,
+		topic:    topic,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// Stop - дожидается окончания текущей публикации
+func (p *ChangesPublisher) Stop() {
+	close(p.stop)
+	<-p.done
+}
+
+func (p *ChangesPublisher) run() {
+	defer close(p.done)
+
+	sub := changesHub.Subscribe()
+	defer func() { sub.Close() }()
+
+	retry := time.Duration(0)
+	for {
+		if err := p.publishPending(); err != nil {
+			log.Error("handlers.ChangesPublisher %s error: %v", p.topic, err)
+			// брокер или БД недоступны - повторим через нарастающую паузу
+			if retry *= 2; retry < publishRetryMin {
+				retry = publishRetryMin
+			} else if retry > publishRetryMax {
+				retry = publishRetryMax
+			}
+			select {
+			case <-p.stop:
+				return
+			case <-time.After(retry):
+			}
+			continue
+		}
+		retry = 0
+
+		timer := time.NewTimer(publishChangesPoll)
+		select {
+		case <-p.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		case _, ok := <-sub.C:
+			timer.Stop()
+			if !ok {
+				// отстали от рассылки - подпишемся заново, пропущенное всё равно возьмём из ленты
+				sub = changesHub.Subscribe()
+			}
+		}
+	}
+}
+
+// опубликуем все события после курсора (пачками)
+func (p *ChangesPublisher) publishPending() error {
+	cursor, err := p.ins.GetPublishCursor(p.topic)
+	if err != nil {
+		return err
+	}
+	for {
+		changesSlice, err := p.ins.GetChangesSince(cursor, publishChangesBatch)
+		if err != nil {
+			return err
+		}
+		if len(changesSlice) == 0 {
+			return nil
+		}
+
+		cursor, err = publishChanges(p.producer, p.topic, cursor, changesSlice)
+		if err != nil {
+			return err
+		}
+		if err = p.ins.SetPublishCursor(p.topic, cursor); err != nil {
+			return err
+		}
+		if len(changesSlice) < publishChangesBatch {
+			return nil
+		}
+	}
+}
+
+// опубликуем пачку событий после cursor; вернём новый курсор - последнее событие пачки.
+// Если брокер не подтвердил запись - курсор прежний, пачку опубликуем заново
+func publishChanges(producer broker.Producer, topic string, cursor int64, changesSlice []dom.ChangeEvent) (int64, error) {
+	if len(changesSlice) == 0 {
+		return cursor, nil
+	}
+	msgs := make([]broker.Message, 0, len(changesSlice))
+	for _, change := range changesSlice {
+		msg, err := changeMessage(topic, change)
+		if err != nil {
+			return cursor, err
+		}
+		msgs = append(msgs, msg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), publishChangesTimeout)
+	err := producer.Publish(ctx, msgs...)
+	cancel()
+	if err != nil {
+		return cursor, fmt.Errorf("publish after change %d error: %v", cursor, err)
+	}
+	return changesSlice[len(changesSlice)-1].ChangeID, nil
+}
+
+// сообщение брокера для события ленты: value - событие как в /changes, тип события - в заголовках
+func changeMessage(topic string, change dom.ChangeEvent) (broker.Message, error) {
+	value, err := json.Marshal(change)
+	if err != nil {
+		return broker.Message{}, fmt.Errorf("handlers.changeMessage marshal error: %v", err)
+	}
+	return broker.Message{
+		Topic: topic,
+		Key:   changeUserGUID(change),
+		Value: value,
+		Headers: map[string]string{
+			"eventType": changeEventType(change),
+			"changeId":  strconv.FormatInt(change.ChangeID, 10),
+		},
+	}, nil
+}
+
+// guid user-а события (для сотрудника - из данных события); для подразделения - guid подразделения
+func changeUserGUID(change dom.ChangeEvent) string {
+	if change.Entity == dom.ChangeEntityEmployee && len(change.Data) > 0 {
+		var employee struct {
+			UserGUID string `json:"userGuid"`
+		}
+		if err := json.Unmarshal(change.Data, &employee); err == nil && employee.UserGUID != "" {
+			return employee.UserGUID
+		}
+	}
+	return change.EntityGUID
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	dom "mdata/internal/domain"
+	"mdata/pkg/broker"
+)
+
+const testChangesTopic = "mdata.changes"
+
+func testChange(t *testing.T, changeID int64, entity, entityGUID, changeType string, data interface{}) dom.ChangeEvent {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		t.Fatalf("marshal error: %v", err)
+	}
+	return dom.ChangeEvent{ChangeID: changeID, Entity: entity, EntityGUID: entityGUID, ChangeType: changeType, Data: payload}
+}
+
+func TestChangeUserGUID(t *testing.T) {
+	const userGUID = "11111111-1111-1111-1111-111111111111"
+	const employeeGUID = "22222222-2222-2222-2222-222222222222"
+
+	cases := []struct {
+		name   string
+		change dom.ChangeEvent
+		want   string
+	}{
+		{"user", testChange(t, 1, dom.ChangeEntityUser, userGUID, "create", map[string]string{"userGuid": userGUID}), userGUID},
+		{"employee", testChange(t, 2, dom.ChangeEntityEmployee, employeeGUID, "create", map[string]string{"userGuid": userGUID}), userGUID},
+		{"employee без user-а", testChange(t, 3, dom.ChangeEntityEmployee, employeeGUID, "fire", map[string]string{}), employeeGUID},
+		{"departament", testChange(t, 4, dom.ChangeEntityDepartament, "33333333-3333-3333-3333-333333333333", "update",
+			map[string]string{"userGuid": userGUID}), "33333333-3333-3333-3333-333333333333"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := changeUserGUID(c.change); got != c.want {
+				t.Errorf("changeUserGUID = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+// события одного user-а (и его сотрудников) - в одной партиции по порядку changeId
+func TestPublishChangesPartitionOrder(t *testing.T) {
+	userGUIDs := []string{
+		"11111111-1111-1111-1111-111111111111",
+		"44444444-4444-4444-4444-444444444444",
+		"55555555-5555-5555-5555-555555555555",
+	}
+	employeeGUIDs := []string{
+		"22222222-2222-2222-2222-222222222220",
+		"22222222-2222-2222-2222-222222222221",
+		"22222222-2222-2222-2222-222222222222",
+	}
+	changesSlice := make([]dom.ChangeEvent, 0)
+	changeID := int64(0)
+	for round := 0; round < 3; round++ {
+		for k, userGUID := range userGUIDs {
+			changeID++
+			changesSlice = append(changesSlice, testChange(t, changeID, dom.ChangeEntityUser, userGUID, "update",
+				map[string]string{"userGuid": userGUID}))
+			changeID++
+			changesSlice = append(changesSlice, testChange(t, changeID, dom.ChangeEntityEmployee, employeeGUIDs[k], "update",
+				map[string]string{"userGuid": userGUID}))
+		}
+	}
+
+	memory := broker.NewMemory(4)
+	cursor, err := publishChanges(memory, testChangesTopic, 0, changesSlice)
+	if err != nil {
+		t.Fatalf("publishChanges error: %v", err)
+	}
+	if cursor != changeID {
+		t.Errorf("cursor = %d, want %d", cursor, changeID)
+	}
+	if got := len(memory.Messages(testChangesTopic)); got != len(changesSlice) {
+		t.Fatalf("published %d messages, want %d", got, len(changesSlice))
+	}
+
+	for _, userGUID := range userGUIDs {
+		partitionMsgs := memory.PartitionMessages(testChangesTopic, memory.Partition(userGUID))
+		lastID := int64(0)
+		count := 0
+		for _, msg := range partitionMsgs {
+			if msg.Key != userGUID {
+				continue
+			}
+			var change dom.ChangeEvent
+			if err := json.Unmarshal(msg.Value, &change); err != nil {
+				t.Fatalf("unmarshal error: %v", err)
+			}
+			if change.ChangeID <= lastID {
+				t.Errorf("user %s: change %d after %d", userGUID, change.ChangeID, lastID)
+			}
+			lastID = change.ChangeID
+			count++
+		}
+		if count != 6 {
+			t.Errorf("user %s: %d messages in partition %d, want 6", userGUID, count, memory.Partition(userGUID))
+		}
+	}
+}
+
+// брокер не подтвердил запись - курсор не сдвигается, после восстановления пачка публикуется заново
+func TestPublishChangesFailKeepsCursor(t *testing.T) {
+	const userGUID = "11111111-1111-1111-1111-111111111111"
+	changesSlice := []dom.ChangeEvent{
+		testChange(t, 11, dom.ChangeEntityUser, userGUID, "create", map[string]string{"userGuid": userGUID}),
+		testChange(t, 12, dom.ChangeEntityUser, userGUID, "email", map[string]string{"userGuid": userGUID}),
+	}
+
+	memory := broker.NewMemory(0)
+	memory.FailWith(errors.New("broker unavailable"))
+	cursor, err := publishChanges(memory, testChangesTopic, 10, changesSlice)
+	if err == nil {
+		t.Fatal("publishChanges: error expected")
+	}
+	if cursor != 10 {
+		t.Errorf("cursor = %d after failure, want 10", cursor)
+	}
+	if got := len(memory.Messages(testChangesTopic)); got != 0 {
+		t.Errorf("published %d messages after failure, want 0", got)
+	}
+
+	memory.FailWith(nil)
+	cursor, err = publishChanges(memory, testChangesTopic, cursor, changesSlice)
+	if err != nil {
+		t.Fatalf("publishChanges error: %v", err)
+	}
+	if cursor != 12 {
+		t.Errorf("cursor = %d, want 12", cursor)
+	}
+	if got := len(memory.Messages(testChangesTopic)); got != 2 {
+		t.Errorf("published %d messages, want 2", got)
+	}
+}
@@ -7,14 +7,15 @@ import (
 	"io"
 	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	config "mdata/configs"
 	dom "mdata/internal/domain"
 	"mdata/internal/repository"
 	"mdata/internal/utils"
+	"mdata/pkg/export"
 	log "mdata/pkg/logging"
 )
 
@@ -449,6 +450,20 @@ func RestPutNewUsersWithEmailToCreate1CAccounts(ins *repository.PostgreInstance)
 // Отдаем данные всех работающих (актуальных) сотрудников (все аттрибуты)
 func RestSendActEmployeesAllAttributes(ins *repository.PostgreInstance) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		format, err := takeExportFormat(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if format != exportFormatJSON {
+			restExportEmployees(ins, w, r, format, "employees", ins.GetAllActualUsersAllAttributes, false, nil)
+			return
+		}
+		if len(r.URL.Query()) > 0 {
+			restSendEmployeesPage(ins, w, r, false, nil)
+			return
+		}
 		// получаем весь массив сотрудников, который будем возвращать
 		jsonSliceOfEmployees, err := GetActEmployeesAllAttributes(ins)
 		if err != nil {
@@ -467,6 +482,13 @@ func RestSendUsersFiredFromAllAttributes(ins *repository.PostgreInstance) http.H
 	return func(w http.ResponseWriter, r *http.Request) {
 		var dateFrom time.Time = time.Now()
 
+		format, err := takeExportFormat(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
 		params := r.URL.Query()
 		if len(params) < 1 {
 			w.WriteHeader(http.StatusBadRequest)
@@ -507,6 +529,17 @@ func RestSendUsersFiredFromAllAttributes(ins *repository.PostgreInstance) http.H
 			return
 		}
 
+		if format != exportFormatJSON {
+			firedUsers, err := ins.GetUsersFiredFrom(dateFrom)
+			if err != nil {
+				log.Error("handlers.RestSendUsersFiredFromAllAttributes error: %v", err)
+				http.Error(w, "500 - Something bad happened!", 500)
+				return
+			}
+			writeExport(w, format, "fired-employees", employeesExportTable(firedUsers, nil))
+			return
+		}
+
 		// получаем весь массив сотрудников, который будем возвращать
 		jsonSliceOfEmployees, err := GetFiredEmployeesUsersAllAttributes(ins, dateFrom)
 		if err != nil {
@@ -523,6 +556,20 @@ func RestSendUsersFiredFromAllAttributes(ins *repository.PostgreInstance) http.H
 // Отдаем данные всех работающих (актуальных) сотрудников, у которых есть email-ы (все аттрибуты)
 func RestSendAllEmailEmployeesAllAttributes(ins *repository.PostgreInstance) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		format, err := takeExportFormat(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if format != exportFormatJSON {
+			restExportEmployees(ins, w, r, format, "employees", ins.GetAllActualEmailUsersAllAttributes, true, nil)
+			return
+		}
+		if len(r.URL.Query()) > 0 {
+			restSendEmployeesPage(ins, w, r, true, nil)
+			return
+		}
 		// получаем весь массив сотрудников, который будем возвращать
 		jsonSliceOfEmployees, err := GetAllEmailEmployeesAllAttributes(ins)
 		if err != nil {
@@ -580,6 +627,20 @@ func RestSendEmployeeAllAttributes(ins *repository.PostgreInstance) http.Handler
 // Отдаем данные всех работающих (актуальных) сотрудников (облегчённые аттрибуты)
 func RestSendAllEmployeesLightVersionAttributes(ins *repository.PostgreInstance) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		format, err := takeExportFormat(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if format != exportFormatJSON {
+			restExportEmployees(ins, w, r, format, "employees", ins.GetAllActualUsersLightVersionAttributes, false, repository.LightVersionFields)
+			return
+		}
+		if len(r.URL.Query()) > 0 {
+			restSendEmployeesPage(ins, w, r, false, repository.LightVersionFields)
+			return
+		}
 		// получаем весь массив сотрудников, который будем возвращать
 		jsonSliceOfEmployees, err := GetAllEmployeesLightVersionAttributes(ins)
 		if err != nil {
@@ -596,6 +657,20 @@ func RestSendAllEmployeesLightVersionAttributes(ins *repository.PostgreInstance)
 // Отдаем данные всех работающих (актуальных) сотрудников, у которых есть email-ы (облегчённые аттрибуты)
 func RestSendAllEmailEmployeesLightVersionAttributes(ins *repository.PostgreInstance) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		format, err := takeExportFormat(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if format != exportFormatJSON {
+			restExportEmployees(ins, w, r, format, "employees", ins.GetAllActualEmailUsersLightVersionAttributes, true, repository.LightVersionFields)
+			return
+		}
+		if len(r.URL.Query()) > 0 {
+			restSendEmployeesPage(ins, w, r, true, repository.LightVersionFields)
+			return
+		}
 		// получаем весь массив сотрудников, который будем возвращать
 		jsonSliceOfEmployees, err := GetAllEmailEmployeesLightVersionAttributes(ins)
 		if err != nil {
@@ -609,41 +684,34 @@ func RestSendAllEmailEmployeesLightVersionAttributes(ins *repository.PostgreInst
 	}
 }
 
-type delayStruct struct {
-	delayMap map[string]time.Time
-	mu       sync.RWMutex
-}
-
-func delayStructInit() *delayStruct {
-	return &delayStruct{
-		delayMap: make(map[string]time.Time, 0),
+// Отдаем страницу работающих (актуальных) сотрудников по параметрам запроса (фильтры, limit/offset или cursor, fields=)
+// onlyWithEmail - только user-ы с email-ами, defaultFields - поля, если fields= не задан (nil - все аттрибуты)
+func restSendEmployeesPage(ins *repository.PostgreInstance, w http.ResponseWriter, r *http.Request, onlyWithEmail bool, defaultFields []string) {
+	filter, err := parseEmployeesFilter(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
 	}
-}
-
-func (ds *delayStruct) writeTime(comp string, t time.Time) {
-	ds.mu.Lock()
-	defer ds.mu.Unlock()
-	ds.delayMap[comp] = t
-}
-
-func (ds *delayStruct) getTime(comp string) (time.Time, bool) {
-	ds.mu.RLock()
-	defer ds.mu.RUnlock()
-	t, ok := ds.delayMap[comp]
-	if !ok {
-		t = time.Time{}
+	if onlyWithEmail {
+		hasEmail := true
+		filter.HasEmail = &hasEmail
+	}
+	if len(filter.Fields) == 0 {
+		filter.Fields = defaultFields
 	}
-	return t, ok
-}
 
-func (ds *delayStruct) delRecord(comp string) {
-	ds.mu.Lock()
-	defer ds.mu.Unlock()
-	delete(ds.delayMap, comp)
+	jsonPage, err := GetEmployeesPage(ins, filter)
+	if err != nil {
+		log.Error("handlers.restSendEmployeesPage error: %v", err)
+		http.Error(w, "500 - Something bad happened!", 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonPage)
 }
 
-var globalDelayMap = delayStructInit()
-
 // Отдаем данные одного/группы работающих (актуальных) пользователя(-лей) по одному параметру (обрабатывается как like) (облегчённые аттрибуты)
 func RestSendEmployeeLightVersionAttributes(ins *repository.PostgreInstance) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -670,25 +738,6 @@ func RestSendEmployeeLightVersionAttributes(ins *repository.PostgreInstance) htt
 			w.Write(jsonSliceOfUsersByTabNo)
 			return
 		} else if userName != "" {
-
-			// request from 1C
-			if strings.Contains(r.Header["User-Agent"][0], "Enterprise") {
-				// TODO LRU Cash
-				remAddr := r.RemoteAddr
-				assertLenRemAddr := len(remAddr) - 6
-				remAddr = remAddr[:assertLenRemAddr]
-				t, ok := globalDelayMap.getTime(remAddr)
-				if !ok {
-					globalDelayMap.writeTime(remAddr, time.Now())
-					return
-				}
-				if time.Since(t) < 5*time.Second {
-					globalDelayMap.writeTime(remAddr, time.Now()) // рестартуем таймер
-					return
-				}
-				globalDelayMap.delRecord(remAddr)
-			}
-
 			// получаем весь массив сотрудников, который будем возвращать, т.к. параметр обрабатывается как like
 			jsonSliceOfUsersByName := GetUsersByNameLightVersionAttributes(ins, userName)
 			w.Header().Set("Content-Type", "application/json")
@@ -754,7 +803,7 @@ func RestHandleDebugWriteSingleDepartament(ins *repository.PostgreInstance) http
 		}
 		log.Info(strAnswer)
 		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("200 - ok!"))
+		w.Write([]byte("200 - ok! " + strAnswer))
 		// must return "w" - response ("ok", "200" or not)
 	}
 }
@@ -792,6 +841,225 @@ func RestHandleFromZupAllDepartament(ins *repository.PostgreInstance) http.Handl
 			log.Error("rest handlers.RestHandleFromZupAllDepartament handleAllDepartamentForCRUD error: %v", err)
 		}
 		log.Info("handlers.RestHandleFromZupAllDepartament answer: %s", strAnswer)
+		rw.Write([]byte(strAnswer))
+	}
+}
+
+//------------------------------------------------------------
+// отдать подразделения:
+//   /departaments - все актуальные подразделения (?tree=true - деревом, ?includeClosed=true - вместе с расформированными)
+//   /departaments/{guid} - подразделение с родителями ("хлебные крошки") и деревом потомков
+//   /departaments/{guid}/employees - работающие сотрудники подразделения (?recursive=true - вместе с подчиненными подразделениями)
+//   /departaments/{guid}/headcount - численность по каждому узлу поддерева подразделения
+//   /departaments/{guid}/head - руководитель подразделения (GET; PUT - назначить, DELETE - снять ручное назначение)
+func RestSendDepartaments(ins *repository.PostgreInstance) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// путь: /departaments[/{guid}[/employees|/headcount|/head]]
+		var pathParts []string
+		if strPath := strings.Trim(strings.TrimPrefix(r.URL.Path, "/departaments"), "/"); strPath != "" {
+			pathParts = strings.Split(strPath, "/")
+		}
+
+		if len(pathParts) == 2 && pathParts[1] == "head" && r.Method != http.MethodGet {
+			restSetDepartamentHead(ins, w, r, pathParts[0])
+			return
+		}
+
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("Need GET method. Please try one more time."))
+			return
+		}
+
+		format, err := takeExportFormat(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		params := r.URL.Query()
+		includeClosed, err := parseBoolParam(params.Get("includeClosed"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Wrong parametr includeClosed. Please enter true or false"))
+			return
+		}
+		asTree, err := parseBoolParam(params.Get("tree"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Wrong parametr tree. Please enter true or false"))
+			return
+		}
+		recursive, err := parseBoolParam(params.Get("recursive"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Wrong parametr recursive. Please enter true or false"))
+			return
+		}
+
+		// выгрузка в CSV / XLSX - только списки: подразделения и сотрудники подразделения
+		if format != exportFormatJSON {
+			var t export.Table
+			var fileName string
+			switch {
+			case len(pathParts) == 0:
+				t, err = getDepartamentsForExport(ins, includeClosed)
+				fileName = "departaments"
+			case len(pathParts) == 2 && pathParts[1] == "employees":
+				t, err = getDepartamentEmployeesForExport(ins, pathParts[0], recursive)
+				fileName = "departament-employees"
+			default:
+				w.WriteHeader(http.StatusNotAcceptable)
+				w.Write([]byte("Only json is available for this path"))
+				return
+			}
+			if err != nil {
+				if strings.Contains(err.Error(), "no rows") {
+					http.NotFound(w, r)
+					return
+				}
+				log.Error("handlers.RestSendDepartaments error: %v", err)
+				http.Error(w, "500 - Something bad happened!", 500)
+				return
+			}
+			writeExport(w, format, fileName, t)
+			return
+		}
+
+		var jsonDepartaments []byte
+		switch {
+		case len(pathParts) == 0:
+			jsonDepartaments, err = GetDepartaments(ins, includeClosed, asTree)
+		case len(pathParts) == 1:
+			jsonDepartaments, err = GetDepartamentCard(ins, pathParts[0], includeClosed)
+		case len(pathParts) == 2 && pathParts[1] == "employees":
+			jsonDepartaments, err = GetDepartamentEmployees(ins, pathParts[0], recursive)
+		case len(pathParts) == 2 && pathParts[1] == "headcount":
+			jsonDepartaments, err = GetDepartamentHeadcount(ins, pathParts[0], includeClosed)
+		case len(pathParts) == 2 && pathParts[1] == "head":
+			jsonDepartaments, err = GetDepartamentHead(ins, pathParts[0])
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			if strings.Contains(err.Error(), "no rows") {
+				http.NotFound(w, r)
+				return
+			}
+			log.Error("handlers.RestSendDepartaments error: %v", err)
+			http.Error(w, "500 - Something bad happened!", 500)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonDepartaments)
+	}
+}
+
+// назначить (PUT) руководителя подразделения или снять ручное назначение (DELETE)
+func restSetDepartamentHead(ins *repository.PostgreInstance, w http.ResponseWriter, r *http.Request, depGUID string) {
+	if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Need GET, PUT or DELETE method. Please try one more time."))
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Error("handlers.restSetDepartamentHead: io.ReadAll(Body) %v", err)
+		http.Error(w, "500 - Something bad happened!", 500)
+		return
+	}
+	defer r.Body.Close()
+
+	strAnswer, err := SetDepartamentHead(ins, depGUID, body, r.Method == http.MethodDelete)
+	if err != nil {
+		log.Error("handlers.restSetDepartamentHead error: %v", err)
+		if strings.Contains(err.Error(), "no rows") {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("200 - ok! " + strAnswer))
+}
+
+//------------------------------------------------------------
+// блок "Сотрудники" (по guid сотрудника)
+//   /employees/{guid}/manager-chain - цепочка руководителей сотрудника вверх по оргструктуре (для согласований)
+func RestSendEmployees(ins *repository.PostgreInstance) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("Need GET method. Please try one more time."))
+			return
+		}
+
+		pathParts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/employees"), "/"), "/")
+		if len(pathParts) != 2 || pathParts[0] == "" || pathParts[1] != "manager-chain" {
+			http.NotFound(w, r)
+			return
+		}
+
+		jsonManagerChain, err := GetEmployeeManagerChain(ins, pathParts[0])
+		if err != nil {
+			if strings.Contains(err.Error(), "no rows") {
+				http.NotFound(w, r)
+				return
+			}
+			log.Error("handlers.RestSendEmployees error: %v", err)
+			http.Error(w, "500 - Something bad happened!", 500)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonManagerChain)
+	}
+}
+
+// разбор необязательного параметра true/false (пустой - false)
+func parseBoolParam(param string) (bool, error) {
+	param = strings.TrimSpace(param)
+	if param == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(param)
+}
+
+//------------------------------------------------------------
+// отдать работающих сотрудников, которые числятся в расформированных подразделениях (все аттрибуты)
+func RestSendEmployeesInClosedDepartaments(ins *repository.PostgreInstance) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jsonSliceOfEmployees, err := GetEmployeesInClosedDepartaments(ins)
+		if err != nil {
+			log.Error("handlers.RestSendEmployeesInClosedDepartaments error: %v", err)
+			http.Error(w, "500 - Something bad happened!", 500)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonSliceOfEmployees)
+	}
+}
+
+// запустить поиск сотрудников в расформированных подразделениях и рассылку в отдел кадров
+func RestSendClosedDepartamentsNotifications(ins *repository.PostgreInstance) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		usersCount, err := sendClosedDepartamentsNotifications(ins)
+		if err != nil {
+			log.Error("handlers.RestSendClosedDepartamentsNotifications error: %v", err)
+			http.Error(rw, err.Error(), 500)
+			return
+		}
+		status := fmt.Sprintf("handlers.RestSendClosedDepartamentsNotifications : найдено сотрудников в расформированных подразделениях - %d", usersCount)
+		log.Info(status)
+		rw.WriteHeader(http.StatusOK)
+		rw.Write([]byte(status))
 	}
 }
 
@@ -829,6 +1097,151 @@ func RestSetOOCoupleForBdNotifications(ins *repository.PostgreInstance) http.Han
 	}
 }
 
+//------------------------------------------------------------
+// подписки сотрудника на ДР (для интранета; ответ и ошибки - json как в /api/v1):
+//   GET /bd-subscriptions?observer=<guid> - именинники, подразделения, отказ от рассылки
+//   POST /bd-subscriptions - подписаться (тело - {"observerGuid": ..., "ownerGuid": ...} или {"observerGuid": ..., "ownerTabNumber": ...})
+//   DELETE /bd-subscriptions?observer=<guid>&owner=<guid> - отписаться
+//   POST|DELETE /bd-subscriptions/opt-out?observer=<guid> - отказаться от рассылки / вернуть её
+//   GET|POST|DELETE /bd-subscriptions/calendar?observer=<guid> - ссылка на календарь ДР (.ics): получить / выпустить заново / отозвать.
+//   calendarBaseURL - адрес MD в ссылке (пусто - по запросу)
+func RestBdSubscriptions(ins *repository.PostgreInstance, calendarBaseURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pathParts := apiPathParts(r, "/bd-subscriptions")
+		params := r.URL.Query()
+
+		switch {
+		case len(pathParts) == 1 && pathParts[0] == "opt-out":
+			if !checkAPIMethod(w, r, http.MethodPost, http.MethodDelete) {
+				return
+			}
+			observerGUID, ok := takeBdGUIDParam(w, params.Get("observer"), "observer")
+			if !ok {
+				return
+			}
+			if err := ins.SetBdOptOut(observerGUID, r.Method == http.MethodPost); err != nil {
+				writeAPIErrorFrom(w, "RestBdSubscriptions", err)
+				return
+			}
+			subs, err := ins.GetBdSubscriptions(observerGUID)
+			writeAPIBdSubscriptions(w, http.StatusOK, subs, err)
+
+		case len(pathParts) == 1 && pathParts[0] == "calendar":
+			if !checkAPIMethod(w, r, http.MethodGet, http.MethodPost, http.MethodDelete) {
+				return
+			}
+			observerGUID, ok := takeBdGUIDParam(w, params.Get("observer"), "observer")
+			if !ok {
+				return
+			}
+			switch r.Method {
+			case http.MethodGet:
+				calToken, err := ins.GetBdCalendarToken(observerGUID)
+				calToken.URL = bdCalendarURL(r, calendarBaseURL, calToken.Token)
+				writeAPIBdSubscriptions(w, http.StatusOK, calToken, err)
+
+			case http.MethodPost:
+				// новый токен: прежняя ссылка перестаёт работать
+				calToken, err := ins.IssueBdCalendarToken(observerGUID)
+				calToken.URL = bdCalendarURL(r, calendarBaseURL, calToken.Token)
+				writeAPIBdSubscriptions(w, http.StatusCreated, calToken, err)
+
+			default:
+				if err := ins.DeleteBdCalendarToken(observerGUID); err != nil {
+					writeAPIErrorFrom(w, "RestBdSubscriptions", err)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+			}
+
+		case len(pathParts) == 0:
+			if !checkAPIMethod(w, r, http.MethodGet, http.MethodPost, http.MethodDelete) {
+				return
+			}
+			switch r.Method {
+			case http.MethodGet:
+				observerGUID, ok := takeBdGUIDParam(w, params.Get("observer"), "observer")
+				if !ok {
+					return
+				}
+				subs, err := ins.GetBdSubscriptions(observerGUID)
+				writeAPIBdSubscriptions(w, http.StatusOK, subs, err)
+
+			case http.MethodDelete:
+				observerGUID, ok := takeBdGUIDParam(w, params.Get("observer"), "observer")
+				if !ok {
+					return
+				}
+				ownerGUID, ok := takeBdGUIDParam(w, params.Get("owner"), "owner")
+				if !ok {
+					return
+				}
+				if err := ins.DeleteBdSubscription(observerGUID, ownerGUID); err != nil {
+					writeAPIErrorFrom(w, "RestBdSubscriptions", err)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+
+			default:
+				req := dom.BdSubscriptionRequest{}
+				err := json.NewDecoder(r.Body).Decode(&req)
+				defer r.Body.Close()
+				if err != nil {
+					writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, "wrong body: "+err.Error())
+					return
+				}
+				observerGUID, ok := takeBdGUIDParam(w, req.ObserverGUID, "observerGuid")
+				if !ok {
+					return
+				}
+				ownerTabNumber := strings.TrimSpace(req.OwnerTabNumber)
+				if (strings.TrimSpace(req.OwnerGUID) == "") == (ownerTabNumber == "") {
+					writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, "one of ownerGuid or ownerTabNumber is required")
+					return
+				}
+				var ownerGUID string
+				if ownerTabNumber != "" {
+					// только точное совпадение табельного номера
+					if ownerGUID, err = ins.GetUserGUIDByTabNo(ownerTabNumber); err != nil {
+						writeAPIErrorFrom(w, "RestBdSubscriptions", err)
+						return
+					}
+				} else if ownerGUID, ok = takeBdGUIDParam(w, req.OwnerGUID, "ownerGuid"); !ok {
+					return
+				}
+				owner, err := ins.AddBdSubscription(observerGUID, ownerGUID)
+				writeAPIBdSubscriptions(w, http.StatusCreated, owner, err)
+			}
+
+		default:
+			writeAPIError(w, http.StatusNotFound, apiErrNotFound, "unknown path "+r.URL.Path)
+		}
+	}
+}
+
+// обязательный guid из параметра или тела; при ошибке ответ уже записан
+func takeBdGUIDParam(w http.ResponseWriter, value, name string) (string, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if !uuidRegexp.MatchString(value) {
+		writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, name+" is required: guid expected")
+		return "", false
+	}
+	return value, true
+}
+
+func writeAPIBdSubscriptions(w http.ResponseWriter, status int, v interface{}, err error) {
+	if err != nil {
+		writeAPIErrorFrom(w, "RestBdSubscriptions", err)
+		return
+	}
+	sliceOfByte, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		writeAPIErrorFrom(w, "RestBdSubscriptions", err)
+		return
+	}
+	writeAPIJSON(w, status, sliceOfByte)
+}
+
 //------------------------------------------------------------
 // запустить поиск и рассылку
 func RestSendBdNotifications(ins *repository.PostgreInstance) http.HandlerFunc {
@@ -842,4 +1255,71 @@ func RestSendBdNotifications(ins *repository.PostgreInstance) http.HandlerFunc {
 	}
 }
 
-//------------------------------------------------------------
+//*******************************************
+// лента изменений
+// отдать события (создание, изменение, увольнение user-ов, сотрудников, подразделений) после курсора:
+//   /changes?since=<nextCursor предыдущего ответа>&limit=  (since пустой - с начала, since=now - с текущего места)
+//   &wait=<сек> - если событий пока нет, ждать первого нового (long-poll), не дольше maxWait
+func RestSendChanges(ins *repository.PostgreInstance, maxWait time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("Need GET method. Please try one more time."))
+			return
+		}
+
+		params, err := parseChangesParams(r.URL.Query(), maxWait)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		jsonChanges, err := GetChangesFeed(ins, params)
+		if err != nil {
+			log.Error("handlers.RestSendChanges error: %v", err)
+			http.Error(w, "500 - Something bad happened!", 500)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonChanges)
+	}
+}
+
+// поток событий (Server-Sent Events): /events/stream?types=user.create,user.email,employee.fire
+// при переподключении - заголовок Last-Event-ID (или ?lastEventId=): сначала пропущенные события, потом новые.
+// maxDuration - сколько держать соединение (config: http.stream_max_duration), потом клиент переподключается сам
+func RestEventsStream(ins *repository.PostgreInstance, maxDuration time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("Need GET method. Please try one more time."))
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "500 - Streaming is not supported", 500)
+			return
+		}
+
+		sinceID, replay, err := parseLastEventID(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		filter := parseEventTypesFilter(r.URL.Query().Get("types"))
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no") // чтобы nginx не буферизовал поток
+		w.WriteHeader(http.StatusOK)
+
+		err = streamChanges(ins, w, r, flusher, filter, sinceID, replay, maxDuration)
+		if err != nil {
+			log.Error("handlers.RestEventsStream error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,999 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	dom "mdata/internal/domain"
+	"mdata/internal/repository"
+	"mdata/pkg/export"
+	log "mdata/pkg/logging"
+	"mdata/pkg/mailtmpl"
+)
+
+//*******************************************
+// REST api v1 (/api/v1/...)
+// Ресурсы: users, employees, departaments, positions, exchanges, mail-outbox, mail-templates, notification-types, bd-rules, bd-departament-subscriptions.
+// Ответ - json, ошибки - в едином конверте dom.APIErrorEnvelope.
+// Старые маршруты (/get-act-employees/ и т.д.) оставлены как есть - ими пользуются клиенты 1С.
+
+const APIv1Prefix = "/api/v1"
+
+// коды ошибок api
+const (
+	apiErrBadRequest       = "bad_request"
+	apiErrNotFound         = "not_found"
+	apiErrMethodNotAllowed = "method_not_allowed"
+	apiErrNotAcceptable    = "not_acceptable"
+	apiErrConflict         = "conflict"
+	apiErrInternal         = "internal_error"
+)
+
+//------------------------------------------------------------
+// общие функции
+
+func writeAPIJSON(w http.ResponseWriter, status int, sliceOfByte []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(sliceOfByte)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, code, message string) {
+	envelope := dom.APIErrorEnvelope{Error: dom.APIError{Status: status, Code: code, Message: message}}
+	sliceOfByte, err := json.MarshalIndent(envelope, "", "  ")
+	if err != nil {
+		log.Error("handlers.writeAPIError marshal error: %v", err)
+		http.Error(w, message, status)
+		return
+	}
+	writeAPIJSON(w, status, sliceOfByte)
+}
+
+// ошибка из функций репозитория: "no rows" - 404, "conflict: ..." - 409 с пояснением, остальное - 500 (подробности только в лог)
+func writeAPIErrorFrom(w http.ResponseWriter, funcName string, err error) {
+	if strings.Contains(err.Error(), "no rows") {
+		writeAPIError(w, http.StatusNotFound, apiErrNotFound, "resource not found")
+		return
+	}
+	if i := strings.LastIndex(err.Error(), "conflict: "); i >= 0 {
+		writeAPIError(w, http.StatusConflict, apiErrConflict, err.Error()[i+len("conflict: "):])
+		return
+	}
+	log.Error("handlers.%s error: %v", funcName, err)
+	writeAPIError(w, http.StatusInternalServerError, apiErrInternal, "internal server error")
+}
+
+// проверка метода запроса; если метод не подходит - 405 с заголовком Allow
+func checkAPIMethod(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeAPIError(w, http.StatusMethodNotAllowed, apiErrMethodNotAllowed,
+		fmt.Sprintf("method %s not allowed, use %s", r.Method, strings.Join(methods, ", ")))
+	return false
+}
+
+// части пути после префикса ресурса: /api/v1/departaments/{guid}/head -> [{guid}, head]
+func apiPathParts(r *http.Request, resourcePrefix string) []string {
+	strPath := strings.Trim(strings.TrimPrefix(r.URL.Path, resourcePrefix), "/")
+	if strPath == "" {
+		return nil
+	}
+	return strings.Split(strPath, "/")
+}
+
+// формат ответа (?format= или Accept); при ошибке ответ уже записан.
+// exportable - можно ли отдать этот путь в CSV / XLSX (иначе на такой запрос - 406)
+func takeAPIExportFormat(w http.ResponseWriter, r *http.Request, exportable bool) (string, bool) {
+	format, err := takeExportFormat(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, err.Error())
+		return "", false
+	}
+	if format != exportFormatJSON && !exportable {
+		writeAPIError(w, http.StatusNotAcceptable, apiErrNotAcceptable, "only json is available for "+r.URL.Path)
+		return "", false
+	}
+	return format, true
+}
+
+// выгрузка в CSV / XLSX; ошибки получения данных - в конверте api
+func writeAPIExport(w http.ResponseWriter, funcName, format, fileName string, t export.Table, err error) {
+	if err != nil {
+		if _, ok := err.(errBadExportRequest); ok {
+			writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, err.Error())
+			return
+		}
+		writeAPIErrorFrom(w, funcName, err)
+		return
+	}
+	writeExport(w, format, fileName, t)
+}
+
+// разбор необязательных bool-параметров запроса; при ошибке ответ уже записан
+func parseAPIBoolParams(w http.ResponseWriter, r *http.Request, names ...string) (map[string]bool, bool) {
+	values := make(map[string]bool, len(names))
+	for _, name := range names {
+		value, err := parseBoolParam(r.URL.Query().Get(name))
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, "wrong parametr "+name+": true or false expected")
+			return nil, false
+		}
+		values[name] = value
+	}
+	return values, true
+}
+
+// все неизвестные пути /api/v1/...
+func RestAPIv1NotFound() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusNotFound, apiErrNotFound, "unknown api path "+r.URL.Path)
+	}
+}
+
+// спецификация OpenAPI 3 (собирается при старте в routes)
+func RestSendOpenAPI(spec []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAPIMethod(w, r, http.MethodGet) {
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, spec)
+	}
+}
+
+//------------------------------------------------------------
+// users:
+//   GET /api/v1/users - работающие user-ы: фильтры (?tabno=&name=&departament=&position=&employment=&state=&hasEmail=&bdMonth=),
+//                       постранично (?limit=&offset= или ?limit=&cursor=), выбор полей (?fields=)
+//   GET /api/v1/users/search?tabno=&name=&email=&departament=&position=&limit= - поиск (ФИО - нечётко, с ранжированием)
+//   GET /api/v1/users/fired?from=2006-01-02 - уволенные с даты
+//   GET /api/v1/users/{guid} - user по guid (все сотрудники, все аттрибуты)
+func RestAPIv1Users(ins *repository.PostgreInstance) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAPIMethod(w, r, http.MethodGet) {
+			return
+		}
+
+		pathParts := apiPathParts(r, APIv1Prefix+"/users")
+		format, ok := takeAPIExportFormat(w, r, len(pathParts) == 0 || (len(pathParts) == 1 && pathParts[0] == "fired"))
+		if !ok {
+			return
+		}
+		switch {
+		case len(pathParts) == 0 && format != exportFormatJSON:
+			t, err := getEmployeesForExport(ins, r, ins.GetAllActualUsersAllAttributes, false, nil)
+			writeAPIExport(w, "RestAPIv1Users", format, "employees", t, err)
+
+		case len(pathParts) == 0:
+			filter, err := parseEmployeesFilter(r.URL.Query())
+			if err != nil {
+				writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, err.Error())
+				return
+			}
+
+			jsonPage, err := GetEmployeesPage(ins, filter)
+			if err != nil {
+				writeAPIErrorFrom(w, "RestAPIv1Users", err)
+				return
+			}
+			writeAPIJSON(w, http.StatusOK, jsonPage)
+
+		case len(pathParts) == 1 && pathParts[0] == "search":
+			search, err := parseEmployeesSearch(r.URL.Query())
+			if err != nil {
+				writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, err.Error())
+				return
+			}
+			jsonFound, err := SearchEmployees(ins, search)
+			if err != nil {
+				writeAPIErrorFrom(w, "RestAPIv1Users", err)
+				return
+			}
+			writeAPIJSON(w, http.StatusOK, jsonFound)
+
+		case len(pathParts) == 1 && pathParts[0] == "fired":
+			dateFrom, err := time.Parse("2006-01-02", strings.TrimSpace(r.URL.Query().Get("from")))
+			if err != nil {
+				writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, "wrong parametr from: YYYY-MM-DD expected")
+				return
+			}
+			firedUsers, err := ins.GetUsersFiredFrom(dateFrom)
+			if err != nil {
+				writeAPIErrorFrom(w, "RestAPIv1Users", err)
+				return
+			}
+			if format != exportFormatJSON {
+				writeExport(w, format, "fired-employees", employeesExportTable(firedUsers, nil))
+				return
+			}
+			sliceOfByte, err := json.MarshalIndent(dom.AGUsers{Users: firedUsers}, "", "  ")
+			if err != nil {
+				writeAPIErrorFrom(w, "RestAPIv1Users", err)
+				return
+			}
+			writeAPIJSON(w, http.StatusOK, sliceOfByte)
+
+		case len(pathParts) == 1:
+			if !uuidRegexp.MatchString(pathParts[0]) {
+				writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, "user guid expected")
+				return
+			}
+			usersSlice, err := ins.GetCastomUserListAllAttributes([]string{pathParts[0]})
+			if err != nil {
+				writeAPIErrorFrom(w, "RestAPIv1Users", err)
+				return
+			}
+			if len(usersSlice) == 0 {
+				writeAPIError(w, http.StatusNotFound, apiErrNotFound, "user not found")
+				return
+			}
+			sliceOfByte, err := json.MarshalIndent(usersSlice[0], "", "  ")
+			if err != nil {
+				writeAPIErrorFrom(w, "RestAPIv1Users", err)
+				return
+			}
+			writeAPIJSON(w, http.StatusOK, sliceOfByte)
+
+		default:
+			writeAPIError(w, http.StatusNotFound, apiErrNotFound, "unknown api path "+r.URL.Path)
+		}
+	}
+}
+
+//------------------------------------------------------------
+// employees (по guid сотрудника):
+//   GET /api/v1/employees/{guid} - user с этим сотрудником
+//   GET /api/v1/employees/{guid}/manager-chain - цепочка руководителей сотрудника
+func RestAPIv1Employees(ins *repository.PostgreInstance) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAPIMethod(w, r, http.MethodGet) {
+			return
+		}
+
+		pathParts := apiPathParts(r, APIv1Prefix+"/employees")
+		if len(pathParts) == 0 || len(pathParts) > 2 || (len(pathParts) == 2 && pathParts[1] != "manager-chain") {
+			writeAPIError(w, http.StatusNotFound, apiErrNotFound, "unknown api path "+r.URL.Path)
+			return
+		}
+
+		var sliceOfByte []byte
+		var err error
+		if len(pathParts) == 1 {
+			var user dom.User
+			user, err = ins.GetUserByEmployeeGUIDAllAttributes(pathParts[0])
+			if err == nil {
+				sliceOfByte, err = json.MarshalIndent(user, "", "  ")
+			}
+		} else {
+			sliceOfByte, err = GetEmployeeManagerChain(ins, pathParts[0])
+		}
+		if err != nil {
+			writeAPIErrorFrom(w, "RestAPIv1Employees", err)
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, sliceOfByte)
+	}
+}
+
+//------------------------------------------------------------
+// departaments:
+//   GET /api/v1/departaments (?tree=true, ?includeClosed=true)
+//   GET /api/v1/departaments/{guid} - с родителями и деревом потомков
+//   GET /api/v1/departaments/{guid}/employees (?recursive=true)
+//   GET /api/v1/departaments/{guid}/headcount
+//   GET, PUT, DELETE /api/v1/departaments/{guid}/head
+func RestAPIv1Departaments(ins *repository.PostgreInstance) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pathParts := apiPathParts(r, APIv1Prefix+"/departaments")
+
+		if len(pathParts) == 2 && pathParts[1] == "head" {
+			if !checkAPIMethod(w, r, http.MethodGet, http.MethodPut, http.MethodDelete) {
+				return
+			}
+		} else if !checkAPIMethod(w, r, http.MethodGet) {
+			return
+		}
+
+		if len(pathParts) == 2 && pathParts[1] == "head" && r.Method != http.MethodGet {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				writeAPIErrorFrom(w, "RestAPIv1Departaments", err)
+				return
+			}
+			defer r.Body.Close()
+
+			strAnswer, err := SetDepartamentHead(ins, pathParts[0], body, r.Method == http.MethodDelete)
+			if err != nil {
+				if strings.Contains(err.Error(), "no rows") {
+					writeAPIError(w, http.StatusNotFound, apiErrNotFound, "departament or employee not found")
+					return
+				}
+				writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, err.Error())
+				return
+			}
+			log.Info("handlers.RestAPIv1Departaments: %s", strAnswer)
+			jsonHead, err := GetDepartamentHead(ins, pathParts[0])
+			if err != nil {
+				writeAPIErrorFrom(w, "RestAPIv1Departaments", err)
+				return
+			}
+			writeAPIJSON(w, http.StatusOK, jsonHead)
+			return
+		}
+
+		format, ok := takeAPIExportFormat(w, r, len(pathParts) == 0 || (len(pathParts) == 2 && pathParts[1] == "employees"))
+		if !ok {
+			return
+		}
+		params, ok := parseAPIBoolParams(w, r, "includeClosed", "tree", "recursive")
+		if !ok {
+			return
+		}
+
+		if format != exportFormatJSON {
+			if len(pathParts) == 0 {
+				t, err := getDepartamentsForExport(ins, params["includeClosed"])
+				writeAPIExport(w, "RestAPIv1Departaments", format, "departaments", t, err)
+			} else {
+				t, err := getDepartamentEmployeesForExport(ins, pathParts[0], params["recursive"])
+				writeAPIExport(w, "RestAPIv1Departaments", format, "departament-employees", t, err)
+			}
+			return
+		}
+
+		var sliceOfByte []byte
+		var err error
+		switch {
+		case len(pathParts) == 0:
+			sliceOfByte, err = GetDepartaments(ins, params["includeClosed"], params["tree"])
+		case len(pathParts) == 1:
+			sliceOfByte, err = GetDepartamentCard(ins, pathParts[0], params["includeClosed"])
+		case len(pathParts) == 2 && pathParts[1] == "employees":
+			sliceOfByte, err = GetDepartamentEmployees(ins, pathParts[0], params["recursive"])
+		case len(pathParts) == 2 && pathParts[1] == "headcount":
+			sliceOfByte, err = GetDepartamentHeadcount(ins, pathParts[0], params["includeClosed"])
+		case len(pathParts) == 2 && pathParts[1] == "head":
+			sliceOfByte, err = GetDepartamentHead(ins, pathParts[0])
+		default:
+			writeAPIError(w, http.StatusNotFound, apiErrNotFound, "unknown api path "+r.URL.Path)
+			return
+		}
+		if err != nil {
+			writeAPIErrorFrom(w, "RestAPIv1Departaments", err)
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, sliceOfByte)
+	}
+}
+
+//------------------------------------------------------------
+// positions:
+//   GET /api/v1/positions - должности работающих сотрудников с количеством сотрудников
+func RestAPIv1Positions(ins *repository.PostgreInstance) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAPIMethod(w, r, http.MethodGet) {
+			return
+		}
+		if len(apiPathParts(r, APIv1Prefix+"/positions")) > 0 {
+			writeAPIError(w, http.StatusNotFound, apiErrNotFound, "unknown api path "+r.URL.Path)
+			return
+		}
+
+		positionsSlice, err := ins.GetActualPositions()
+		if err != nil {
+			writeAPIErrorFrom(w, "RestAPIv1Positions", err)
+			return
+		}
+		sliceOfByte, err := json.MarshalIndent(positionsSlice, "", "  ")
+		if err != nil {
+			writeAPIErrorFrom(w, "RestAPIv1Positions", err)
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, sliceOfByte)
+	}
+}
+
+//------------------------------------------------------------
+// exchanges:
+//   GET /api/v1/exchanges (?reason=1, ?failed=true, ?limit=100) - строки обменов, последние - первыми
+//   POST /api/v1/exchanges - зарегистрировать строку к обмену (тело - dom.ExchangeStruct)
+func RestAPIv1Exchanges(ins *repository.PostgreInstance) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAPIMethod(w, r, http.MethodGet, http.MethodPost) {
+			return
+		}
+		if len(apiPathParts(r, APIv1Prefix+"/exchanges")) > 0 {
+			writeAPIError(w, http.StatusNotFound, apiErrNotFound, "unknown api path "+r.URL.Path)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			exch := dom.ExchangeStruct{}
+			err := json.NewDecoder(r.Body).Decode(&exch)
+			if err != nil {
+				writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, "wrong body: "+err.Error())
+				return
+			}
+			defer r.Body.Close()
+			if exch.BaseID == 0 || exch.ReasonID == 0 || strings.TrimSpace(exch.RowData) == "" {
+				writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, "baseID, reasonID and rowData are required")
+				return
+			}
+			err = registerToExchange(ins, &exch)
+			if err != nil {
+				writeAPIErrorFrom(w, "RestAPIv1Exchanges", err)
+				return
+			}
+			sliceOfByte, err := json.MarshalIndent(exch, "", "  ")
+			if err != nil {
+				writeAPIErrorFrom(w, "RestAPIv1Exchanges", err)
+				return
+			}
+			writeAPIJSON(w, http.StatusCreated, sliceOfByte)
+			return
+		}
+
+		params := r.URL.Query()
+		reasonID, limit := 0, 100
+		var err error
+		if param := strings.TrimSpace(params.Get("reason")); param != "" {
+			reasonID, err = strconv.Atoi(param)
+			if err != nil || reasonID < 1 {
+				writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, "wrong parametr reason: positive number expected")
+				return
+			}
+		}
+		if param := strings.TrimSpace(params.Get("limit")); param != "" {
+			limit, err = strconv.Atoi(param)
+			if err != nil || limit < 1 {
+				writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, "wrong parametr limit: positive number expected")
+				return
+			}
+			if limit > maxEmployeesPageLimit {
+				limit = maxEmployeesPageLimit
+			}
+		}
+		boolParams, ok := parseAPIBoolParams(w, r, "failed")
+		if !ok {
+			return
+		}
+
+		exchangesSlice, err := ins.GetExchanges(reasonID, boolParams["failed"], limit)
+		if err != nil {
+			writeAPIErrorFrom(w, "RestAPIv1Exchanges", err)
+			return
+		}
+		sliceOfByte, err := json.MarshalIndent(exchangesSlice, "", "  ")
+		if err != nil {
+			writeAPIErrorFrom(w, "RestAPIv1Exchanges", err)
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, sliceOfByte)
+	}
+}
+
+//------------------------------------------------------------
+// mail-outbox (очередь исходящих писем):
+//   GET /api/v1/mail-outbox (?status=failed|pending|sent|all, по умолчанию failed; ?limit=100) - письма, последние - первыми
+//   POST /api/v1/mail-outbox/{id}/retry - вернуть неотправленное (failed) письмо в очередь
+func RestAPIv1MailOutbox(ins *repository.PostgreInstance) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pathParts := apiPathParts(r, APIv1Prefix+"/mail-outbox")
+
+		if len(pathParts) == 2 && pathParts[1] == "retry" {
+			if !checkAPIMethod(w, r, http.MethodPost) {
+				return
+			}
+			mailID, err := strconv.ParseInt(pathParts[0], 10, 64)
+			if err != nil || mailID < 1 {
+				writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, "wrong mail id: positive number expected")
+				return
+			}
+			mail, err := ins.RetryOutboxMail(mailID)
+			if err != nil {
+				writeAPIErrorFrom(w, "RestAPIv1MailOutbox", err)
+				return
+			}
+			sliceOfByte, err := json.MarshalIndent(mail, "", "  ")
+			if err != nil {
+				writeAPIErrorFrom(w, "RestAPIv1MailOutbox", err)
+				return
+			}
+			writeAPIJSON(w, http.StatusOK, sliceOfByte)
+			return
+		}
+		if len(pathParts) > 0 {
+			writeAPIError(w, http.StatusNotFound, apiErrNotFound, "unknown api path "+r.URL.Path)
+			return
+		}
+		if !checkAPIMethod(w, r, http.MethodGet) {
+			return
+		}
+
+		params := r.URL.Query()
+		status, limit := dom.MailStatusFailed, 100
+		var err error
+		switch param := strings.TrimSpace(params.Get("status")); param {
+		case "":
+		case "all":
+			status = ""
+		case dom.MailStatusPending, dom.MailStatusSent, dom.MailStatusFailed:
+			status = param
+		default:
+			writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, "wrong parametr status: failed, pending, sent or all expected")
+			return
+		}
+		if param := strings.TrimSpace(params.Get("limit")); param != "" {
+			limit, err = strconv.Atoi(param)
+			if err != nil || limit < 1 {
+				writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, "wrong parametr limit: positive number expected")
+				return
+			}
+			if limit > maxEmployeesPageLimit {
+				limit = maxEmployeesPageLimit
+			}
+		}
+
+		mailsSlice, err := ins.GetOutboxMails(status, limit)
+		if err != nil {
+			writeAPIErrorFrom(w, "RestAPIv1MailOutbox", err)
+			return
+		}
+		sliceOfByte, err := json.MarshalIndent(mailsSlice, "", "  ")
+		if err != nil {
+			writeAPIErrorFrom(w, "RestAPIv1MailOutbox", err)
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, sliceOfByte)
+	}
+}
+
+//------------------------------------------------------------
+// mail-templates (шаблоны писем рассылок):
+//   GET /api/v1/mail-templates - все шаблоны (custom - изменён через api)
+//   GET /api/v1/mail-templates/{key} - шаблон; PUT - изменить (тело - subject, html, text); DELETE - вернуть шаблон по умолчанию
+//   GET|POST /api/v1/mail-templates/{key}/preview (?view=html|text) - письмо по шаблону на данных-примере;
+//     POST - предпросмотр правки до сохранения (тело - как в PUT, пустые части - из действующего шаблона)
+func RestAPIv1MailTemplates(ins *repository.PostgreInstance) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pathParts := apiPathParts(r, APIv1Prefix+"/mail-templates")
+
+		switch {
+		case len(pathParts) == 0:
+			if !checkAPIMethod(w, r, http.MethodGet) {
+				return
+			}
+			templatesSlice, err := ins.GetMailTemplates()
+			writeAPIMailTemplate(w, templatesSlice, err)
+
+		case len(pathParts) == 1:
+			if !checkAPIMethod(w, r, http.MethodGet, http.MethodPut, http.MethodDelete) {
+				return
+			}
+			key := pathParts[0]
+			switch r.Method {
+			case http.MethodGet:
+				t, err := ins.GetMailTemplate(key)
+				writeAPIMailTemplate(w, t, err)
+			case http.MethodDelete:
+				t, err := ins.DeleteMailTemplate(key)
+				writeAPIMailTemplate(w, t, err)
+			default:
+				t, ok := readAPIMailTemplate(w, r, ins, key)
+				if !ok {
+					return
+				}
+				if err := repository.CheckMailTemplate(t); err != nil {
+					writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, "wrong template: "+err.Error())
+					return
+				}
+				t, err := ins.SaveMailTemplate(t)
+				writeAPIMailTemplate(w, t, err)
+			}
+
+		case len(pathParts) == 2 && pathParts[1] == "preview":
+			if !checkAPIMethod(w, r, http.MethodGet, http.MethodPost) {
+				return
+			}
+			key := pathParts[0]
+			var t dom.MailTemplate
+			var ok bool
+			if r.Method == http.MethodPost {
+				if t, ok = readAPIMailTemplate(w, r, ins, key); !ok {
+					return
+				}
+			} else {
+				var err error
+				if t, err = ins.GetMailTemplate(key); err != nil {
+					writeAPIErrorFrom(w, "RestAPIv1MailTemplates", err)
+					return
+				}
+			}
+			rendered, err := mailtmpl.Render(mailtmpl.Template{Subject: t.Subject, HTML: t.HTML, Text: t.Text}, repository.MailTemplateSample(key))
+			if err != nil {
+				writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, "wrong template: "+err.Error())
+				return
+			}
+
+			switch strings.TrimSpace(r.URL.Query().Get("view")) {
+			case "":
+				sliceOfByte, err := json.MarshalIndent(rendered, "", "  ")
+				if err != nil {
+					writeAPIErrorFrom(w, "RestAPIv1MailTemplates", err)
+					return
+				}
+				writeAPIJSON(w, http.StatusOK, sliceOfByte)
+			case "html":
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				w.Write([]byte(rendered.HTML))
+			case "text":
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				w.Write([]byte("Subject: " + rendered.Subject + "\n\n" + rendered.Text))
+			default:
+				writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, "wrong parametr view: html or text expected")
+			}
+
+		default:
+			writeAPIError(w, http.StatusNotFound, apiErrNotFound, "unknown api path "+r.URL.Path)
+		}
+	}
+}
+
+// правка шаблона из тела запроса; пустые части - из действующего шаблона. При ошибке ответ уже записан
+func readAPIMailTemplate(w http.ResponseWriter, r *http.Request, ins *repository.PostgreInstance, key string) (dom.MailTemplate, bool) {
+	t, err := ins.GetMailTemplate(key)
+	if err != nil {
+		writeAPIErrorFrom(w, "RestAPIv1MailTemplates", err)
+		return t, false
+	}
+
+	edit := dom.MailTemplate{}
+	err = json.NewDecoder(r.Body).Decode(&edit)
+	defer r.Body.Close()
+	if err != nil && err != io.EOF {
+		writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, "wrong body: "+err.Error())
+		return t, false
+	}
+	if edit.Subject != "" {
+		t.Subject = edit.Subject
+	}
+	if edit.HTML != "" {
+		t.HTML = edit.HTML
+	}
+	if edit.Text != "" {
+		t.Text = edit.Text
+	}
+	return t, true
+}
+
+func writeAPIMailTemplate(w http.ResponseWriter, v interface{}, err error) {
+	if err != nil {
+		writeAPIErrorFrom(w, "RestAPIv1MailTemplates", err)
+		return
+	}
+	sliceOfByte, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		writeAPIErrorFrom(w, "RestAPIv1MailTemplates", err)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, sliceOfByte)
+}
+
+//------------------------------------------------------------
+// notification-types (типы рассылок и подписчики):
+//   GET /api/v1/notification-types - все типы; POST - добавить (тело - {"name": ...})
+//   GET|PUT|DELETE /api/v1/notification-types/{id} - тип; PUT - переименовать; DELETE - удалить (встроенные и с подписчиками - 409)
+//   GET /api/v1/notification-types/{id}/subscribers - подписчики; POST - подписать (тело - {"userGuid": ...} или {"email": ...})
+//   DELETE /api/v1/notification-types/{id}/subscribers/{subscriberId} - отписать
+func RestAPIv1NotificationTypes(ins *repository.PostgreInstance) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pathParts := apiPathParts(r, APIv1Prefix+"/notification-types")
+
+		if len(pathParts) == 0 {
+			if !checkAPIMethod(w, r, http.MethodGet, http.MethodPost) {
+				return
+			}
+			if r.Method == http.MethodGet {
+				typesSlice, err := ins.GetNotificationTypes()
+				writeAPINotifications(w, http.StatusOK, typesSlice, err)
+				return
+			}
+			name, ok := readAPINotificationTypeName(w, r)
+			if !ok {
+				return
+			}
+			notiType, err := ins.AddNotificationType(name)
+			writeAPINotifications(w, http.StatusCreated, notiType, err)
+			return
+		}
+
+		notiTypeID, err := strconv.Atoi(pathParts[0])
+		if err != nil || notiTypeID < 1 {
+			writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, "wrong notification type id: positive number expected")
+			return
+		}
+
+		switch {
+		case len(pathParts) == 1:
+			if !checkAPIMethod(w, r, http.MethodGet, http.MethodPut, http.MethodDelete) {
+				return
+			}
+			switch r.Method {
+			case http.MethodGet:
+				notiType, err := ins.GetNotificationType(notiTypeID)
+				writeAPINotifications(w, http.StatusOK, notiType, err)
+			case http.MethodPut:
+				name, ok := readAPINotificationTypeName(w, r)
+				if !ok {
+					return
+				}
+				notiType, err := ins.RenameNotificationType(notiTypeID, name)
+				writeAPINotifications(w, http.StatusOK, notiType, err)
+			default:
+				if err := ins.DeleteNotificationType(notiTypeID); err != nil {
+					writeAPIErrorFrom(w, "RestAPIv1NotificationTypes", err)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+			}
+
+		case len(pathParts) == 2 && pathParts[1] == "subscribers":
+			if !checkAPIMethod(w, r, http.MethodGet, http.MethodPost) {
+				return
+			}
+			if r.Method == http.MethodGet {
+				subscribersSlice, err := ins.GetNotificationSubscribers(notiTypeID)
+				writeAPINotifications(w, http.StatusOK, subscribersSlice, err)
+				return
+			}
+
+			subscriber := dom.NotificationSubscriber{}
+			err := json.NewDecoder(r.Body).Decode(&subscriber)
+			defer r.Body.Close()
+			if err != nil && err != io.EOF {
+				writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, "wrong body: "+err.Error())
+				return
+			}
+			subscriber.UserGUID = strings.TrimSpace(subscriber.UserGUID)
+			subscriber.Email = strings.TrimSpace(subscriber.Email)
+			if (subscriber.UserGUID == "") == (subscriber.Email == "") {
+				writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, "one of userGuid or email is required")
+				return
+			}
+			if subscriber.UserGUID != "" && !uuidRegexp.MatchString(subscriber.UserGUID) {
+				writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, "wrong userGuid")
+				return
+			}
+			if subscriber.Email != "" {
+				address, err := mail.ParseAddress(subscriber.Email)
+				if err != nil || address.Address != subscriber.Email {
+					writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, "wrong email: plain address expected")
+					return
+				}
+			}
+			subscriber, err = ins.AddNotificationSubscriber(notiTypeID, subscriber.UserGUID, subscriber.Email)
+			writeAPINotifications(w, http.StatusCreated, subscriber, err)
+
+		case len(pathParts) == 3 && pathParts[1] == "subscribers":
+			if !checkAPIMethod(w, r, http.MethodDelete) {
+				return
+			}
+			subscriberID, err := strconv.ParseInt(pathParts[2], 10, 64)
+			if err != nil || subscriberID < 1 {
+				writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, "wrong subscriber id: positive number expected")
+				return
+			}
+			if err = ins.DeleteNotificationSubscriber(notiTypeID, subscriberID); err != nil {
+				writeAPIErrorFrom(w, "RestAPIv1NotificationTypes", err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			writeAPIError(w, http.StatusNotFound, apiErrNotFound, "unknown api path "+r.URL.Path)
+		}
+	}
+}
+
+// имя типа рассылки из тела запроса. При ошибке ответ уже записан
+func readAPINotificationTypeName(w http.ResponseWriter, r *http.Request) (string, bool) {
+	notiType := dom.NotificationType{}
+	err := json.NewDecoder(r.Body).Decode(&notiType)
+	defer r.Body.Close()
+	if err != nil && err != io.EOF {
+		writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, "wrong body: "+err.Error())
+		return "", false
+	}
+	notiType.Name = strings.TrimSpace(notiType.Name)
+	if notiType.Name == "" {
+		writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, "name is required")
+		return "", false
+	}
+	return notiType.Name, true
+}
+
+func writeAPINotifications(w http.ResponseWriter, status int, v interface{}, err error) {
+	if err != nil {
+		writeAPIErrorFrom(w, "RestAPIv1NotificationTypes", err)
+		return
+	}
+	sliceOfByte, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		writeAPIErrorFrom(w, "RestAPIv1NotificationTypes", err)
+		return
+	}
+	writeAPIJSON(w, status, sliceOfByte)
+}
+
+//------------------------------------------------------------
+// bd-rules (правила рассылки о днях рождения):
+//   GET /api/v1/bd-rules - все правила (общее - первым)
+//   GET|PUT /api/v1/bd-rules/global - общее правило (для observer-ов без своего)
+//   GET|PUT|DELETE /api/v1/bd-rules/{observerGuid} - правило observer-а; DELETE - снова действует общее
+//   тело PUT - {"leadDays": [1, 3], "weeklyDay": 5, "monthlyLeadDays": 4, "skipWeekends": true, "timeZone": "Europe/Moscow"}
+func RestAPIv1BdRules(ins *repository.PostgreInstance) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pathParts := apiPathParts(r, APIv1Prefix+"/bd-rules")
+
+		switch len(pathParts) {
+		case 0:
+			if !checkAPIMethod(w, r, http.MethodGet) {
+				return
+			}
+			rulesSlice, err := ins.GetBdRules()
+			writeAPIBdRule(w, rulesSlice, err)
+
+		case 1:
+			observerGUID := ""
+			if pathParts[0] != "global" {
+				observerGUID = pathParts[0]
+				if !uuidRegexp.MatchString(observerGUID) {
+					writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, "wrong observer guid: guid or global expected")
+					return
+				}
+				if !checkAPIMethod(w, r, http.MethodGet, http.MethodPut, http.MethodDelete) {
+					return
+				}
+			} else if !checkAPIMethod(w, r, http.MethodGet, http.MethodPut) {
+				return
+			}
+
+			switch r.Method {
+			case http.MethodGet:
+				rule, err := ins.GetBdRule(observerGUID)
+				writeAPIBdRule(w, rule, err)
+			case http.MethodDelete:
+				if err := ins.DeleteBdRule(observerGUID); err != nil {
+					writeAPIErrorFrom(w, "RestAPIv1BdRules", err)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				rule := dom.BdRule{}
+				err := json.NewDecoder(r.Body).Decode(&rule)
+				defer r.Body.Close()
+				if err != nil {
+					writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, "wrong body: "+err.Error())
+					return
+				}
+				rule.ObserverGUID = observerGUID
+				if err = repository.CheckBdRule(&rule); err != nil {
+					writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, "wrong rule: "+err.Error())
+					return
+				}
+				rule, err = ins.SaveBdRule(rule)
+				writeAPIBdRule(w, rule, err)
+			}
+
+		default:
+			writeAPIError(w, http.StatusNotFound, apiErrNotFound, "unknown api path "+r.URL.Path)
+		}
+	}
+}
+
+func writeAPIBdRule(w http.ResponseWriter, v interface{}, err error) {
+	if err != nil {
+		writeAPIErrorFrom(w, "RestAPIv1BdRules", err)
+		return
+	}
+	sliceOfByte, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		writeAPIErrorFrom(w, "RestAPIv1BdRules", err)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, sliceOfByte)
+}
+
+//------------------------------------------------------------
+// bd-departament-subscriptions (подписки observer-ов на ДР сотрудников подразделения; именинники - на момент рассылки):
+//   GET /api/v1/bd-departament-subscriptions (?observer=guid) - подписки
+//   POST /api/v1/bd-departament-subscriptions - подписать (тело - {"observerGuid": ..., "departamentGuid": ..., "recursive": true};
+//     departamentGuid пуст - подразделения, где работает observer)
+//   DELETE /api/v1/bd-departament-subscriptions/{subscriptionId} - отписать
+func RestAPIv1BdDepSubscriptions(ins *repository.PostgreInstance) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pathParts := apiPathParts(r, APIv1Prefix+"/bd-departament-subscriptions")
+
+		switch len(pathParts) {
+		case 0:
+			if !checkAPIMethod(w, r, http.MethodGet, http.MethodPost) {
+				return
+			}
+			if r.Method == http.MethodGet {
+				observerGUID := strings.TrimSpace(r.URL.Query().Get("observer"))
+				if observerGUID != "" && !uuidRegexp.MatchString(observerGUID) {
+					writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, "wrong parametr observer: guid expected")
+					return
+				}
+				subsSlice, err := ins.GetBdDepSubscriptions(observerGUID)
+				if err != nil {
+					writeAPIErrorFrom(w, "RestAPIv1BdDepSubscriptions", err)
+					return
+				}
+				sliceOfByte, err := json.MarshalIndent(subsSlice, "", "  ")
+				if err != nil {
+					writeAPIErrorFrom(w, "RestAPIv1BdDepSubscriptions", err)
+					return
+				}
+				writeAPIJSON(w, http.StatusOK, sliceOfByte)
+				return
+			}
+
+			sub := dom.BdDepartamentSubscription{}
+			err := json.NewDecoder(r.Body).Decode(&sub)
+			defer r.Body.Close()
+			if err != nil {
+				writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, "wrong body: "+err.Error())
+				return
+			}
+			sub.ObserverGUID = strings.TrimSpace(sub.ObserverGUID)
+			sub.DepartamentGUID = strings.TrimSpace(sub.DepartamentGUID)
+			if !uuidRegexp.MatchString(sub.ObserverGUID) {
+				writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, "observerGuid is required")
+				return
+			}
+			if sub.DepartamentGUID != "" && !uuidRegexp.MatchString(sub.DepartamentGUID) {
+				writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, "wrong departamentGuid")
+				return
+			}
+			sub, err = ins.AddBdDepSubscription(sub)
+			if err != nil {
+				writeAPIErrorFrom(w, "RestAPIv1BdDepSubscriptions", err)
+				return
+			}
+			sliceOfByte, err := json.MarshalIndent(sub, "", "  ")
+			if err != nil {
+				writeAPIErrorFrom(w, "RestAPIv1BdDepSubscriptions", err)
+				return
+			}
+			writeAPIJSON(w, http.StatusCreated, sliceOfByte)
+
+		case 1:
+			if !checkAPIMethod(w, r, http.MethodDelete) {
+				return
+			}
+			subscriptionID, err := strconv.ParseInt(pathParts[0], 10, 64)
+			if err != nil || subscriptionID < 1 {
+				writeAPIError(w, http.StatusBadRequest, apiErrBadRequest, "wrong subscription id: positive number expected")
+				return
+			}
+			if err = ins.DeleteBdDepSubscription(subscriptionID); err != nil {
+				writeAPIErrorFrom(w, "RestAPIv1BdDepSubscriptions", err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			writeAPIError(w, http.StatusNotFound, apiErrNotFound, "unknown api path "+r.URL.Path)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	config "mdata/configs"
+	dom "mdata/internal/domain"
+	"mdata/internal/repository"
+	"mdata/internal/utils"
+	log "mdata/pkg/logging"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//*********************************************************************************
+// дайджесты отдела кадров: годовщины работы (на следующую неделю) и принятые / уволенные (за прошедшую неделю).
+// Получатели - типы рассылок NotiTypeWorkAnniversaries и NotiTypeStaffChanges; запуск - как и рассылки о ДР, по расписанию
+
+const staffDigestDateLayout = "2006-01-02"
+
+// период по умолчанию для годовщин - следующая неделя (пн - вс)
+func workAnniversariesPeriod(now time.Time) (time.Time, time.Time) {
+	return utils.NextWeek(now)
+}
+
+// период по умолчанию для принятых и уволенных - семь дней до сегодня
+func staffChangesPeriod(now time.Time) (time.Time, time.Time) {
+	today := utils.StartOfThisDay(now)
+	return today.AddDate(0, 0, -7), today.AddDate(0, 0, -1)
+}
+
+// период из ?from=&to= (YYYY-MM-DD, оба или ни одного); без параметров - по умолчанию
+func parseStaffDigestPeriod(r *http.Request, defaultPeriod func(time.Time) (time.Time, time.Time)) (time.Time, time.Time, error) {
+	paramFrom := strings.TrimSpace(r.URL.Query().Get("from"))
+	paramTo := strings.TrimSpace(r.URL.Query().Get("to"))
+	if paramFrom == "" && paramTo == "" {
+		from, to := defaultPeriod(time.Now())
+		return from, to, nil
+	}
+	from, err := time.Parse(staffDigestDateLayout, paramFrom)
+	if err != nil {
+		return from, from, fmt.Errorf("wrong from %q: YYYY-MM-DD expected", paramFrom)
+	}
+	to, err := time.Parse(staffDigestDateLayout, paramTo)
+	if err != nil {
+		return from, to, fmt.Errorf("wrong to %q: YYYY-MM-DD expected", paramTo)
+	}
+	if to.Before(from) || to.Sub(from) > 366*24*time.Hour {
+		return from, to, fmt.Errorf("wrong period %s - %s: up to a year expected", paramFrom, paramTo)
+	}
+	return from, to, nil
+}
+
+func staffDigestPeriodTitle(from, to time.Time) string {
+	return from.Format("02.01.2006") + " - " + to.Format("02.01.2006")
+}
+
+// "07.03 - Иванов Иван Иванович (таб. № 8337), менеджер"
+func staffDigestLine(date time.Time, empl dom.StaffDigestEmployee) string {
+	line := date.Format("02.01") + " - " + empl.UserName + " (таб. № " + empl.TabNumber + ")"
+	if empl.PositionDescr != "" {
+		line += ", " + empl.PositionDescr
+	}
+	return line
+}
+
+func staffDigestDepTitle(empl dom.StaffDigestEmployee) string {
+	if empl.DepartamentDescr == "" {
+		return "Без подразделения"
+	}
+	return empl.DepartamentDescr
+}
+
+func yearsWord(n int) string {
+	switch {
+	case n%10 == 1 && n%100 != 11:
+		return "год"
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return "года"
+	}
+	return "лет"
+}
+
+//---------------------------------------
+
+// отправим в отдел кадров годовщины работы за период. Возвращаем количество сотрудников
+func sendWorkAnniversariesNotifications(ins *repository.PostgreInstance, from, to time.Time) (int, error) {
+	emplSlice, err := ins.GetWorkAnniversariesByDates(from, to)
+	if err != nil {
+		return 0, fmt.Errorf("handlers.sendWorkAnniversariesNotifications error: %v", err)
+	}
+	if len(emplSlice) == 0 {
+		return 0, nil
+	}
+
+	recipients, err := ins.GetNotificationRecipients(config.NotiTypeWorkAnniversaries)
+	if err != nil {
+		return len(emplSlice), fmt.Errorf("handlers.sendWorkAnniversariesNotifications GetRecipients error: %v", err)
+	}
+	bccAdmin := ins.GetBccAdmin()
+
+	// сотрудники уже упорядочены по подразделениям и датам
+	data := dom.MailWorkAnniversariesData{Period: staffDigestPeriodTitle(from, to)}
+	for _, empl := range emplSlice {
+		depTitle := staffDigestDepTitle(empl)
+		if k := len(data.Departaments) - 1; k < 0 || data.Departaments[k].Title != depTitle {
+			data.Departaments = append(data.Departaments, dom.MailClosedDepartament{Title: depTitle})
+		}
+		dep := &data.Departaments[len(data.Departaments)-1]
+		dep.Employees = append(dep.Employees,
+			staffDigestLine(empl.Date.Time, empl)+", "+strconv.Itoa(empl.Years)+" "+yearsWord(empl.Years))
+	}
+
+	err = ins.SendMailByTemplate(dom.MailTemplateWorkAnniversaries, recipients, bccAdmin, data, "")
+	if err != nil {
+		return len(emplSlice), fmt.Errorf("handlers.sendWorkAnniversariesNotifications SendMailByTemplate error: %v", err)
+	}
+
+	log.Info("notifications handlers.sendWorkAnniversariesNotifications OK: %d employees", len(emplSlice))
+	return len(emplSlice), nil
+}
+
+// отправим в отдел кадров принятых и уволенных за период. Возвращаем количество сотрудников
+func sendStaffChangesNotifications(ins *repository.PostgreInstance, from, to time.Time) (int, error) {
+	hired, fired, err := ins.GetStaffChangesByDates(from, to)
+	if err != nil {
+		return 0, fmt.Errorf("handlers.sendStaffChangesNotifications error: %v", err)
+	}
+	count := len(hired) + len(fired)
+	if count == 0 {
+		return 0, nil
+	}
+
+	recipients, err := ins.GetNotificationRecipients(config.NotiTypeStaffChanges)
+	if err != nil {
+		return count, fmt.Errorf("handlers.sendStaffChangesNotifications GetRecipients error: %v", err)
+	}
+	bccAdmin := ins.GetBccAdmin()
+
+	// тело: принятые и уволенные по подразделениям
+	depsMap := make(map[string]*dom.MailStaffChangesDepartament)
+	depsOrder := make([]string, 0)
+	depOf := func(empl dom.StaffDigestEmployee) *dom.MailStaffChangesDepartament {
+		depTitle := staffDigestDepTitle(empl)
+		if _, ok := depsMap[depTitle]; !ok {
+			depsMap[depTitle] = &dom.MailStaffChangesDepartament{Title: depTitle}
+			depsOrder = append(depsOrder, depTitle)
+		}
+		return depsMap[depTitle]
+	}
+	for _, empl := range hired {
+		dep := depOf(empl)
+		dep.Hired = append(dep.Hired, staffDigestLine(empl.StateDate.Time, empl))
+	}
+	for _, empl := range fired {
+		dep := depOf(empl)
+		dep.Fired = append(dep.Fired, staffDigestLine(empl.StateDate.Time, empl))
+	}
+	sort.Strings(depsOrder)
+
+	data := dom.MailStaffChangesData{Period: staffDigestPeriodTitle(from, to)}
+	for _, depTitle := range depsOrder {
+		data.Departaments = append(data.Departaments, *depsMap[depTitle])
+	}
+
+	err = ins.SendMailByTemplate(dom.MailTemplateStaffChanges, recipients, bccAdmin, data, "")
+	if err != nil {
+		return count, fmt.Errorf("handlers.sendStaffChangesNotifications SendMailByTemplate error: %v", err)
+	}
+
+	log.Info("notifications handlers.sendStaffChangesNotifications OK: hired %d, fired %d", len(hired), len(fired))
+	return count, nil
+}
+
+//------------------------------------------------------------
+// отдать годовщины работы за период (?from=&to=, по умолчанию - следующая неделя)
+func RestSendWorkAnniversaries(ins *repository.PostgreInstance) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from, to, err := parseStaffDigestPeriod(r, workAnniversariesPeriod)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		emplSlice, err := ins.GetWorkAnniversariesByDates(from, to)
+		if err != nil {
+			log.Error("handlers.RestSendWorkAnniversaries error: %v", err)
+			http.Error(w, "500 - Something bad happened!", 500)
+			return
+		}
+		writeStaffDigestJSON(w, "RestSendWorkAnniversaries", &dom.WorkAnniversaries{
+			From: from.Format(staffDigestDateLayout), To: to.Format(staffDigestDateLayout), Employees: emplSlice})
+	}
+}
+
+// отдать принятых и уволенных за период (?from=&to=, по умолчанию - семь дней до сегодня)
+func RestSendStaffChanges(ins *repository.PostgreInstance) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from, to, err := parseStaffDigestPeriod(r, staffChangesPeriod)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		hired, fired, err := ins.GetStaffChangesByDates(from, to)
+		if err != nil {
+			log.Error("handlers.RestSendStaffChanges error: %v", err)
+			http.Error(w, "500 - Something bad happened!", 500)
+			return
+		}
+		writeStaffDigestJSON(w, "RestSendStaffChanges", &dom.StaffChanges{
+			From: from.Format(staffDigestDateLayout), To: to.Format(staffDigestDateLayout), Hired: hired, Fired: fired})
+	}
+}
+
+func writeStaffDigestJSON(w http.ResponseWriter, funcName string, v interface{}) {
+	sliceOfByte, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		log.Error("handlers.%s marshal error: %v", funcName, err)
+		http.Error(w, "500 - Something bad happened!", 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(sliceOfByte)
+}
+
+// запустить рассылку в отдел кадров о годовщинах работы (?from=&to=, по умолчанию - следующая неделя)
+func RestSendWorkAnniversariesNotifications(ins *repository.PostgreInstance) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		from, to, err := parseStaffDigestPeriod(r, workAnniversariesPeriod)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		count, err := sendWorkAnniversariesNotifications(ins, from, to)
+		if err != nil {
+			log.Error("handlers.RestSendWorkAnniversariesNotifications error: %v", err)
+			http.Error(rw, err.Error(), 500)
+			return
+		}
+		status := fmt.Sprintf("handlers.RestSendWorkAnniversariesNotifications : годовщин работы за %s - %d", staffDigestPeriodTitle(from, to), count)
+		log.Info(status)
+		rw.WriteHeader(http.StatusOK)
+		rw.Write([]byte(status))
+	}
+}
+
+// запустить рассылку в отдел кадров о принятых и уволенных (?from=&to=, по умолчанию - семь дней до сегодня)
+func RestSendStaffChangesNotifications(ins *repository.PostgreInstance) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		from, to, err := parseStaffDigestPeriod(r, staffChangesPeriod)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		count, err := sendStaffChangesNotifications(ins, from, to)
+		if err != nil {
+			log.Error("handlers.RestSendStaffChangesNotifications error: %v", err)
+			http.Error(rw, err.Error(), 500)
+			return
+		}
+		status := fmt.Sprintf("handlers.RestSendStaffChangesNotifications : принятых и уволенных за %s - %d", staffDigestPeriodTitle(from, to), count)
+		log.Info(status)
+		rw.WriteHeader(http.StatusOK)
+		rw.Write([]byte(status))
+	}
+}
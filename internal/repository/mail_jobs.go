@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"mdata/internal/domain"
+	"mdata/pkg/broker"
+	log "mdata/pkg/logging"
+)
+
+// отправка писем через почтовый сервис: DeliverMail публикует задание в топик почты вместо SMTP.
+// Задаётся при запуске (config.Kafka.KafkaMailJobs), по умолчанию письма уходят через SMTP
+
+const mailJobPublishTimeout = 30 * time.Second
+
+var (
+	mailProducer broker.Producer
+	mailTopic    string
+	mailUsers    *PostgreInstance // где искать user-а адресата (ключ задания)
+)
+
+// SetMailProducer - nil - снова отправлять через SMTP. ins - по адресу ищем user-а для ключа задания
+func SetMailProducer(producer broker.Producer, topic string, ins *PostgreInstance) {
+	mailProducer = producer
+	mailTopic = topic
+	mailUsers = ins
+}
+
+// ключ задания - guid user-а адресата, как у событий master data: письма одному человеку идут в одну партицию по порядку.
+// Если user-а с таким email нет или их несколько (общий ящик), либо БД недоступна - ключ сам адрес
+func mailJobKey(ins *PostgreInstance, to []string) string {
+	addr := mailJobAddr(to)
+	if ins == nil || addr == "" {
+		return addr
+	}
+	userGUID, err := ins.getUserGUIDByEmail(addr)
+	if err != nil {
+		log.Error("repository.mailJobKey error: %v", err)
+		return addr
+	}
+	if userGUID == "" {
+		return addr
+	}
+	return userGUID
+}
+
+// адресат задания (нижний регистр). Почти все письма - одному адресату; у письма нескольким адресатам -
+// наименьший адрес, а не весь список: от порядка и состава списка ключ не зависит
+func mailJobAddr(to []string) string {
+	key := ""
+	for _, addr := range to {
+		addr = strings.ToLower(strings.TrimSpace(addr))
+		if addr != "" && (key == "" || addr < key) {
+			key = addr
+		}
+	}
+	return key
+}
+
+// guid единственного user-а с email (без учёта регистра и пробелов), "" - такого нет или их несколько
+func (i *PostgreInstance) getUserGUIDByEmail(email string) (string, error) {
+	rows, err := i.Db.Query(context.Background(),
+		"select user_guid from users where lower(trim(email)) = $1 limit 2;", email)
+	if err != nil {
+		return "", fmt.Errorf("repository.getUserGUIDByEmail error: %v", err)
+	}
+	defer rows.Close()
+
+	guids := make([]string, 0, 2)
+	for rows.Next() {
+		var userGUID string
+		if err = rows.Scan(&userGUID); err != nil {
+			return "", fmt.Errorf("repository.getUserGUIDByEmail scan error: %v", err)
+		}
+		guids = append(guids, userGUID)
+	}
+	if len(guids) != 1 {
+		return "", nil
+	}
+	return guids[0], nil
+}
+
+// опубликуем задание на отправку (ключ - mailJobKey)
+func publishMailJob(job domain.MailJob) error {
+	value, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("repository.publishMailJob marshal error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mailJobPublishTimeout)
+	defer cancel()
+	err = mailProducer.Publish(ctx, broker.Message{
+		Topic:   mailTopic,
+		Key:     mailJobKey(mailUsers, job.To),
+		Value:   value,
+		Headers: map[string]string{"subject": job.Subject},
+	})
+	if err != nil {
+		return fmt.Errorf("repository.publishMailJob error: %v", err)
+	}
+	return nil
+}
+
+//---------------------------------------
+// очередь исходящих (mail_outbox): задаётся при запуске (config.MailOutbox), без неё письма отправляются сразу
+
+var (
+	mailOutbox     *PostgreInstance
+	mailOutboxWake = make(chan struct{}, 1)
+)
+
+// SetMailOutbox - nil - отправлять сразу, без очереди
+func SetMailOutbox(ins *PostgreInstance) {
+	mailOutbox = ins
+}
+
+// MailEnqueued - сигнал обработчику очереди, что появилось новое письмо (чтобы не ждать очередного опроса)
+func MailEnqueued() <-chan struct{} {
+	return mailOutboxWake
+}
+
+func enqueueMail(job domain.MailJob) error {
+	_, err := mailOutbox.EnqueueMail(job)
+	if err != nil {
+		return err
+	}
+	select {
+	case mailOutboxWake <- struct{}{}:
+	default: // обработчик уже разбужен
+	}
+	return nil
+}
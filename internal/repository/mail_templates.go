@@ -0,0 +1,281 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	config "mdata/configs"
+	"mdata/internal/domain"
+	log "mdata/pkg/logging"
+	"mdata/pkg/mailtmpl"
+
+	"github.com/jackc/pgx/v4"
+)
+
+//***************************************************************************************
+// Шаблоны писем рассылок. Шаблоны по умолчанию - ниже; изменённые через api хранятся в таблице mail_templates
+// и действуют вместо них без передеплоя. Данные для заполнения - domain.Mail...Data
+
+const (
+	mailFooterText = "\n" +
+		"---------- \n" +
+		"Your notification center\n"
+	mailFooterHTML = `<hr><p style="color: #888888; font-size: 12px;">Your notification center</p>` + "\n"
+
+	mailHTMLBegin = `<html><body style="font-family: Arial, sans-serif; font-size: 14px;">` + "\n"
+	mailHTMLEnd   = "</body></html>\n"
+)
+
+var defaultMailTemplates = []domain.MailTemplate{
+	{
+		Key:         domain.MailTemplateBirthdays,
+		Description: "Наблюдателям о днях рождения (завтра, через три дня, на следующей неделе, в следующем месяце)",
+		Subject:     "Birthdays notification",
+		HTML: mailHTMLBegin +
+			`{{range .Periods}}<p><b>{{.Title}}</b></p>` + "\n" +
+			`<ul>{{range .Owners}}<li>{{.Name}} ({{.Birthday}})</li>{{end}}</ul>` + "\n" +
+			`{{end}}` + mailFooterHTML + mailHTMLEnd,
+		Text: "{{range .Periods}}-------------------------- \n" +
+			"{{.Title}}\n" +
+			"{{range .Owners}}        {{.Name}} ({{.Birthday}}) \n{{end}}" +
+			"{{end}}" + mailFooterText,
+	},
+	{
+		Key:         domain.MailTemplateBuchEmails,
+		Description: "В бухгалтерию о загрузке email-ов в 1С:ЗУП (по пятницам, вложение - файл с email-ами)",
+		NotiType:    config.NotiTypeBuch,
+		Subject:     "Emails file",
+		HTML: mailHTMLBegin +
+			`<p>Email-ы сотрудников, заполненные на {{.Week}} неделе. Отправлено - {{.Date}}г.</p>` + "\n" +
+			mailFooterHTML + mailHTMLEnd,
+		Text: "Email-ы сотрудников, заполненные на {{.Week}} неделе. Отправлено - {{.Date}}г.\n" + mailFooterText,
+	},
+	{
+		Key:         domain.MailTemplate1CCreateUser,
+		Description: "В 1C:CreateUser о выгрузке новых user-ов для автоматического создания пользователей (итог или ошибка)",
+		NotiType:    config.NotiType1CCreateUser,
+		Subject:     "В 1C:CreateUser о новом user-е с email",
+		HTML: mailHTMLBegin +
+			`<p>Попытка выгрузить следующих пользователей для автоматического создания</p>` + "\n" +
+			`<ul>{{range .Users}}<li>{{.Name}} (код = {{.ID}})</li>{{end}}</ul>` + "\n" +
+			`{{if .Error}}<p>Завершилась с ошибкой:</p><pre>{{.Error}}</pre>{{else}}<p>Завершилась успехом</p>{{end}}` + "\n" +
+			mailFooterHTML + mailHTMLEnd,
+		Text: "Попытка выгрузить следующих пользователей для автоматического создания \n" +
+			"{{range .Users}}-------------------------- \n" +
+			"        {{.Name}} (код = {{.ID}}) \n{{end}}" +
+			"-------------------------- \n" +
+			"{{if .Error}}Завершилась с ошибкой: \n{{.Error}}\n{{else}}Завершилась успехом \n{{end}}" + mailFooterText,
+	},
+	{
+		Key:         domain.MailTemplate1CCreateUserStatus,
+		Description: "В 1C:CreateUser о статусах выгрузки новых user-ов (ответ 1С)",
+		NotiType:    config.NotiType1CCreateUser,
+		Subject:     "В 1C:CreateUser о новом user-е с email",
+		HTML: mailHTMLBegin +
+			`<p>Статусы выгрузки пользователей для автоматического создания</p>` + "\n" +
+			`<table border="1" cellpadding="4" cellspacing="0">` +
+			`<tr><th>Пользователь</th><th>Код</th><th>Статус</th></tr>` +
+			`{{range .Users}}<tr><td>{{.Name}}</td><td>{{.ID}}</td><td>{{.Status}}</td></tr>{{end}}</table>` + "\n" +
+			mailFooterHTML + mailHTMLEnd,
+		Text: "Статусы выгрузки пользователей для автоматического создания \n" +
+			"{{range .Users}}-------------------------- \n" +
+			"        {{.Name}} (код = {{.ID}})   |   {{.Status}} \n{{end}}" + mailFooterText,
+	},
+	{
+		Key:         domain.MailTemplateClosedDepartaments,
+		Description: "В отдел кадров о работающих сотрудниках в расформированных подразделениях",
+		NotiType:    config.NotiTypeClosedDepartaments,
+		Subject:     "Сотрудники в расформированных подразделениях",
+		HTML: mailHTMLBegin +
+			`<p>Работающие сотрудники числятся в расформированных подразделениях. Необходимо перевести их в 1С:ЗУП.</p>` + "\n" +
+			`{{range .Departaments}}<p><b>{{.Title}}</b></p>` + "\n" +
+			`<ul>{{range .Employees}}<li>{{.}}</li>{{end}}</ul>` + "\n" +
+			`{{end}}` + mailFooterHTML + mailHTMLEnd,
+		Text: "Работающие сотрудники числятся в расформированных подразделениях. Необходимо перевести их в 1С:ЗУП. \n" +
+			"{{range .Departaments}}-------------------------- \n" +
+			"{{.Title}}\n" +
+			"{{range .Employees}}        {{.}} \n{{end}}" +
+			"{{end}}" + mailFooterText,
+	},
+	{
+		Key:         domain.MailTemplateWorkAnniversaries,
+		Description: "В отдел кадров о годовщинах работы на следующей неделе (по подразделениям)",
+		NotiType:    config.NotiTypeWorkAnniversaries,
+		Subject:     "Годовщины работы",
+		HTML: mailHTMLBegin +
+			`<p>Годовщины работы в компании ({{.Period}}):</p>` + "\n" +
+			`{{range .Departaments}}<p><b>{{.Title}}</b></p>` + "\n" +
+			`<ul>{{range .Employees}}<li>{{.}}</li>{{end}}</ul>` + "\n" +
+			`{{end}}` + mailFooterHTML + mailHTMLEnd,
+		Text: "Годовщины работы в компании ({{.Period}}): \n" +
+			"{{range .Departaments}}-------------------------- \n" +
+			"{{.Title}}\n" +
+			"{{range .Employees}}        {{.}} \n{{end}}" +
+			"{{end}}" + mailFooterText,
+	},
+	{
+		Key:         domain.MailTemplateStaffChanges,
+		Description: "В отдел кадров о принятых и уволенных за неделю (по подразделениям)",
+		NotiType:    config.NotiTypeStaffChanges,
+		Subject:     "Принятые и уволенные за неделю",
+		HTML: mailHTMLBegin +
+			`<p>Принятые и уволенные сотрудники ({{.Period}}):</p>` + "\n" +
+			`{{range .Departaments}}<p><b>{{.Title}}</b></p>` + "\n" +
+			`{{if .Hired}}<p>Приняты:</p><ul>{{range .Hired}}<li>{{.}}</li>{{end}}</ul>{{end}}` + "\n" +
+			`{{if .Fired}}<p>Уволены:</p><ul>{{range .Fired}}<li>{{.}}</li>{{end}}</ul>{{end}}` + "\n" +
+			`{{end}}` + mailFooterHTML + mailHTMLEnd,
+		Text: "Принятые и уволенные сотрудники ({{.Period}}): \n" +
+			"{{range .Departaments}}-------------------------- \n" +
+			"{{.Title}}\n" +
+			"{{if .Hired}}    Приняты: \n{{range .Hired}}        {{.}} \n{{end}}{{end}}" +
+			"{{if .Fired}}    Уволены: \n{{range .Fired}}        {{.}} \n{{end}}{{end}}" +
+			"{{end}}" + mailFooterText,
+	},
+}
+
+// данные-примеры для предпросмотра и проверки шаблонов
+var mailTemplatesSamples = map[string]interface{}{
+	domain.MailTemplateBirthdays: domain.MailBirthdaysData{Periods: []domain.MailBirthdaysPeriod{
+		{Title: "Завтра день рождения у: ", Owners: []domain.MailBirthdayOwner{{Name: "Иванов Иван Иванович", Birthday: "24-02-1985"}}},
+		{Title: "На следующей неделе день рождения у: ", Owners: []domain.MailBirthdayOwner{
+			{Name: "Петрова Анна Сергеевна", Birthday: "02-03-1990"}, {Name: "Сидоров Пётр Алексеевич", Birthday: "05-03-1979"}}},
+	}},
+	domain.MailTemplateBuchEmails: domain.MailBuchEmailsData{Week: "8", Date: "24.02.2023"},
+	domain.MailTemplate1CCreateUser: domain.Mail1CCreateUserData{
+		Users: []domain.Mail1CUser{{Name: "Иванов Иван Иванович", ID: "0000000123"}},
+		Error: "1C:CreateUser response status: 500 Internal Server Error",
+	},
+	domain.MailTemplate1CCreateUserStatus: domain.Mail1CCreateUserData{Users: []domain.Mail1CUser{
+		{Name: "Иванов Иван Иванович", ID: "0000000123", Status: "Success"},
+		{Name: "Петрова Анна Сергеевна", ID: "0000000456", Status: "MD. Информация не доступна."},
+	}},
+	domain.MailTemplateClosedDepartaments: domain.MailClosedDepartamentsData{Departaments: []domain.MailClosedDepartament{
+		{Title: "Отдел снабжения (расформировано 01.02.2023)", Employees: []string{"Иванов Иван Иванович (таб. № 8337)"}},
+	}},
+	domain.MailTemplateWorkAnniversaries: domain.MailWorkAnniversariesData{Period: "06.03.2023 - 12.03.2023", Departaments: []domain.MailClosedDepartament{
+		{Title: "Отдел снабжения", Employees: []string{"07.03 - Иванов Иван Иванович (таб. № 8337), 10 лет"}},
+	}},
+	domain.MailTemplateStaffChanges: domain.MailStaffChangesData{Period: "27.02.2023 - 05.03.2023", Departaments: []domain.MailStaffChangesDepartament{
+		{Title: "Отдел снабжения", Hired: []string{"01.03 - Петрова Анна Сергеевна (таб. № 9012), менеджер"},
+			Fired: []string{"03.03 - Сидоров Пётр Алексеевич (таб. № 7001), кладовщик"}},
+	}},
+}
+
+func defaultMailTemplate(key string) (domain.MailTemplate, bool) {
+	for _, t := range defaultMailTemplates {
+		if t.Key == key {
+			return t, true
+		}
+	}
+	return domain.MailTemplate{}, false
+}
+
+// MailTemplateSample - данные-пример для шаблона key
+func MailTemplateSample(key string) interface{} {
+	return mailTemplatesSamples[key]
+}
+
+// CheckMailTemplate - шаблон разбирается и заполняется данными-примером (так находим и ошибки в именах полей)
+func CheckMailTemplate(t domain.MailTemplate) error {
+	_, err := mailtmpl.Render(mailtmpl.Template{Subject: t.Subject, HTML: t.HTML, Text: t.Text}, MailTemplateSample(t.Key))
+	return err
+}
+
+//---------------------------------------
+
+// вернём все шаблоны (изменённые - из БД, остальные - по умолчанию)
+func (i *PostgreInstance) GetMailTemplates() ([]domain.MailTemplate, error) {
+	templatesSlice := make([]domain.MailTemplate, 0, len(defaultMailTemplates))
+	for _, t := range defaultMailTemplates {
+		curTemplate, err := i.GetMailTemplate(t.Key)
+		if err != nil {
+			return templatesSlice, err
+		}
+		templatesSlice = append(templatesSlice, curTemplate)
+	}
+	return templatesSlice, nil
+}
+
+// вернём действующий шаблон. "no rows" - нет такого шаблона
+func (i *PostgreInstance) GetMailTemplate(key string) (domain.MailTemplate, error) {
+	t, ok := defaultMailTemplate(key)
+	if !ok {
+		return t, fmt.Errorf("no rows: repository.GetMailTemplate error: unknown template %s", key)
+	}
+
+	var updatedAt time.Time
+	err := i.Db.QueryRow(context.Background(),
+		"select subject, html_body, text_body, updated_at from mail_templates where template_key = $1;", key).
+		Scan(&t.Subject, &t.HTML, &t.Text, &updatedAt)
+	if err == pgx.ErrNoRows {
+		return t, nil
+	} else if err != nil {
+		return t, fmt.Errorf("repository.GetMailTemplate error: %v", err)
+	}
+	t.Custom = true
+	t.UpdatedAt = &updatedAt
+	return t, nil
+}
+
+// сохраним изменённый шаблон (тема, html, текст). Шаблон должен быть проверен CheckMailTemplate
+func (i *PostgreInstance) SaveMailTemplate(t domain.MailTemplate) (domain.MailTemplate, error) {
+	if _, ok := defaultMailTemplate(t.Key); !ok {
+		return t, fmt.Errorf("no rows: repository.SaveMailTemplate error: unknown template %s", t.Key)
+	}
+	_, err := i.Db.Exec(context.Background(),
+		"INSERT INTO mail_templates (template_key, subject, html_body, text_body) VALUES ($1, $2, $3, $4) "+
+			"    ON CONFLICT (template_key) DO UPDATE SET subject = EXCLUDED.subject, html_body = EXCLUDED.html_body, "+
+			"        text_body = EXCLUDED.text_body, updated_at = now();",
+		t.Key, t.Subject, t.HTML, t.Text)
+	if err != nil {
+		return t, fmt.Errorf("repository.SaveMailTemplate error: %v", err)
+	}
+	return i.GetMailTemplate(t.Key)
+}
+
+// вернём шаблону вид по умолчанию
+func (i *PostgreInstance) DeleteMailTemplate(key string) (domain.MailTemplate, error) {
+	if _, ok := defaultMailTemplate(key); !ok {
+		return domain.MailTemplate{}, fmt.Errorf("no rows: repository.DeleteMailTemplate error: unknown template %s", key)
+	}
+	_, err := i.Db.Exec(context.Background(), "DELETE FROM mail_templates WHERE template_key = $1;", key)
+	if err != nil {
+		return domain.MailTemplate{}, fmt.Errorf("repository.DeleteMailTemplate error: %v", err)
+	}
+	return i.GetMailTemplate(key)
+}
+
+// заполним действующий шаблон key данными. Если изменённый шаблон не читается из БД или не заполняется -
+// пишем в лог и заполняем шаблон по умолчанию: из-за неудачной правки рассылка не должна пропасть
+func (i *PostgreInstance) RenderMailTemplate(key string, data interface{}) (mailtmpl.Rendered, error) {
+	t, err := i.GetMailTemplate(key)
+	if err != nil {
+		log.Error("repository.RenderMailTemplate %s error: %v", key, err)
+		var ok bool
+		if t, ok = defaultMailTemplate(key); !ok {
+			return mailtmpl.Rendered{}, err
+		}
+	}
+
+	rendered, err := mailtmpl.Render(mailtmpl.Template{Subject: t.Subject, HTML: t.HTML, Text: t.Text}, data)
+	if err != nil && t.Custom {
+		log.Error("repository.RenderMailTemplate %s custom template error: %v", key, err)
+		t, _ = defaultMailTemplate(key)
+		rendered, err = mailtmpl.Render(mailtmpl.Template{Subject: t.Subject, HTML: t.HTML, Text: t.Text}, data)
+	}
+	if err != nil {
+		return rendered, fmt.Errorf("repository.RenderMailTemplate %s error: %v", key, err)
+	}
+	return rendered, nil
+}
+
+// SendMailByTemplate - письмо по шаблону key. attachment - путь к файлу вложения (пусто - без вложения)
+func (i *PostgreInstance) SendMailByTemplate(key string, to []string, bccAdmin string, data interface{}, attachment string) error {
+	rendered, err := i.RenderMailTemplate(key, data)
+	if err != nil {
+		log.Error("repository.SendMailByTemplate error: %v", err)
+		return err
+	}
+	return SendRenderedMail(to, bccAdmin, rendered, attachment)
+}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"mdata/internal/domain"
+
+	"github.com/jackc/pgx/v4"
+)
+
+//***************************************************************************************
+// Календарь ДР observer-а (.ics, /bd-calendar/<token>.ics): те же пары observer - именинник, что и в рассылке (см. bdPairsCTE).
+// Доступ - по случайному токену (таблица bd_calendar_tokens); токен можно перевыпустить или отозвать
+
+const bdCalendarTokenBytes = 24
+
+func newBdCalendarToken() (string, error) {
+	b := make([]byte, bdCalendarTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// токен observer-а. "no rows" - календарь не выпущен
+func (ins *PostgreInstance) GetBdCalendarToken(observerGUID string) (domain.BdCalendarToken, error) {
+	calToken := domain.BdCalendarToken{}
+	var createdAt time.Time
+	err := ins.Db.QueryRow(context.Background(),
+		"select cast(observer_guid as text), token, created_at from bd_calendar_tokens where observer_guid = $1;",
+		observerGUID).Scan(&calToken.ObserverGUID, &calToken.Token, &createdAt)
+	if err == pgx.ErrNoRows {
+		return calToken, fmt.Errorf("no rows: repository.GetBdCalendarToken error: no calendar for observer %s", observerGUID)
+	} else if err != nil {
+		return calToken, fmt.Errorf("repository.GetBdCalendarToken error: %v", err)
+	}
+	calToken.CreatedAt = &createdAt
+	return calToken, nil
+}
+
+// выпустим токен observer-у; если он уже был - заменим (старая ссылка перестаёт работать). "no rows" - нет такого user-а
+func (ins *PostgreInstance) IssueBdCalendarToken(observerGUID string) (domain.BdCalendarToken, error) {
+	usersSlice, err := ins.GetUsersBySliceOfGUID([]string{observerGUID})
+	if err != nil {
+		return domain.BdCalendarToken{}, fmt.Errorf("repository.IssueBdCalendarToken error: %v", err)
+	}
+	if len(usersSlice) == 0 {
+		return domain.BdCalendarToken{}, fmt.Errorf("no rows: repository.IssueBdCalendarToken error: no user %s", observerGUID)
+	}
+
+	token, err := newBdCalendarToken()
+	if err != nil {
+		return domain.BdCalendarToken{}, fmt.Errorf("repository.IssueBdCalendarToken error: %v", err)
+	}
+	_, err = ins.Db.Exec(context.Background(),
+		"INSERT INTO bd_calendar_tokens (observer_guid, token, created_at) VALUES ($1, $2, now()) "+
+			"    ON CONFLICT (observer_guid) DO UPDATE SET token = excluded.token, created_at = excluded.created_at;",
+		observerGUID, token)
+	if err != nil {
+		return domain.BdCalendarToken{}, fmt.Errorf("repository.IssueBdCalendarToken error: %v", err)
+	}
+	return ins.GetBdCalendarToken(observerGUID)
+}
+
+// отзовём токен. "no rows" - календарь не выпущен
+func (ins *PostgreInstance) DeleteBdCalendarToken(observerGUID string) error {
+	commandTag, err := ins.Db.Exec(context.Background(), "DELETE FROM bd_calendar_tokens WHERE observer_guid = $1;", observerGUID)
+	if err != nil {
+		return fmt.Errorf("repository.DeleteBdCalendarToken error: %v", err)
+	}
+	if commandTag.RowsAffected() == 0 {
+		return fmt.Errorf("no rows: repository.DeleteBdCalendarToken error: no calendar for observer %s", observerGUID)
+	}
+	return nil
+}
+
+//---------------------------------------
+
+// observer по токену и все его именинники (по порядку дат в году). "no rows" - нет такого токена.
+// Отказ от рассылки (bd_opt_outs) календарь не отключает - его отключают отзывом токена
+func (ins *PostgreInstance) GetBdCalendarByToken(token string) (domain.BdObserver, error) {
+	observer := domain.BdObserver{Owners: make([]domain.User, 0)}
+
+	err := ins.Db.QueryRow(context.Background(),
+		"select cast(usr.user_guid as text), usr.user_name, usr.email "+
+			"    from bd_calendar_tokens t "+
+			"        inner join users usr on t.observer_guid = usr.user_guid "+
+			"    where t.token = $1;", token).Scan(&observer.ObserverGUID, &observer.ObserverName, &observer.Email)
+	if err == pgx.ErrNoRows {
+		return observer, fmt.Errorf("no rows: repository.GetBdCalendarByToken error: unknown token")
+	} else if err != nil {
+		return observer, fmt.Errorf("repository.GetBdCalendarByToken error: %v", err)
+	}
+
+	bd_usrs_query := bdPairsCTE("$2", "$3") +
+		" select cast(usr1.user_guid as text), usr1.user_name, usr1.user_id, usr1.user_birthday " +
+		"     from bd_pairs bd " +
+		"         inner join users usr1 on bd.owner_guid = cast(usr1.user_guid as text) " +
+		"     where bd.observer_guid = $1 and usr1.user_birthday is not null " +
+		"     order by extract(month from usr1.user_birthday), extract(day from usr1.user_birthday), usr1.user_name;"
+
+	rows, err := ins.Db.Query(context.Background(), bd_usrs_query, observer.ObserverGUID, maxDepartamentsDepth, "%Работ%")
+	if err == pgx.ErrNoRows {
+		return observer, nil
+	} else if err != nil {
+		return observer, fmt.Errorf("repository.GetBdCalendarByToken error: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		curBdOwner := domain.User{}
+		err = rows.Scan(&curBdOwner.UserGUID, &curBdOwner.UserName, &curBdOwner.UserID, &curBdOwner.UserBirthday)
+		if err != nil {
+			return observer, fmt.Errorf("repository.GetBdCalendarByToken scan error: %v", err)
+		}
+		observer.Owners = append(observer.Owners, curBdOwner)
+	}
+	return observer, nil
+}
+
+// политика для родившихся 29 февраля (см. SetBdFeb29Policy) - календарь строится по ней же
+func BdFeb29Policy() string {
+	return bdFeb29Policy
+}
@@ -0,0 +1,260 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"mdata/internal/domain"
+
+	"github.com/jackc/pgx/v4"
+)
+
+//***************************************************************************************
+// Правила рассылки о днях рождения (таблица bd_rules): общее правило (observer_guid пуст) действует для всех observer-ов,
+// у которых нет своего. Правила управляются через api /api/v1/bd-rules
+
+const (
+	maxBdLeadDays        = 60
+	maxBdMonthlyLeadDays = 27
+)
+
+const bdRulesQuery = "select coalesce(cast(r.observer_guid as text), ''), coalesce(usr.user_name, ''), " +
+	"        r.lead_days, r.weekly_day, r.monthly_lead_days, r.skip_weekends, r.time_zone, r.updated_at " +
+	"    from bd_rules r " +
+	"        left join users usr on r.observer_guid = usr.user_guid "
+
+// проверим правило и приведём дни оповещения к порядку (по возрастанию, без повторов)
+func CheckBdRule(rule *domain.BdRule) error {
+	leadDays := make([]int, 0, len(rule.LeadDays))
+	seen := make(map[int]bool)
+	for _, days := range rule.LeadDays {
+		if days < 1 || days > maxBdLeadDays {
+			return fmt.Errorf("wrong leadDays %d: 1-%d expected", days, maxBdLeadDays)
+		}
+		if !seen[days] {
+			seen[days] = true
+			leadDays = append(leadDays, days)
+		}
+	}
+	sort.Ints(leadDays)
+	rule.LeadDays = leadDays
+
+	if rule.WeeklyDay < -1 || rule.WeeklyDay > 6 {
+		return fmt.Errorf("wrong weeklyDay %d: 0 (sunday) - 6 (saturday) or -1 (no digest) expected", rule.WeeklyDay)
+	}
+	if rule.MonthlyLeadDays < 0 || rule.MonthlyLeadDays > maxBdMonthlyLeadDays {
+		return fmt.Errorf("wrong monthlyLeadDays %d: 0-%d expected", rule.MonthlyLeadDays, maxBdMonthlyLeadDays)
+	}
+	rule.TimeZone = strings.TrimSpace(rule.TimeZone)
+	if _, err := BdRuleLocation(*rule); err != nil {
+		return err
+	}
+	return nil
+}
+
+// часовой пояс правила; пусто - время сервера
+func BdRuleLocation(rule domain.BdRule) (*time.Location, error) {
+	if rule.TimeZone == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(rule.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("wrong timeZone %s: %v", rule.TimeZone, err)
+	}
+	return loc, nil
+}
+
+func scanBdRule(row pgx.Row) (domain.BdRule, error) {
+	rule := domain.BdRule{}
+	var updatedAt time.Time
+	err := row.Scan(&rule.ObserverGUID, &rule.ObserverName, &rule.LeadDays, &rule.WeeklyDay, &rule.MonthlyLeadDays,
+		&rule.SkipWeekends, &rule.TimeZone, &updatedAt)
+	if err != nil {
+		return rule, err
+	}
+	rule.UpdatedAt = &updatedAt
+	return rule, nil
+}
+
+//---------------------------------------
+
+// все правила: общее - первым, затем правила observer-ов по ФИО
+func (ins *PostgreInstance) GetBdRules() ([]domain.BdRule, error) {
+	rulesSlice := make([]domain.BdRule, 0)
+
+	rows, err := ins.Db.Query(context.Background(),
+		bdRulesQuery+" order by r.observer_guid is not null, usr.user_name;")
+	if err == pgx.ErrNoRows {
+		return rulesSlice, nil
+	} else if err != nil {
+		return rulesSlice, fmt.Errorf("repository.GetBdRules error: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		rule, err := scanBdRule(rows)
+		if err != nil {
+			return rulesSlice, fmt.Errorf("repository.GetBdRules scan error: %v", err)
+		}
+		rulesSlice = append(rulesSlice, rule)
+	}
+	return rulesSlice, nil
+}
+
+// правило observer-а (observerGUID пуст - общее). "no rows" - своего правила нет
+func (ins *PostgreInstance) GetBdRule(observerGUID string) (domain.BdRule, error) {
+	var row pgx.Row
+	if observerGUID == "" {
+		row = ins.Db.QueryRow(context.Background(), bdRulesQuery+" where r.observer_guid is null;")
+	} else {
+		row = ins.Db.QueryRow(context.Background(), bdRulesQuery+" where r.observer_guid = $1;", observerGUID)
+	}
+	rule, err := scanBdRule(row)
+	if err == pgx.ErrNoRows {
+		return rule, fmt.Errorf("no rows: repository.GetBdRule error: no rule for observer %s", observerGUID)
+	} else if err != nil {
+		return rule, fmt.Errorf("repository.GetBdRule error: %v", err)
+	}
+	return rule, nil
+}
+
+// запишем правило (новое или вместо прежнего). Правило должно быть проверено CheckBdRule. "no rows" - нет такого user-а
+func (ins *PostgreInstance) SaveBdRule(rule domain.BdRule) (domain.BdRule, error) {
+	var observerParam interface{}
+	if rule.ObserverGUID != "" {
+		usersSlice, err := ins.GetUsersBySliceOfGUID([]string{rule.ObserverGUID})
+		if err != nil {
+			return rule, fmt.Errorf("repository.SaveBdRule error: %v", err)
+		}
+		if len(usersSlice) == 0 {
+			return rule, fmt.Errorf("no rows: repository.SaveBdRule error: no user %s", rule.ObserverGUID)
+		}
+		observerParam = rule.ObserverGUID
+	}
+
+	_, err := ins.Db.Exec(context.Background(),
+		"INSERT INTO bd_rules (observer_guid, lead_days, weekly_day, monthly_lead_days, skip_weekends, time_zone, updated_at) "+
+			"    VALUES ($1, $2, $3, $4, $5, $6, now()) "+
+			"    ON CONFLICT ((coalesce(observer_guid, '00000000-0000-0000-0000-000000000000'::uuid))) DO UPDATE SET "+
+			"        lead_days = excluded.lead_days, weekly_day = excluded.weekly_day, monthly_lead_days = excluded.monthly_lead_days, "+
+			"        skip_weekends = excluded.skip_weekends, time_zone = excluded.time_zone, updated_at = excluded.updated_at;",
+		observerParam, rule.LeadDays, rule.WeeklyDay, rule.MonthlyLeadDays, rule.SkipWeekends, rule.TimeZone)
+	if err != nil {
+		return rule, fmt.Errorf("repository.SaveBdRule error: %v", err)
+	}
+	return ins.GetBdRule(rule.ObserverGUID)
+}
+
+// удалим правило observer-а - для него снова действует общее. Общее удалить нельзя ("conflict")
+func (ins *PostgreInstance) DeleteBdRule(observerGUID string) error {
+	if observerGUID == "" {
+		return fmt.Errorf("conflict: the global rule can not be deleted, change it instead")
+	}
+	commandTag, err := ins.Db.Exec(context.Background(), "DELETE FROM bd_rules WHERE observer_guid = $1;", observerGUID)
+	if err != nil {
+		return fmt.Errorf("repository.DeleteBdRule error: %v", err)
+	}
+	if commandTag.RowsAffected() == 0 {
+		return fmt.Errorf("no rows: repository.DeleteBdRule error: no rule for observer %s", observerGUID)
+	}
+	return nil
+}
+
+//***************************************************************************************
+// Подписки observer-ов на ДР сотрудников подразделения (таблица bd_dep_subscriptions, api /api/v1/bd-departament-subscriptions).
+// Сами именинники определяются при рассылке (см. bdPairsCTE)
+
+const bdDepSubscriptionsQuery = "select s.subscription_id, cast(s.observer_guid as text), coalesce(usr.user_name, ''), " +
+	"        coalesce(cast(s.departament_guid as text), ''), coalesce(dep.departament_descr, ''), s.recursive " +
+	"    from bd_dep_subscriptions s " +
+	"        left join users usr on s.observer_guid = usr.user_guid " +
+	"        left join departaments dep on cast(s.departament_guid as text) = cast(dep.departament_guid as text) "
+
+func scanBdDepSubscription(row pgx.Row) (domain.BdDepartamentSubscription, error) {
+	sub := domain.BdDepartamentSubscription{}
+	err := row.Scan(&sub.SubscriptionID, &sub.ObserverGUID, &sub.ObserverName, &sub.DepartamentGUID, &sub.DepartamentDescr, &sub.Recursive)
+	return sub, err
+}
+
+// подписки на подразделения (observerGUID пуст - всех observer-ов)
+func (ins *PostgreInstance) GetBdDepSubscriptions(observerGUID string) ([]domain.BdDepartamentSubscription, error) {
+	subsSlice := make([]domain.BdDepartamentSubscription, 0)
+
+	rows, err := ins.Db.Query(context.Background(),
+		bdDepSubscriptionsQuery+" where $1 = '' or cast(s.observer_guid as text) = lower($1) "+
+			" order by usr.user_name, s.subscription_id;", observerGUID)
+	if err == pgx.ErrNoRows {
+		return subsSlice, nil
+	} else if err != nil {
+		return subsSlice, fmt.Errorf("repository.GetBdDepSubscriptions error: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		sub, err := scanBdDepSubscription(rows)
+		if err != nil {
+			return subsSlice, fmt.Errorf("repository.GetBdDepSubscriptions scan error: %v", err)
+		}
+		subsSlice = append(subsSlice, sub)
+	}
+	return subsSlice, nil
+}
+
+// подпишем observer-а на подразделение (DepartamentGUID пуст - на те, где он работает).
+// "no rows" - нет такого user-а или подразделения; "conflict" - уже подписан
+func (ins *PostgreInstance) AddBdDepSubscription(sub domain.BdDepartamentSubscription) (domain.BdDepartamentSubscription, error) {
+	usersSlice, err := ins.GetUsersBySliceOfGUID([]string{sub.ObserverGUID})
+	if err != nil {
+		return sub, fmt.Errorf("repository.AddBdDepSubscription error: %v", err)
+	}
+	if len(usersSlice) == 0 {
+		return sub, fmt.Errorf("no rows: repository.AddBdDepSubscription error: no user %s", sub.ObserverGUID)
+	}
+	var depParam interface{}
+	if sub.DepartamentGUID != "" {
+		if _, err = ins.SelectDepByGUID(sub.DepartamentGUID); err != nil {
+			return sub, err
+		}
+		depParam = sub.DepartamentGUID
+	}
+
+	subsSlice, err := ins.GetBdDepSubscriptions(sub.ObserverGUID)
+	if err != nil {
+		return sub, err
+	}
+	for _, curSub := range subsSlice {
+		if strings.EqualFold(curSub.DepartamentGUID, sub.DepartamentGUID) {
+			return sub, fmt.Errorf("conflict: %s is already subscribed (subscriptionId %d)", usersSlice[0].UserName, curSub.SubscriptionID)
+		}
+	}
+
+	var subscriptionID int64
+	err = ins.Db.QueryRow(context.Background(),
+		"INSERT INTO bd_dep_subscriptions (observer_guid, departament_guid, recursive) VALUES ($1, $2, $3) RETURNING subscription_id;",
+		sub.ObserverGUID, depParam, sub.Recursive).Scan(&subscriptionID)
+	if err != nil {
+		return sub, fmt.Errorf("repository.AddBdDepSubscription error: %v", err)
+	}
+
+	sub, err = scanBdDepSubscription(ins.Db.QueryRow(context.Background(),
+		bdDepSubscriptionsQuery+" where s.subscription_id = $1;", subscriptionID))
+	if err != nil {
+		return sub, fmt.Errorf("repository.AddBdDepSubscription error: %v", err)
+	}
+	return sub, nil
+}
+
+// "no rows" - нет такой подписки
+func (ins *PostgreInstance) DeleteBdDepSubscription(subscriptionID int64) error {
+	commandTag, err := ins.Db.Exec(context.Background(), "DELETE FROM bd_dep_subscriptions WHERE subscription_id = $1;", subscriptionID)
+	if err != nil {
+		return fmt.Errorf("repository.DeleteBdDepSubscription error: %v", err)
+	}
+	if commandTag.RowsAffected() == 0 {
+		return fmt.Errorf("no rows: repository.DeleteBdDepSubscription error: no subscription %d", subscriptionID)
+	}
+	return nil
+}
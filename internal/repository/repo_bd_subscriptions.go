@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"mdata/internal/domain"
+
+	"github.com/jackc/pgx/v4"
+)
+
+//***************************************************************************************
+// Подписки observer-ов на ДР конкретных user-ов (таблица bd_notifications) и отказ от рассылки (bd_opt_outs).
+// Управляются самими сотрудниками через /bd-subscriptions; пары - по guid, табельный номер - только точное совпадение
+// (с точностью до пробелов и ведущих нулей, см. normalizeTabNo)
+
+// табельный номер для сравнения: без пробелов по краям и ведущих нулей - 1С:ЗУП дополняет номер нулями
+// до длины кода ("00000123"), а вводят его как "123". Номер из одних нулей - "0".
+// В запросе так же нормализуется users.user_id (tabNoSQL)
+func normalizeTabNo(tabNo string) string {
+	tabNo = strings.TrimSpace(tabNo)
+	if tabNo == "" {
+		return ""
+	}
+	if trimmed := strings.TrimLeft(tabNo, "0"); trimmed != "" {
+		return trimmed
+	}
+	return "0"
+}
+
+// normalizeTabNo в sql
+const tabNoSQL = "coalesce(nullif(ltrim(trim(usr.user_id), '0'), ''), '0')"
+
+// guid user-а по табельному номеру (normalizeTabNo). "no rows" - нет такого, "conflict" - номер не уникален
+func (ins *PostgreInstance) GetUserGUIDByTabNo(tabNo string) (string, error) {
+	key := normalizeTabNo(tabNo)
+	if key == "" {
+		return "", fmt.Errorf("no rows: repository.GetUserGUIDByTabNo error: empty tab number")
+	}
+	rows, err := ins.Db.Query(context.Background(),
+		"select cast(usr.user_guid as text), usr.user_name from users usr where trim(usr.user_id) <> '' and "+tabNoSQL+" = $1;", key)
+	if err != nil {
+		return "", fmt.Errorf("repository.GetUserGUIDByTabNo error: %v", err)
+	}
+	defer rows.Close()
+
+	guids := make([]string, 0, 1)
+	names := make([]string, 0, 1)
+	for rows.Next() {
+		var guid, name string
+		if err = rows.Scan(&guid, &name); err != nil {
+			return "", fmt.Errorf("repository.GetUserGUIDByTabNo scan error: %v", err)
+		}
+		guids = append(guids, guid)
+		names = append(names, name)
+	}
+	switch len(guids) {
+	case 0:
+		return "", fmt.Errorf("no rows: repository.GetUserGUIDByTabNo error: no user with tab number %s", tabNo)
+	case 1:
+		return guids[0], nil
+	}
+	return "", fmt.Errorf("conflict: tab number %s belongs to several users: %s", tabNo, strings.Join(names, ", "))
+}
+
+// подписки observer-а. "no rows" - нет такого user-а
+func (ins *PostgreInstance) GetBdSubscriptions(observerGUID string) (domain.BdSubscriptions, error) {
+	subs := domain.BdSubscriptions{
+		ObserverGUID: observerGUID,
+		Owners:       make([]domain.BdSubscriptionOwner, 0),
+	}
+
+	err := ins.Db.QueryRow(context.Background(),
+		"select usr.user_name, exists(select 1 from bd_opt_outs o where o.observer_guid = usr.user_guid) "+
+			"    from users usr where cast(usr.user_guid as text) = lower($1);", observerGUID).Scan(&subs.ObserverName, &subs.OptedOut)
+	if err == pgx.ErrNoRows {
+		return subs, fmt.Errorf("no rows: repository.GetBdSubscriptions error: no user %s", observerGUID)
+	} else if err != nil {
+		return subs, fmt.Errorf("repository.GetBdSubscriptions error: %v", err)
+	}
+
+	rows, err := ins.Db.Query(context.Background(),
+		"select cast(usr.user_guid as text), usr.user_name, usr.user_id "+
+			"    from bd_notifications bd "+
+			"        inner join users usr on bd.bd_owner_guid = usr.user_guid "+
+			"    where cast(bd.bd_observer_guid as text) = lower($1) "+
+			"    order by usr.user_name;", observerGUID)
+	if err != nil && err != pgx.ErrNoRows {
+		return subs, fmt.Errorf("repository.GetBdSubscriptions error: %v", err)
+	}
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			owner := domain.BdSubscriptionOwner{}
+			if err = rows.Scan(&owner.UserGUID, &owner.UserName, &owner.UserID); err != nil {
+				return subs, fmt.Errorf("repository.GetBdSubscriptions scan error: %v", err)
+			}
+			subs.Owners = append(subs.Owners, owner)
+		}
+	}
+
+	subs.Departaments, err = ins.GetBdDepSubscriptions(observerGUID)
+	if err != nil {
+		return subs, err
+	}
+	return subs, nil
+}
+
+// подпишем observer-а на ДР user-а. "no rows" - нет такого user-а; "conflict" - уже подписан или подписка на себя
+func (ins *PostgreInstance) AddBdSubscription(observerGUID, ownerGUID string) (domain.BdSubscriptionOwner, error) {
+	owner := domain.BdSubscriptionOwner{}
+	if strings.EqualFold(observerGUID, ownerGUID) {
+		return owner, fmt.Errorf("conflict: observer and owner are the same user")
+	}
+	usersSlice, err := ins.GetUsersBySliceOfGUID([]string{observerGUID, ownerGUID})
+	if err != nil {
+		return owner, fmt.Errorf("repository.AddBdSubscription error: %v", err)
+	}
+	for _, guid := range []string{observerGUID, ownerGUID} {
+		found := false
+		for _, user := range usersSlice {
+			if strings.EqualFold(user.UserGUID, guid) {
+				found = true
+				if guid == ownerGUID {
+					owner = domain.BdSubscriptionOwner{UserGUID: user.UserGUID, UserName: user.UserName, UserID: user.UserID}
+				}
+			}
+		}
+		if !found {
+			return owner, fmt.Errorf("no rows: repository.AddBdSubscription error: no user %s", guid)
+		}
+	}
+
+	commandTag, err := ins.Db.Exec(context.Background(),
+		"insert into bd_notifications (bd_observer_guid, bd_owner_guid) "+
+			"    select $1::uuid, $2::uuid "+
+			"    where not exists (select 1 from bd_notifications where bd_observer_guid = $1::uuid and bd_owner_guid = $2::uuid);",
+		observerGUID, ownerGUID)
+	if err != nil {
+		if strings.Contains(err.Error(), "SQLSTATE 23505") {
+			return owner, fmt.Errorf("conflict: already subscribed to %s", owner.UserName)
+		}
+		return owner, fmt.Errorf("repository.AddBdSubscription error: %v", err)
+	}
+	if commandTag.RowsAffected() == 0 {
+		return owner, fmt.Errorf("conflict: already subscribed to %s", owner.UserName)
+	}
+	return owner, nil
+}
+
+// "no rows" - такой подписки нет
+func (ins *PostgreInstance) DeleteBdSubscription(observerGUID, ownerGUID string) error {
+	commandTag, err := ins.Db.Exec(context.Background(),
+		"delete from bd_notifications where bd_observer_guid = $1 and bd_owner_guid = $2;", observerGUID, ownerGUID)
+	if err != nil {
+		return fmt.Errorf("repository.DeleteBdSubscription error: %v", err)
+	}
+	if commandTag.RowsAffected() == 0 {
+		return fmt.Errorf("no rows: repository.DeleteBdSubscription error: %s is not subscribed to %s", observerGUID, ownerGUID)
+	}
+	return nil
+}
+
+// отказ observer-а от рассылки о ДР (optOut = false - вернуть рассылку). "no rows" - нет такого user-а
+func (ins *PostgreInstance) SetBdOptOut(observerGUID string, optOut bool) error {
+	usersSlice, err := ins.GetUsersBySliceOfGUID([]string{observerGUID})
+	if err != nil {
+		return fmt.Errorf("repository.SetBdOptOut error: %v", err)
+	}
+	if len(usersSlice) == 0 {
+		return fmt.Errorf("no rows: repository.SetBdOptOut error: no user %s", observerGUID)
+	}
+
+	if optOut {
+		_, err = ins.Db.Exec(context.Background(),
+			"insert into bd_opt_outs (observer_guid) values ($1) on conflict (observer_guid) do nothing;", observerGUID)
+	} else {
+		_, err = ins.Db.Exec(context.Background(), "delete from bd_opt_outs where observer_guid = $1;", observerGUID)
+	}
+	if err != nil {
+		return fmt.Errorf("repository.SetBdOptOut error: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package repository
+
+import "testing"
+
+func TestNormalizeTabNo(t *testing.T) {
+	cases := []struct {
+		tabNo string
+		want  string
+	}{
+		{"123", "123"},
+		{"00000123", "123"},
+		{" 0000123 ", "123"},
+		{"1230", "1230"},
+		{"ЗК-00123", "ЗК-00123"},
+		{"0000", "0"},
+		{"0", "0"},
+		{"  ", ""},
+		{"", ""},
+	}
+	for _, c := range cases {
+		if got := normalizeTabNo(c.tabNo); got != c.want {
+			t.Errorf("normalizeTabNo(%q) = %q, want %q", c.tabNo, got, c.want)
+		}
+	}
+}
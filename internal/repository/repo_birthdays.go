@@ -0,0 +1,200 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"mdata/internal/domain"
+	log "mdata/pkg/logging"
+
+	"github.com/jackc/pgx/v4"
+)
+
+//***************************************************************************************
+// Поиск именинников за период. Период переводим в список дней (месяц, день) и сравниваем с EXTRACT(month/day) даты
+// рождения - так период может переходить через границу месяца и года. Родившихся 29 февраля в невисокосный год
+// ищем по политике bdFeb29Policy (config Birthdays.BdFeb29Policy)
+
+// политика для родившихся 29 февраля в невисокосный год
+const (
+	BdFeb29OnFeb28 = "feb28" // оповещать 28 февраля
+	BdFeb29OnMar1  = "mar1"  // оповещать 1 марта
+	BdFeb29Skip    = "skip"  // не оповещать
+)
+
+const maxBdRangeDays = 366
+
+var bdFeb29Policy = BdFeb29OnFeb28
+
+// SetBdFeb29Policy - неизвестная политика - ошибка, действует прежняя
+func SetBdFeb29Policy(policy string) error {
+	switch policy {
+	case BdFeb29OnFeb28, BdFeb29OnMar1, BdFeb29Skip:
+		bdFeb29Policy = policy
+		return nil
+	}
+	return fmt.Errorf("repository.SetBdFeb29Policy error: unknown policy %s: %s, %s or %s expected", policy, BdFeb29OnFeb28, BdFeb29OnMar1, BdFeb29Skip)
+}
+
+// дни рождения (месяц, день), которые отмечаются в период from - to включительно, и даты, на которые они приходятся.
+// 29 февраля в невисокосный год - по политике feb29Policy
+func bdDaysInRange(from, to time.Time, feb29Policy string) (months, days []int, dates []time.Time) {
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	to = time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	for d, n := from, 0; !d.After(to) && n < maxBdRangeDays; d, n = d.AddDate(0, 0, 1), n+1 {
+		months = append(months, int(d.Month()))
+		days = append(days, d.Day())
+		dates = append(dates, d)
+
+		if isLeapYear(d.Year()) {
+			continue
+		}
+		if (feb29Policy == BdFeb29OnFeb28 && d.Month() == time.February && d.Day() == 28) ||
+			(feb29Policy == BdFeb29OnMar1 && d.Month() == time.March && d.Day() == 1) {
+			months = append(months, int(time.February))
+			days = append(days, 29)
+			dates = append(dates, d)
+		}
+	}
+	return months, days, dates
+}
+
+func isLeapYear(year int) bool {
+	return year%4 == 0 && (year%100 != 0 || year%400 == 0)
+}
+
+//---------------------------------------
+
+// соединение с днями периода ($1 - месяцы, $2 - дни, $3 - даты, см. bdDaysInRange) по месяцу и дню dateColumn
+// (дата рождения, дата приёма); occurs - дата в периоде
+func bdDaysJoin(dateColumn string) string {
+	return " inner join unnest($1::int[], $2::int[], $3::date[]) as bd_days(bd_month, bd_day, occurs) " +
+		"     on extract(month from " + dateColumn + ") = bd_days.bd_month and extract(day from " + dateColumn + ") = bd_days.bd_day "
+}
+
+// вернуть именинников, ДР которых отмечается в период from - to включительно, по порядку дат
+func (ins *PostgreInstance) GetBdOwnersByDates(from, to time.Time) ([]domain.User, error) {
+	bd_usrs_query := "select cast(usr1.user_guid as text), usr1.user_name, usr1.user_id, usr1.user_birthday, usr1.email " +
+		"				   from users usr1 " + bdDaysJoin("usr1.user_birthday") +
+		"				   order by bd_days.occurs, usr1.user_name;"
+
+	ownersSlice := make([]domain.User, 0)
+	months, days, dates := bdDaysInRange(from, to, bdFeb29Policy)
+
+	rows, err := ins.Db.Query(context.Background(), bd_usrs_query, months, days, dates)
+	if err == pgx.ErrNoRows {
+		return ownersSlice, nil
+	} else if err != nil {
+		return ownersSlice, fmt.Errorf("repository.GetBdOwnersByDates error: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		curBdOwner := domain.User{}
+		err = rows.Scan(&curBdOwner.UserGUID, &curBdOwner.UserName, &curBdOwner.UserID, &curBdOwner.UserBirthday, &curBdOwner.UserEmail)
+		if err != nil {
+			return ownersSlice, fmt.Errorf("repository.GetBdOwnersByDates scan error: %v", err)
+		}
+		ownersSlice = append(ownersSlice, curBdOwner)
+	}
+	return ownersSlice, nil
+}
+
+// пары observer - именинник: заданные явно (bd_notifications) и по подпискам на подразделения (bd_dep_subscriptions) -
+// работающие сотрудники подразделения (при recursive - и подчиненных), кроме самого observer-а.
+// depthParam - параметр запроса с глубиной поддерева, stateParam - с состоянием "работает" (например "$4", "$5")
+func bdPairsCTE(depthParam, stateParam string) string {
+	return "with recursive sub_deps as ( " +
+		"     select s.observer_guid, s.recursive, " +
+		"            coalesce(cast(s.departament_guid as text), cast(empl.employee_departament as text)) as departament_guid, 0 as lvl " +
+		"         from bd_dep_subscriptions s " +
+		"             left join employees empl on s.departament_guid is null and empl.employee_user = s.observer_guid " +
+		"             left join employee_states emplCS on emplCS.employee_guid = empl.employee_guid " +
+		"         where s.departament_guid is not null or emplCS.state_descr ilike " + stateParam + " " +
+		"     union all " +
+		"     select sd.observer_guid, sd.recursive, cast(dep.departament_guid as text), sd.lvl + 1 " +
+		"         from departaments dep " +
+		"             inner join sub_deps sd on cast(dep.departament_parent_guid as text) = sd.departament_guid " +
+		"         where sd.recursive and sd.lvl < " + depthParam + " " +
+		"             and dep.zup_parent_id <> '000999999' and dep.zup_not_used_from = '0001-01-01'), " +
+		" bd_pairs as ( " +
+		"     select cast(bd.bd_observer_guid as text) as observer_guid, cast(bd.bd_owner_guid as text) as owner_guid " +
+		"         from bd_notifications bd " +
+		"     union " +
+		"     select cast(sd.observer_guid as text), cast(empl.employee_user as text) " +
+		"         from sub_deps sd " +
+		"             inner join employees empl on cast(empl.employee_departament as text) = sd.departament_guid " +
+		"             inner join employee_states emplCS on emplCS.employee_guid = empl.employee_guid " +
+		"         where emplCS.state_descr ilike " + stateParam + " and cast(empl.employee_user as text) <> cast(sd.observer_guid as text)) "
+}
+
+// вернуть observer-ов и их именинников, ДР которых отмечается в период from - to включительно (см. bdPairsCTE);
+// отказавшихся от рассылки (bd_opt_outs) пропускаем. Ключ - guid observer-а; именинники - по порядку дат в периоде
+func (ins *PostgreInstance) GetBdObserversOwnersByDates(from, to time.Time) (map[string]domain.BdObserver, error) {
+
+	bd_usrs_query := bdPairsCTE("$4", "$5") +
+		" select " +
+		" 						cast(usr.user_guid as text), " +
+		" 						usr.user_name, " +
+		" 						usr.email, " + //  as observer_email
+		" 						usr1.user_name, " + //  as bd_owner
+		" 						usr1.user_birthday " + // as bd
+		"				   from bd_pairs bd " +
+		" 						inner join users usr on bd.observer_guid = cast(usr.user_guid as text) " +
+		" 						inner join users usr1 on bd.owner_guid = cast(usr1.user_guid as text) " + bdDaysJoin("usr1.user_birthday") +
+		"				   where not exists (select 1 from bd_opt_outs o where o.observer_guid = usr.user_guid) " + // отказались от рассылки
+		"				   order by usr.user_guid, bd_days.occurs, usr1.user_name;"
+
+	// одному observer-у (key) сопоставляем много bd_owner-ов
+	retMap := make(map[string]domain.BdObserver)
+	months, days, dates := bdDaysInRange(from, to, bdFeb29Policy)
+
+	rows, err := ins.Db.Query(context.Background(), bd_usrs_query, months, days, dates, maxDepartamentsDepth, "%Работ%")
+	if err == pgx.ErrNoRows {
+		return retMap, nil
+	} else if err != nil {
+		return retMap, fmt.Errorf("repository.GetBdObserversOwnersByDates error: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		curObserver := domain.BdObserver{}
+		curBdOwner := new(domain.User)
+		err = rows.Scan(&curObserver.ObserverGUID, &curObserver.ObserverName, &curObserver.Email, &curBdOwner.UserName, &curBdOwner.UserBirthday)
+		if err != nil {
+			return retMap, fmt.Errorf("repository.GetBdObserversOwnersByDates scan error: %v", err)
+		}
+		if strings.TrimSpace(curObserver.Email) == "" {
+			log.Error("bd_notifications repository.GetBdObserversOwnersByDates error: для пользователя %v не найден email.", curObserver.ObserverName)
+			continue
+		}
+		if observer, ok := retMap[curObserver.ObserverGUID]; ok {
+			curObserver = observer
+		}
+		curObserver.Owners = append(curObserver.Owners, *curBdOwner)
+		retMap[curObserver.ObserverGUID] = curObserver
+	}
+
+	return retMap, nil
+}
+
+//------------------------------------------------------
+// вернуть всех именинников дня day - администратору MD DEBUG !!!!!!!!!!!!!!!!!!!!!!!!!
+func (ins *PostgreInstance) GetBdOwnersOneDayDebug(day time.Time) (map[string][]domain.User, error) {
+	var retMap map[string][]domain.User = map[string][]domain.User{} // одному observer - у сопоставляем много bd_owner - ов
+	admin := ins.GetBccAdmin()
+	if admin == "" {
+		return retMap, fmt.Errorf("no rows: repository.GetBdOwnersOneDayDebug error: no admins")
+	}
+
+	ownersSlice, err := ins.GetBdOwnersByDates(day, day)
+	if err != nil {
+		return retMap, err
+	}
+	if len(ownersSlice) > 0 {
+		retMap[admin] = ownersSlice
+	}
+	return retMap, nil
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func bdTestDate(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// дни периода как "ММ-ДД@дата в периоде" - так видно, на какую дату периода приходится 29 февраля
+func bdDaysStrings(months, days []int, dates []time.Time) []string {
+	result := make([]string, 0, len(dates))
+	for k := range dates {
+		result = append(result, fmt.Sprintf("%02d-%02d@%s", months[k], days[k], dates[k].Format("2006-01-02")))
+	}
+	return result
+}
+
+func TestBdDaysInRange(t *testing.T) {
+	cases := []struct {
+		name     string
+		from, to time.Time
+		policy   string
+		want     []string
+	}{
+		{"через новый год", bdTestDate(2023, time.December, 28), bdTestDate(2024, time.January, 3), BdFeb29OnFeb28, []string{
+			"12-28@2023-12-28", "12-29@2023-12-29", "12-30@2023-12-30", "12-31@2023-12-31",
+			"01-01@2024-01-01", "01-02@2024-01-02", "01-03@2024-01-03"}},
+
+		{"2023, feb28", bdTestDate(2023, time.February, 28), bdTestDate(2023, time.March, 1), BdFeb29OnFeb28, []string{
+			"02-28@2023-02-28", "02-29@2023-02-28", "03-01@2023-03-01"}},
+		{"2023, mar1", bdTestDate(2023, time.February, 28), bdTestDate(2023, time.March, 1), BdFeb29OnMar1, []string{
+			"02-28@2023-02-28", "03-01@2023-03-01", "02-29@2023-03-01"}},
+		{"2023, skip", bdTestDate(2023, time.February, 28), bdTestDate(2023, time.March, 1), BdFeb29Skip, []string{
+			"02-28@2023-02-28", "03-01@2023-03-01"}},
+
+		{"2024, feb28", bdTestDate(2024, time.February, 28), bdTestDate(2024, time.March, 1), BdFeb29OnFeb28, []string{
+			"02-28@2024-02-28", "02-29@2024-02-29", "03-01@2024-03-01"}},
+		{"2024, mar1", bdTestDate(2024, time.February, 28), bdTestDate(2024, time.March, 1), BdFeb29OnMar1, []string{
+			"02-28@2024-02-28", "02-29@2024-02-29", "03-01@2024-03-01"}},
+		{"2024, skip", bdTestDate(2024, time.February, 28), bdTestDate(2024, time.March, 1), BdFeb29Skip, []string{
+			"02-28@2024-02-28", "02-29@2024-02-29", "03-01@2024-03-01"}},
+
+		{"29 февраля 2024", bdTestDate(2024, time.February, 29), bdTestDate(2024, time.February, 29), BdFeb29OnFeb28, []string{
+			"02-29@2024-02-29"}},
+
+		{"время и часовой пояс не учитываются", time.Date(2023, time.March, 1, 23, 30, 0, 0, time.FixedZone("MSK", 3*60*60)),
+			time.Date(2023, time.March, 2, 1, 0, 0, 0, time.UTC), BdFeb29Skip, []string{
+				"03-01@2023-03-01", "03-02@2023-03-02"}},
+		{"to раньше from", bdTestDate(2023, time.March, 2), bdTestDate(2023, time.March, 1), BdFeb29OnFeb28, []string{}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := bdDaysStrings(bdDaysInRange(c.from, c.to, c.policy))
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("bdDaysInRange = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+// период длиннее maxBdRangeDays обрезается: не больше maxBdRangeDays дат подряд от from
+func TestBdDaysInRangeLimit(t *testing.T) {
+	from := bdTestDate(2023, time.January, 1)
+	to := bdTestDate(2024, time.December, 31)
+
+	cases := []struct {
+		policy      string
+		wantEntries int // 29 февраля в 2023 добавляется к 28.02 или 01.03
+	}{
+		{BdFeb29Skip, maxBdRangeDays},
+		{BdFeb29OnFeb28, maxBdRangeDays + 1},
+		{BdFeb29OnMar1, maxBdRangeDays + 1},
+	}
+	for _, c := range cases {
+		t.Run(c.policy, func(t *testing.T) {
+			months, days, dates := bdDaysInRange(from, to, c.policy)
+			if len(months) != c.wantEntries || len(days) != c.wantEntries || len(dates) != c.wantEntries {
+				t.Fatalf("got %d/%d/%d entries, want %d", len(months), len(days), len(dates), c.wantEntries)
+			}
+			if last, want := dates[len(dates)-1], from.AddDate(0, 0, maxBdRangeDays-1); !last.Equal(want) {
+				t.Errorf("last date = %s, want %s", last.Format("2006-01-02"), want.Format("2006-01-02"))
+			}
+		})
+	}
+}
+
+func TestIsLeapYear(t *testing.T) {
+	cases := []struct {
+		year int
+		want bool
+	}{
+		{2023, false},
+		{2024, true},
+		{1900, false},
+		{2000, true},
+		{2100, false},
+	}
+	for _, c := range cases {
+		if got := isLeapYear(c.year); got != c.want {
+			t.Errorf("isLeapYear(%d) = %v, want %v", c.year, got, c.want)
+		}
+	}
+}
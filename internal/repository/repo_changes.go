@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"mdata/internal/domain"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Курсор ленты "change_id > since" не должен пропускать события, поэтому change_id выдаются в порядке фиксации:
+// AddChange берёт транзакционную advisory-блокировку changesLockKey до INSERT (до nextval) и держит её до commit.
+// Пока событие не зафиксировано, следующее не получит change_id - событие с меньшим change_id
+// не может появиться в ленте позже события с большим, и читающим ждать не нужно
+const changesLockKey int64 = 0x6d64617461 // "mdata"
+
+// запишем событие в ленту; data - сущность после изменения (в payload как json). Вернём событие с курсором и временем
+func (i *PostgreInstance) AddChange(entity, entityGUID, changeType string, data interface{}) (domain.ChangeEvent, error) {
+	change := domain.ChangeEvent{Entity: entity, EntityGUID: entityGUID, ChangeType: changeType}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return change, fmt.Errorf("repository.AddChange marshal error: %v", err)
+	}
+	change.Data = json.RawMessage(payload)
+
+	tx, err := i.Db.Begin(context.Background())
+	if err != nil {
+		return change, fmt.Errorf("repository.AddChange begin error: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	if _, err = tx.Exec(context.Background(), "select pg_advisory_xact_lock($1);", changesLockKey); err != nil {
+		return change, fmt.Errorf("repository.AddChange lock error: %v", err)
+	}
+	err = tx.QueryRow(context.Background(),
+		"INSERT INTO changes (entity, entity_guid, change_type, payload) VALUES ($1, $2, $3, $4::jsonb) RETURNING change_id, change_date;",
+		entity, entityGUID, changeType, string(payload)).Scan(&change.ChangeID, &change.ChangeDate)
+	if err != nil {
+		return change, fmt.Errorf("repository.AddChange error: %v", err)
+	}
+	if err = tx.Commit(context.Background()); err != nil {
+		return change, fmt.Errorf("repository.AddChange commit error: %v", err)
+	}
+	return change, nil
+}
+
+// вернём события ленты после sinceID (по возрастанию), не больше limit
+func (i *PostgreInstance) GetChangesSince(sinceID int64, limit int) ([]domain.ChangeEvent, error) {
+	changesSlice := make([]domain.ChangeEvent, 0)
+
+	rows, err := i.Db.Query(context.Background(),
+		"select change_id, entity, entity_guid, change_type, change_date, coalesce(payload::text, '') "+
+			"    from changes "+
+			"    where change_id > $1 "+
+			"    order by change_id "+
+			"    limit $2;",
+		sinceID, limit)
+	if err == pgx.ErrNoRows {
+		return changesSlice, nil
+	} else if err != nil {
+		return changesSlice, fmt.Errorf("repository.GetChangesSince error: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		curChange := domain.ChangeEvent{}
+		var payload string
+		err = rows.Scan(&curChange.ChangeID, &curChange.Entity, &curChange.EntityGUID, &curChange.ChangeType, &curChange.ChangeDate, &payload)
+		if err != nil {
+			return changesSlice, fmt.Errorf("repository.GetChangesSince scan error: %v", err)
+		}
+		if payload != "" {
+			curChange.Data = json.RawMessage(payload)
+		}
+		changesSlice = append(changesSlice, curChange)
+	}
+
+	return changesSlice, nil
+}
+
+// последний курсор ленты (0 - лента пуста)
+func (i *PostgreInstance) GetLastChangeID() (int64, error) {
+	var lastID int64
+	err := i.Db.QueryRow(context.Background(), "select coalesce(max(change_id), 0) from changes;").Scan(&lastID)
+	if err != nil {
+		return 0, fmt.Errorf("repository.GetLastChangeID error: %v", err)
+	}
+	return lastID, nil
+}
+
+// до какого события лента уже опубликована в топик (0 - ещё ничего не публиковали)
+func (i *PostgreInstance) GetPublishCursor(topic string) (int64, error) {
+	var lastID int64
+	err := i.Db.QueryRow(context.Background(), "select last_change_id from publish_cursors where topic = $1;", topic).Scan(&lastID)
+	if err == pgx.ErrNoRows {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("repository.GetPublishCursor error: %v", err)
+	}
+	return lastID, nil
+}
+
+// запомним, что события до lastID включительно опубликованы в топик
+func (i *PostgreInstance) SetPublishCursor(topic string, lastID int64) error {
+	_, err := i.Db.Exec(context.Background(),
+		"INSERT INTO publish_cursors (topic, last_change_id) VALUES ($1, $2) "+
+			"    ON CONFLICT (topic) DO UPDATE SET last_change_id = EXCLUDED.last_change_id, updated_at = now();",
+		topic, lastID)
+	if err != nil {
+		return fmt.Errorf("repository.SetPublishCursor error: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,306 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"mdata/internal/domain"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// максимальная глубина обхода дерева подразделений (защита от зацикливания по departament_parent_guid)
+const maxDepartamentsDepth = 50
+
+// поля подразделения в том порядке, в котором их читает handlRowsDepartaments
+const departamentFields = " dep.departament_guid, dep.zup_id, dep.departament_descr, dep.zup_parent_id, dep.zup_not_used_from, dep.departament_parent_guid, dep.departament_head_guid "
+
+func handlRowsDepartaments(rows pgx.Rows) []domain.Departament {
+	depsSlice := make([]domain.Departament, 0)
+	for rows.Next() {
+		curDep := new(domain.Departament)
+		rows.Scan(
+			&curDep.DepartamentGUID,
+			&curDep.DepartamentIdZUP,
+			&curDep.DepartamentDescr,
+			&curDep.DepartamentParentIdZUP,
+			&curDep.DepartamentNotUsedFrom,
+			&curDep.DepartamentParentGUID,
+			&curDep.DepartamentHeadGUID)
+
+		depsSlice = append(depsSlice, *curDep)
+	}
+	return depsSlice
+}
+
+// цепочка родителей подразделения $1 (вместе с ним самим, lvl = 0) глубиной не более $2
+const departamentParentsCTE = "with recursive parents as ( " +
+	"     select " + departamentFields + ", 0 as lvl " +
+	"         from departaments dep " +
+	"         where cast(dep.departament_guid as text) = $1 " +
+	"     union all " +
+	"     select " + departamentFields + ", p.lvl + 1 " +
+	"         from departaments dep " +
+	"             inner join parents p on cast(dep.departament_guid as text) = cast(p.departament_parent_guid as text) " +
+	"         where p.lvl < $2) "
+
+// вернём цепочку родителей подразделения (от корня к непосредственному родителю) - "хлебные крошки":
+func (i *PostgreInstance) GetDepartamentAncestors(depGUID string) ([]domain.Departament, error) {
+
+	const ancestors_query = departamentParentsCTE +
+		" select " + departamentFields + " from parents dep where dep.lvl > 0 order by dep.lvl desc;"
+
+	ancestorsSlice := make([]domain.Departament, 0)
+
+	rows, err := i.Db.Query(context.Background(), ancestors_query, depGUID, maxDepartamentsDepth)
+	if err == pgx.ErrNoRows {
+		return ancestorsSlice, nil
+	} else if err != nil {
+		return ancestorsSlice, fmt.Errorf("repository.GetDepartamentAncestors error: %v", err)
+	}
+	defer rows.Close()
+
+	ancestorsSlice = handlRowsDepartaments(rows)
+
+	return ancestorsSlice, nil
+}
+
+// вернём подразделение и всех его родителей по порядку вверх (от самого подразделения к корню):
+func (i *PostgreInstance) GetDepartamentWithParents(depGUID string) ([]domain.Departament, error) {
+
+	const parents_query = departamentParentsCTE +
+		" select " + departamentFields + " from parents dep order by dep.lvl;"
+
+	parentsSlice := make([]domain.Departament, 0)
+
+	rows, err := i.Db.Query(context.Background(), parents_query, depGUID, maxDepartamentsDepth)
+	if err == pgx.ErrNoRows {
+		return parentsSlice, nil
+	} else if err != nil {
+		return parentsSlice, fmt.Errorf("repository.GetDepartamentWithParents error: %v", err)
+	}
+	defer rows.Close()
+
+	parentsSlice = handlRowsDepartaments(rows)
+
+	return parentsSlice, nil
+}
+
+// поддерево подразделения $1 (вместе с ним самим, lvl = 0) глубиной не более $2.
+// расформированные подразделения (и их потомков) берём только при $3 = true
+const departamentSubtreeCTE = "with recursive subtree as ( " +
+	"     select " + departamentFields + ", 0 as lvl " +
+	"         from departaments dep " +
+	"         where cast(dep.departament_guid as text) = $1 " +
+	"     union all " +
+	"     select " + departamentFields + ", s.lvl + 1 " +
+	"         from departaments dep " +
+	"             inner join subtree s on cast(dep.departament_parent_guid as text) = cast(s.departament_guid as text) " +
+	"         where s.lvl < $2 " +
+	"             and ($3 or (dep.zup_parent_id <> '000999999' and dep.zup_not_used_from = '0001-01-01'))) "
+
+// вернём всех потомков подразделения (на всю глубину), без самого подразделения.
+// расформированные подразделения (и их потомки) возвращаем только при includeClosed = true
+func (i *PostgreInstance) GetDepartamentDescendants(depGUID string, includeClosed bool) ([]domain.Departament, error) {
+
+	const descendants_query = departamentSubtreeCTE +
+		" select " + departamentFields + " from subtree dep where dep.lvl > 0 order by dep.lvl, dep.departament_descr;"
+
+	descendantsSlice := make([]domain.Departament, 0)
+
+	rows, err := i.Db.Query(context.Background(), descendants_query, depGUID, maxDepartamentsDepth, includeClosed)
+	if err == pgx.ErrNoRows {
+		return descendantsSlice, nil
+	} else if err != nil {
+		return descendantsSlice, fmt.Errorf("repository.GetDepartamentDescendants error: %v", err)
+	}
+	defer rows.Close()
+
+	descendantsSlice = handlRowsDepartaments(rows)
+
+	return descendantsSlice, nil
+}
+
+// вернём работающих пользователей (физ.лиц) подразделения, а при recursive - и всех подчиненных ему подразделений (все атрибуты).
+// у пользователя отдаём только тех сотрудников, которые работают в этих подразделениях
+func (i *PostgreInstance) GetActualUsersByDepartamentAllAttributes(depGUID string, recursive bool) ([]domain.User, error) {
+
+	usrs_query := departamentSubtreeCTE + commonQueryAllAttributes +
+		" where cast(empl.employee_departament as text) in (select cast(departament_guid as text) from subtree) " +
+		"     and state_descr ilike $4 " +
+		" order by usr.user_name, usr.user_guid;"
+
+	depth := 0
+	if recursive {
+		depth = maxDepartamentsDepth
+	}
+
+	usersSlice := make([]domain.User, 0)
+
+	rows, err := i.Db.Query(context.Background(), usrs_query, depGUID, depth, false, "%Работ%")
+	if err == pgx.ErrNoRows {
+		return usersSlice, nil
+	} else if err != nil {
+		return usersSlice, fmt.Errorf("repository.GetActualUsersByDepartamentAllAttributes error: %v", err)
+	}
+	defer rows.Close()
+
+	usersSlice = handlRowsAllAttributes(rows)
+
+	return usersSlice, nil
+}
+
+// вернём поддерево подразделения (вместе с ним самим) и количество работающих сотрудников
+// непосредственно в каждом подразделении (map-а по guid подразделения)
+func (i *PostgreInstance) GetDepartamentSubtreeHeadcount(depGUID string, includeClosed bool) ([]domain.Departament, map[string]int, error) {
+
+	const headcount_query = departamentSubtreeCTE +
+		" select " + departamentFields + ", " +
+		"     count(distinct case when emplCS.state_descr ilike $4 then empl.employee_guid end) " +
+		"     from subtree dep " +
+		"         left join employees empl on cast(empl.employee_departament as text) = cast(dep.departament_guid as text) " +
+		"         left join employee_states emplCS on emplCS.employee_guid=empl.employee_guid " +
+		"     group by " + departamentFields + ", dep.lvl " +
+		"     order by dep.lvl, dep.departament_descr;"
+
+	depsSlice := make([]domain.Departament, 0)
+	headcountMap := make(map[string]int)
+
+	rows, err := i.Db.Query(context.Background(), headcount_query, depGUID, maxDepartamentsDepth, includeClosed, "%Работ%")
+	if err == pgx.ErrNoRows {
+		return depsSlice, headcountMap, nil
+	} else if err != nil {
+		return depsSlice, headcountMap, fmt.Errorf("repository.GetDepartamentSubtreeHeadcount error: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		curDep := new(domain.Departament)
+		var headcount int
+		rows.Scan(
+			&curDep.DepartamentGUID,
+			&curDep.DepartamentIdZUP,
+			&curDep.DepartamentDescr,
+			&curDep.DepartamentParentIdZUP,
+			&curDep.DepartamentNotUsedFrom,
+			&curDep.DepartamentParentGUID,
+			&curDep.DepartamentHeadGUID,
+			&headcount)
+
+		depsSlice = append(depsSlice, *curDep)
+		headcountMap[curDep.DepartamentGUID] = headcount
+	}
+
+	return depsSlice, headcountMap, nil
+}
+
+// Сверка родителей после загрузки подразделений из 1С:ЗУП.
+// При записи подразделения его родитель мог быть ещё не загружен (ЗУП отдаёт детей раньше родителей),
+// поэтому проставляем departament_parent_guid по zup_parent_id для всех строк разом. Возвращаем количество исправленных строк.
+func (i *PostgreInstance) ReconcileDepartamentParents() (int64, error) {
+	const reconcile_query = "update departaments dep set departament_parent_guid = par.departament_guid " +
+		"     from departaments par " +
+		"     where par.zup_id = trim(dep.zup_parent_id) " + // при загрузке zup_parent_id тоже сравниваем без пробелов
+		"         and trim(dep.zup_parent_id) <> '' " +
+		"         and cast(dep.departament_parent_guid as text) is distinct from cast(par.departament_guid as text);"
+
+	commandTag, err := i.Db.Exec(context.Background(), reconcile_query)
+	if err != nil {
+		return 0, fmt.Errorf("repository.ReconcileDepartamentParents error: %v", err)
+	}
+	return commandTag.RowsAffected(), nil
+}
+
+// вернём подразделения-"сироты": указан zup_parent_id, но подразделения с таким zup_id в базе нет
+// (000999999 - признак расформированного подразделения, а не код родителя)
+func (i *PostgreInstance) GetOrphanDepartaments() ([]domain.Departament, error) {
+	const orphans_query = "select " + departamentFields +
+		"     from departaments dep " +
+		"     where trim(dep.zup_parent_id) <> '' and trim(dep.zup_parent_id) <> '000999999' " +
+		"         and not exists (select 1 from departaments par where par.zup_id = trim(dep.zup_parent_id)) " +
+		"     order by dep.departament_descr;"
+
+	orphansSlice := make([]domain.Departament, 0)
+
+	rows, err := i.Db.Query(context.Background(), orphans_query)
+	if err == pgx.ErrNoRows {
+		return orphansSlice, nil
+	} else if err != nil {
+		return orphansSlice, fmt.Errorf("repository.GetOrphanDepartaments error: %v", err)
+	}
+	defer rows.Close()
+
+	orphansSlice = handlRowsDepartaments(rows)
+
+	return orphansSlice, nil
+}
+
+//***************************************************************************************
+// Руководители подразделений
+
+// назначить руководителя подразделения через api (загрузка из 1С:ЗУП его больше не перетирает).
+// пустой headEmployeeGUID снимает ручное назначение - руководитель снова берётся из 1С:ЗУП при следующей загрузке
+func (i *PostgreInstance) SetDepartamentHead(depGUID, headEmployeeGUID string) (string, error) {
+	const head_update_query = "UPDATE departaments set departament_head_guid=$1, head_set_manually=$2 where cast(departament_guid as text)=$3;"
+
+	headEmployeeGUID = strings.TrimSpace(headEmployeeGUID)
+	commandTag, err := i.Db.Exec(context.Background(), head_update_query,
+		headEmployeeGUID,
+		headEmployeeGUID != "",
+		depGUID)
+	if err != nil {
+		return commandTag.String(), fmt.Errorf("repository.SetDepartamentHead error: %v", err)
+	}
+	if commandTag.RowsAffected() == 0 {
+		return commandTag.String(), fmt.Errorf("repository.SetDepartamentHead error: no rows for departament %s", depGUID) // "no rows" - по ним определяем 404
+	}
+	return commandTag.String(), nil
+}
+
+// вернём пользователя (физ.лицо) с единственным сотрудником по guid сотрудника (все атрибуты):
+func (i *PostgreInstance) GetUserByEmployeeGUIDAllAttributes(emplGUID string) (domain.User, error) {
+
+	usrs_query := commonQueryAllAttributes + " where cast(empl.employee_guid as text) = $1;"
+
+	rows, err := i.Db.Query(context.Background(), usrs_query, emplGUID)
+	if err == pgx.ErrNoRows {
+		return domain.User{}, fmt.Errorf("no rows: repository.GetUserByEmployeeGUIDAllAttributes error: %v", err)
+	} else if err != nil {
+		return domain.User{}, fmt.Errorf("repository.GetUserByEmployeeGUIDAllAttributes error: %v", err)
+	}
+	defer rows.Close()
+
+	usersSlice := handlRowsAllAttributes(rows)
+	if len(usersSlice) == 0 {
+		return domain.User{}, fmt.Errorf("repository.GetUserByEmployeeGUIDAllAttributes error: no rows for employee %s", emplGUID)
+	}
+
+	return usersSlice[0], nil
+}
+
+//***************************************************************************************
+// Расформированные подразделения
+
+// вернём работающих пользователей (физ.лиц), сотрудники которых числятся в подразделениях,
+// расформированных сегодня или раньше (все атрибуты; у пользователя - только такие сотрудники):
+func (i *PostgreInstance) GetActualUsersInClosedDepartaments() ([]domain.User, error) {
+
+	usrs_query := commonQueryAllAttributes +
+		" where state_descr ilike $1 " +
+		"     and dep.zup_not_used_from <> '0001-01-01' and dep.zup_not_used_from <= current_date " +
+		" order by usr.user_name, usr.user_guid;"
+
+	usersSlice := make([]domain.User, 0)
+
+	rows, err := i.Db.Query(context.Background(), usrs_query, "%Работ%")
+	if err == pgx.ErrNoRows {
+		return usersSlice, nil
+	} else if err != nil {
+		return usersSlice, fmt.Errorf("repository.GetActualUsersInClosedDepartaments error: %v", err)
+	}
+	defer rows.Close()
+
+	usersSlice = handlRowsAllAttributes(rows)
+
+	return usersSlice, nil
+}
@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"mdata/internal/domain"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// вернём строки таблицы exchanges (последние - первыми):
+// reasonID > 0 - только с этой причиной обмена, onlyFailed - только неуспешные (resp_status не 200(ok)), limit > 0 - не больше limit строк
+func (i *PostgreInstance) GetExchanges(reasonID int, onlyFailed bool, limit int) ([]domain.ExchangeRecord, error) {
+	query := "select ex_id, base_id, r_id, rowdata, date_init, coalesce(attempt_count, 0), " +
+		"        coalesce(last_attempt_date, '0001-01-01'::timestamp), coalesce(resp_status, '') " +
+		"    from exchanges " +
+		"    where ($1 = 0 or r_id = $1) and (not $2 or coalesce(resp_status, '') <> '200(ok)') " +
+		"    order by ex_id desc"
+	if limit > 0 {
+		query += " limit " + strconv.Itoa(limit)
+	}
+
+	exchangesSlice := make([]domain.ExchangeRecord, 0)
+
+	rows, err := i.Db.Query(context.Background(), query, reasonID, onlyFailed)
+	if err == pgx.ErrNoRows {
+		return exchangesSlice, nil
+	} else if err != nil {
+		return exchangesSlice, fmt.Errorf("repository.GetExchanges error: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		curExch := domain.ExchangeRecord{}
+		err = rows.Scan(&curExch.ExchangeId, &curExch.BaseID, &curExch.ReasonID, &curExch.RowData, &curExch.DateInit,
+			&curExch.AttemptCount, &curExch.LastAttemptDate, &curExch.RespStatus)
+		if err != nil {
+			return exchangesSlice, fmt.Errorf("repository.GetExchanges scan error: %v", err)
+		}
+		exchangesSlice = append(exchangesSlice, curExch)
+	}
+
+	return exchangesSlice, nil
+}
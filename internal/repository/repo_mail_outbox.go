@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"mdata/internal/domain"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// очередь исходящих писем (mail_outbox): письмо сначала записывается, потом его доставляет фоновый обработчик
+
+const mailOutboxColumns = "mail_id, recipients, bcc, subject, body, attachment_name, status, attempt_count, last_error, " +
+	"created_at, next_attempt_at, sent_at"
+
+// запишем письмо в очередь; вернём его номер
+func (i *PostgreInstance) EnqueueMail(job domain.MailJob) (int64, error) {
+	var mailID int64
+	err := i.Db.QueryRow(context.Background(),
+		"INSERT INTO mail_outbox (recipients, bcc, subject, body, html_body, attachment_name, attachment) "+
+			"    VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING mail_id;",
+		job.To, job.Bcc, job.Subject, job.Body, job.HTMLBody, job.AttachmentName, job.Attachment).Scan(&mailID)
+	if err != nil {
+		return 0, fmt.Errorf("repository.EnqueueMail error: %v", err)
+	}
+	return mailID, nil
+}
+
+// возьмём в отправку письма, время очередной попытки которых подошло (не больше limit, с вложениями).
+// Следующую попытку сразу переносим на lease вперёд: если процесс упадёт посреди отправки, письмо отправится повторно,
+// а не потеряется; SKIP LOCKED - чтобы несколько экземпляров MD не взяли одно письмо
+func (i *PostgreInstance) ClaimDueMails(limit int, lease time.Duration) ([]domain.MailOutboxRecord, []domain.MailJob, error) {
+	recordsSlice := make([]domain.MailOutboxRecord, 0)
+	jobsSlice := make([]domain.MailJob, 0)
+
+	rows, err := i.Db.Query(context.Background(),
+		"UPDATE mail_outbox SET next_attempt_at = now() + $2 * interval '1 second' "+
+			"    WHERE mail_id IN (select mail_id from mail_outbox "+
+			"                          where status = 'pending' and next_attempt_at <= now() "+
+			"                          order by next_attempt_at, mail_id limit $1 for update skip locked) "+
+			"    RETURNING "+mailOutboxColumns+", html_body, attachment;",
+		limit, int(lease/time.Second))
+	if err == pgx.ErrNoRows {
+		return recordsSlice, jobsSlice, nil
+	} else if err != nil {
+		return recordsSlice, jobsSlice, fmt.Errorf("repository.ClaimDueMails error: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		curMail := domain.MailOutboxRecord{}
+		var htmlBody string
+		var attachment []byte
+		err = rows.Scan(&curMail.MailID, &curMail.To, &curMail.Bcc, &curMail.Subject, &curMail.Body, &curMail.AttachmentName,
+			&curMail.Status, &curMail.AttemptCount, &curMail.LastError, &curMail.CreatedAt, &curMail.NextAttemptAt, &curMail.SentAt,
+			&htmlBody, &attachment)
+		if err != nil {
+			return recordsSlice, jobsSlice, fmt.Errorf("repository.ClaimDueMails scan error: %v", err)
+		}
+		recordsSlice = append(recordsSlice, curMail)
+		jobsSlice = append(jobsSlice, domain.MailJob{To: curMail.To, Bcc: curMail.Bcc, Subject: curMail.Subject, Body: curMail.Body,
+			HTMLBody: htmlBody, AttachmentName: curMail.AttachmentName, Attachment: attachment})
+	}
+
+	return recordsSlice, jobsSlice, nil
+}
+
+// письмо отправлено
+func (i *PostgreInstance) MarkMailSent(mailID int64) error {
+	_, err := i.Db.Exec(context.Background(),
+		"UPDATE mail_outbox SET status = 'sent', attempt_count = attempt_count + 1, last_error = '', sent_at = now() "+
+			"    WHERE mail_id = $1;",
+		mailID)
+	if err != nil {
+		return fmt.Errorf("repository.MarkMailSent error: %v", err)
+	}
+	return nil
+}
+
+// попытка не удалась: следующая - через retryAfter; если попытки исчерпаны (final) - письмо failed
+func (i *PostgreInstance) MarkMailAttemptFailed(mailID int64, sendErr string, retryAfter time.Duration, final bool) error {
+	status := domain.MailStatusPending
+	if final {
+		status = domain.MailStatusFailed
+	}
+	_, err := i.Db.Exec(context.Background(),
+		"UPDATE mail_outbox SET status = $2, attempt_count = attempt_count + 1, last_error = $3, "+
+			"        next_attempt_at = now() + $4 * interval '1 second' "+
+			"    WHERE mail_id = $1;",
+		mailID, status, sendErr, int(retryAfter/time.Second))
+	if err != nil {
+		return fmt.Errorf("repository.MarkMailAttemptFailed error: %v", err)
+	}
+	return nil
+}
+
+// письма очереди со статусом status (пусто - все), последние - первыми
+func (i *PostgreInstance) GetOutboxMails(status string, limit int) ([]domain.MailOutboxRecord, error) {
+	query := "select " + mailOutboxColumns +
+		"    from mail_outbox " +
+		"    where ($1 = '' or status = $1) " +
+		"    order by mail_id desc"
+	if limit > 0 {
+		query += " limit " + strconv.Itoa(limit)
+	}
+
+	mailsSlice := make([]domain.MailOutboxRecord, 0)
+
+	rows, err := i.Db.Query(context.Background(), query, status)
+	if err == pgx.ErrNoRows {
+		return mailsSlice, nil
+	} else if err != nil {
+		return mailsSlice, fmt.Errorf("repository.GetOutboxMails error: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		curMail := domain.MailOutboxRecord{}
+		err = rows.Scan(&curMail.MailID, &curMail.To, &curMail.Bcc, &curMail.Subject, &curMail.Body, &curMail.AttachmentName,
+			&curMail.Status, &curMail.AttemptCount, &curMail.LastError, &curMail.CreatedAt, &curMail.NextAttemptAt, &curMail.SentAt)
+		if err != nil {
+			return mailsSlice, fmt.Errorf("repository.GetOutboxMails scan error: %v", err)
+		}
+		mailsSlice = append(mailsSlice, curMail)
+	}
+
+	return mailsSlice, nil
+}
+
+// вернём неотправленное (failed) письмо в очередь: попытки - заново, отправка - сразу. "no rows" - нет такого failed-письма
+func (i *PostgreInstance) RetryOutboxMail(mailID int64) (domain.MailOutboxRecord, error) {
+	curMail := domain.MailOutboxRecord{}
+	err := i.Db.QueryRow(context.Background(),
+		"UPDATE mail_outbox SET status = 'pending', attempt_count = 0, next_attempt_at = now() "+
+			"    WHERE mail_id = $1 and status = 'failed' "+
+			"    RETURNING "+mailOutboxColumns+";",
+		mailID).Scan(&curMail.MailID, &curMail.To, &curMail.Bcc, &curMail.Subject, &curMail.Body, &curMail.AttachmentName,
+		&curMail.Status, &curMail.AttemptCount, &curMail.LastError, &curMail.CreatedAt, &curMail.NextAttemptAt, &curMail.SentAt)
+	if err == pgx.ErrNoRows {
+		return curMail, fmt.Errorf("no rows: repository.RetryOutboxMail error: no failed mail %d", mailID)
+	} else if err != nil {
+		return curMail, fmt.Errorf("repository.RetryOutboxMail error: %v", err)
+	}
+	return curMail, nil
+}
@@ -0,0 +1,273 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	config "mdata/configs"
+	"mdata/internal/domain"
+	log "mdata/pkg/logging"
+
+	"github.com/jackc/pgx/v4"
+)
+
+//***************************************************************************************
+// Типы рассылок и их подписчики (управляются через api /api/v1/notification-types).
+// Ошибки "no rows: ..." - нет такого типа / подписчика, "conflict: ..." - операция противоречит текущим данным
+
+// рассылки, которые отправляет сам MD: такие типы удалять нельзя
+var builtInNotificationTypes = map[int]bool{
+	config.NotiTypeAdmin:              true,
+	config.NotiTypeBuch:               true,
+	config.NotiType1CCreateUser:       true,
+	config.NotiTypeClosedDepartaments: true,
+	config.NotiTypeWorkAnniversaries:  true,
+	config.NotiTypeStaffChanges:       true,
+}
+
+// вернём получателей рассылки notitype. Если у рассылки нет ни одного адреса - администраторам MD (с записью в лог),
+// чтобы письмо не пропало; если нет и их - ошибка "no rows"
+func (ins *PostgreInstance) GetNotificationRecipients(notitype int) ([]string, error) {
+	recipients, err := ins.GetUserEmailsByNotificationsTypes(notitype)
+	if err != nil {
+		return recipients, fmt.Errorf("repository.GetNotificationRecipients error: %v", err)
+	}
+	if len(recipients) > 0 || notitype == config.NotiTypeAdmin {
+		if len(recipients) == 0 {
+			return recipients, fmt.Errorf("no rows: repository.GetNotificationRecipients error: no recipients for notification type %d", notitype)
+		}
+		return recipients, nil
+	}
+
+	log.Error("repository.GetNotificationRecipients: no recipients for notification type %d, sending to admins", notitype)
+	admins, err := ins.GetUserEmailsByNotificationsTypes(config.NotiTypeAdmin)
+	if err != nil {
+		return admins, fmt.Errorf("repository.GetNotificationRecipients error: %v", err)
+	}
+	if len(admins) == 0 {
+		return admins, fmt.Errorf("no rows: repository.GetNotificationRecipients error: no recipients for notification type %d and no admins", notitype)
+	}
+	return admins, nil
+}
+
+// адрес скрытой копии рассылок - первый администратор MD; пусто (с записью в лог), если администраторов нет
+func (ins *PostgreInstance) GetBccAdmin() string {
+	admins, err := ins.GetUserEmailsByNotificationsTypes(config.NotiTypeAdmin)
+	if err != nil {
+		log.Error("repository.GetBccAdmin error: %v", err)
+		return ""
+	}
+	if len(admins) == 0 {
+		log.Error("repository.GetBccAdmin error: no admins (notification type %d)", config.NotiTypeAdmin)
+		return ""
+	}
+	return admins[0]
+}
+
+//---------------------------------------
+// типы рассылок
+
+func (ins *PostgreInstance) GetNotificationTypes() ([]domain.NotificationType, error) {
+	typesSlice := make([]domain.NotificationType, 0)
+
+	rows, err := ins.Db.Query(context.Background(),
+		"select n.id, n.notification_type, "+
+			"        (select count(*) from users_for_notifications un where un.notitype = n.id) "+
+			"    from notifications n "+
+			"    order by n.id;")
+	if err == pgx.ErrNoRows {
+		return typesSlice, nil
+	} else if err != nil {
+		return typesSlice, fmt.Errorf("repository.GetNotificationTypes error: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		curType := domain.NotificationType{}
+		err = rows.Scan(&curType.ID, &curType.Name, &curType.SubscribersCount)
+		if err != nil {
+			return typesSlice, fmt.Errorf("repository.GetNotificationTypes scan error: %v", err)
+		}
+		curType.BuiltIn = builtInNotificationTypes[curType.ID]
+		typesSlice = append(typesSlice, curType)
+	}
+
+	return typesSlice, nil
+}
+
+// "no rows" - нет такого типа
+func (ins *PostgreInstance) GetNotificationType(id int) (domain.NotificationType, error) {
+	curType := domain.NotificationType{}
+	err := ins.Db.QueryRow(context.Background(),
+		"select n.id, n.notification_type, "+
+			"        (select count(*) from users_for_notifications un where un.notitype = n.id) "+
+			"    from notifications n "+
+			"    where n.id = $1;", id).Scan(&curType.ID, &curType.Name, &curType.SubscribersCount)
+	if err == pgx.ErrNoRows {
+		return curType, fmt.Errorf("no rows: repository.GetNotificationType error: no notification type %d", id)
+	} else if err != nil {
+		return curType, fmt.Errorf("repository.GetNotificationType error: %v", err)
+	}
+	curType.BuiltIn = builtInNotificationTypes[curType.ID]
+	return curType, nil
+}
+
+// добавим тип рассылки (id - из последовательности notifications_custom_id_seq, от config.NotiTypeCustomMin: меньшие - для встроенных)
+func (ins *PostgreInstance) AddNotificationType(name string) (domain.NotificationType, error) {
+	var id int
+	err := ins.Db.QueryRow(context.Background(),
+		"INSERT INTO notifications (id, notification_type) VALUES (nextval('notifications_custom_id_seq'), $1) RETURNING id;",
+		name).Scan(&id)
+	if err != nil {
+		return domain.NotificationType{}, fmt.Errorf("repository.AddNotificationType error: %v", err)
+	}
+	return ins.GetNotificationType(id)
+}
+
+func (ins *PostgreInstance) RenameNotificationType(id int, name string) (domain.NotificationType, error) {
+	commandTag, err := ins.Db.Exec(context.Background(), "UPDATE notifications SET notification_type = $2 WHERE id = $1;", id, name)
+	if err != nil {
+		return domain.NotificationType{}, fmt.Errorf("repository.RenameNotificationType error: %v", err)
+	}
+	if commandTag.RowsAffected() == 0 {
+		return domain.NotificationType{}, fmt.Errorf("no rows: repository.RenameNotificationType error: no notification type %d", id)
+	}
+	return ins.GetNotificationType(id)
+}
+
+// удалим тип рассылки. Встроенные и с подписчиками - нельзя ("conflict")
+func (ins *PostgreInstance) DeleteNotificationType(id int) error {
+	curType, err := ins.GetNotificationType(id)
+	if err != nil {
+		return err
+	}
+	if curType.BuiltIn {
+		return fmt.Errorf("conflict: notification type %d is sent by MD and can not be deleted", id)
+	}
+	if curType.SubscribersCount > 0 {
+		return fmt.Errorf("conflict: notification type %d has %d subscribers, delete them first", id, curType.SubscribersCount)
+	}
+	_, err = ins.Db.Exec(context.Background(), "DELETE FROM notifications WHERE id = $1;", id)
+	if err != nil {
+		return fmt.Errorf("repository.DeleteNotificationType error: %v", err)
+	}
+	return nil
+}
+
+//---------------------------------------
+// подписчики
+
+const notificationSubscribersQuery = "select un.subscriber_id, un.notitype, coalesce(cast(un.user_guid as text), ''), " +
+	"        coalesce(usr.user_name, ''), case when un.email <> '' then un.email else coalesce(usr.email, '') end " +
+	"    from users_for_notifications un " +
+	"        left join users usr on un.user_guid = usr.user_guid "
+
+func scanNotificationSubscribers(rows pgx.Rows) ([]domain.NotificationSubscriber, error) {
+	subscribersSlice := make([]domain.NotificationSubscriber, 0)
+	for rows.Next() {
+		curSubscriber := domain.NotificationSubscriber{}
+		err := rows.Scan(&curSubscriber.SubscriberID, &curSubscriber.NotiType, &curSubscriber.UserGUID,
+			&curSubscriber.UserName, &curSubscriber.Email)
+		if err != nil {
+			return subscribersSlice, err
+		}
+		subscribersSlice = append(subscribersSlice, curSubscriber)
+	}
+	return subscribersSlice, nil
+}
+
+// подписчики типа рассылки. "no rows" - нет такого типа
+func (ins *PostgreInstance) GetNotificationSubscribers(notitype int) ([]domain.NotificationSubscriber, error) {
+	if _, err := ins.GetNotificationType(notitype); err != nil {
+		return nil, err
+	}
+
+	rows, err := ins.Db.Query(context.Background(),
+		notificationSubscribersQuery+" where un.notitype = $1 order by un.subscriber_id;", notitype)
+	if err == pgx.ErrNoRows {
+		return make([]domain.NotificationSubscriber, 0), nil
+	} else if err != nil {
+		return nil, fmt.Errorf("repository.GetNotificationSubscribers error: %v", err)
+	}
+	defer rows.Close()
+
+	subscribersSlice, err := scanNotificationSubscribers(rows)
+	if err != nil {
+		return subscribersSlice, fmt.Errorf("repository.GetNotificationSubscribers scan error: %v", err)
+	}
+	return subscribersSlice, nil
+}
+
+// подпишем на рассылку user-а (userGUID) или произвольный адрес (email) - задаётся что-то одно.
+// "no rows" - нет такого типа или user-а; "conflict" - уже подписан (в т.ч. одновременным запросом - уникальный индекс), у user-а нет email-а
+func (ins *PostgreInstance) AddNotificationSubscriber(notitype int, userGUID, email string) (domain.NotificationSubscriber, error) {
+	subscriber := domain.NotificationSubscriber{}
+	subscribersSlice, err := ins.GetNotificationSubscribers(notitype)
+	if err != nil {
+		return subscriber, err
+	}
+
+	if userGUID != "" {
+		usersSlice, err := ins.GetUsersBySliceOfGUID([]string{userGUID})
+		if err != nil {
+			return subscriber, fmt.Errorf("repository.AddNotificationSubscriber error: %v", err)
+		}
+		if len(usersSlice) == 0 {
+			return subscriber, fmt.Errorf("no rows: repository.AddNotificationSubscriber error: no user %s", userGUID)
+		}
+		if strings.TrimSpace(usersSlice[0].UserEmail) == "" {
+			return subscriber, fmt.Errorf("conflict: user %s has no email", usersSlice[0].UserName)
+		}
+		for _, curSubscriber := range subscribersSlice {
+			if strings.EqualFold(curSubscriber.UserGUID, userGUID) {
+				return subscriber, fmt.Errorf("conflict: user %s is already subscribed (subscriberId %d)", usersSlice[0].UserName, curSubscriber.SubscriberID)
+			}
+		}
+	} else {
+		for _, curSubscriber := range subscribersSlice {
+			if strings.EqualFold(curSubscriber.Email, email) {
+				return subscriber, fmt.Errorf("conflict: %s is already subscribed (subscriberId %d)", email, curSubscriber.SubscriberID)
+			}
+		}
+	}
+
+	var subscriberID int64
+	var guidParam interface{}
+	if userGUID != "" {
+		guidParam = userGUID
+	}
+	err = ins.Db.QueryRow(context.Background(),
+		"INSERT INTO users_for_notifications (notitype, user_guid, email) VALUES ($1, $2, $3) RETURNING subscriber_id;",
+		notitype, guidParam, email).Scan(&subscriberID)
+	if err != nil {
+		if strings.Contains(err.Error(), "SQLSTATE 23505") {
+			if userGUID != "" {
+				return subscriber, fmt.Errorf("conflict: user %s is already subscribed", userGUID)
+			}
+			return subscriber, fmt.Errorf("conflict: %s is already subscribed", email)
+		}
+		return subscriber, fmt.Errorf("repository.AddNotificationSubscriber error: %v", err)
+	}
+
+	err = ins.Db.QueryRow(context.Background(),
+		notificationSubscribersQuery+" where un.subscriber_id = $1;", subscriberID).Scan(&subscriber.SubscriberID,
+		&subscriber.NotiType, &subscriber.UserGUID, &subscriber.UserName, &subscriber.Email)
+	if err != nil {
+		return subscriber, fmt.Errorf("repository.AddNotificationSubscriber error: %v", err)
+	}
+	return subscriber, nil
+}
+
+// отпишем подписчика. "no rows" - нет такой подписки у типа
+func (ins *PostgreInstance) DeleteNotificationSubscriber(notitype int, subscriberID int64) error {
+	commandTag, err := ins.Db.Exec(context.Background(),
+		"DELETE FROM users_for_notifications WHERE notitype = $1 and subscriber_id = $2;", notitype, subscriberID)
+	if err != nil {
+		return fmt.Errorf("repository.DeleteNotificationSubscriber error: %v", err)
+	}
+	if commandTag.RowsAffected() == 0 {
+		return fmt.Errorf("no rows: repository.DeleteNotificationSubscriber error: no subscriber %d for notification type %d", subscriberID, notitype)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"mdata/internal/domain"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// вернём список должностей работающих сотрудников с количеством сотрудников на каждой:
+func (i *PostgreInstance) GetActualPositions() ([]domain.PositionCount, error) {
+	const pos_query = "select pos.position_descr, count(distinct empl.employee_guid) " +
+		"    from positions pos " +
+		"        join employees empl on pos.employee_guid=empl.employee_guid " +
+		"        join employee_states emplCS on emplCS.employee_guid=empl.employee_guid " +
+		"    where emplCS.state_descr ilike $1 " +
+		"    group by pos.position_descr " +
+		"    order by pos.position_descr;"
+
+	positionsSlice := make([]domain.PositionCount, 0)
+
+	rows, err := i.Db.Query(context.Background(), pos_query, "%Работ%")
+	if err == pgx.ErrNoRows {
+		return positionsSlice, nil
+	} else if err != nil {
+		return positionsSlice, fmt.Errorf("repository.GetActualPositions error: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		curPos := domain.PositionCount{}
+		rows.Scan(&curPos.PositionDescr, &curPos.EmployeesCount)
+		positionsSlice = append(positionsSlice, curPos)
+	}
+
+	return positionsSlice, nil
+}
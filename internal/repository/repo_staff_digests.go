@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"mdata/internal/domain"
+
+	"github.com/jackc/pgx/v4"
+)
+
+//***************************************************************************************
+// Дайджесты отдела кадров по состояниям сотрудников (employee_states), которые приходят с загрузкой из 1С:ЗУП:
+// годовщины работы (от даты приёма employees.employee_hire_date - дата состояния "Работа" сдвигается после
+// отпуска по уходу за ребенком) и принятые / уволенные за период.
+// Новым считаем сотрудника, которого загрузка добавила недавно (событие create в ленте changes) -
+// так вернувшиеся из отпуска по уходу за ребенком не попадают в принятые
+
+// приём в 1С оформляют заранее: сотрудник мог появиться в ленте раньше даты приёма
+const staffHireLookbackDays = 60
+
+// перевод через увольнение: увольнение и приём того же физ.лица в пределах этого интервала - не увольнение и не приём
+const staffTransferInterval = "interval '3 days'"
+
+// dateColumn - дата сотрудника в дайджесте (StateDate): дата состояния или дата приёма
+func staffDigestQuery(dateColumn string) string {
+	return "select cast(usr.user_guid as text), usr.user_name, coalesce(empl.employee_tabno, ''), " +
+		"        coalesce(cast(dep.departament_guid as text), ''), coalesce(dep.departament_descr, ''), coalesce(pos.position_descr, ''), " +
+		"        " + dateColumn + " "
+}
+
+const staffDigestJoins = "    from users usr " +
+	"        inner join employees empl on usr.user_guid=empl.employee_user " +
+	"        inner join employee_states emplCS on emplCS.employee_guid=empl.employee_guid " +
+	"        left join departaments dep on empl.employee_departament=dep.departament_guid " +
+	"        left join positions pos on pos.employee_guid=empl.employee_guid "
+
+func scanStaffDigestEmployees(rows pgx.Rows, withAnniversary bool) ([]domain.StaffDigestEmployee, error) {
+	emplSlice := make([]domain.StaffDigestEmployee, 0)
+	for rows.Next() {
+		empl := domain.StaffDigestEmployee{}
+		dests := []interface{}{&empl.UserGUID, &empl.UserName, &empl.TabNumber,
+			&empl.DepartamentGUID, &empl.DepartamentDescr, &empl.PositionDescr, &empl.StateDate}
+		if withAnniversary {
+			empl.Date = new(domain.CastDate)
+			dests = append(dests, empl.Date, &empl.Years)
+		}
+		if err := rows.Scan(dests...); err != nil {
+			return emplSlice, err
+		}
+		emplSlice = append(emplSlice, empl)
+	}
+	return emplSlice, nil
+}
+
+// работающие сотрудники, годовщина приёма которых отмечается в период from - to включительно (от года и больше),
+// по подразделениям и датам. Сотрудники без даты приёма (загружены до появления ленты changes или не работали
+// при первой загрузке) не попадают. Принятых 29 февраля в невисокосный год - по политике bdFeb29Policy, как и ДР
+func (ins *PostgreInstance) GetWorkAnniversariesByDates(from, to time.Time) ([]domain.StaffDigestEmployee, error) {
+	query := staffDigestQuery("empl.employee_hire_date") + ", bd_days.occurs, " +
+		"        cast(extract(year from bd_days.occurs) - extract(year from empl.employee_hire_date) as int) " +
+		staffDigestJoins + bdDaysJoin("empl.employee_hire_date") +
+		"    where emplCS.state_descr ilike $4 and empl.employee_hire_date > '0001-01-01' " +
+		"        and extract(year from bd_days.occurs) > extract(year from empl.employee_hire_date) " +
+		"    order by dep.departament_descr, bd_days.occurs, usr.user_name;"
+
+	months, days, dates := bdDaysInRange(from, to, bdFeb29Policy)
+
+	rows, err := ins.Db.Query(context.Background(), query, months, days, dates, "%Работ%")
+	if err == pgx.ErrNoRows {
+		return make([]domain.StaffDigestEmployee, 0), nil
+	} else if err != nil {
+		return nil, fmt.Errorf("repository.GetWorkAnniversariesByDates error: %v", err)
+	}
+	defer rows.Close()
+
+	emplSlice, err := scanStaffDigestEmployees(rows, true)
+	if err != nil {
+		return emplSlice, fmt.Errorf("repository.GetWorkAnniversariesByDates scan error: %v", err)
+	}
+	return emplSlice, nil
+}
+
+// принятые (hired) и уволенные (fired) в период from - to включительно, по подразделениям и ФИО.
+// Уволенные - без тех, у кого остались работающие сотрудники; переведённые через увольнение - ни там, ни там
+func (ins *PostgreInstance) GetStaffChangesByDates(from, to time.Time) (hired, fired []domain.StaffDigestEmployee, err error) {
+	// $1, $2 - период, $3 - "работает", $4 - "уволен", $5 - с какой даты искать событие create
+	hiredQuery := staffDigestQuery("emplCS.state_date_from") + staffDigestJoins +
+		"    where emplCS.state_descr ilike $3 and emplCS.state_date_from between $1::date and $2::date " +
+		"        and exists (select 1 from changes ch " +
+		"            where ch.entity = 'employee' and ch.change_type = 'create' " +
+		"                and ch.entity_guid = cast(empl.employee_guid as text) and ch.change_date >= $5) " +
+		"        and not exists (select 1 from employees empl2 " +
+		"            inner join employee_states emplCS2 on emplCS2.employee_guid=empl2.employee_guid " +
+		"            where empl2.employee_user = usr.user_guid and empl2.employee_guid <> empl.employee_guid " +
+		"                and emplCS2.state_descr ilike $4 " +
+		"                and emplCS2.state_date_from between emplCS.state_date_from - " + staffTransferInterval +
+		"                    and emplCS.state_date_from + " + staffTransferInterval + ") " +
+		"    order by dep.departament_descr, usr.user_name;"
+
+	// $1, $2 - период, $3 - "работает", $4 - "уволен"
+	firedQuery := staffDigestQuery("emplCS.state_date_from") + staffDigestJoins +
+		"    where emplCS.state_descr ilike $4 and emplCS.state_date_from between $1::date and $2::date " +
+		"        and not exists (select 1 from employees empl2 " +
+		"            inner join employee_states emplCS2 on emplCS2.employee_guid=empl2.employee_guid " +
+		"            where empl2.employee_user = usr.user_guid and emplCS2.state_descr ilike $3) " +
+		"    order by dep.departament_descr, usr.user_name;"
+
+	hired, err = ins.getStaffDigestEmployees(hiredQuery, from, to, "%Работ%", "%Увольнен%", from.AddDate(0, 0, -staffHireLookbackDays))
+	if err != nil {
+		return hired, fired, fmt.Errorf("repository.GetStaffChangesByDates hired error: %v", err)
+	}
+	fired, err = ins.getStaffDigestEmployees(firedQuery, from, to, "%Работ%", "%Увольнен%")
+	if err != nil {
+		return hired, fired, fmt.Errorf("repository.GetStaffChangesByDates fired error: %v", err)
+	}
+	return hired, fired, nil
+}
+
+func (ins *PostgreInstance) getStaffDigestEmployees(query string, args ...interface{}) ([]domain.StaffDigestEmployee, error) {
+	rows, err := ins.Db.Query(context.Background(), query, args...)
+	if err == pgx.ErrNoRows {
+		return make([]domain.StaffDigestEmployee, 0), nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanStaffDigestEmployees(rows, false)
+}
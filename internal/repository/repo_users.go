@@ -64,7 +64,7 @@ func (i *PostgreInstance) GetUsersFiredFrom(from time.Time) ([]domain.User, erro
 	if err != nil {
 		return firedUsersSlice, err
 	}
-	const usrs_query = commonQueryLightVersionAttributes + " where state_descr ilike $1 and state_date_from >= $2;"
+	usrs_query := commonQueryLightVersionAttributes + " where state_descr ilike $1 and state_date_from >= $2;"
 
 	rows, err := i.Db.Query(ctx, usrs_query, "%Увольнен%", from)
 	if err == pgx.ErrNoRows {
@@ -76,7 +76,10 @@ func (i *PostgreInstance) GetUsersFiredFrom(from time.Time) ([]domain.User, erro
 	defer rows.Close()
 
 	// получаем полную map-у уволенных, в т.ч. тех, кто вернулся, переведен через увольнение и т.д.
-	firedUsersMap := handlRowsLightVersionAttributesToMap(rows)
+	firedUsersMap := make(map[string]domain.User)
+	for _, user := range handlRowsLightVersionAttributes(rows) {
+		firedUsersMap[user.UserGUID] = user
+	}
 
 	// пробежим по map-е исключений (mapOfUsers) и выкинем их из полученной (firedUsersMap):
 	for userGuid, _ := range mapOfUsers {
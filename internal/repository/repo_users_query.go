@@ -0,0 +1,325 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"mdata/internal/domain"
+
+	"github.com/jackc/pgx/v4"
+)
+
+//***************************************************************************************
+// Построитель запросов по user-ам (физ.лицам) вместе с их сотрудниками.
+// Набор колонок определяется запрошенными полями (как они называются в json), условия - фильтром (domain.EmployeesFilter).
+// "Все аттрибуты" и "облегчённая версия" - это просто два фиксированных набора полей.
+
+// колонка выборки: поле user-а или сотрудника (имя как в json, для fields=), выражение в select и куда сканировать
+type userColumn struct {
+	field string
+	expr  string
+	dest  func(u *domain.User, e *domain.Employee) interface{}
+}
+
+// все колонки в порядке выборки. Поля-структуры сотрудника (departament, position и т.д.) выбираются целиком
+var usersColumns = []userColumn{
+	{"userGuid", "usr.user_guid", func(u *domain.User, e *domain.Employee) interface{} { return &u.UserGUID }},
+	{"userName", "usr.user_name", func(u *domain.User, e *domain.Employee) interface{} { return &u.UserName }},
+	{"userId", "usr.user_id", func(u *domain.User, e *domain.Employee) interface{} { return &u.UserID }},
+	{"userBirthday", "usr.user_birthday", func(u *domain.User, e *domain.Employee) interface{} { return &u.UserBirthday }},
+	{"userEmail", "usr.email", func(u *domain.User, e *domain.Employee) interface{} { return &u.UserEmail }},
+
+	{"employeeGuid", "empl.employee_guid", func(u *domain.User, e *domain.Employee) interface{} { return &e.EmployeeGUID }},
+	{"employeeId", "empl.employee_id", func(u *domain.User, e *domain.Employee) interface{} { return &e.EmployeeId }},
+	{"tabNumber", "empl.employee_tabno", func(u *domain.User, e *domain.Employee) interface{} { return &e.EmpTabNumber }},
+	{"employment", "empl.employment", func(u *domain.User, e *domain.Employee) interface{} { return &e.Employment }},
+	{"employeeAdress", "empl.employee_adress", func(u *domain.User, e *domain.Employee) interface{} { return &e.EmployeeAdress }},
+
+	{"departament", "dep.departament_guid", func(u *domain.User, e *domain.Employee) interface{} { return &e.EmployeeDepartament.DepartamentGUID }},
+	{"departament", "dep.zup_id", func(u *domain.User, e *domain.Employee) interface{} { return &e.EmployeeDepartament.DepartamentIdZUP }},
+	{"departament", "dep.departament_descr", func(u *domain.User, e *domain.Employee) interface{} { return &e.EmployeeDepartament.DepartamentDescr }},
+	{"departament", "dep.zup_parent_id", func(u *domain.User, e *domain.Employee) interface{} {
+		return &e.EmployeeDepartament.DepartamentParentIdZUP
+	}},
+	{"departament", "dep.departament_parent_guid", func(u *domain.User, e *domain.Employee) interface{} {
+		return &e.EmployeeDepartament.DepartamentParentGUID
+	}},
+	{"departament", "dep.zup_not_used_from", func(u *domain.User, e *domain.Employee) interface{} {
+		return &e.EmployeeDepartament.DepartamentNotUsedFrom
+	}},
+
+	{"position", "pos.position_guid", func(u *domain.User, e *domain.Employee) interface{} { return &e.EmployeePosition.PositionGUID }},
+	{"position", "pos.position_descr", func(u *domain.User, e *domain.Employee) interface{} { return &e.EmployeePosition.PositionDescr }},
+
+	{"positionShr", "pshr.pshr_guid", func(u *domain.User, e *domain.Employee) interface{} { return &e.EmployeePshr.PshrGUID }},
+	{"positionShr", "pshr.pshr_id", func(u *domain.User, e *domain.Employee) interface{} { return &e.EmployeePshr.PshrId }},
+	{"positionShr", "pshr.pshr_descr", func(u *domain.User, e *domain.Employee) interface{} { return &e.EmployeePshr.PshrDescr }},
+
+	{"currentState", "emplCS.state_descr", func(u *domain.User, e *domain.Employee) interface{} { return &e.EmployeeCurrentState.StateName }},
+	{"currentState", "emplCS.state_date_from", func(u *domain.User, e *domain.Employee) interface{} { return &e.EmployeeCurrentState.DateFrom }},
+}
+
+// поля user-а (остальные - поля сотрудника); "employees" - все поля сотрудника
+var userLevelFields = map[string]bool{"userGuid": true, "userName": true, "userId": true, "userBirthday": true, "userEmail": true}
+
+// облегчённая версия
+var LightVersionFields = []string{"userGuid", "userName", "userId", "userEmail",
+	"employeeId", "tabNumber", "employment", "employeeAdress", "departament", "position", "currentState"}
+
+// колонки облегчённой версии - как в исходном запросе для 1С: из подразделения и должности - не все колонки поля
+var lightVersionExprs = map[string]bool{
+	"usr.user_guid": true, "usr.user_name": true, "usr.user_id": true, "usr.email": true,
+	"empl.employee_id": true, "empl.employee_tabno": true, "empl.employment": true, "empl.employee_adress": true,
+	"dep.zup_id": true, "dep.departament_descr": true,
+	"pos.position_descr": true,
+	"emplCS.state_descr": true, "emplCS.state_date_from": true,
+}
+
+const usersFromJoins = "    from users usr " +
+	"        left join employees empl on usr.user_guid=empl.employee_user " +
+	"        left join departaments dep on empl.employee_departament=dep.departament_guid " +
+	"        left join positions pos on pos.employee_guid=empl.employee_guid " +
+	"        left join employee_states emplCS on emplCS.employee_guid=empl.employee_guid "
+
+// штатные позиции присоединяем только когда они запрошены (строк в pshr_list может быть несколько на сотрудника)
+const usersPshrJoin = "        left join pshr_list pshr on pshr.employee_guid=empl.employee_guid "
+
+var (
+	allAttributesColumns, _ = selectUsersColumns(nil)
+	lightVersionColumns, _  = selectUsersColumns(LightVersionFields)
+
+	// все аттрибуты
+	commonQueryAllAttributes = buildUsersSelect(allAttributesColumns)
+	// облегченные (не все аттрибуты)
+	commonQueryLightVersionAttributes = buildUsersSelect(lightVersionColumns)
+)
+
+// проверим, что все запрошенные поля (fields=) нам известны
+func ValidateUsersFields(fields []string) error {
+	_, err := selectUsersColumns(fields)
+	return err
+}
+
+// колонки по списку полей (пустой список - все поля, LightVersionFields - колонки облегчённой версии).
+// userGuid выбираем всегда - по нему собираем сотрудников user-а
+func selectUsersColumns(fields []string) ([]userColumn, error) {
+	if len(fields) == 0 {
+		return usersColumns, nil
+	}
+	if isLightVersionFields(fields) {
+		cols := make([]userColumn, 0, len(lightVersionExprs))
+		for _, col := range usersColumns {
+			if lightVersionExprs[col.expr] {
+				cols = append(cols, col)
+			}
+		}
+		return cols, nil
+	}
+
+	fieldsMap := map[string]bool{"userGuid": true}
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if field == "employees" {
+			for _, col := range usersColumns {
+				if !userLevelFields[col.field] {
+					fieldsMap[col.field] = true
+				}
+			}
+			continue
+		}
+		known := false
+		for _, col := range usersColumns {
+			if col.field == field {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("repository.selectUsersColumns error: неизвестное поле %q", field)
+		}
+		fieldsMap[field] = true
+	}
+
+	cols := make([]userColumn, 0, len(usersColumns))
+	for _, col := range usersColumns {
+		if fieldsMap[col.field] {
+			cols = append(cols, col)
+		}
+	}
+	return cols, nil
+}
+
+func isLightVersionFields(fields []string) bool {
+	if len(fields) != len(LightVersionFields) {
+		return false
+	}
+	for k, field := range fields {
+		if strings.TrimSpace(field) != LightVersionFields[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// select + from + join-ы для выбранных колонок (условия дописывает вызывающий)
+func buildUsersSelect(cols []userColumn) string {
+	exprs := make([]string, 0, len(cols))
+	needPshr := false
+	for _, col := range cols {
+		exprs = append(exprs, col.expr)
+		if strings.HasPrefix(col.expr, "pshr.") {
+			needPshr = true
+		}
+	}
+
+	query := "select " + strings.Join(exprs, ", ") + usersFromJoins
+	if needPshr {
+		query += usersPshrJoin
+	}
+	return query
+}
+
+// условия выборки по фильтру. Параметры нумеруются с $1
+func buildUsersWhere(f domain.EmployeesFilter) (string, []interface{}) {
+	conds := make([]string, 0)
+	args := make([]interface{}, 0)
+	addCond := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, strings.Replace(cond, "?", "$"+strconv.Itoa(len(args)), 1))
+	}
+
+	state := f.State
+	if state == "" {
+		state = "Работ"
+	}
+	addCond("emplCS.state_descr ilike ?", "%"+state+"%")
+	if f.TabNo != "" {
+		addCond("usr.user_id ilike ?", "%"+f.TabNo+"%")
+	}
+	if f.Name != "" {
+		addCond("usr.user_name ilike ?", "%"+f.Name+"%")
+	}
+	if f.DepartamentGUID != "" {
+		addCond("cast(dep.departament_guid as text) = ?", f.DepartamentGUID)
+	}
+	if f.Position != "" {
+		addCond("pos.position_descr ilike ?", "%"+f.Position+"%")
+	}
+	if f.Employment != "" {
+		addCond("empl.employment ilike ?", "%"+f.Employment+"%")
+	}
+	if f.HasEmail != nil {
+		if *f.HasEmail {
+			conds = append(conds, "coalesce(usr.email, '') <> ''")
+		} else {
+			conds = append(conds, "coalesce(usr.email, '') = ''")
+		}
+	}
+	if f.BirthdayMonth > 0 {
+		addCond("extract(month from usr.user_birthday) = ?", f.BirthdayMonth)
+	}
+
+	return " where " + strings.Join(conds, " and "), args
+}
+
+// собираем строки выборки в user-ов с их сотрудниками (строки одного user-а идут подряд)
+func handlRowsUsers(rows pgx.Rows, cols []userColumn) []domain.User {
+	allUsersSlice := make([]domain.User, 0, 1000)
+	var oldUser = domain.User{}
+	empSlice := make([]domain.Employee, 0, 2)
+
+	for rows.Next() {
+
+		curUser := new(domain.User)
+		curEmpl := new(domain.Employee)
+		dests := make([]interface{}, len(cols))
+		for k, col := range cols {
+			dests[k] = col.dest(curUser, curEmpl)
+		}
+		rows.Scan(dests...)
+
+		if (oldUser.UserGUID != "") && (curUser.UserGUID != oldUser.UserGUID) {
+			oldUser.Employees = empSlice
+			allUsersSlice = append(allUsersSlice, oldUser)
+			empSlice = make([]domain.Employee, 0, 2)
+		}
+
+		empSlice = append(empSlice, *curEmpl)
+		oldUser = *curUser
+	}
+	if oldUser.UserGUID == "" { // строк не было
+		return allUsersSlice
+	}
+	oldUser.Employees = empSlice
+	allUsersSlice = append(allUsersSlice, oldUser)
+
+	return allUsersSlice
+}
+
+func handlRowsAllAttributes(rows pgx.Rows) []domain.User {
+	return handlRowsUsers(rows, allAttributesColumns)
+}
+
+func handlRowsLightVersionAttributes(rows pgx.Rows) []domain.User {
+	return handlRowsUsers(rows, lightVersionColumns)
+}
+
+// вернём user-ов по фильтру с запрошенными полями и общее количество подходящих user-ов.
+// Постранично: f.Limit > 0 - размер страницы; f.Cursor - guid последнего user-а предыдущей страницы (тогда f.Offset не нужен).
+// user-ы на странице упорядочены по guid
+func (i *PostgreInstance) GetUsersByFilter(f domain.EmployeesFilter) ([]domain.User, int, error) {
+	usersSlice := make([]domain.User, 0)
+
+	cols, err := selectUsersColumns(f.Fields)
+	if err != nil {
+		return usersSlice, 0, err
+	}
+	where, args := buildUsersWhere(f)
+
+	// общее количество user-ов по фильтру
+	var total int
+	err = i.Db.QueryRow(context.Background(), "select count(distinct usr.user_guid)"+usersFromJoins+where, args...).Scan(&total)
+	if err != nil {
+		return usersSlice, 0, fmt.Errorf("repository.GetUsersByFilter count error: %v", err)
+	}
+
+	usrs_query := buildUsersSelect(cols) + where
+	if f.Limit > 0 || f.Offset > 0 || f.Cursor != "" {
+		// страница - guid-ы user-ов (условия те же, плюс курсор)
+		pageWhere := where
+		pageArgs := append(make([]interface{}, 0, len(args)+3), args...)
+		if f.Cursor != "" {
+			pageArgs = append(pageArgs, f.Cursor)
+			pageWhere += " and usr.user_guid > $" + strconv.Itoa(len(pageArgs)) + "::uuid"
+		}
+		page := "select distinct usr.user_guid" + usersFromJoins + pageWhere + " order by usr.user_guid"
+		if f.Limit > 0 {
+			pageArgs = append(pageArgs, f.Limit)
+			page += " limit $" + strconv.Itoa(len(pageArgs))
+		}
+		if f.Offset > 0 {
+			pageArgs = append(pageArgs, f.Offset)
+			page += " offset $" + strconv.Itoa(len(pageArgs))
+		}
+		usrs_query += " and usr.user_guid in (" + page + ")"
+		args = pageArgs
+	}
+	usrs_query += " order by usr.user_guid, empl.employee_tabno;"
+
+	rows, err := i.Db.Query(context.Background(), usrs_query, args...)
+	if err == pgx.ErrNoRows {
+		return usersSlice, total, nil
+	} else if err != nil {
+		return usersSlice, total, fmt.Errorf("repository.GetUsersByFilter error: %v", err)
+	}
+	defer rows.Close()
+
+	usersSlice = handlRowsUsers(rows, cols)
+
+	return usersSlice, total, nil
+}
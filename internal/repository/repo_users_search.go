@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"mdata/internal/domain"
+
+	"github.com/jackc/pgx/v4"
+)
+
+//***************************************************************************************
+// Поиск user-ов (физ.лиц) по нескольким критериям сразу. ФИО ищем нечётко (pg_trgm, см. migrations/00003_users_name_trgm.sql)
+
+// ФИО в базе, приведённое к виду для сравнения: нижний регистр, ё -> е
+const normUserName = "replace(lower(usr.user_name), 'ё', 'е')"
+
+// минимальная похожесть ФИО (word_similarity: 0 - ничего общего, 1 - запрос целиком есть в ФИО).
+// Отбор - оператором "<%" (его поддерживает индекс users_user_name_trgm_idx), порог - pg_trgm.word_similarity_threshold
+// на время запроса; word_similarity считаем только для отобранных строк - для ранжирования
+const nameSimilarityThreshold = "0.4"
+
+// разберём ФИО из запроса: слова (фамилия, имя...) и инициалы ("Кабанов А.И." -> ["кабанов"], ["а", "и"])
+func splitSearchName(name string) ([]string, []string) {
+	name = strings.Replace(strings.ToLower(name), "ё", "е", -1)
+	name = strings.Replace(name, ".", " ", -1)
+
+	words := make([]string, 0, 3)
+	initials := make([]string, 0, 2)
+	for _, token := range strings.Fields(name) {
+		if len([]rune(token)) == 1 {
+			initials = append(initials, token)
+		} else {
+			words = append(words, token)
+		}
+	}
+	return words, initials
+}
+
+// вернём работающих user-ов по критериям, самые похожие - первыми (у user-а - только работающие сотрудники, все аттрибуты)
+func (i *PostgreInstance) SearchActualUsers(s domain.EmployeesSearch) ([]domain.UserSearchResult, error) {
+	resultSlice := make([]domain.UserSearchResult, 0)
+
+	conds := make([]string, 0)
+	args := make([]interface{}, 0)
+	addArg := func(arg interface{}) string {
+		args = append(args, arg)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	conds = append(conds, "emplCS.state_descr ilike "+addArg("%Работ%"))
+	rank := "1.0"
+
+	words, initials := splitSearchName(s.Name)
+	if len(words) > 0 {
+		nameArg := addArg(strings.Join(words, " "))
+		rank = "word_similarity(" + nameArg + ", " + normUserName + ")"
+		conds = append(conds, "("+nameArg+" <% "+normUserName+" or "+normUserName+" like '%' || "+nameArg+" || '%')")
+	}
+	// инициалы - по имени и отчеству (в базе ФИО хранится как "Фамилия Имя Отчество")
+	for k, initial := range initials {
+		if k > 1 {
+			break
+		}
+		conds = append(conds, "split_part("+normUserName+", ' ', "+strconv.Itoa(k+2)+") like "+addArg(initial+"%"))
+	}
+	if tabno := strings.TrimSpace(s.TabNo); tabno != "" {
+		tabnoArg := addArg(tabno + "%")
+		conds = append(conds, "(trim(usr.user_id) like "+tabnoArg+" or trim(empl.employee_tabno) like "+tabnoArg+")")
+	}
+	if email := strings.TrimSpace(s.Email); email != "" {
+		conds = append(conds, "usr.email ilike "+addArg("%"+email+"%"))
+	}
+	if dep := strings.TrimSpace(s.Departament); dep != "" {
+		// guid подразделения или часть наименования
+		conds = append(conds, "(cast(dep.departament_guid as text) = "+addArg(strings.ToLower(dep))+
+			" or dep.departament_descr ilike "+addArg("%"+dep+"%")+")")
+	}
+	if pos := strings.TrimSpace(s.Position); pos != "" {
+		conds = append(conds, "pos.position_descr ilike "+addArg("%"+pos+"%"))
+	}
+
+	where := " where " + strings.Join(conds, " and ")
+	search_query := "select usr.user_guid, max(" + rank + ") as user_rank " + usersFromJoins + where +
+		" group by usr.user_guid " +
+		" order by user_rank desc, max(usr.user_name) " +
+		" limit " + addArg(s.Limit) + ";"
+
+	// порог "<%" - только для этой транзакции; оба запроса - в ней (одно соединение из пула на поиск)
+	tx, err := i.Db.Begin(context.Background())
+	if err != nil {
+		return resultSlice, fmt.Errorf("repository.SearchActualUsers begin error: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+	_, err = tx.Exec(context.Background(), "select set_config('pg_trgm.word_similarity_threshold', $1, true);", nameSimilarityThreshold)
+	if err != nil {
+		return resultSlice, fmt.Errorf("repository.SearchActualUsers set threshold error: %v", err)
+	}
+
+	rows, err := tx.Query(context.Background(), search_query, args...)
+	if err == pgx.ErrNoRows {
+		return resultSlice, nil
+	} else if err != nil {
+		return resultSlice, fmt.Errorf("repository.SearchActualUsers error: %v", err)
+	}
+
+	guidsSlice := make([]string, 0, s.Limit)
+	rankMap := make(map[string]float64, s.Limit)
+	for rows.Next() {
+		var userGUID string
+		var userRank float64
+		err = rows.Scan(&userGUID, &userRank)
+		if err != nil {
+			rows.Close()
+			return resultSlice, fmt.Errorf("repository.SearchActualUsers scan error: %v", err)
+		}
+		guidsSlice = append(guidsSlice, userGUID)
+		rankMap[userGUID] = userRank
+	}
+	rows.Close()
+	if len(guidsSlice) == 0 {
+		return resultSlice, nil
+	}
+
+	// все аттрибуты найденных user-ов
+	usrs_query := commonQueryAllAttributes + " where usr.user_guid = ANY($1::uuid[]) and emplCS.state_descr ilike $2 order by usr.user_guid;"
+	rows, err = tx.Query(context.Background(), usrs_query, "{"+strings.Join(guidsSlice, ",")+"}", "%Работ%")
+	if err != nil {
+		return resultSlice, fmt.Errorf("repository.SearchActualUsers error: %v", err)
+	}
+	defer rows.Close()
+
+	usersMap := make(map[string]domain.User, len(guidsSlice))
+	for _, user := range handlRowsAllAttributes(rows) {
+		usersMap[user.UserGUID] = user
+	}
+	// в порядке ранжирования
+	for _, userGUID := range guidsSlice {
+		if user, ok := usersMap[userGUID]; ok {
+			resultSlice = append(resultSlice, domain.UserSearchResult{User: user, Rank: rankMap[userGUID]})
+		}
+	}
+
+	return resultSlice, nil
+}
@@ -284,7 +284,7 @@ func (i *PostgreInstance) GetCastomUserListAllAttributes(userGUIDSlice []string)
 	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout*time.Millisecond)
 	defer cancel()
 
-	const usrs_query = commonQueryAllAttributes + " where user_guid = ANY($1::uuid[])"
+	usrs_query := commonQueryAllAttributes + " where user_guid = ANY($1::uuid[])"
 	param := "{" + strings.Join(userGUIDSlice, ",") + "}"
 
 	allUsersSlice := make([]domain.User, 0)
@@ -307,65 +307,12 @@ func (i *PostgreInstance) GetCastomUserListAllAttributes(userGUIDSlice []string)
 //***************************************************************************************
 //---------------------------------------
 // все аттрибуты
-const commonQueryAllAttributes = "select usr.user_guid, usr.user_name, usr.user_id, usr.user_birthday, usr.email, " +
-	" empl.employee_guid, empl.employee_id, empl.employee_tabno, empl.employment, empl.employee_adress, " +
-	" dep.departament_guid, dep.zup_id, dep.departament_descr, dep.zup_parent_id, dep.departament_parent_guid, dep.zup_not_used_from, " +
-	" pos.position_guid, pos.position_descr, " +
-	" pshr.pshr_guid, pshr.pshr_id, pshr.pshr_descr, " +
-	" emplCS.state_descr, emplCS.state_date_from " +
-	"    from users usr " +
-	"        left join employees empl on usr.user_guid=empl.employee_user " +
-	"        left join departaments dep on empl.employee_departament=dep.departament_guid " +
-	"        left join positions pos on pos.employee_guid=empl.employee_guid" +
-	"        left join pshr_list pshr on pshr.employee_guid=empl.employee_guid" +
-	"        left join employee_states emplCS on emplCS.employee_guid=empl.employee_guid "
-
-func handlRowsAllAttributes(rows pgx.Rows) []domain.User {
-	allUsersSlice := make([]domain.User, 0, 1000)
-	curUser := new(domain.User)
-	var oldUser = domain.User{}
-	empSlice := make([]domain.Employee, 0, 2)
-
-	for rows.Next() {
-
-		curEmpl := new(domain.Employee)
-		curDep := new(domain.Departament)
-		curPos := new(domain.Position)
-		curPshr := new(domain.Pshr)
-		curEmplSt := new(domain.EmplCurrentState)
-		rows.Scan(&curUser.UserGUID, &curUser.UserName, &curUser.UserID, &curUser.UserBirthday, &curUser.UserEmail,
-			&curEmpl.EmployeeGUID, &curEmpl.EmployeeId, &curEmpl.EmpTabNumber, &curEmpl.Employment, &curEmpl.EmployeeAdress,
-			&curDep.DepartamentGUID, &curDep.DepartamentIdZUP, &curDep.DepartamentDescr, &curDep.DepartamentParentIdZUP, &curDep.DepartamentParentGUID, &curDep.DepartamentNotUsedFrom,
-			&curPos.PositionGUID, &curPos.PositionDescr,
-			&curPshr.PshrGUID, &curPshr.PshrId, &curPshr.PshrDescr,
-			&curEmplSt.StateName, &curEmplSt.DateFrom)
-
-		curEmpl.EmployeeDepartament = *curDep
-		curEmpl.EmployeePosition = *curPos
-		curEmpl.EmployeePshr = *curPshr
-		curEmpl.EmployeeCurrentState = *curEmplSt
-
-		if (oldUser.UserGUID != "") && (curUser.UserGUID != oldUser.UserGUID) {
-			oldUser.Employees = empSlice
-			allUsersSlice = append(allUsersSlice, oldUser)
-			empSlice = make([]domain.Employee, 0, 2)
-		}
-
-		empSlice = append(empSlice, *curEmpl)
-		oldUser = *curUser
-	}
-	oldUser.Employees = empSlice
-	allUsersSlice = append(allUsersSlice, oldUser)
-
-	return allUsersSlice
-}
-
 // вернём всех работающих пользователей (физ.лиц) все атрибуты:
 func (i *PostgreInstance) GetAllActualUsersAllAttributes() ([]domain.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout*time.Millisecond)
 	defer cancel()
 
-	const usrs_query = commonQueryAllAttributes + " where state_descr ilike $1;"
+	usrs_query := commonQueryAllAttributes + " where state_descr ilike $1;"
 
 	allUsersSlice := make([]domain.User, 0)
 
@@ -387,7 +334,7 @@ func (i *PostgreInstance) GetAllActualUsersAllAttributes() ([]domain.User, error
 // вернём всех работающих пользователей (физ.лиц), у которых есть email-ы (все аттрибуты):
 func (i *PostgreInstance) GetAllActualEmailUsersAllAttributes() ([]domain.User, error) {
 
-	const usrs_query = commonQueryAllAttributes + " where state_descr ilike $1 and email<>'';"
+	usrs_query := commonQueryAllAttributes + " where state_descr ilike $1 and email<>'';"
 
 	allUsersSlice := make([]domain.User, 0)
 
@@ -409,7 +356,7 @@ func (i *PostgreInstance) GetAllActualEmailUsersAllAttributes() ([]domain.User,
 // вернём массив только работающих пользователей с подходящими кодами - табельными номерами (?tabno=8337) все атрибуты:
 func (i *PostgreInstance) GetActualUsersByTabNoAllAttributes(tabno string) ([]domain.User, error) {
 
-	const usrs_query = commonQueryAllAttributes + " where user_id ilike $1 and state_descr ilike $2;"
+	usrs_query := commonQueryAllAttributes + " where user_id ilike $1 and state_descr ilike $2;"
 
 	usersByTabNoSlice := make([]domain.User, 0)
 
@@ -431,7 +378,7 @@ func (i *PostgreInstance) GetActualUsersByTabNoAllAttributes(tabno string) ([]do
 // вернём массив только работающих пользователей с подходящими ФИО (?name=захаро) все атрибуты:
 func (i *PostgreInstance) GetActualUsersByUserNameAllAttributes(userName string) ([]domain.User, error) {
 
-	const usrs_query = commonQueryAllAttributes + " where user_name ilike $1 and state_descr ilike $2;"
+	usrs_query := commonQueryAllAttributes + " where user_name ilike $1 and state_descr ilike $2;"
 
 	usersByUserNameSlice := make([]domain.User, 0)
 
@@ -452,96 +399,10 @@ func (i *PostgreInstance) GetActualUsersByUserNameAllAttributes(userName string)
 
 //---------------------------------------
 // облегченные (не все аттрибуты)
-const commonQueryLightVersionAttributes = "select usr.user_guid, usr.user_name, usr.user_id, usr.email, " +
-	" empl.employee_id, empl.employee_tabno, empl.employment, empl.employee_adress, " +
-	" dep.zup_id, dep.departament_descr, " +
-	" pos.position_descr, " +
-	" emplCS.state_descr, emplCS.state_date_from " +
-	"    from users usr " +
-	"        left join employees empl on usr.user_guid=empl.employee_user " +
-	"        left join departaments dep on empl.employee_departament=dep.departament_guid " +
-	"        left join positions pos on pos.employee_guid=empl.employee_guid" +
-	"        left join employee_states emplCS on emplCS.employee_guid=empl.employee_guid "
-
-func handlRowsLightVersionAttributes(rows pgx.Rows) []domain.User {
-	allUsersSlice := make([]domain.User, 0, 1000)
-	curUser := new(domain.User)
-	var oldUser = domain.User{}
-	empSlice := make([]domain.Employee, 0, 2)
-
-	for rows.Next() {
-
-		curEmpl := new(domain.Employee)
-		curDep := new(domain.Departament)
-		curPos := new(domain.Position)
-		curEmplSt := new(domain.EmplCurrentState)
-		rows.Scan(&curUser.UserGUID, &curUser.UserName, &curUser.UserID, &curUser.UserEmail,
-			&curEmpl.EmployeeId, &curEmpl.EmpTabNumber, &curEmpl.Employment, &curEmpl.EmployeeAdress,
-			&curDep.DepartamentIdZUP, &curDep.DepartamentDescr,
-			&curPos.PositionDescr,
-			&curEmplSt.StateName, &curEmplSt.DateFrom)
-
-		curEmpl.EmployeeDepartament = *curDep
-		curEmpl.EmployeePosition = *curPos
-		curEmpl.EmployeeCurrentState = *curEmplSt
-
-		if (oldUser.UserID != "") && (curUser.UserID != oldUser.UserID) {
-			oldUser.Employees = empSlice
-			allUsersSlice = append(allUsersSlice, oldUser)
-			empSlice = make([]domain.Employee, 0, 2)
-		}
-
-		empSlice = append(empSlice, *curEmpl)
-		oldUser = *curUser
-	}
-	oldUser.Employees = empSlice
-	allUsersSlice = append(allUsersSlice, oldUser)
-
-	return allUsersSlice
-}
-
-// то же самое, только в map-у (по user_guid)
-func handlRowsLightVersionAttributesToMap(rows pgx.Rows) map[string]domain.User {
-	allUsersMap := make(map[string]domain.User)
-	curUser := new(domain.User)
-	var oldUser = domain.User{}
-	empSlice := make([]domain.Employee, 0, 2)
-
-	for rows.Next() {
-
-		curEmpl := new(domain.Employee)
-		curDep := new(domain.Departament)
-		curPos := new(domain.Position)
-		curEmplSt := new(domain.EmplCurrentState)
-		rows.Scan(&curUser.UserGUID, &curUser.UserName, &curUser.UserID, &curUser.UserEmail,
-			&curEmpl.EmployeeId, &curEmpl.EmpTabNumber, &curEmpl.Employment, &curEmpl.EmployeeAdress,
-			&curDep.DepartamentIdZUP, &curDep.DepartamentDescr,
-			&curPos.PositionDescr,
-			&curEmplSt.StateName, &curEmplSt.DateFrom)
-
-		curEmpl.EmployeeDepartament = *curDep
-		curEmpl.EmployeePosition = *curPos
-		curEmpl.EmployeeCurrentState = *curEmplSt
-
-		if (oldUser.UserID != "") && (curUser.UserID != oldUser.UserID) {
-			oldUser.Employees = empSlice
-			allUsersMap[oldUser.UserGUID] = oldUser
-			empSlice = make([]domain.Employee, 0, 2)
-		}
-
-		empSlice = append(empSlice, *curEmpl)
-		oldUser = *curUser
-	}
-	oldUser.Employees = empSlice
-	allUsersMap[oldUser.UserGUID] = oldUser
-
-	return allUsersMap
-}
-
 // вернём всех работающих пользователей (физ.лиц) облегчённые атрибуты:
 func (i *PostgreInstance) GetAllActualUsersLightVersionAttributes() ([]domain.User, error) {
 
-	const usrs_query = commonQueryLightVersionAttributes + " where state_descr ilike $1;"
+	usrs_query := commonQueryLightVersionAttributes + " where state_descr ilike $1;"
 
 	allUsersSlice := make([]domain.User, 0)
 
@@ -563,7 +424,7 @@ func (i *PostgreInstance) GetAllActualUsersLightVersionAttributes() ([]domain.Us
 // вернём всех работающих пользователей (физ.лиц), у которых есть email-ы (облегчённые аттрибуты):
 func (i *PostgreInstance) GetAllActualEmailUsersLightVersionAttributes() ([]domain.User, error) {
 
-	const usrs_query = commonQueryLightVersionAttributes + " where state_descr ilike $1 and email<>'';"
+	usrs_query := commonQueryLightVersionAttributes + " where state_descr ilike $1 and email<>'';"
 
 	allUsersSlice := make([]domain.User, 0)
 
@@ -585,7 +446,7 @@ func (i *PostgreInstance) GetAllActualEmailUsersLightVersionAttributes() ([]doma
 // вернём массив только работающих пользователей с подходящими кодами - табельными номерами (?tabno=8337) облегчённые атрибуты:
 func (i *PostgreInstance) GetActualUsersByTabNoLightVersionAttributes(tabno string) ([]domain.User, error) {
 
-	const usrs_query = commonQueryLightVersionAttributes + " where user_id ilike $1 and state_descr ilike $2;"
+	usrs_query := commonQueryLightVersionAttributes + " where user_id ilike $1 and state_descr ilike $2;"
 
 	usersByTabNoSlice := make([]domain.User, 0)
 
@@ -607,7 +468,7 @@ func (i *PostgreInstance) GetActualUsersByTabNoLightVersionAttributes(tabno stri
 // вернём массив только работающих пользователей с подходящими ФИО (?name=захаро) облегчённые атрибуты:
 func (i *PostgreInstance) GetActualUsersByUserNameLightVersionAttributes(userName string) ([]domain.User, error) {
 
-	const usrs_query = commonQueryLightVersionAttributes + " where user_name ilike $1 and state_descr ilike $2;"
+	usrs_query := commonQueryLightVersionAttributes + " where user_name ilike $1 and state_descr ilike $2;"
 
 	usersByUserNameSlice := make([]domain.User, 0)
 
@@ -727,17 +588,29 @@ func selectSingleEmployeeWithAttribsByGUID(insDB *pgxpool.Pool, empGUID string)
 	return &emp, nil
 }
 
+// дата приёма: дата состояния "Работа" при первой загрузке сотрудника или первом переходе в "Работа"
+// (nil - не работает, дата неизвестна). Потом не меняется (setEmployeeHireDate)
+func employeeHireDate(empl *domain.Employee) *time.Time {
+	state := empl.EmployeeCurrentState
+	if !strings.Contains(state.StateName, "Работ") || state.DateFrom.Year() <= 1 {
+		return nil
+	}
+	hireDate := state.DateFrom.Time
+	return &hireDate
+}
+
 func (i *PostgreInstance) AddEmployeeToDB(parentUserGUID string, empl *domain.Employee) (string, error) {
 
 	commandTag, err := i.Db.Exec(context.Background(),
-		"INSERT INTO employees (employee_guid, employee_user, employee_id, employee_tabno, employee_adress, employment, employee_departament) VALUES ($1, $2, $3, $4, $5, $6, $7);",
+		"INSERT INTO employees (employee_guid, employee_user, employee_id, employee_tabno, employee_adress, employment, employee_departament, employee_hire_date) VALUES ($1, $2, $3, $4, $5, $6, $7, $8);",
 		empl.EmployeeGUID,
 		parentUserGUID,
 		strings.TrimSpace(empl.EmployeeId),
 		strings.TrimSpace(empl.EmpTabNumber),
 		strings.TrimSpace(empl.EmployeeAdress),
 		strings.TrimSpace(empl.Employment),
-		empl.EmployeeDepartament.DepartamentGUID)
+		empl.EmployeeDepartament.DepartamentGUID,
+		employeeHireDate(empl))
 
 	if err != nil {
 		log.Error("repository.AddEmployeeToDB error %v", err)
@@ -817,6 +690,9 @@ func (i *PostgreInstance) AddEmployeeStateToDB(empl *domain.Employee) (string, e
 		log.Error("repository.AddEmployeeStateToDB error %v", err)
 		return commandTag.String(), err
 	}
+	if err = i.setEmployeeHireDate(empl); err != nil {
+		return commandTag.String(), err
+	}
 	return commandTag.String(), nil
 }
 
@@ -831,9 +707,29 @@ func (i *PostgreInstance) UpdateEmployeeStateToDB(empl *domain.Employee) (string
 		log.Error("repository.UpdateEmployeeStateToDB error %v", err)
 		return commandTag.String(), err
 	}
+	if err = i.setEmployeeHireDate(empl); err != nil {
+		return commandTag.String(), err
+	}
 	return commandTag.String(), nil
 }
 
+// состояние стало "Работа", а даты приёма ещё нет (загружен не работающим или до её появления) - запишем.
+// Уже записанную дату не трогаем: после отпуска по уходу за ребенком дата состояния сдвигается
+func (i *PostgreInstance) setEmployeeHireDate(empl *domain.Employee) error {
+	hireDate := employeeHireDate(empl)
+	if hireDate == nil {
+		return nil
+	}
+	_, err := i.Db.Exec(context.Background(),
+		"UPDATE employees set employee_hire_date=$1 where employee_guid=$2 and employee_hire_date is null;",
+		hireDate, empl.EmployeeGUID)
+	if err != nil {
+		log.Error("repository.setEmployeeHireDate error %v", err)
+		return err
+	}
+	return nil
+}
+
 //***************************************************************************************
 // Positions
 func (i *PostgreInstance) GetEmplPositionByEmplGUID(emplGUID string) (*domain.Position, error) {
@@ -1008,7 +904,7 @@ func selectDepartamentByGUID(insDB *pgxpool.Pool, DepGUID string) (*domain.Depar
 	var dep *domain.Departament = new(domain.Departament)
 
 	rows, err := insDB.Query(context.Background(),
-		"select departament_guid, departament_descr, departament_parent_guid, zup_id, zup_parent_id, zup_not_used_from from departaments where departament_guid=$1;",
+		"select departament_guid, departament_descr, departament_parent_guid, zup_id, zup_parent_id, zup_not_used_from, departament_head_guid, head_set_manually from departaments where departament_guid=$1;",
 		DepGUID)
 
 	if err == pgx.ErrNoRows {
@@ -1033,7 +929,9 @@ func selectDepartamentByGUID(insDB *pgxpool.Pool, DepGUID string) (*domain.Depar
 			&curDep.DepartamentParentGUID,
 			&curDep.DepartamentIdZUP,
 			&curDep.DepartamentParentIdZUP,
-			&curDep.DepartamentNotUsedFrom)
+			&curDep.DepartamentNotUsedFrom,
+			&curDep.DepartamentHeadGUID,
+			&curDep.DepartamentHeadSetManually)
 		dep = curDep
 	}
 
@@ -1046,7 +944,7 @@ func selectDepartamentByGUID(insDB *pgxpool.Pool, DepGUID string) (*domain.Depar
 func getDepParentGUIDByParentIdZUP(insDB *pgxpool.Pool, parentIdZUP string) (string, error) {
 	var parentDepGUID string
 
-	rows, err := insDB.Query(context.Background(), "select departament_guid from departaments where zup_parent_id=$1;", parentIdZUP)
+	rows, err := insDB.Query(context.Background(), "select departament_guid from departaments where zup_id=$1;", strings.TrimSpace(parentIdZUP))
 	if err == pgx.ErrNoRows {
 		err = fmt.Errorf("no rows: repository.getDepParentGUIDByParentIdZUP error: %v", err) // "no rows" - не удалять - по ним дальше определяем добавление
 		log.Error(err.Error())
@@ -1080,13 +978,14 @@ func (i *PostgreInstance) AddDepartament(dep *domain.Departament) (string, error
 	}
 
 	commandTag, err := i.Db.Exec(context.Background(),
-		"INSERT INTO departaments (departament_guid, departament_descr, departament_parent_guid, zup_id, zup_parent_id, zup_not_used_from) VALUES ($1, $2, $3, $4, $5, $6);",
+		"INSERT INTO departaments (departament_guid, departament_descr, departament_parent_guid, zup_id, zup_parent_id, zup_not_used_from, departament_head_guid) VALUES ($1, $2, $3, $4, $5, $6, $7);",
 		dep.DepartamentGUID,
 		strings.TrimSpace(dep.DepartamentDescr),
 		curDepParentGUID,
 		strings.TrimSpace(dep.DepartamentIdZUP),
 		strings.TrimSpace(dep.DepartamentParentIdZUP),
-		dep.DepartamentNotUsedFrom.Format("2006-01-02"))
+		dep.DepartamentNotUsedFrom.Format("2006-01-02"),
+		strings.TrimSpace(dep.DepartamentHeadGUID))
 	if err != nil {
 		log.Error("repository.AddDepartament error %v", err)
 		return commandTag.String(), err
@@ -1099,12 +998,14 @@ func (i *PostgreInstance) UpdateDepartament(dep *domain.Departament) (string, er
 	curDepParentGUID, _ := getDepParentGUIDByParentIdZUP(i.Db, dep.DepartamentParentIdZUP) // получим guid родителя, если он есть
 
 	commandTag, err := i.Db.Exec(context.Background(),
-		"UPDATE departaments set departament_descr=$1, departament_parent_guid=$2, zup_id=$3, zup_parent_id=$4, zup_not_used_from=$5 where departament_guid=$6;",
+		"UPDATE departaments set departament_descr=$1, departament_parent_guid=$2, zup_id=$3, zup_parent_id=$4, zup_not_used_from=$5, "+
+			" departament_head_guid=(case when head_set_manually then departament_head_guid else $6 end) where departament_guid=$7;", // руководителя, назначенного через api, из ЗУП не перетираем
 		strings.TrimSpace(dep.DepartamentDescr),
 		curDepParentGUID,
 		strings.TrimSpace(dep.DepartamentIdZUP),
 		strings.TrimSpace(dep.DepartamentParentIdZUP),
 		dep.DepartamentNotUsedFrom.Format("2006-01-02"),
+		strings.TrimSpace(dep.DepartamentHeadGUID),
 		dep.DepartamentGUID)
 	if err != nil {
 		log.Error("repository.UpdateDepartament error %v", err)
@@ -1117,7 +1018,7 @@ func (i *PostgreInstance) UpdateDepartament(dep *domain.Departament) (string, er
 // вернём все подразделения (и активные, и расформированные):
 func (i *PostgreInstance) GetAllDepartaments() ([]domain.Departament, error) {
 
-	const departaments_query = "select departament_guid, zup_id, departament_descr, zup_parent_id, zup_not_used_from, departament_parent_guid from departaments;"
+	const departaments_query = "select departament_guid, zup_id, departament_descr, zup_parent_id, zup_not_used_from, departament_parent_guid, departament_head_guid from departaments;"
 
 	allDepartamentsSlice := make([]domain.Departament, 0)
 
@@ -1139,7 +1040,8 @@ func (i *PostgreInstance) GetAllDepartaments() ([]domain.Departament, error) {
 			&curDep.DepartamentDescr,
 			&curDep.DepartamentParentIdZUP,
 			&curDep.DepartamentNotUsedFrom,
-			&curDep.DepartamentParentGUID)
+			&curDep.DepartamentParentGUID,
+			&curDep.DepartamentHeadGUID)
 
 		allDepartamentsSlice = append(allDepartamentsSlice, *curDep)
 	}
@@ -1150,7 +1052,7 @@ func (i *PostgreInstance) GetAllDepartaments() ([]domain.Departament, error) {
 // вернём только все актуальные подразделения (не расформированные):
 func (i *PostgreInstance) GetActualDepartaments() ([]domain.Departament, error) {
 
-	const departaments_query = "select departament_guid, zup_id, departament_descr, zup_parent_id, zup_not_used_from, departament_parent_guid " +
+	const departaments_query = "select departament_guid, zup_id, departament_descr, zup_parent_id, zup_not_used_from, departament_parent_guid, departament_head_guid " +
 		" from departaments where zup_parent_id <> '000999999' and zup_not_used_from = '0001-01-01';"
 
 	allDepartamentsSlice := make([]domain.Departament, 0)
@@ -1173,7 +1075,8 @@ func (i *PostgreInstance) GetActualDepartaments() ([]domain.Departament, error)
 			&curDep.DepartamentDescr,
 			&curDep.DepartamentParentIdZUP,
 			&curDep.DepartamentNotUsedFrom,
-			&curDep.DepartamentParentGUID)
+			&curDep.DepartamentParentGUID,
+			&curDep.DepartamentHeadGUID)
 
 		allDepartamentsSlice = append(allDepartamentsSlice, *curDep)
 	}
@@ -1184,7 +1087,7 @@ func (i *PostgreInstance) GetActualDepartaments() ([]domain.Departament, error)
 // вернём все актуальные подразделения по родителю:
 func (i *PostgreInstance) GetActualDepartamentsByParentIdZUP(parentIdZUP string) ([]domain.Departament, error) {
 
-	const departaments_query = "select departament_guid, zup_id, departament_descr, zup_parent_id, zup_not_used_from, departament_parent_guid " +
+	const departaments_query = "select departament_guid, zup_id, departament_descr, zup_parent_id, zup_not_used_from, departament_parent_guid, departament_head_guid " +
 		" from departaments where zup_parent_id <> '000999999' and zup_not_used_from = '0001-01-01' and zup_parent_id=$1;"
 
 	allDepartamentsSlice := make([]domain.Departament, 0)
@@ -1207,7 +1110,8 @@ func (i *PostgreInstance) GetActualDepartamentsByParentIdZUP(parentIdZUP string)
 			&curDep.DepartamentDescr,
 			&curDep.DepartamentParentIdZUP,
 			&curDep.DepartamentNotUsedFrom,
-			&curDep.DepartamentParentGUID)
+			&curDep.DepartamentParentGUID,
+			&curDep.DepartamentHeadGUID)
 
 		allDepartamentsSlice = append(allDepartamentsSlice, *curDep)
 	}
@@ -1296,12 +1200,14 @@ func (ins *PostgreInstance) SetExchangeStatus(ex_id int, attempt_count int, erro
 //------------------------------------------------------
 
 // common notifications
-// получить список email-ов user-ов по типу рассылки
+// получить список email-ов подписчиков по типу рассылки: адрес подписки или текущий email user-а.
+// Пустые адреса (у user-а нет email-а) и повторы пропускаем
 func (ins *PostgreInstance) GetUserEmailsByNotificationsTypes(notitype int) ([]string, error) {
-	const bd_usrs_query_debug_all = "select usr.email " +
+	const bd_usrs_query_debug_all = "select case when un.email <> '' then un.email else coalesce(usr.email, '') end " +
 		" 							 from users_for_notifications un " +
 		" 								left join users usr on un.user_guid=usr.user_guid " +
-		" 							 where un.notitype = $1;"
+		" 							 where un.notitype = $1 " +
+		" 							 order by un.subscriber_id;"
 
 	usersEmailsSlice := make([]string, 0)
 
@@ -1313,186 +1219,39 @@ func (ins *PostgreInstance) GetUserEmailsByNotificationsTypes(notitype int) ([]s
 	}
 	defer rows.Close()
 
+	seen := make(map[string]bool)
 	for rows.Next() {
 		var curUserEmail string
-		rows.Scan(&curUserEmail)
-
-		usersEmailsSlice = append(usersEmailsSlice, curUserEmail)
-	}
-	return usersEmailsSlice, nil
-
-}
-
-//------------------------------------------------------
-// вернуть всех именинников, ДР которых приходится на конкретную дату DEBUG !!!!!!!!!!!!!!!!!!!!!!!!!
-func (ins *PostgreInstance) GetBdOwnersOneDayDebug(dateTempl string) (map[string][]domain.User, error) { //([]domain.User, error) {
-
-	const bd_usrs_query_debug_all = "select user_name, user_birthday from users " +
-		"								where cast(user_birthday as text) like $1;"
-
-	var retMap map[string][]domain.User = map[string][]domain.User{} // одному observer - у сопоставляем много bd_owner - ов
-	adminSlice, err := ins.GetUserEmailsByNotificationsTypes(1)      // admin    []string{"akabanov@VODOKANAL-NN.RU"}
-	if err != nil {
-		return retMap, err
-	}
-	admin := adminSlice[0]
-
-	rows, err := ins.Db.Query(context.Background(), bd_usrs_query_debug_all, "%"+dateTempl+"%") //  "-05-31"
-	if err == pgx.ErrNoRows {
-		return retMap, err
-	} else if err != nil {
-		return retMap, err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		curBdOwner := new(domain.User)
-		err = rows.Scan(&curBdOwner.UserName, &curBdOwner.UserBirthday)
-		if err != nil {
-			return retMap, err
-		}
-		curBdOwnerSlice, ok := retMap[admin]
-		if !ok {
-			curBdOwnerSlice = make([]domain.User, 0)
-		}
-		curBdOwnerSlice = append(curBdOwnerSlice, *curBdOwner)
-		retMap[admin] = curBdOwnerSlice
-	}
-
-	return retMap, nil
-}
-
-// вернуть всех именинников, ДР которых приходится на конкретную дату, а также их наблюдателей
-func (ins *PostgreInstance) GetBdObserversOwnersByTempl(dateTempl string) (map[string][]domain.User, error) {
-
-	const bd_usrs_query = "select " +
-		" 						usr.user_name, " +
-		" 						usr.email, " + //  as observer_email
-		" 						usr1.user_name, " + //  as bd_owner
-		" 						usr1.user_birthday " + // as bd
-		"				   from bd_notifications bd " +
-		" 						inner join users usr on bd.bd_observer_guid=usr.user_guid " +
-		" 						inner join users usr1 on bd.bd_owner_guid=usr1.user_guid " +
-		"				   where cast(usr1.user_birthday as text) like $1;"
-
-	// одному observer-у (key) сопоставляем много bd_owner-ов (value)
-	var retMap map[string][]domain.User = map[string][]domain.User{}
-
-	rows, err := ins.Db.Query(context.Background(), bd_usrs_query, "%"+dateTempl+"%") //  "-05-31"
-	if err == pgx.ErrNoRows {
-		return retMap, err
-	} else if err != nil {
-		return retMap, err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var curObserverUserName string
-		var curObserverEmail string
-		curBdOwner := new(domain.User)
-		err = rows.Scan(&curObserverUserName, &curObserverEmail, &curBdOwner.UserName, &curBdOwner.UserBirthday)
-		if err != nil {
-			return retMap, err
+		if err = rows.Scan(&curUserEmail); err != nil {
+			return usersEmailsSlice, fmt.Errorf("repository.GetUserEmailsByNotificationsTypes scan error: %v", err)
 		}
-		if strings.TrimSpace(curObserverEmail) == "" {
-			log.Error("bd_notifications repository.GetBdObserversOwnersnextWeek error: для пользователя %v не найден email.", curObserverUserName)
+		curUserEmail = strings.TrimSpace(curUserEmail)
+		if curUserEmail == "" || seen[strings.ToLower(curUserEmail)] {
 			continue
 		}
-		curBdOwnerSlice, ok := retMap[curObserverEmail]
-		if !ok {
-			curBdOwnerSlice = make([]domain.User, 0)
-		}
-		curBdOwnerSlice = append(curBdOwnerSlice, *curBdOwner)
-		retMap[curObserverEmail] = curBdOwnerSlice
-	}
-
-	return retMap, nil
-}
-
-// вернуть всех именинников, ДР которых приходится на nextWeek, а также их наблюдателей
-func (ins *PostgreInstance) GetBdObserversOwnersnextWeek(nextWeek domain.NextWeekStruct) (map[string][]domain.User, error) {
-
-	const bd_usrs_query = "select " +
-		" 						usr.user_name, " +
-		" 						usr.email, " +
-		" 						usr1.user_name, " +
-		" 						usr1.user_birthday " +
-		"				   from bd_notifications bd " +
-		" 						inner join users usr on bd.bd_observer_guid=usr.user_guid " +
-		" 						inner join users usr1 on bd.bd_owner_guid=usr1.user_guid " +
-		"				   where ((cast(usr1.user_birthday as text) like $1) or " + // '%-01-17%'
-		" 						  (cast(usr1.user_birthday as text) like $2) or " +
-		" 						  (cast(usr1.user_birthday as text) like $3) or " +
-		" 						  (cast(usr1.user_birthday as text) like $4) or " +
-		" 						  (cast(usr1.user_birthday as text) like $5) or " +
-		" 						  (cast(usr1.user_birthday as text) like $6) or " +
-		" 						  (cast(usr1.user_birthday as text) like $7));"
-
-	// одному observer-у (key) сопоставляем много bd_owner-ов (value)
-	var retMap map[string][]domain.User = map[string][]domain.User{}
-
-	rows, err := ins.Db.Query(context.Background(), bd_usrs_query,
-		"%"+nextWeek.Monday+"%",
-		"%"+nextWeek.Tuesday+"%",
-		"%"+nextWeek.Wednesday+"%",
-		"%"+nextWeek.Thursday+"%",
-		"%"+nextWeek.Friday+"%",
-		"%"+nextWeek.Saturday+"%",
-		"%"+nextWeek.Sunday+"%")
-
-	if err == pgx.ErrNoRows {
-		return retMap, err
-	} else if err != nil {
-		return retMap, err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var curObserverUserName string
-		var curObserverEmail string
-		curBdOwner := new(domain.User)
-		err = rows.Scan(&curObserverUserName, &curObserverEmail, &curBdOwner.UserName, &curBdOwner.UserBirthday)
-		if err != nil {
-			return retMap, err
-		}
-		if strings.TrimSpace(curObserverEmail) == "" {
-			log.Error("bd_notifications repository.GetBdObserversOwnersnextWeek error: для пользователя %v не найден email.", curObserverUserName)
-			continue
-		}
-		curBdOwnerSlice, ok := retMap[curObserverEmail]
-		if !ok {
-			curBdOwnerSlice = make([]domain.User, 0)
-		}
-		curBdOwnerSlice = append(curBdOwnerSlice, *curBdOwner)
-		retMap[curObserverEmail] = curBdOwnerSlice
+		seen[strings.ToLower(curUserEmail)] = true
+		usersEmailsSlice = append(usersEmailsSlice, curUserEmail)
 	}
+	return usersEmailsSlice, nil
 
-	return retMap, nil
 }
 
 //------------------------------------------------------
-// сделать запись в таблицу "напомнить кому" - "напомнить о ком"
+// сделать запись в таблицу "напомнить кому" - "напомнить о ком" (по точным табельным номерам)
 func (ins *PostgreInstance) InsertBdObsOwners(bdObserverId, bdOwnerId string) error {
-	const bd_usrs_query = "insert into bd_notifications " +
-		" 				       (bd_observer_guid, bd_owner_guid) " +
-		" 				   values( " +
-		" 					   (select user_guid from users where user_id like $1), " +
-		"					   (select user_guid from users where user_id like $2)); "
-
-	_, err := ins.Db.Exec(context.Background(), bd_usrs_query, "%"+bdObserverId+"%", "%"+bdOwnerId+"%")
-	if err == pgx.ErrNoRows {
+	observerGUID, err := ins.GetUserGUIDByTabNo(bdObserverId)
+	if err != nil {
 		return err
-	} else if err != nil {
-		// pqErr := err.(*pq.Error)
-		// if pqErr.Code.Name() == "SQLSTATE 23505" {
-		// 	return fmt.Errorf("Ограничения уникальности %v", err)
-		// }
-		if strings.Contains(err.Error(), "SQLSTATE 23505") {
-			err = fmt.Errorf("Ограничения уникальности. Пара %s и %s уже существует. %v", bdObserverId, bdOwnerId, err)
-			return err
+	}
+	ownerGUID, err := ins.GetUserGUIDByTabNo(bdOwnerId)
+	if err != nil {
+		return err
+	}
+	if _, err = ins.AddBdSubscription(observerGUID, ownerGUID); err != nil {
+		if strings.Contains(err.Error(), "conflict: already subscribed") {
+			return fmt.Errorf("Ограничения уникальности. Пара %s и %s уже существует. %v", bdObserverId, bdOwnerId, err)
 		}
 		return err
 	}
-
 	return nil
 }
@@ -3,14 +3,18 @@ package repository
 import (
 	"bytes"
 	"encoding/base64"
+	"fmt"
 	"io/ioutil"
 	"net/smtp"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
 	config "mdata/configs"
+	"mdata/internal/domain"
 	log "mdata/pkg/logging"
+	"mdata/pkg/mailtmpl"
 
 	"github.com/go-mail/mail"
 )
@@ -45,7 +49,76 @@ type sendMail struct {
 	auth     smtp.Auth
 }
 
+// подпись писем без шаблона (в шаблонах она своя)
+const mailTextFooter = "\n" +
+	"---------- \n" +
+	"Your notification center"
+
+// SendMailToRecipient - письмо без шаблона, текстом. attachment - путь к файлу вложения (пусто - без вложения).
+// Если включена очередь исходящих - письмо записывается в неё (вместе с содержимым вложения), доставит обработчик очереди
 func SendMailToRecipient(to []string, BccAdmin, subject, body, attachment string) error {
+	job, err := newMailJob(to, BccAdmin, attachment)
+	if err != nil {
+		log.Error("repository.SendMailToRecipient error: %v", err)
+		return err
+	}
+	job.Subject = subject
+	job.Body = body + mailTextFooter
+	return sendMailJob(job)
+}
+
+// SendRenderedMail - письмо по заполненному шаблону (html и текстовая версии)
+func SendRenderedMail(to []string, bccAdmin string, rendered mailtmpl.Rendered, attachment string) error {
+	job, err := newMailJob(to, bccAdmin, attachment)
+	if err != nil {
+		log.Error("repository.SendRenderedMail error: %v", err)
+		return err
+	}
+	job.Subject = rendered.Subject
+	job.Body = rendered.Text
+	job.HTMLBody = rendered.HTML
+	return sendMailJob(job)
+}
+
+func sendMailJob(job domain.MailJob) error {
+	if mailOutbox != nil {
+		err := enqueueMail(job)
+		if err == nil {
+			return nil
+		}
+		// очередь недоступна (БД) - пробуем отправить сразу, чтобы не потерять письмо
+		log.Error("repository.sendMailJob enqueueMail error: %v", err)
+	}
+
+	err := DeliverMail(job)
+	if err != nil {
+		log.Error("repository.sendMailJob DeliverMail error: %v", err)
+	}
+	return err
+}
+
+// DeliverMail - отправить письмо сейчас: почтовому сервису через Kafka (если задан SetMailProducer) или через SMTP
+func DeliverMail(job domain.MailJob) error {
+	if mailProducer != nil {
+		return publishMailJob(job)
+	}
+	return sendMailSMTP(job)
+}
+
+func newMailJob(to []string, bccAdmin, attachment string) (domain.MailJob, error) {
+	job := domain.MailJob{To: to, Bcc: bccAdmin}
+	if attachment != "" {
+		content, err := ioutil.ReadFile(attachment)
+		if err != nil {
+			return job, fmt.Errorf("repository.newMailJob read attachment error: %v", err)
+		}
+		job.AttachmentName = filepath.Base(attachment)
+		job.Attachment = content
+	}
+	return job, nil
+}
+
+func sendMailSMTP(job domain.MailJob) error {
 
 	cfg := config.GetCfg()
 
@@ -54,23 +127,29 @@ func SendMailToRecipient(to []string, BccAdmin, subject, body, attachment string
 	m := mail.NewMessage()
 	m.SetHeaders(map[string][]string{
 		"From":    {cfg.MailFrom},
-		"To":      to,
-		"Subject": {subject},
+		"To":      job.To,
+		"Subject": {job.Subject},
 	})
-	m.SetAddressHeader("Bcc", BccAdmin, "admin")
-
-	body = body + "\n" +
-		"---------- \n" +
-		"Your notification center"
+	if job.Bcc != "" {
+		m.SetAddressHeader("Bcc", job.Bcc, "admin")
+	}
 
-	m.SetBody("text/plain", body)
-	if attachment != "" {
-		m.Attach(attachment)
+	// текст и html - альтернативы (клиент покажет html, если умеет)
+	switch {
+	case job.HTMLBody == "":
+		m.SetBody("text/plain", job.Body)
+	case job.Body == "":
+		m.SetBody("text/html", job.HTMLBody)
+	default:
+		m.SetBody("text/plain", job.Body)
+		m.AddAlternative("text/html", job.HTMLBody)
+	}
+	if job.AttachmentName != "" {
+		m.AttachReader(job.AttachmentName, bytes.NewReader(job.Attachment))
 	}
 	err := d.DialAndSend(m)
 	if err != nil {
-		log.Error("repository.SendMailToRecipient d.DialAndSend(m)) error: %v", err)
-		return err
+		return fmt.Errorf("repository.sendMailSMTP d.DialAndSend(m) error: %v", err)
 	}
 	return nil
 }
@@ -1,81 +1,181 @@
 package routes
 
 import (
+	config "mdata/configs"
 	"mdata/internal/handlers"
 	"mdata/internal/repository"
 	"net/http"
+	"time"
 )
 
-func InitializeRoutes(mux *http.ServeMux, ins *repository.PostgreInstance) {
+// регистрируем все маршруты в mux, потоковые (SSE, long-poll) - в streamMux (его обслуживает сервер без таймаута записи);
+// возвращаем их шаблоны (по ним проверяем, что спецификация OpenAPI не разошлась с маршрутами)
+func InitializeRoutes(mux, streamMux *http.ServeMux, ins *repository.PostgreInstance, cfg *config.Config) []string {
+	cache := newResponseCache(cfg.ResponseCache)
+
+	// регистрируем маршрут с ограничением частоты запросов и кэшем ответов и запоминаем его шаблон для спецификации OpenAPI
+	registeredPatterns := make([]string, 0, len(routesDocs))
+	handleOn := func(m *http.ServeMux, pattern string, handler http.HandlerFunc) {
+		m.Handle(pattern, newRouteLimiter(cfg.RateLimit, pattern).Middleware(withResponseCache(cache, pattern, handler)))
+		registeredPatterns = append(registeredPatterns, pattern)
+	}
+	handle := func(pattern string, handler http.HandlerFunc) {
+		handleOn(mux, pattern, handler)
+	}
+	handleStream := func(pattern string, handler http.HandlerFunc) {
+		handleOn(streamMux, pattern, handler)
+		mux.Handle(pattern, http.NotFoundHandler()) // на основном адресе - 404, а не ping из "/"
+	}
+	streamMaxDuration := time.Duration(cfg.HTTPStreamMaxDuration) * time.Second
+
 	// ping - метод. Получим доступность базы 1С:ЗУП
-	mux.HandleFunc("/from-zup/ping/", handlers.PingZup)
+	handle("/from-zup/ping/", handlers.PingZup)
 
 	// ping - метод. Получим всех пользователей 1С:ЗУП
-	mux.HandleFunc("/from-zup/ping/AllUsers/", handlers.PingFromZmupAllUsers)
+	handle("/from-zup/ping/AllUsers/", handlers.PingFromZmupAllUsers)
 
 	// Запишем в БД всех user-ов из ЗУП-а, по пути получив их email из AD                     (daily task)
-	mux.HandleFunc("/db/from-zup/write/all-users/", handlers.RestHandleZupWriteAllUsers(ins))
+	handle("/db/from-zup/write/all-users/", handlers.RestHandleZupWriteAllUsers(ins))
 
 	// Debug-method. Запишем в БД одного user-а из запроса (из Postman-а), по пути получив его email из AD
-	mux.HandleFunc("/db/from-zup/write/one-user/", handlers.RestHandleDebugWriteOneUser(ins))
+	handle("/db/from-zup/write/one-user/", handlers.RestHandleDebugWriteOneUser(ins))
 
 	// Debug-method Отправляем в 1С:ЗУП email одного захардкоженного пользователя.
-	mux.HandleFunc("/to-zup/send-email/ping/", handlers.RestPutOneUserEmailToZup)
+	handle("/to-zup/send-email/ping/", handlers.RestPutOneUserEmailToZup)
 
 	// Отправляем в 1С:ЗУП email всех пользователей для обновления email (можно один, но в массиве)    (daily task)
-	mux.HandleFunc("/to-zup/send-email/put-array/", handlers.RestPutAllUsersWithEmailToZup(ins))
+	handle("/to-zup/send-email/put-array/", handlers.RestPutAllUsersWithEmailToZup(ins))
 
 	// Отправляем в 1С:CreateUser даные новых сотрудников (users) для создания для них пользователей в 1С (можно один, но в массиве)    (daily task)
-	mux.HandleFunc("/to-1cuser/send-accounts-crud/put-array/", handlers.RestPutNewUsersWithEmailToCreate1CAccounts(ins))
+	handle("/to-1cuser/send-accounts-crud/put-array/", handlers.RestPutNewUsersWithEmailToCreate1CAccounts(ins))
 
 	// блок "Подразделения"
 	// ping-метод - получить все подразделения из 1С:ЗУП
-	mux.HandleFunc("/from-zup/ping/AllDepartaments/", handlers.RestGetFromZupPingAllDepartaments())
+	handle("/from-zup/ping/AllDepartaments/", handlers.RestGetFromZupPingAllDepartaments())
 
 	// получить все подразделения из 1С:ЗУП и записать их в базу MD
-	mux.HandleFunc("/db/from-zup/write/all-departaments/", handlers.RestHandleFromZupAllDepartament(ins))
+	handle("/db/from-zup/write/all-departaments/", handlers.RestHandleFromZupAllDepartament(ins))
 
 	// Debug-method. Запишем в БД одно подразделение из запроса (из Postman-а)
-	mux.HandleFunc("/db/from-zup/write/singl-departament/", handlers.RestHandleDebugWriteSingleDepartament(ins))
+	handle("/db/from-zup/write/singl-departament/", handlers.RestHandleDebugWriteSingleDepartament(ins))
+
+	// отдать подразделения плоским списком или деревом (?tree=true), с расформированными (?includeClosed=true)
+	handle("/departaments", handlers.RestSendDepartaments(ins))
+
+	// отдать подразделение по guid с родителями и деревом потомков (/departaments/{guid}),
+	// его работающих сотрудников (/departaments/{guid}/employees?recursive=true), численность по узлам (/departaments/{guid}/headcount)
+	// и руководителя (/departaments/{guid}/head; PUT - назначить, DELETE - снять ручное назначение)
+	handle("/departaments/", handlers.RestSendDepartaments(ins))
+
+	// отдать цепочку руководителей сотрудника вверх по оргструктуре (/employees/{guid}/manager-chain)
+	handle("/employees/", handlers.RestSendEmployees(ins))
+
+	// отдать работающих сотрудников, которые числятся в расформированных подразделениях
+	handle("/closed-departaments/employees/", handlers.RestSendEmployeesInClosedDepartaments(ins))
+
+	// найти работающих сотрудников в расформированных подразделениях и отправить их список в отдел кадров       (daily task)
+	handle("/closed-departaments/notifications/", handlers.RestSendClosedDepartamentsNotifications(ins))
+
+	// отдать годовщины работы за период (?from=&to=, по умолчанию - следующая неделя) и отправить их в отдел кадров  (weekly task)
+	handle("/work-anniversaries/employees/", handlers.RestSendWorkAnniversaries(ins))
+	handle("/work-anniversaries/notifications/", handlers.RestSendWorkAnniversariesNotifications(ins))
+
+	// отдать принятых и уволенных за период (?from=&to=, по умолчанию - семь дней до сегодня) и отправить их в отдел кадров  (weekly task)
+	handle("/staff-changes/employees/", handlers.RestSendStaffChanges(ins))
+	handle("/staff-changes/notifications/", handlers.RestSendStaffChangesNotifications(ins))
+
+	// лента изменений: создание, изменение, увольнение user-ов, сотрудников и подразделений после курсора (?since=, ожидание - &wait=)
+	handleStream("/changes", handlers.RestSendChanges(ins, streamMaxDuration))
+
+	// те же события в реальном времени (Server-Sent Events), фильтр ?types=, переподключение с Last-Event-ID
+	handleStream("/events/stream", handlers.RestEventsStream(ins, streamMaxDuration))
+
+	//------------------------------------------------------------------
+	// REST api v1 (ответы и ошибки - json). Старые маршруты ниже оставлены для клиентов 1С
+	// работающие физ.лица (фильтры, постранично, fields=), уволенные (/fired?from=), физ.лицо по guid
+	handle(handlers.APIv1Prefix+"/users", handlers.RestAPIv1Users(ins))
+	handle(handlers.APIv1Prefix+"/users/", handlers.RestAPIv1Users(ins))
+
+	// сотрудник по guid, цепочка руководителей (/manager-chain)
+	handle(handlers.APIv1Prefix+"/employees/", handlers.RestAPIv1Employees(ins))
+
+	// подразделения: список/дерево, карточка, сотрудники, численность, руководитель
+	handle(handlers.APIv1Prefix+"/departaments", handlers.RestAPIv1Departaments(ins))
+	handle(handlers.APIv1Prefix+"/departaments/", handlers.RestAPIv1Departaments(ins))
+
+	// должности работающих сотрудников
+	handle(handlers.APIv1Prefix+"/positions", handlers.RestAPIv1Positions(ins))
+
+	// обмены: просмотр (GET) и регистрация (POST)
+	handle(handlers.APIv1Prefix+"/exchanges", handlers.RestAPIv1Exchanges(ins))
+
+	// очередь исходящих писем: неотправленные (GET, ?status=), повторить отправку (POST /{id}/retry)
+	handle(handlers.APIv1Prefix+"/mail-outbox", handlers.RestAPIv1MailOutbox(ins))
+	handle(handlers.APIv1Prefix+"/mail-outbox/", handlers.RestAPIv1MailOutbox(ins))
+
+	// шаблоны писем рассылок: просмотр, правка (PUT), сброс (DELETE), предпросмотр (/{key}/preview)
+	handle(handlers.APIv1Prefix+"/mail-templates", handlers.RestAPIv1MailTemplates(ins))
+	handle(handlers.APIv1Prefix+"/mail-templates/", handlers.RestAPIv1MailTemplates(ins))
+	handle(handlers.APIv1Prefix+"/notification-types", handlers.RestAPIv1NotificationTypes(ins))
+	handle(handlers.APIv1Prefix+"/notification-types/", handlers.RestAPIv1NotificationTypes(ins))
+	handle(handlers.APIv1Prefix+"/bd-rules", handlers.RestAPIv1BdRules(ins))
+	handle(handlers.APIv1Prefix+"/bd-rules/", handlers.RestAPIv1BdRules(ins))
+	handle(handlers.APIv1Prefix+"/bd-departament-subscriptions", handlers.RestAPIv1BdDepSubscriptions(ins))
+	handle(handlers.APIv1Prefix+"/bd-departament-subscriptions/", handlers.RestAPIv1BdDepSubscriptions(ins))
+
+	// остальные пути api - 404 в json
+	handle(handlers.APIv1Prefix+"/", handlers.RestAPIv1NotFound())
 
 	//------------------------------------------------------------------
 	// блок REST api  --------------------------------------------------
 	//------------------------------------------------------------------
 	// ping - метод. Доступность сервиса MD
-	mux.HandleFunc("/", handlers.PingMasterData)
+	handle("/", handlers.PingMasterData)
 
 	// ping - метод. Доступность DB
-	mux.Handle("/db/ping/", handlers.PingDB(ins))
+	handle("/db/ping/", handlers.PingDB(ins))
+	//------------------------------------------------------------------
+	// списки сотрудников и подразделений (и уволенных) можно выгрузить файлом: ?format=csv|xlsx или заголовок Accept
 	//------------------------------------------------------------------
 	// все аттрибуты
 	// отдать всех работающих (актуальных) физ.лиц (все аттрибуты)
-	mux.HandleFunc("/get-act-employees/", handlers.RestSendActEmployeesAllAttributes(ins))
+	handle("/get-act-employees/", handlers.RestSendActEmployeesAllAttributes(ins))
 
 	// отдать всех работающих (актуальных) физ.лиц, у которых есть email-ы (все аттрибуты)
-	mux.HandleFunc("/get-act-email-employees/", handlers.RestSendAllEmailEmployeesAllAttributes(ins))
+	handle("/get-act-email-employees/", handlers.RestSendAllEmailEmployeesAllAttributes(ins))
 
 	// отдать сотрудника(-ков) работающих (актуальных) по параметрам ?tabno=8337 или ?name=Кабанов (обрабатывается по принципу like) (все аттрибуты)
-	mux.HandleFunc("/get-act-employee", handlers.RestSendEmployeeAllAttributes(ins))
+	handle("/get-act-employee", handlers.RestSendEmployeeAllAttributes(ins))
 
 	// отдать всех уволенных физ.лиц (все аттрибуты) по параметрам ?from=2006-01-02  (YYYY-MM-DD)
-	mux.HandleFunc("/get-fired-employees", handlers.RestSendUsersFiredFromAllAttributes(ins))
+	handle("/get-fired-employees", handlers.RestSendUsersFiredFromAllAttributes(ins))
 
 	//------------------------------------------------------------------
 	// облегчённые аттрибуты
 	// отдать всех работающих (актуальных) физ.лиц (облегчённые аттрибуты)
-	mux.HandleFunc("/get-act-employees-light/", handlers.RestSendAllEmployeesLightVersionAttributes(ins))
+	handle("/get-act-employees-light/", handlers.RestSendAllEmployeesLightVersionAttributes(ins))
 
 	// отдать всех работающих (актуальных) физ.лиц, у которых есть email-ы (облегчённые аттрибуты)
-	mux.HandleFunc("/get-act-email-employees-light/", handlers.RestSendAllEmailEmployeesLightVersionAttributes(ins))
+	handle("/get-act-email-employees-light/", handlers.RestSendAllEmailEmployeesLightVersionAttributes(ins))
 
 	// отдать сотрудника(-ков) работающих (актуальных) по параметрам ?tabno=8337 или ?name=Кабанов (обрабатывается по принципу like) (облегчённые аттрибуты)
-	mux.HandleFunc("/get-act-employee-light", handlers.RestSendEmployeeLightVersionAttributes(ins))
+	handle("/get-act-employee-light", handlers.RestSendEmployeeLightVersionAttributes(ins))
 
 	//------------------------------------------------------------------
 	// birthday notifications
-	mux.HandleFunc("/bd-notifications/", handlers.RestSendBdNotifications(ins))
+	handle("/bd-notifications/", handlers.RestSendBdNotifications(ins))
 
 	// set oocouple birthday notifications по параметрам ?tabno=8337
-	mux.HandleFunc("/bd-oocouple/", handlers.RestSetOOCoupleForBdNotifications(ins))
+	handle("/bd-oocouple/", handlers.RestSetOOCoupleForBdNotifications(ins))
+	handle("/bd-subscriptions", handlers.RestBdSubscriptions(ins, cfg.BdCalendarBaseURL))
+	handle("/bd-subscriptions/", handlers.RestBdSubscriptions(ins, cfg.BdCalendarBaseURL))
 
+	// календарь ДР observer-а для подписки из Outlook: /bd-calendar/<token>.ics (токен - /bd-subscriptions/calendar)
+	handle("/bd-calendar/", handlers.RestBdCalendar(ins))
+
+	//------------------------------------------------------------------
+	// спецификация OpenAPI 3 по всем маршрутам выше
+	registeredPatterns = append(registeredPatterns, "/openapi.json")
+	mux.HandleFunc("/openapi.json", handlers.RestSendOpenAPI(buildOpenAPI(registeredPatterns)))
+	return registeredPatterns
 }
@@ -0,0 +1,68 @@
+package routes
+
+import (
+	config "mdata/configs"
+	"mdata/internal/handlers"
+	"mdata/pkg/respcache"
+	"net/http"
+	"time"
+)
+
+//------------------------------------------------------------------
+// Кэш ответов выгрузок (ETag / Last-Modified, 304 на условные запросы).
+// Данные сотрудников и подразделений меняются только загрузкой из 1С:ЗУП и правками через api -
+// после таких запросов кэш сбрасывается целиком.
+
+type cacheRole int
+
+const (
+	cacheNone       cacheRole = iota
+	cacheRead                 // ответы GET кэшируются
+	cacheInvalidate           // после запроса данные изменились
+	cacheReadWrite            // GET кэшируется, после PUT/POST/DELETE кэш сбрасывается
+)
+
+var routesCache = map[string]cacheRole{
+	"/get-act-employees/":                   cacheRead,
+	"/get-act-email-employees/":             cacheRead,
+	"/get-act-employees-light/":             cacheRead,
+	"/get-act-email-employees-light/":       cacheRead,
+	"/get-fired-employees":                  cacheRead,
+	"/closed-departaments/employees/":       cacheRead,
+	"/employees/":                           cacheRead,
+	handlers.APIv1Prefix + "/users":         cacheRead,
+	handlers.APIv1Prefix + "/users/":        cacheRead,
+	handlers.APIv1Prefix + "/employees/":    cacheRead,
+	handlers.APIv1Prefix + "/positions":     cacheRead,
+	"/departaments":                         cacheRead,
+	"/departaments/":                        cacheReadWrite, // PUT/DELETE .../head
+	handlers.APIv1Prefix + "/departaments":  cacheRead,
+	handlers.APIv1Prefix + "/departaments/": cacheReadWrite,
+	"/db/from-zup/write/all-users/":         cacheInvalidate,
+	"/db/from-zup/write/one-user/":          cacheInvalidate,
+	"/db/from-zup/write/all-departaments/":  cacheInvalidate,
+	"/db/from-zup/write/singl-departament/": cacheInvalidate,
+}
+
+func newResponseCache(cfg config.ResponseCache) *respcache.Cache {
+	if !cfg.ResponseCacheEnabled {
+		return nil
+	}
+	return respcache.New(cfg.ResponseCacheMaxEntries, cfg.ResponseCacheMaxBytes, time.Duration(cfg.ResponseCacheTTL)*time.Second)
+}
+
+// обернём обработчик маршрута кэшем согласно routesCache (cache == nil - кэш выключен)
+func withResponseCache(cache *respcache.Cache, pattern string, handler http.Handler) http.Handler {
+	if cache == nil {
+		return handler
+	}
+	switch routesCache[pattern] {
+	case cacheRead:
+		return cache.Middleware(handler)
+	case cacheInvalidate:
+		return cache.InvalidateAfter(handler, false)
+	case cacheReadWrite:
+		return cache.InvalidateAfter(cache.Middleware(handler), true)
+	}
+	return handler
+}
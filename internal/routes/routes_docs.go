@@ -0,0 +1,246 @@
+package routes
+
+import (
+	dom "mdata/internal/domain"
+	"mdata/internal/handlers"
+	log "mdata/pkg/logging"
+	"mdata/pkg/mailtmpl"
+	"mdata/pkg/openapi"
+)
+
+//------------------------------------------------------------------
+// Описание маршрутов для спецификации OpenAPI (/openapi.json).
+// Pattern должен совпадать с шаблоном в InitializeRoutes: при расхождении (маршрут без описания или описание без маршрута)
+// при старте пишем ошибку в лог. Схемы ответов строятся по go-типам из domain.
+
+const openAPITitle = "Master Data"
+const openAPIVersion = "1.0.0"
+
+// параметры
+var (
+	pGUID          = openapi.Param{Name: "guid", In: "path", Description: "guid"}
+	pTabno         = openapi.Param{Name: "tabno", Description: "табельный номер (like)"}
+	pName          = openapi.Param{Name: "name", Description: "ФИО (like)"}
+	pFrom          = openapi.Param{Name: "from", Description: "дата YYYY-MM-DD", Required: true}
+	pTree          = openapi.Param{Name: "tree", Type: "boolean", Description: "деревом"}
+	pIncludeClosed = openapi.Param{Name: "includeClosed", Type: "boolean", Description: "вместе с расформированными"}
+	pRecursive     = openapi.Param{Name: "recursive", Type: "boolean", Description: "вместе с подчиненными подразделениями"}
+	pFormat        = openapi.Param{Name: "format", Description: "json (по умолчанию), csv или xlsx; также по заголовку Accept"}
+	pKey           = openapi.Param{Name: "key", In: "path", Description: "шаблон: birthdays, buch-emails, 1c-create-user, 1c-create-user-status, closed-departaments, work-anniversaries, staff-changes"}
+	pView          = openapi.Param{Name: "view", Description: "html или text - отдать письмо как есть (по умолчанию - json)"}
+	pNotiTypeID    = openapi.Param{Name: "id", In: "path", Type: "integer", Description: "тип рассылки"}
+	pObserver      = openapi.Param{Name: "observer", In: "path", Description: "guid observer-а или global"}
+	pObserverGUID  = openapi.Param{Name: "observer", Description: "guid сотрудника (observer-а)", Required: true}
+
+	// период дайджестов отдела кадров: оба или ни одного
+	pPeriod = []openapi.Param{
+		{Name: "from", Description: "дата YYYY-MM-DD"},
+		{Name: "to", Description: "дата YYYY-MM-DD"},
+	}
+
+	// фильтры, постраничная выдача и fields= (см. handlers.parseEmployeesFilter)
+	pEmployeesFilter = []openapi.Param{
+		pTabno, pName,
+		{Name: "departament", Description: "guid подразделения"},
+		{Name: "position", Description: "должность (like)"},
+		{Name: "employment", Description: "тип работы (like)"},
+		{Name: "state", Description: "состояние сотрудника (like), по умолчанию - Работа"},
+		{Name: "hasEmail", Type: "boolean", Description: "есть email"},
+		{Name: "bdMonth", Type: "integer", Description: "месяц рождения 1-12"},
+		{Name: "limit", Type: "integer", Description: "размер страницы (не больше 1000)"},
+		{Name: "offset", Type: "integer", Description: "смещение"},
+		{Name: "cursor", Description: "guid последнего user-а предыдущей страницы (nextCursor)"},
+		{Name: "fields", Description: "поля через запятую (userName,tabNumber,departament,... или employees)"},
+	}
+)
+
+// тело запроса /bd-oocouple/ (см. handlers.handleSetOOCoupleForBdNotifications)
+type bdObsOwnersDoc struct {
+	BdObserverId string
+	BdOwners     []struct {
+		BdOwnerId string
+	}
+}
+
+// параметры списков, которые можно выгрузить в CSV / XLSX
+func withFormat(params ...openapi.Param) []openapi.Param {
+	return append(append(make([]openapi.Param, 0, len(params)+1), params...), pFormat)
+}
+
+func get(summary string, response interface{}, params ...openapi.Param) openapi.Operation {
+	return openapi.Operation{Method: "GET", Summary: summary, Response: response, Params: params}
+}
+
+func post(summary string, requestBody, response interface{}, params ...openapi.Param) openapi.Operation {
+	return openapi.Operation{Method: "POST", Summary: summary, RequestBody: requestBody, Response: response, Params: params}
+}
+
+var routesDocs = []openapi.Route{
+	// ping-и и загрузки из 1С
+	{Pattern: "/from-zup/ping/", Path: "/from-zup/ping/", Operations: []openapi.Operation{get("Доступность базы 1С:ЗУП", nil)}},
+	{Pattern: "/from-zup/ping/AllUsers/", Path: "/from-zup/ping/AllUsers/", Operations: []openapi.Operation{get("Все пользователи 1С:ЗУП (ping)", nil)}},
+	{Pattern: "/db/from-zup/write/all-users/", Path: "/db/from-zup/write/all-users/", Operations: []openapi.Operation{get("Загрузить всех user-ов из 1С:ЗУП (с email из AD)", nil)}},
+	{Pattern: "/db/from-zup/write/one-user/", Path: "/db/from-zup/write/one-user/", Operations: []openapi.Operation{post("Debug: записать одного user-а из тела запроса", dom.User{}, nil)}},
+	{Pattern: "/to-zup/send-email/ping/", Path: "/to-zup/send-email/ping/", Operations: []openapi.Operation{get("Debug: отправить в 1С:ЗУП email тестового пользователя", nil)}},
+	{Pattern: "/to-zup/send-email/put-array/", Path: "/to-zup/send-email/put-array/", Operations: []openapi.Operation{get("Отправить в 1С:ЗУП email-ы user-ов", nil)}},
+	{Pattern: "/to-1cuser/send-accounts-crud/put-array/", Path: "/to-1cuser/send-accounts-crud/put-array/", Operations: []openapi.Operation{get("Отправить в 1С:CreateUser новых сотрудников", nil)}},
+	{Pattern: "/from-zup/ping/AllDepartaments/", Path: "/from-zup/ping/AllDepartaments/", Operations: []openapi.Operation{get("Все подразделения 1С:ЗУП (ping)", nil)}},
+	{Pattern: "/db/from-zup/write/all-departaments/", Path: "/db/from-zup/write/all-departaments/", Operations: []openapi.Operation{get("Загрузить все подразделения из 1С:ЗУП", nil)}},
+	{Pattern: "/db/from-zup/write/singl-departament/", Path: "/db/from-zup/write/singl-departament/", Operations: []openapi.Operation{post("Debug: записать одно подразделение из тела запроса", dom.Departament{}, nil)}},
+
+	// подразделения
+	{Pattern: "/departaments", Path: "/departaments", Operations: []openapi.Operation{get("Подразделения списком или деревом (csv/xlsx - списком)", dom.Departaments{}, withFormat(pTree, pIncludeClosed)...)}},
+	{Pattern: "/departaments/", Path: "/departaments/{guid}", Operations: []openapi.Operation{get("Подразделение с родителями и деревом потомков", dom.DepartamentCard{}, pGUID, pIncludeClosed)}},
+	{Pattern: "/departaments/", Path: "/departaments/{guid}/employees", Operations: []openapi.Operation{get("Работающие сотрудники подразделения", dom.AGUsers{}, withFormat(pGUID, pRecursive)...)}},
+	{Pattern: "/departaments/", Path: "/departaments/{guid}/headcount", Operations: []openapi.Operation{get("Численность по узлам поддерева", dom.DepartamentHeadcount{}, pGUID, pIncludeClosed)}},
+	{Pattern: "/departaments/", Path: "/departaments/{guid}/head", Operations: []openapi.Operation{
+		get("Руководитель подразделения", dom.User{}, pGUID),
+		{Method: "PUT", Summary: "Назначить руководителя", RequestBody: dom.DepartamentHeadStruct{}, Params: []openapi.Param{pGUID}},
+		{Method: "DELETE", Summary: "Снять ручное назначение руководителя", Params: []openapi.Param{pGUID}},
+	}},
+	{Pattern: "/employees/", Path: "/employees/{guid}/manager-chain", Operations: []openapi.Operation{get("Цепочка руководителей сотрудника", dom.ManagerChain{}, pGUID)}},
+	{Pattern: "/closed-departaments/employees/", Path: "/closed-departaments/employees/", Operations: []openapi.Operation{get("Работающие сотрудники в расформированных подразделениях", dom.AGUsers{})}},
+	{Pattern: "/closed-departaments/notifications/", Path: "/closed-departaments/notifications/", Operations: []openapi.Operation{get("Отправить в отдел кадров список сотрудников в расформированных подразделениях", nil)}},
+	{Pattern: "/work-anniversaries/employees/", Path: "/work-anniversaries/employees/", Operations: []openapi.Operation{get("Годовщины работы за период (по умолчанию - следующая неделя)", dom.WorkAnniversaries{}, pPeriod...)}},
+	{Pattern: "/work-anniversaries/notifications/", Path: "/work-anniversaries/notifications/", Operations: []openapi.Operation{get("Отправить в отдел кадров годовщины работы", nil, pPeriod...)}},
+	{Pattern: "/staff-changes/employees/", Path: "/staff-changes/employees/", Operations: []openapi.Operation{get("Принятые и уволенные за период (по умолчанию - семь дней до сегодня)", dom.StaffChanges{}, pPeriod...)}},
+	{Pattern: "/staff-changes/notifications/", Path: "/staff-changes/notifications/", Operations: []openapi.Operation{get("Отправить в отдел кадров принятых и уволенных", nil, pPeriod...)}},
+
+	{Pattern: "/changes", Path: "/changes", Operations: []openapi.Operation{get("Лента изменений после курсора (сервер потоков: http.stream_addr)", dom.ChangesFeed{},
+		openapi.Param{Name: "since", Description: "nextCursor предыдущего ответа; пусто - с начала, now - с текущего места"},
+		openapi.Param{Name: "limit", Type: "integer", Description: "не больше 5000, по умолчанию 500"},
+		openapi.Param{Name: "wait", Type: "integer", Description: "если событий нет - ждать новых столько секунд (long-poll)"})}},
+	{Pattern: "/events/stream", Path: "/events/stream", Operations: []openapi.Operation{get("Поток событий (text/event-stream, сервер потоков: http.stream_addr): id - курсор ленты, event - user.create, user.email, employee.fire, ...", nil,
+		openapi.Param{Name: "types", Description: "типы событий через запятую (user.create, employee.fire), сущности (user) или изменения (fire)"},
+		openapi.Param{Name: "lastEventId", Description: "курсор, с которого продолжить (обычно - заголовок Last-Event-ID)"})}},
+
+	// REST api v1
+	{Pattern: handlers.APIv1Prefix + "/users", Path: handlers.APIv1Prefix + "/users", Operations: []openapi.Operation{get("Работающие физ.лица: фильтры, постранично, fields=", dom.EmployeesPage{}, withFormat(pEmployeesFilter...)...)}},
+	{Pattern: handlers.APIv1Prefix + "/users/", Path: handlers.APIv1Prefix + "/users/search", Operations: []openapi.Operation{get("Поиск работающих физ.лиц по нескольким критериям (ФИО - нечётко: ё/е, инициалы)", dom.UsersSearchResult{},
+		pTabno,
+		openapi.Param{Name: "name", Description: "ФИО: \"Кабанов\", \"Кабанов А.И.\", с опечатками"},
+		openapi.Param{Name: "email", Description: "email (like)"},
+		openapi.Param{Name: "departament", Description: "guid или часть наименования подразделения"},
+		openapi.Param{Name: "position", Description: "должность (like)"},
+		openapi.Param{Name: "limit", Type: "integer", Description: "не больше 100, по умолчанию 20"})}},
+	{Pattern: handlers.APIv1Prefix + "/users/", Path: handlers.APIv1Prefix + "/users/fired", Operations: []openapi.Operation{get("Уволенные с даты", dom.AGUsers{}, withFormat(pFrom)...)}},
+	{Pattern: handlers.APIv1Prefix + "/users/", Path: handlers.APIv1Prefix + "/users/{guid}", Operations: []openapi.Operation{get("Физ.лицо по guid", dom.User{}, pGUID)}},
+	{Pattern: handlers.APIv1Prefix + "/employees/", Path: handlers.APIv1Prefix + "/employees/{guid}", Operations: []openapi.Operation{get("Физ.лицо по guid сотрудника", dom.User{}, pGUID)}},
+	{Pattern: handlers.APIv1Prefix + "/employees/", Path: handlers.APIv1Prefix + "/employees/{guid}/manager-chain", Operations: []openapi.Operation{get("Цепочка руководителей сотрудника", dom.ManagerChain{}, pGUID)}},
+	{Pattern: handlers.APIv1Prefix + "/departaments", Path: handlers.APIv1Prefix + "/departaments", Operations: []openapi.Operation{get("Подразделения списком или деревом (csv/xlsx - списком)", dom.Departaments{}, withFormat(pTree, pIncludeClosed)...)}},
+	{Pattern: handlers.APIv1Prefix + "/departaments/", Path: handlers.APIv1Prefix + "/departaments/{guid}", Operations: []openapi.Operation{get("Подразделение с родителями и деревом потомков", dom.DepartamentCard{}, pGUID, pIncludeClosed)}},
+	{Pattern: handlers.APIv1Prefix + "/departaments/", Path: handlers.APIv1Prefix + "/departaments/{guid}/employees", Operations: []openapi.Operation{get("Работающие сотрудники подразделения", dom.AGUsers{}, withFormat(pGUID, pRecursive)...)}},
+	{Pattern: handlers.APIv1Prefix + "/departaments/", Path: handlers.APIv1Prefix + "/departaments/{guid}/headcount", Operations: []openapi.Operation{get("Численность по узлам поддерева", dom.DepartamentHeadcount{}, pGUID, pIncludeClosed)}},
+	{Pattern: handlers.APIv1Prefix + "/departaments/", Path: handlers.APIv1Prefix + "/departaments/{guid}/head", Operations: []openapi.Operation{
+		get("Руководитель подразделения", dom.User{}, pGUID),
+		{Method: "PUT", Summary: "Назначить руководителя", RequestBody: dom.DepartamentHeadStruct{}, Response: dom.User{}, Params: []openapi.Param{pGUID}},
+		{Method: "DELETE", Summary: "Снять ручное назначение руководителя", Response: dom.User{}, Params: []openapi.Param{pGUID}},
+	}},
+	{Pattern: handlers.APIv1Prefix + "/positions", Path: handlers.APIv1Prefix + "/positions", Operations: []openapi.Operation{get("Должности работающих сотрудников", []dom.PositionCount{})}},
+	{Pattern: handlers.APIv1Prefix + "/exchanges", Path: handlers.APIv1Prefix + "/exchanges", Operations: []openapi.Operation{
+		get("Строки обменов", []dom.ExchangeRecord{},
+			openapi.Param{Name: "reason", Type: "integer", Description: "причина обмена (r_id)"},
+			openapi.Param{Name: "failed", Type: "boolean", Description: "только неуспешные"},
+			openapi.Param{Name: "limit", Type: "integer", Description: "не больше строк (по умолчанию 100)"}),
+		{Method: "POST", Summary: "Зарегистрировать строку к обмену", RequestBody: dom.ExchangeStruct{}, Response: dom.ExchangeStruct{}, Status: 201},
+	}},
+	{Pattern: handlers.APIv1Prefix + "/mail-outbox", Path: handlers.APIv1Prefix + "/mail-outbox", Operations: []openapi.Operation{get("Очередь исходящих писем (по умолчанию - неотправленные)", []dom.MailOutboxRecord{},
+		openapi.Param{Name: "status", Description: "failed (по умолчанию), pending, sent или all"},
+		openapi.Param{Name: "limit", Type: "integer", Description: "не больше писем (по умолчанию 100)"})}},
+	{Pattern: handlers.APIv1Prefix + "/mail-outbox/", Path: handlers.APIv1Prefix + "/mail-outbox/{id}/retry", Operations: []openapi.Operation{
+		{Method: "POST", Summary: "Вернуть неотправленное письмо в очередь", Response: dom.MailOutboxRecord{},
+			Params: []openapi.Param{{Name: "id", In: "path", Type: "integer"}}},
+	}},
+	{Pattern: handlers.APIv1Prefix + "/mail-templates", Path: handlers.APIv1Prefix + "/mail-templates", Operations: []openapi.Operation{get("Шаблоны писем рассылок", []dom.MailTemplate{})}},
+	{Pattern: handlers.APIv1Prefix + "/mail-templates/", Path: handlers.APIv1Prefix + "/mail-templates/{key}", Operations: []openapi.Operation{
+		get("Шаблон письма", dom.MailTemplate{}, pKey),
+		{Method: "PUT", Summary: "Изменить шаблон (subject, html, text; пустые - без изменений)", RequestBody: dom.MailTemplate{}, Response: dom.MailTemplate{}, Params: []openapi.Param{pKey}},
+		{Method: "DELETE", Summary: "Вернуть шаблон по умолчанию", Response: dom.MailTemplate{}, Params: []openapi.Param{pKey}},
+	}},
+	{Pattern: handlers.APIv1Prefix + "/mail-templates/", Path: handlers.APIv1Prefix + "/mail-templates/{key}/preview", Operations: []openapi.Operation{
+		get("Письмо по шаблону на данных-примере", mailtmpl.Rendered{}, pKey, pView),
+		{Method: "POST", Summary: "Предпросмотр правки шаблона до сохранения", RequestBody: dom.MailTemplate{}, Response: mailtmpl.Rendered{}, Params: []openapi.Param{pKey, pView}},
+	}},
+	{Pattern: handlers.APIv1Prefix + "/notification-types", Path: handlers.APIv1Prefix + "/notification-types", Operations: []openapi.Operation{
+		get("Типы рассылок с числом подписчиков", []dom.NotificationType{}),
+		{Method: "POST", Summary: "Добавить тип рассылки (name)", RequestBody: dom.NotificationType{}, Response: dom.NotificationType{}, Status: 201},
+	}},
+	{Pattern: handlers.APIv1Prefix + "/notification-types/", Path: handlers.APIv1Prefix + "/notification-types/{id}", Operations: []openapi.Operation{
+		get("Тип рассылки", dom.NotificationType{}, pNotiTypeID),
+		{Method: "PUT", Summary: "Переименовать тип рассылки (name)", RequestBody: dom.NotificationType{}, Response: dom.NotificationType{}, Params: []openapi.Param{pNotiTypeID}},
+		{Method: "DELETE", Summary: "Удалить тип рассылки (встроенные и с подписчиками - 409)", Params: []openapi.Param{pNotiTypeID}, Status: 204},
+	}},
+	{Pattern: handlers.APIv1Prefix + "/notification-types/", Path: handlers.APIv1Prefix + "/notification-types/{id}/subscribers", Operations: []openapi.Operation{
+		get("Подписчики рассылки", []dom.NotificationSubscriber{}, pNotiTypeID),
+		{Method: "POST", Summary: "Подписать user-а (userGuid) или адрес (email)", RequestBody: dom.NotificationSubscriber{}, Response: dom.NotificationSubscriber{}, Params: []openapi.Param{pNotiTypeID}, Status: 201},
+	}},
+	{Pattern: handlers.APIv1Prefix + "/notification-types/", Path: handlers.APIv1Prefix + "/notification-types/{id}/subscribers/{subscriberId}", Operations: []openapi.Operation{
+		{Method: "DELETE", Summary: "Отписать", Params: []openapi.Param{pNotiTypeID, {Name: "subscriberId", In: "path", Type: "integer"}}, Status: 204},
+	}},
+	{Pattern: handlers.APIv1Prefix + "/bd-rules", Path: handlers.APIv1Prefix + "/bd-rules", Operations: []openapi.Operation{get("Правила рассылки о днях рождения (общее - первым)", []dom.BdRule{})}},
+	{Pattern: handlers.APIv1Prefix + "/bd-rules/", Path: handlers.APIv1Prefix + "/bd-rules/{observer}", Operations: []openapi.Operation{
+		get("Правило observer-а (global - общее)", dom.BdRule{}, pObserver),
+		{Method: "PUT", Summary: "Записать правило", RequestBody: dom.BdRule{}, Response: dom.BdRule{}, Params: []openapi.Param{pObserver}},
+		{Method: "DELETE", Summary: "Удалить правило observer-а (действует общее)", Params: []openapi.Param{pObserver}, Status: 204},
+	}},
+	{Pattern: handlers.APIv1Prefix + "/bd-departament-subscriptions", Path: handlers.APIv1Prefix + "/bd-departament-subscriptions", Operations: []openapi.Operation{
+		get("Подписки observer-ов на ДР сотрудников подразделений", []dom.BdDepartamentSubscription{}, openapi.Param{Name: "observer", Description: "guid observer-а"}),
+		{Method: "POST", Summary: "Подписать observer-а на подразделение (пусто - где работает он сам)", RequestBody: dom.BdDepartamentSubscription{}, Response: dom.BdDepartamentSubscription{}, Status: 201},
+	}},
+	{Pattern: handlers.APIv1Prefix + "/bd-departament-subscriptions/", Path: handlers.APIv1Prefix + "/bd-departament-subscriptions/{subscriptionId}", Operations: []openapi.Operation{
+		{Method: "DELETE", Summary: "Отписать", Params: []openapi.Param{{Name: "subscriptionId", In: "path", Type: "integer"}}, Status: 204},
+	}},
+	{Pattern: handlers.APIv1Prefix + "/", Path: handlers.APIv1Prefix + "/{path}", Operations: []openapi.Operation{get("Неизвестный путь api: 404 с ошибкой в конверте", dom.APIErrorEnvelope{}, openapi.Param{Name: "path", In: "path"})}},
+
+	// служебные
+	{Pattern: "/", Path: "/", Operations: []openapi.Operation{get("Доступность сервиса", nil)}},
+	{Pattern: "/db/ping/", Path: "/db/ping/", Operations: []openapi.Operation{get("Доступность БД", nil)}},
+
+	// старые маршруты (клиенты 1С)
+	{Pattern: "/get-act-employees/", Path: "/get-act-employees/", Operations: []openapi.Operation{get("Работающие физ.лица (все аттрибуты); с параметрами - страница EmployeesPage", dom.AGUsers{}, withFormat(pEmployeesFilter...)...)}},
+	{Pattern: "/get-act-email-employees/", Path: "/get-act-email-employees/", Operations: []openapi.Operation{get("Работающие физ.лица с email (все аттрибуты); с параметрами - страница EmployeesPage", dom.AGUsers{}, withFormat(pEmployeesFilter...)...)}},
+	{Pattern: "/get-act-employee", Path: "/get-act-employee", Operations: []openapi.Operation{get("Работающие физ.лица по tabno или name (все аттрибуты)", dom.AGUsers{}, pTabno, pName)}},
+	{Pattern: "/get-fired-employees", Path: "/get-fired-employees", Operations: []openapi.Operation{get("Уволенные с даты (все аттрибуты)", dom.AGUsers{}, withFormat(pFrom)...)}},
+	{Pattern: "/get-act-employees-light/", Path: "/get-act-employees-light/", Operations: []openapi.Operation{get("Работающие физ.лица (облегчённые аттрибуты)", dom.AGUsers{}, withFormat(pEmployeesFilter...)...)}},
+	{Pattern: "/get-act-email-employees-light/", Path: "/get-act-email-employees-light/", Operations: []openapi.Operation{get("Работающие физ.лица с email (облегчённые аттрибуты)", dom.AGUsers{}, withFormat(pEmployeesFilter...)...)}},
+	{Pattern: "/get-act-employee-light", Path: "/get-act-employee-light", Operations: []openapi.Operation{get("Работающие физ.лица по tabno или name (облегчённые аттрибуты)", dom.AGUsers{}, pTabno, pName)}},
+
+	// рассылки о днях рождения
+	{Pattern: "/bd-notifications/", Path: "/bd-notifications/", Operations: []openapi.Operation{get("Запустить рассылку о днях рождения", nil)}},
+	{Pattern: "/bd-oocouple/", Path: "/bd-oocouple/", Operations: []openapi.Operation{post("Установить пары observer - bd_owner", bdObsOwnersDoc{}, nil)}},
+	{Pattern: "/bd-subscriptions", Path: "/bd-subscriptions", Operations: []openapi.Operation{
+		get("Подписки сотрудника на ДР", dom.BdSubscriptions{}, pObserverGUID),
+		{Method: "POST", Summary: "Подписаться на ДР (ownerGuid или точный ownerTabNumber)", RequestBody: dom.BdSubscriptionRequest{}, Response: dom.BdSubscriptionOwner{}, Status: 201},
+		{Method: "DELETE", Summary: "Отписаться", Params: []openapi.Param{pObserverGUID, {Name: "owner", Description: "guid именинника", Required: true}}, Status: 204},
+	}},
+	{Pattern: "/bd-subscriptions/", Path: "/bd-subscriptions/opt-out", Operations: []openapi.Operation{
+		{Method: "POST", Summary: "Отказаться от рассылки о ДР", Response: dom.BdSubscriptions{}, Params: []openapi.Param{pObserverGUID}},
+		{Method: "DELETE", Summary: "Вернуть рассылку о ДР", Response: dom.BdSubscriptions{}, Params: []openapi.Param{pObserverGUID}},
+	}},
+	{Pattern: "/bd-subscriptions/", Path: "/bd-subscriptions/calendar", Operations: []openapi.Operation{
+		get("Ссылка на календарь ДР (.ics)", dom.BdCalendarToken{}, pObserverGUID),
+		{Method: "POST", Summary: "Выпустить ссылку на календарь ДР заново (прежняя перестаёт работать)", Response: dom.BdCalendarToken{}, Params: []openapi.Param{pObserverGUID}, Status: 201},
+		{Method: "DELETE", Summary: "Отозвать ссылку на календарь ДР", Params: []openapi.Param{pObserverGUID}, Status: 204},
+	}},
+	{Pattern: "/bd-calendar/", Path: "/bd-calendar/{token}.ics", Operations: []openapi.Operation{
+		get("Календарь ДР observer-а (text/calendar) для подписки из Outlook", nil, openapi.Param{Name: "token", In: "path", Description: "токен из /bd-subscriptions/calendar"}),
+	}},
+
+	{Pattern: "/openapi.json", Path: "/openapi.json", Operations: []openapi.Operation{{Method: "GET", Summary: "Эта спецификация (OpenAPI 3)", Response: map[string]interface{}{}}}},
+}
+
+// соберём спецификацию по зарегистрированным маршрутам; расхождения описаний с маршрутами - в лог
+func buildOpenAPI(registeredPatterns []string) []byte {
+	spec, undocumented, unregistered, err := openapi.Build(openAPITitle, openAPIVersion, registeredPatterns, routesDocs)
+	if err != nil {
+		log.Error("routes.buildOpenAPI error: %v", err)
+		return []byte("{}")
+	}
+	for _, pattern := range undocumented {
+		log.Error("routes.buildOpenAPI: маршрут %s не описан в routesDocs", pattern)
+	}
+	for _, pattern := range unregistered {
+		log.Error("routes.buildOpenAPI: описан незарегистрированный маршрут %s", pattern)
+	}
+	return spec
+}
@@ -0,0 +1,43 @@
+package routes
+
+import (
+	config "mdata/configs"
+	"mdata/internal/handlers"
+	"mdata/pkg/ratelimit"
+)
+
+//------------------------------------------------------------------
+// Ограничение частоты запросов по маршрутам. У каждого маршрута свои корзины клиентов,
+// а величина ограничения задаётся классом маршрута (см. config.RateLimit). Не указанные здесь маршруты - rateLimitDefault.
+
+type rateLimitClass int
+
+const (
+	rateLimitDefault rateLimitClass = iota
+	rateLimitSearch                 // поиск сотрудника (1С дергает на каждый ввод символа)
+	rateLimitBulk                   // выгрузки всех сотрудников
+)
+
+var routesRateLimits = map[string]rateLimitClass{
+	"/get-act-employee":               rateLimitSearch,
+	"/get-act-employee-light":         rateLimitSearch,
+	handlers.APIv1Prefix + "/users/":  rateLimitSearch,
+	handlers.APIv1Prefix + "/users":   rateLimitBulk,
+	"/get-act-employees/":             rateLimitBulk,
+	"/get-act-email-employees/":       rateLimitBulk,
+	"/get-act-employees-light/":       rateLimitBulk,
+	"/get-act-email-employees-light/": rateLimitBulk,
+	"/get-fired-employees":            rateLimitBulk,
+	"/closed-departaments/employees/": rateLimitBulk,
+}
+
+func newRouteLimiter(cfg config.RateLimit, pattern string) *ratelimit.Limiter {
+	limit := ratelimit.Limit{Rate: cfg.RateLimitDefaultRPS, Burst: cfg.RateLimitDefaultBurst}
+	switch routesRateLimits[pattern] {
+	case rateLimitSearch:
+		limit = ratelimit.Limit{Rate: cfg.RateLimitSearchRPS, Burst: cfg.RateLimitSearchBurst}
+	case rateLimitBulk:
+		limit = ratelimit.Limit{Rate: cfg.RateLimitBulkRPS, Burst: cfg.RateLimitBulkBurst}
+	}
+	return ratelimit.New(limit, cfg.RateLimitMaxClients, cfg.RateLimitTrustProxy)
+}
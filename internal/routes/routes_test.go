@@ -0,0 +1,110 @@
+package routes
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	config "mdata/configs"
+	"mdata/internal/repository"
+	"mdata/pkg/openapi"
+)
+
+// go test ./internal/routes -run OpenAPI -update - перезаписать эталон testdata/openapi.json
+var updateGolden = flag.Bool("update", false, "перезаписать testdata/openapi.json")
+
+const goldenOpenAPI = "testdata/openapi.json"
+
+func buildTestOpenAPI(t *testing.T) []byte {
+	registeredPatterns := InitializeRoutes(http.NewServeMux(), http.NewServeMux(), &repository.PostgreInstance{}, &config.Config{})
+
+	spec, undocumented, unregistered, err := openapi.Build(openAPITitle, openAPIVersion, registeredPatterns, routesDocs)
+	if err != nil {
+		t.Fatalf("openapi.Build error: %v", err)
+	}
+	if len(undocumented) > 0 {
+		t.Errorf("маршруты без описания в routesDocs: %v", undocumented)
+	}
+	if len(unregistered) > 0 {
+		t.Errorf("описаны незарегистрированные маршруты: %v", unregistered)
+	}
+	return spec
+}
+
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	spec := buildTestOpenAPI(t)
+
+	if *updateGolden {
+		if err := ioutil.WriteFile(goldenOpenAPI, append(spec, '\n'), 0664); err != nil {
+			t.Fatalf("write %s error: %v", goldenOpenAPI, err)
+		}
+		return
+	}
+
+	golden, err := ioutil.ReadFile(filepath.Clean(goldenOpenAPI))
+	if err != nil {
+		t.Fatalf("read %s error: %v (создать: go test ./internal/routes -run OpenAPI -update)", goldenOpenAPI, err)
+	}
+	// спецификация целиком: маршруты, параметры и схемы (изменение json-тэгов или описаний - обновить эталон)
+	got, want := openAPIDoc(t, spec), openAPIDoc(t, golden)
+	if reflect.DeepEqual(got, want) {
+		return
+	}
+	for _, section := range []string{"paths", "schemas"} {
+		for _, name := range diffKeys(got[section], want[section]) {
+			t.Errorf("%s %s разошлось с %s (обновить: go test ./internal/routes -run OpenAPI -update)", section, name, goldenOpenAPI)
+		}
+	}
+	if !reflect.DeepEqual(got["other"], want["other"]) {
+		t.Errorf("заголовок спецификации разошёлся с %s (обновить: -update)", goldenOpenAPI)
+	}
+}
+
+// спецификация по разделам: paths, schemas (components.schemas) и other - остальное
+func openAPIDoc(t *testing.T, spec []byte) map[string]map[string]interface{} {
+	doc := make(map[string]interface{})
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		t.Fatalf("openapi.json unmarshal error: %v", err)
+	}
+	result := map[string]map[string]interface{}{"paths": {}, "schemas": {}, "other": {}}
+	for key, value := range doc {
+		switch key {
+		case "paths":
+			result["paths"], _ = value.(map[string]interface{})
+		case "components":
+			components, _ := value.(map[string]interface{})
+			for compKey, compValue := range components {
+				if compKey == "schemas" {
+					result["schemas"], _ = compValue.(map[string]interface{})
+				} else {
+					result["other"]["components."+compKey] = compValue
+				}
+			}
+		default:
+			result["other"][key] = value
+		}
+	}
+	return result
+}
+
+// ключи, которые есть только в одном из got, want или различаются
+func diffKeys(got, want map[string]interface{}) []string {
+	keys := make([]string, 0)
+	for key, value := range got {
+		if !reflect.DeepEqual(value, want[key]) {
+			keys = append(keys, key)
+		}
+	}
+	for key := range want {
+		if _, ok := got[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
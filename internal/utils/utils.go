@@ -2,6 +2,7 @@ package utils
 
 import (
 	"fmt"
+	config "mdata/configs"
 	"mdata/internal/domain"
 	"mdata/internal/repository"
 	"os"
@@ -17,30 +18,22 @@ func SendEmailToBuch(ins *repository.PostgreInstance) error {
 	t := time.Now()
 	if t.Weekday() == time.Friday {
 		// адресаты
-		recipients, err := ins.GetUserEmailsByNotificationsTypes(2) // notification_type = 'В бухгалтерию о загрузке email-ов в 1С:ЗУП', id = 2
+		recipients, err := ins.GetNotificationRecipients(config.NotiTypeBuch) // notification_type = 'В бухгалтерию о загрузке email-ов в 1С:ЗУП', id = 2
 		if err != nil {
 			return err
 		}
 
-		admins, err := ins.GetUserEmailsByNotificationsTypes(1)
-		if err != nil {
-			log.Error("notifications handlers.SendEmailToBuch GetBccAdmin error: %v", err)
-		}
-		bccAdmin := admins[0]
-		if bccAdmin == "" {
-			log.Error("notifications handlers.SendEmailToBuch GetBccAdmin error: no bccAdmin", err)
-		}
+		bccAdmin := ins.GetBccAdmin()
 
-		// тема
-		subject := "Emails file"
 		// тело
 		t := time.Now()
 		_, thisWeek := t.ISOWeek()
-		weekNumber := strconv.Itoa(thisWeek)
-		formatted := fmt.Sprintf("%02d.%02d.%d", t.Day(), t.Month(), t.Year())
-		body := fmt.Sprintf("Email-ы сотрудников, заполненные на %s неделе. Отправлено - %vг.", weekNumber, formatted)
-		// отправка
-		err = repository.SendMailToRecipient(recipients, bccAdmin, subject, body, log.FBuchName)
+		data := domain.MailBuchEmailsData{
+			Week: strconv.Itoa(thisWeek),
+			Date: fmt.Sprintf("%02d.%02d.%d", t.Day(), t.Month(), t.Year()),
+		}
+		// отправка (содержимое файла попадает в письмо сразу, поэтому файл можно очищать)
+		err = ins.SendMailByTemplate(domain.MailTemplateBuchEmails, recipients, bccAdmin, data, log.FBuchName)
 		if err != nil {
 			return err
 		}
@@ -56,39 +49,23 @@ func SendEmailToBuch(ins *repository.PostgreInstance) error {
 // Отправка сообщений админам 1С о необходимости промониторить работу по автоматическому созданию пользователей (если ответ от 1С != 200):
 func SendEmailTo1CAdminsOtherErrors(ins *repository.PostgreInstance, usersToExchangeSlice []domain.User, strInErr string) {
 	// адресаты
-	recipients, err := ins.GetUserEmailsByNotificationsTypes(3) // notification_type = 'В 1C:CreateUser о новом user-е с email', id = 3
+	recipients, err := ins.GetNotificationRecipients(config.NotiType1CCreateUser) // notification_type = 'В 1C:CreateUser о новом user-е с email', id = 3
 	if err != nil {
 		log.Error("notifications utils.SendEmailTo1CAdminsOtherErrors GetRecipients error: %v", err)
+		return
 	}
 	// скрытая копия
-	admins, err := ins.GetUserEmailsByNotificationsTypes(1)
-	if err != nil {
-		log.Error("notifications utils.SendEmailTo1CAdminsOtherErrors GetBccAdmin error: %v", err)
-	}
-	bccAdmin := admins[0]
-	if bccAdmin == "" {
-		log.Error("notifications utils.SendEmailTo1CAdminsOtherErrors GetBccAdmin error: no bccAdmin: %v", err)
-	}
+	bccAdmin := ins.GetBccAdmin()
 
-	// тема
-	subject := "В 1C:CreateUser о новом user-е с email"
 	// тело
-	body := "Попытка выгрузить следующих пользователей для автоматического создания \n"
+	data := domain.Mail1CCreateUserData{Error: strInErr}
 	for _, user := range usersToExchangeSlice {
-		body = body + "-------------------------- \n"
-		body = body + "        " + user.UserName + " (код = " + user.UserID + ")" + " \r\n"
-	}
-	body = body + "-------------------------- \n"
-	if strInErr == "" {
-		body = body + "Завершилась успехом \n"
-	} else {
-		body = body + "Завершилась с ошибкой: \n"
-		body = body + strInErr + "\n"
+		data.Users = append(data.Users, domain.Mail1CUser{Name: user.UserName, ID: user.UserID})
 	}
 	// отправка
-	err = repository.SendMailToRecipient(recipients, bccAdmin, subject, body, "")
+	err = ins.SendMailByTemplate(domain.MailTemplate1CCreateUser, recipients, bccAdmin, data, "")
 	if err != nil {
-		log.Error("notifications utils.SendEmailTo1CAdminsOtherErrors SendMailToRecipient error: %v", err)
+		log.Error("notifications utils.SendEmailTo1CAdminsOtherErrors SendMailByTemplate error: %v", err)
 	}
 
 	log.Info("notifications utils.SendEmailTo1CAdminsOtherErrors OK")
@@ -98,22 +75,13 @@ func SendEmailTo1CAdminsOtherErrors(ins *repository.PostgreInstance, usersToExch
 // userFrom1CStatusMap собрана из domain.Response1CUserStatusStruct - [UserGuid]Status
 func SendEmailTo1CAdminsRespCode200(ins *repository.PostgreInstance, userFrom1CStatusMap map[string]string) {
 	// адресаты
-	recipients, err := ins.GetUserEmailsByNotificationsTypes(3) // notification_type = 'В 1C:CreateUser о новом user-е с email', id = 3
+	recipients, err := ins.GetNotificationRecipients(config.NotiType1CCreateUser) // notification_type = 'В 1C:CreateUser о новом user-е с email', id = 3
 	if err != nil {
 		log.Error("notifications utils.SendEmailTo1CAdminsRespCode200 GetRecipients error: %v", err)
+		return
 	}
 	// скрытая копия
-	admins, err := ins.GetUserEmailsByNotificationsTypes(1)
-	if err != nil {
-		log.Error("notifications utils.SendEmailTo1CAdminsRespCode200 GetBccAdmin error: %v", err)
-	}
-	bccAdmin := admins[0]
-	if bccAdmin == "" {
-		log.Error("notifications utils.SendEmailTo1CAdminsRespCode200 GetBccAdmin error: no bccAdmin: %v", err)
-	}
-
-	// тема
-	subject := "В 1C:CreateUser о новом user-е с email"
+	bccAdmin := ins.GetBccAdmin()
 
 	curUserGuidSlice := make([]string, 0, len(userFrom1CStatusMap))
 	for k := range userFrom1CStatusMap {
@@ -126,20 +94,19 @@ func SendEmailTo1CAdminsRespCode200(ins *repository.PostgreInstance, userFrom1CS
 	}
 
 	// тело
-	body := "Статусы выгрузки пользователей для автоматического создания \n"
+	data := domain.Mail1CCreateUserData{}
 	for _, user := range userSlice {
 		respStr := "MD. Информация не доступна."
 		if v, ok := userFrom1CStatusMap[user.UserGUID]; ok {
 			respStr = v
 		}
-		body = body + "-------------------------- \n"
-		body = body + "        " + user.UserName + " (код = " + user.UserID + ")" + "   |   " + respStr + " \r\n"
+		data.Users = append(data.Users, domain.Mail1CUser{Name: user.UserName, ID: user.UserID, Status: respStr})
 	}
 
 	// отправка
-	err = repository.SendMailToRecipient(recipients, bccAdmin, subject, body, "")
+	err = ins.SendMailByTemplate(domain.MailTemplate1CCreateUserStatus, recipients, bccAdmin, data, "")
 	if err != nil {
-		log.Error("notifications utils.SendEmailTo1CAdminsRespCode200 SendMailToRecipient error: %v", err)
+		log.Error("notifications utils.SendEmailTo1CAdminsRespCode200 SendMailByTemplate error: %v", err)
 	}
 
 	log.Info("notifications utils.SendEmailTo1CAdminsRespCode200 OK")
@@ -166,9 +133,14 @@ func StartOfThisDay(now time.Time) time.Time {
 	return startThisDay
 }
 
+// следующая неделя (пн - вс); для воскресенья - начиная с завтра
 func NextWeek(now time.Time) (nextWeekFrom time.Time, nextWeekTo time.Time) {
 	startThisDay := StartOfThisDay(now)
-	nextWeekFrom = startThisDay.AddDate(0, 0, int(7-startThisDay.Weekday()+1))
+	daysToMonday := (7 - int(startThisDay.Weekday()) + 1) % 7
+	if daysToMonday == 0 {
+		daysToMonday = 7
+	}
+	nextWeekFrom = startThisDay.AddDate(0, 0, daysToMonday)
 	nextWeekTo = nextWeekFrom.AddDate(0, 0, 7).Add(-1 * time.Second)
 	return
 }
@@ -180,30 +152,3 @@ func NextMonth(now time.Time) (nextMonthFrom time.Time, nextMonthTo time.Time) {
 	nextMonthTo = nextMonthFrom.AddDate(0, 1, 0).Add(-1 * time.Second)
 	return
 }
-
-func GetNextWeekTemplStruct(now time.Time) domain.NextWeekStruct {
-	nextWeekFrom, _ := NextWeek(now) // след. неделя начинается с (даты)
-	nextWeek := domain.NextWeekStruct{}
-	layout := "2006-01-02"
-	for i := 0; i < 7; i++ {
-		t := nextWeekFrom.AddDate(0, 0, i)
-		curTempl := t.Format(layout)[4:10]
-		switch t.Weekday() {
-		case time.Monday:
-			nextWeek.Monday = curTempl
-		case time.Tuesday:
-			nextWeek.Tuesday = curTempl
-		case time.Wednesday:
-			nextWeek.Wednesday = curTempl
-		case time.Thursday:
-			nextWeek.Thursday = curTempl
-		case time.Friday:
-			nextWeek.Friday = curTempl
-		case time.Saturday:
-			nextWeek.Saturday = curTempl
-		case time.Sunday:
-			nextWeek.Sunday = curTempl
-		}
-	}
-	return nextWeek
-}
@@ -0,0 +1,8 @@
+-- +goose Up
+-- руководитель подразделения: guid сотрудника из 1С:ЗУП или назначенный через api (тогда head_set_manually = true и загрузка из ЗУП его не перетирает)
+ALTER TABLE departaments ADD COLUMN IF NOT EXISTS departament_head_guid varchar(36) NOT NULL DEFAULT '';
+ALTER TABLE departaments ADD COLUMN IF NOT EXISTS head_set_manually boolean NOT NULL DEFAULT false;
+
+-- +goose Down
+ALTER TABLE departaments DROP COLUMN IF EXISTS head_set_manually;
+ALTER TABLE departaments DROP COLUMN IF EXISTS departament_head_guid;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- рассылка в отдел кадров о работающих сотрудниках, оставшихся в расформированных подразделениях
+INSERT INTO notifications (id, notification_type) VALUES (4, 'В отдел кадров о сотрудниках в расформированных подразделениях')
+    ON CONFLICT (id) DO NOTHING;
+
+-- +goose Down
+DELETE FROM users_for_notifications WHERE notitype = 4;
+DELETE FROM notifications WHERE id = 4;
@@ -0,0 +1,7 @@
+-- +goose Up
+-- нечёткий поиск по ФИО (pg_trgm): индекс по нормализованному ФИО (нижний регистр, ё -> е)
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX IF NOT EXISTS users_user_name_trgm_idx ON users USING gin (replace(lower(user_name), 'ё', 'е') gin_trgm_ops);
+
+-- +goose Down
+DROP INDEX IF EXISTS users_user_name_trgm_idx;
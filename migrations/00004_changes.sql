@@ -0,0 +1,15 @@
+-- +goose Up
+-- лента изменений для потребителей (GET /changes?since=): создание, изменение, увольнение user-ов, сотрудников, подразделений.
+-- change_id - курсор ленты (только растёт)
+CREATE TABLE IF NOT EXISTS changes (
+    change_id   bigserial PRIMARY KEY,
+    entity      varchar(20) NOT NULL,
+    entity_guid varchar(36) NOT NULL,
+    change_type varchar(20) NOT NULL,
+    change_date timestamp NOT NULL DEFAULT now(),
+    payload     jsonb
+);
+CREATE INDEX IF NOT EXISTS changes_entity_guid_idx ON changes (entity_guid);
+
+-- +goose Down
+DROP TABLE IF EXISTS changes;
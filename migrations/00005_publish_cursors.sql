@@ -0,0 +1,11 @@
+-- +goose Up
+-- до какого события ленты changes уже опубликовано во внешний брокер (Kafka), по топикам.
+-- Курсор сдвигается только после подтверждения записи брокером, поэтому после сбоя события публикуются повторно, но не теряются
+CREATE TABLE IF NOT EXISTS publish_cursors (
+    topic          varchar(255) PRIMARY KEY,
+    last_change_id bigint NOT NULL DEFAULT 0,
+    updated_at     timestamp NOT NULL DEFAULT now()
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS publish_cursors;
@@ -0,0 +1,24 @@
+-- +goose Up
+-- исходящие письма: записываются при отправке, фоновый обработчик доставляет их (SMTP или почтовый сервис через Kafka),
+-- при ошибке повторяет с нарастающей паузой (next_attempt_at). status: pending - ждёт отправки, sent - отправлено,
+-- failed - попытки исчерпаны (видно через GET /api/v1/mail-outbox?status=failed, можно повторить)
+CREATE TABLE IF NOT EXISTS mail_outbox (
+    mail_id         bigserial PRIMARY KEY,
+    recipients      text[] NOT NULL,
+    bcc             varchar(255) NOT NULL DEFAULT '',
+    subject         text NOT NULL DEFAULT '',
+    body            text NOT NULL DEFAULT '',
+    attachment_name varchar(255) NOT NULL DEFAULT '',
+    attachment      bytea,
+    status          varchar(20) NOT NULL DEFAULT 'pending',
+    attempt_count   integer NOT NULL DEFAULT 0,
+    last_error      text NOT NULL DEFAULT '',
+    created_at      timestamp NOT NULL DEFAULT now(),
+    next_attempt_at timestamp NOT NULL DEFAULT now(),
+    sent_at         timestamp
+);
+CREATE INDEX IF NOT EXISTS mail_outbox_pending_idx ON mail_outbox (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS mail_outbox_status_idx ON mail_outbox (status, mail_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS mail_outbox;
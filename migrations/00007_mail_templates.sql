@@ -0,0 +1,16 @@
+-- +goose Up
+-- шаблоны писем, изменённые через api (PUT /api/v1/mail-templates/{key}); для остальных действуют шаблоны по умолчанию из кода
+CREATE TABLE IF NOT EXISTS mail_templates (
+    template_key varchar(50) PRIMARY KEY,
+    subject      text NOT NULL,
+    html_body    text NOT NULL DEFAULT '',
+    text_body    text NOT NULL DEFAULT '',
+    updated_at   timestamp NOT NULL DEFAULT now()
+);
+
+-- html-версия письма в очереди исходящих (body - текстовая)
+ALTER TABLE mail_outbox ADD COLUMN IF NOT EXISTS html_body text NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE mail_outbox DROP COLUMN IF EXISTS html_body;
+DROP TABLE IF EXISTS mail_templates;
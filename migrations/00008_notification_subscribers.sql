@@ -0,0 +1,32 @@
+-- +goose Up
+-- подписчики рассылок через api: subscriber_id - номер подписки, email - подписка на произвольный адрес (тогда user_guid пуст),
+-- иначе адрес берётся у user-а
+ALTER TABLE users_for_notifications ADD COLUMN IF NOT EXISTS subscriber_id bigserial;
+ALTER TABLE users_for_notifications ADD COLUMN IF NOT EXISTS email varchar(255) NOT NULL DEFAULT '';
+ALTER TABLE users_for_notifications ALTER COLUMN user_guid DROP NOT NULL;
+CREATE INDEX IF NOT EXISTS users_for_notifications_notitype_idx ON users_for_notifications (notitype);
+
+-- user или адрес подписан на рассылку один раз: повторы, накопленные до индекса, удаляем (остаётся первая подписка)
+DELETE FROM users_for_notifications un
+    USING users_for_notifications dup
+    WHERE un.notitype = dup.notitype
+        AND coalesce(cast(un.user_guid as text), '') = coalesce(cast(dup.user_guid as text), '')
+        AND lower(un.email) = lower(dup.email)
+        AND un.subscriber_id > dup.subscriber_id;
+CREATE UNIQUE INDEX IF NOT EXISTS users_for_notifications_subscriber_idx
+    ON users_for_notifications (notitype, (coalesce(cast(user_guid as text), '')), (lower(email)));
+
+-- id типов рассылок из api: от config.NotiTypeCustomMin (100), меньшие - для встроенных.
+-- Если типы из api уже есть - продолжаем после последнего
+CREATE SEQUENCE IF NOT EXISTS notifications_custom_id_seq MINVALUE 100 START 100;
+SELECT setval('notifications_custom_id_seq',
+    coalesce((SELECT max(id) FROM notifications WHERE id >= 100), 100),
+    (SELECT max(id) FROM notifications WHERE id >= 100) IS NOT NULL);
+
+-- +goose Down
+DROP SEQUENCE IF EXISTS notifications_custom_id_seq;
+DROP INDEX IF EXISTS users_for_notifications_subscriber_idx;
+DROP INDEX IF EXISTS users_for_notifications_notitype_idx;
+DELETE FROM users_for_notifications WHERE user_guid IS NULL;
+ALTER TABLE users_for_notifications DROP COLUMN IF EXISTS email;
+ALTER TABLE users_for_notifications DROP COLUMN IF EXISTS subscriber_id;
@@ -0,0 +1,21 @@
+-- +goose Up
+-- правила рассылки о днях рождения: observer_guid пуст - общее правило (одно), иначе - правило observer-а.
+-- lead_days - за сколько дней до ДР оповещать, weekly_day - день недели дайджеста на следующую неделю (0 - вс, -1 - без него),
+-- monthly_lead_days - за сколько дней до начала месяца дайджест на следующий месяц (0 - без него),
+-- skip_weekends - в сб и вс не рассылать (их оповещения уходят в пятницу), time_zone - IANA (пусто - время сервера)
+CREATE TABLE IF NOT EXISTS bd_rules (
+    observer_guid     uuid,
+    lead_days         integer[] NOT NULL DEFAULT '{1,3}',
+    weekly_day        smallint NOT NULL DEFAULT 5,
+    monthly_lead_days smallint NOT NULL DEFAULT 4,
+    skip_weekends     boolean NOT NULL DEFAULT false,
+    time_zone         varchar(64) NOT NULL DEFAULT '',
+    updated_at        timestamp NOT NULL DEFAULT now()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS bd_rules_observer_idx ON bd_rules ((coalesce(observer_guid, '00000000-0000-0000-0000-000000000000'::uuid)));
+
+-- общее правило - как рассылали раньше: завтра, через 3 дня, по пятницам - на следующую неделю, за 4 дня до начала месяца - на месяц
+INSERT INTO bd_rules (observer_guid) SELECT NULL WHERE NOT EXISTS (SELECT 1 FROM bd_rules WHERE observer_guid IS NULL);
+
+-- +goose Down
+DROP TABLE IF EXISTS bd_rules;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- подписки observer-ов на ДР сотрудников подразделения: departament_guid пуст - подразделения, где работает сам observer;
+-- recursive - вместе с подчиненными подразделениями. Состав именинников определяется при рассылке (новые сотрудники - сразу)
+CREATE TABLE IF NOT EXISTS bd_dep_subscriptions (
+    subscription_id  bigserial PRIMARY KEY,
+    observer_guid    uuid NOT NULL,
+    departament_guid uuid,
+    recursive        boolean NOT NULL DEFAULT false,
+    created_at       timestamp NOT NULL DEFAULT now()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS bd_dep_subscriptions_observer_dep_idx
+    ON bd_dep_subscriptions (observer_guid, (coalesce(departament_guid, '00000000-0000-0000-0000-000000000000'::uuid)));
+
+-- +goose Down
+DROP TABLE IF EXISTS bd_dep_subscriptions;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- observer-ы, отказавшиеся от рассылки о днях рождения (подписки сохраняются - при возврате рассылка продолжится)
+CREATE TABLE IF NOT EXISTS bd_opt_outs (
+    observer_guid uuid PRIMARY KEY,
+    opted_out_at  timestamp NOT NULL DEFAULT now()
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS bd_opt_outs;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- токены календаря ДР (.ics) observer-ов: по ссылке /bd-calendar/<token>.ics календарь отдаётся без авторизации,
+-- поэтому токен - случайный и его можно перевыпустить (старая ссылка перестаёт работать)
+CREATE TABLE IF NOT EXISTS bd_calendar_tokens (
+    observer_guid uuid PRIMARY KEY,
+    token         varchar(64) NOT NULL UNIQUE,
+    created_at    timestamp NOT NULL DEFAULT now()
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS bd_calendar_tokens;
@@ -0,0 +1,31 @@
+-- +goose Up
+-- рассылки в отдел кадров: годовщины работы и принятые / уволенные за неделю (по подразделениям).
+-- Если id 5 или 6 уже занят типом, созданным через api, миграция останавливается: такой тип нужно перенести
+-- (новые типы из api получают id от 100 - config.NotiTypeCustomMin) и запустить миграцию снова
+-- +goose StatementBegin
+DO $$
+DECLARE
+    conflict record;
+BEGIN
+    FOR conflict IN
+        SELECT n.id, n.notification_type
+            FROM notifications n
+                INNER JOIN (VALUES (5, 'В отдел кадров о годовщинах работы'),
+                                   (6, 'В отдел кадров о принятых и уволенных за неделю')) AS b(id, notification_type)
+                    ON n.id = b.id
+            WHERE n.notification_type <> b.notification_type
+    LOOP
+        RAISE EXCEPTION 'notification type id % is taken by "%": move it to id >= 100 before this migration',
+            conflict.id, conflict.notification_type;
+    END LOOP;
+END $$;
+-- +goose StatementEnd
+
+INSERT INTO notifications (id, notification_type) VALUES (5, 'В отдел кадров о годовщинах работы')
+    ON CONFLICT (id) DO NOTHING;
+INSERT INTO notifications (id, notification_type) VALUES (6, 'В отдел кадров о принятых и уволенных за неделю')
+    ON CONFLICT (id) DO NOTHING;
+
+-- +goose Down
+DELETE FROM users_for_notifications WHERE notitype IN (5, 6);
+DELETE FROM notifications WHERE id IN (5, 6);
@@ -0,0 +1,20 @@
+-- +goose Up
+-- дата приёма сотрудника (от неё считаем годовщины работы): дата состояния "Работа", когда сотрудник впервые загружен
+-- или впервые перешёл в "Работа" (пока дата пуста). Дальше дата приёма не меняется, а
+-- employee_states.state_date_from после возвращения из отпуска по уходу за ребенком сдвигается
+ALTER TABLE employees ADD COLUMN IF NOT EXISTS employee_hire_date date;
+
+-- уже загруженные работающие сотрудники - по дате текущего состояния "Работа".
+-- Правило для сдвинутой даты: в employee_states только текущее состояние, поэтому у вернувшихся из отпуска
+-- по уходу за ребенком это дата возвращения - её и берём (годовщины от неё, пока дату не исправят в БД вручную).
+-- Сотрудники не в "Работа" (отпуск, уволен) остаются без даты до перехода в "Работа"
+UPDATE employees empl
+    SET employee_hire_date = emplCS.state_date_from
+    FROM employee_states emplCS
+    WHERE emplCS.employee_guid = empl.employee_guid
+        AND empl.employee_hire_date IS NULL
+        AND emplCS.state_descr ILIKE '%Работ%'
+        AND emplCS.state_date_from > '0001-01-01';
+
+-- +goose Down
+ALTER TABLE employees DROP COLUMN IF EXISTS employee_hire_date;
@@ -0,0 +1,20 @@
+package broker
+
+// Публикация сообщений во внешний брокер (Kafka) для других сервисов: события master data и задания на отправку почты.
+// Producer - интерфейс, чтобы Kafka можно было заменить брокером в памяти (NewMemory) в тестах и при разработке.
+
+import "context"
+
+// Message - Key определяет партицию: сообщения с одним ключом (guid user-а) попадают в одну партицию по порядку
+type Message struct {
+	Topic   string
+	Key     string
+	Value   []byte
+	Headers map[string]string
+}
+
+// Producer - Publish возвращается после подтверждения записи брокером (или с ошибкой - тогда ничего не считаем доставленным)
+type Producer interface {
+	Publish(ctx context.Context, msgs ...Message) error
+	Close() error
+}
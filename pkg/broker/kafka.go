@@ -0,0 +1,59 @@
+package broker
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	_defaultMaxAttempts  = 10
+	_defaultWriteTimeout = 10 * time.Second
+)
+
+// Kafka - синхронная запись с подтверждением от всех реплик (acks=all) и повторами при временных ошибках.
+// Партиция - murmur2 от ключа, как у стандартного клиента Kafka (Java), порядок внутри ключа сохраняется
+type Kafka struct {
+	writer *kafka.Writer
+}
+
+// NewKafka - addrs - адреса брокеров через запятую ("host1:9092,host2:9092").
+// Соединение устанавливается при первой публикации, поэтому недоступность Kafka не мешает запуску сервиса
+func NewKafka(addrs string) *Kafka {
+	brokers := make([]string, 0)
+	for _, addr := range strings.Split(addrs, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			brokers = append(brokers, addr)
+		}
+	}
+
+	return &Kafka{writer: &kafka.Writer{
+		Addr:                   kafka.TCP(brokers...),
+		Balancer:               kafka.Murmur2Balancer{},
+		RequiredAcks:           kafka.RequireAll,
+		MaxAttempts:            _defaultMaxAttempts,
+		WriteTimeout:           _defaultWriteTimeout,
+		BatchTimeout:           10 * time.Millisecond, // пачку отдаём сразу, не ждём её наполнения
+		AllowAutoTopicCreation: true,
+	}}
+}
+
+// Publish -.
+func (k *Kafka) Publish(ctx context.Context, msgs ...Message) error {
+	kafkaMsgs := make([]kafka.Message, 0, len(msgs))
+	for _, msg := range msgs {
+		kafkaMsg := kafka.Message{Topic: msg.Topic, Key: []byte(msg.Key), Value: msg.Value}
+		for key, value := range msg.Headers {
+			kafkaMsg.Headers = append(kafkaMsg.Headers, kafka.Header{Key: key, Value: []byte(value)})
+		}
+		kafkaMsgs = append(kafkaMsgs, kafkaMsg)
+	}
+	return k.writer.WriteMessages(ctx, kafkaMsgs...)
+}
+
+// Close - дожидается отправки уже принятых сообщений
+func (k *Kafka) Close() error {
+	return k.writer.Close()
+}
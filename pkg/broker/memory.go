@@ -0,0 +1,105 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+)
+
+const _defaultMemoryPartitions = 3
+
+// Memory - брокер в памяти: хранит опубликованные сообщения по топикам и партициям (партиция - по хэшу ключа:
+// FNV-1a, а не murmur2, как в Kafka - номера партиций другие, но сообщения одного ключа так же в одной партиции по порядку).
+// Для тестов и разработки без Kafka
+type Memory struct {
+	partitions int
+
+	mu     sync.Mutex
+	topics map[string][][]Message
+	closed bool
+	err    error
+}
+
+// NewMemory - partitions - количество партиций в каждом топике (<= 0 - по умолчанию)
+func NewMemory(partitions int) *Memory {
+	if partitions <= 0 {
+		partitions = _defaultMemoryPartitions
+	}
+	return &Memory{partitions: partitions, topics: make(map[string][][]Message)}
+}
+
+// Publish - все сообщения пачки записываются, либо (при FailWith) ни одно
+func (m *Memory) Publish(ctx context.Context, msgs ...Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return errors.New("broker.Memory: publish to closed broker")
+	}
+	if m.err != nil {
+		return m.err
+	}
+	for _, msg := range msgs {
+		topic, ok := m.topics[msg.Topic]
+		if !ok {
+			topic = make([][]Message, m.partitions)
+			m.topics[msg.Topic] = topic
+		}
+		partition := m.Partition(msg.Key)
+		topic[partition] = append(topic[partition], msg)
+	}
+	return nil
+}
+
+// Close -.
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	return nil
+}
+
+// Partition - номер партиции для ключа
+func (m *Memory) Partition(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(m.partitions))
+}
+
+// Messages - все сообщения топика (по партициям подряд; внутри партиции - в порядке публикации)
+func (m *Memory) Messages(topic string) []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	msgs := make([]Message, 0)
+	for _, partition := range m.topics[topic] {
+		msgs = append(msgs, partition...)
+	}
+	return msgs
+}
+
+// PartitionMessages - сообщения одной партиции топика
+func (m *Memory) PartitionMessages(topic string, partition int) []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if partition < 0 || partition >= len(m.topics[topic]) {
+		return nil
+	}
+	return append([]Message(nil), m.topics[topic][partition]...)
+}
+
+// FailWith - последующие Publish будут возвращать err (nil - снова принимать); имитация недоступности брокера
+func (m *Memory) FailWith(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.err = err
+}
+
+// Reset - очистить все топики
+func (m *Memory) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.topics = make(map[string][][]Message)
+}
@@ -0,0 +1,41 @@
+package export
+
+// Выгрузка таблиц в CSV и XLSX (для отдела кадров и бухгалтерии, которые открывают их в Excel).
+// Пишем прямо в поток ответа, без промежуточного файла.
+
+import (
+	"encoding/csv"
+	"io"
+)
+
+// Table - заголовки колонок и строки (все значения - строки, как их увидит пользователь)
+type Table struct {
+	Headers []string
+	Rows    [][]string
+}
+
+// BOM нужен, чтобы Excel открыл UTF-8 файл с кириллицей без "кракозябр"
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// разделитель ";" - Excel с русской локалью ожидает именно его (запятая у нас - десятичный разделитель)
+const csvSeparator = ';'
+
+// WriteCSV - CSV в UTF-8 с BOM
+func WriteCSV(w io.Writer, t Table) error {
+	if _, err := w.Write(utf8BOM); err != nil {
+		return err
+	}
+	csvWriter := csv.NewWriter(w)
+	csvWriter.Comma = csvSeparator
+	csvWriter.UseCRLF = true
+	if err := csvWriter.Write(t.Headers); err != nil {
+		return err
+	}
+	for _, row := range t.Rows {
+		if err := csvWriter.Write(row); err != nil {
+			return err
+		}
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
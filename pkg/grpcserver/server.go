@@ -0,0 +1,83 @@
+package grpcserver
+
+import (
+	config "mdata/configs"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+const (
+	_defaultAddr            = "localhost:50051"
+	_defaultShutdownTimeout = 3 * time.Second
+)
+
+// Server -.
+type Server struct {
+	server          *grpc.Server
+	addr            string
+	notify          chan error
+	shutdownTimeout time.Duration
+}
+
+// New - register регистрирует сервисы на сервере до его запуска
+func New(cfg config.GRPC, register func(*grpc.Server), opts ...grpc.ServerOption) *Server {
+	s := &Server{
+		server:          grpc.NewServer(opts...),
+		addr:            _defaultAddr,
+		notify:          make(chan error, 1),
+		shutdownTimeout: _defaultShutdownTimeout,
+	}
+
+	if cfg.GRPCAddress != "" {
+		s.addr = cfg.GRPCAddress
+	}
+
+	register(s.server)
+
+	s.start()
+
+	return s
+}
+
+func (s *Server) start() {
+	go func() {
+		listener, err := net.Listen("tcp", s.addr)
+		if err != nil {
+			s.notify <- err
+			close(s.notify)
+			return
+		}
+		s.notify <- s.server.Serve(listener)
+		close(s.notify)
+	}()
+}
+
+// Notify -.
+func (s *Server) Notify() <-chan error {
+	return s.notify
+}
+
+// Shutdown - ждём завершения текущих вызовов (в т.ч. потоков) не дольше shutdownTimeout, потом обрываем
+func (s *Server) Shutdown() error {
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+
+	timer := time.NewTimer(s.shutdownTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-stopped:
+	case <-timer.C:
+		s.server.Stop()
+	}
+	return nil
+}
+
+func (s *Server) GetAddr() string {
+	return s.addr
+}
@@ -3,6 +3,7 @@ package httpserver
 import (
 	"context"
 	config "mdata/configs"
+	"net"
 	"net/http"
 	"time"
 )
@@ -11,6 +12,7 @@ const (
 	_defaultReadTimeout     = 5 * time.Second
 	_defaultWriteTimeout    = 5 * time.Second
 	_defaultAddr            = ":8080"
+	_defaultStreamPort      = "8081"
 	_defaultShutdownTimeout = 3 * time.Second
 )
 
@@ -54,6 +56,50 @@ func New(handler http.Handler, cfg config.HTTP) *Server {
 	return s
 }
 
+// NewStream - сервер для потоковых маршрутов (SSE, long-poll): без таймаута записи, длительность соединений
+// ограничивают сами обработчики
+func NewStream(handler http.Handler, cfg config.HTTP) *Server {
+	// при Shutdown отменяем контексты запросов - иначе открытые потоки не дали бы серверу остановиться
+	baseCtx, cancel := context.WithCancel(context.Background())
+	httpServer := &http.Server{
+		Handler:     handler,
+		ReadTimeout: _defaultReadTimeout,
+		Addr:        streamAddr(cfg),
+		BaseContext: func(net.Listener) context.Context { return baseCtx },
+	}
+	httpServer.RegisterOnShutdown(cancel)
+
+	if time.Duration(cfg.HTTPReadTimeout) != _defaultReadTimeout {
+		httpServer.ReadTimeout = time.Duration(cfg.HTTPReadTimeout * int(time.Second))
+	}
+
+	s := &Server{
+		server:          httpServer,
+		notify:          make(chan error, 1),
+		shutdownTimeout: _defaultShutdownTimeout,
+	}
+
+	s.start()
+
+	return s
+}
+
+// адрес потокового сервера: stream_addr, а если не задан - тот же хост, что и у основного (HTTP_ADDR), порт 8081
+func streamAddr(cfg config.HTTP) string {
+	if cfg.HTTPStreamAddr != "" {
+		return cfg.HTTPStreamAddr
+	}
+	addr := cfg.HTTPAddr
+	if addr == "" {
+		addr = _defaultAddr
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil { // адрес без порта - это хост
+		host = addr
+	}
+	return net.JoinHostPort(host, _defaultStreamPort)
+}
+
 func (s *Server) start() {
 	go func() {
 		s.notify <- s.server.ListenAndServe()
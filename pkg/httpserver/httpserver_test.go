@@ -0,0 +1,31 @@
+package httpserver
+
+import (
+	"testing"
+
+	config "mdata/configs"
+)
+
+func TestStreamAddr(t *testing.T) {
+	cases := []struct {
+		name       string
+		addr       string
+		streamAddr string
+		want       string
+	}{
+		{"задан stream_addr", "localhost:8080", "0.0.0.0:9000", "0.0.0.0:9000"},
+		{"хост из addr", "localhost:8080", "", "localhost:8081"},
+		{"все интерфейсы", ":8080", "", ":8081"},
+		{"ipv6", "[::1]:8080", "", "[::1]:8081"},
+		{"addr не задан", "", "", ":8081"},
+		{"addr без порта", "localhost", "", "localhost:8081"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cfg := config.HTTP{HTTPAddr: c.addr, HTTPStreamAddr: c.streamAddr}
+			if got := streamAddr(cfg); got != c.want {
+				t.Errorf("streamAddr = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package ical
+
+// Минимальный iCalendar (RFC 5545) для подписки из Outlook / Google Calendar: только события на весь день,
+// повторяющиеся по RRULE. Строки - CRLF, длинные строки переносятся (не длиннее 75 байт, по границе символа UTF-8).
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Calendar - календарь (VCALENDAR)
+type Calendar struct {
+	ProdID string // кто сформировал, например -//mdata//birthdays//RU
+	Name   string // имя календаря у подписчика (X-WR-CALNAME)
+	Events []Event
+}
+
+// Event - событие на весь день (VEVENT)
+type Event struct {
+	UID     string    // постоянный идентификатор: по нему клиент обновляет событие, а не дублирует его
+	Summary string    // заголовок
+	Date    time.Time // день события (первое повторение); время не учитывается
+	RRule   string    // правило повторения без "RRULE:", например FREQ=YEARLY; пусто - без повторения
+}
+
+const maxLineOctets = 75
+
+// Write - календарь в w
+func Write(w io.Writer, cal Calendar, stamp time.Time) error {
+	bw := bufio.NewWriter(w)
+	dtStamp := stamp.UTC().Format("20060102T150405Z")
+
+	writeLine(bw, "BEGIN:VCALENDAR")
+	writeLine(bw, "VERSION:2.0")
+	writeLine(bw, "PRODID:"+escapeText(cal.ProdID))
+	writeLine(bw, "CALSCALE:GREGORIAN")
+	writeLine(bw, "METHOD:PUBLISH")
+	if cal.Name != "" {
+		writeLine(bw, "X-WR-CALNAME:"+escapeText(cal.Name))
+	}
+	for _, event := range cal.Events {
+		writeLine(bw, "BEGIN:VEVENT")
+		writeLine(bw, "UID:"+escapeText(event.UID))
+		writeLine(bw, "DTSTAMP:"+dtStamp)
+		writeLine(bw, "DTSTART;VALUE=DATE:"+event.Date.Format("20060102"))
+		writeLine(bw, "DTEND;VALUE=DATE:"+event.Date.AddDate(0, 0, 1).Format("20060102"))
+		if event.RRule != "" {
+			writeLine(bw, "RRULE:"+event.RRule)
+		}
+		writeLine(bw, "SUMMARY:"+escapeText(event.Summary))
+		writeLine(bw, "TRANSP:TRANSPARENT") // не занимает время в расписании
+		writeLine(bw, "END:VEVENT")
+	}
+	writeLine(bw, "END:VCALENDAR")
+	return bw.Flush()
+}
+
+// строка с переносом: продолжение начинается с пробела
+func writeLine(bw *bufio.Writer, line string) {
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		bw.WriteString(line[:cut])
+		bw.WriteString("\r\n ")
+		line = line[cut:]
+		limit = maxLineOctets - 1 // пробел в начале продолжения тоже считается
+	}
+	bw.WriteString(line)
+	bw.WriteString("\r\n")
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
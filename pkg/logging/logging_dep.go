@@ -17,6 +17,10 @@ var (
 var lock = sync.Mutex{}
 
 func init() {
+	// каталог логов - рядом с рабочим каталогом процесса (и пакета при go test)
+	if err := os.MkdirAll("logs", 0775); err != nil {
+		logging.Fatalf("error creating logs dir: %v", err)
+	}
 	mainLogFile, err := os.OpenFile("logs/md-info.log", os.O_CREATE|os.O_APPEND|os.O_RDWR, 0664)
 	if err != nil {
 		logging.Fatalf("error opening file: %v", err)
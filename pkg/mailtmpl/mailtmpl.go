@@ -0,0 +1,96 @@
+package mailtmpl
+
+// Шаблоны писем: тема и текстовая версия - text/template, html-версия - html/template (значения экранируются).
+// Письмо уходит с обеими версиями (multipart/alternative): почтовый клиент покажет html, а если не умеет - текст.
+
+import (
+	"bytes"
+	"errors"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Template - исходники шаблона
+type Template struct {
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// Rendered - готовое письмо
+type Rendered struct {
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+	Text    string `json:"text"`
+}
+
+// Parsed - разобранный шаблон (разбираем один раз, заполняем сколько угодно)
+type Parsed struct {
+	subject *texttemplate.Template
+	html    *htmltemplate.Template
+	text    *texttemplate.Template
+}
+
+// Parse - ошибки синтаксиса - с указанием части шаблона (subject, html, text)
+func Parse(t Template) (*Parsed, error) {
+	if strings.TrimSpace(t.Subject) == "" {
+		return nil, errors.New("subject: empty template")
+	}
+	if strings.TrimSpace(t.HTML) == "" && strings.TrimSpace(t.Text) == "" {
+		return nil, errors.New("html and text: at least one is required")
+	}
+
+	p := &Parsed{}
+	var err error
+	if p.subject, err = texttemplate.New("subject").Option("missingkey=error").Parse(t.Subject); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(t.HTML) != "" {
+		if p.html, err = htmltemplate.New("html").Option("missingkey=error").Parse(t.HTML); err != nil {
+			return nil, err
+		}
+	}
+	if strings.TrimSpace(t.Text) != "" {
+		if p.text, err = texttemplate.New("text").Option("missingkey=error").Parse(t.Text); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Execute - заполним шаблон данными. Тема - в одну строку
+func (p *Parsed) Execute(data interface{}) (Rendered, error) {
+	r := Rendered{}
+	buf := &bytes.Buffer{}
+
+	if err := p.subject.Execute(buf, data); err != nil {
+		return r, err
+	}
+	r.Subject = strings.Join(strings.Fields(buf.String()), " ")
+
+	if p.html != nil {
+		buf.Reset()
+		if err := p.html.Execute(buf, data); err != nil {
+			return r, err
+		}
+		r.HTML = buf.String()
+	}
+	if p.text != nil {
+		buf.Reset()
+		if err := p.text.Execute(buf, data); err != nil {
+			return r, err
+		}
+		r.Text = buf.String()
+	}
+	return r, nil
+}
+
+// Render - Parse и Execute
+func Render(t Template, data interface{}) (Rendered, error) {
+	p, err := Parse(t)
+	if err != nil {
+		return Rendered{}, err
+	}
+	return p.Execute(data)
+}
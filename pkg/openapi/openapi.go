@@ -0,0 +1,235 @@
+package openapi
+
+// Сборка документа OpenAPI 3 из описания маршрутов и go-типов.
+// Схемы строятся отражением (reflect) по json-тэгам структур, поэтому при изменении структур документ меняется сам.
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// описание одного пути документа (Pattern - шаблон, с которым маршрут зарегистрирован в ServeMux;
+// одному шаблону, например "/departaments/", может соответствовать несколько путей)
+type Route struct {
+	Pattern    string
+	Path       string
+	Operations []Operation
+}
+
+type Operation struct {
+	Method      string
+	Summary     string
+	Params      []Param
+	RequestBody interface{} // пример значения go-типа тела запроса (nil - без тела)
+	Response    interface{} // пример значения go-типа ответа (nil - ответ текстом)
+	Status      int         // код успешного ответа (0 - 200)
+}
+
+type Param struct {
+	Name        string
+	In          string // query | path
+	Description string
+	Type        string // string | integer | boolean
+	Required    bool
+}
+
+// построим документ. Возвращаем также шаблоны зарегистрированных маршрутов без описания
+// и описанные шаблоны, которые не зарегистрированы (их надо поправить, чтобы спецификация не разошлась с маршрутами)
+func Build(title, version string, registeredPatterns []string, routes []Route) ([]byte, []string, []string, error) {
+	registered := make(map[string]bool, len(registeredPatterns))
+	for _, pattern := range registeredPatterns {
+		registered[pattern] = true
+	}
+	described := make(map[string]bool, len(routes))
+
+	b := &builder{schemas: make(map[string]interface{})}
+	paths := make(map[string]map[string]interface{})
+	for _, route := range routes {
+		described[route.Pattern] = true
+		if !registered[route.Pattern] {
+			continue
+		}
+		pathItem, ok := paths[route.Path]
+		if !ok {
+			pathItem = make(map[string]interface{})
+			paths[route.Path] = pathItem
+		}
+		for _, op := range route.Operations {
+			pathItem[strings.ToLower(op.Method)] = b.operation(route.Path, op)
+		}
+	}
+
+	undocumented := make([]string, 0)
+	for _, pattern := range registeredPatterns {
+		if !described[pattern] {
+			undocumented = append(undocumented, pattern)
+		}
+	}
+	unregistered := make([]string, 0)
+	for pattern := range described {
+		if !registered[pattern] {
+			unregistered = append(unregistered, pattern)
+		}
+	}
+	sort.Strings(unregistered)
+
+	doc := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   title,
+			"version": version,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": b.schemas,
+		},
+	}
+	sliceOfByte, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, undocumented, unregistered, fmt.Errorf("openapi.Build marshal error: %v", err)
+	}
+	return sliceOfByte, undocumented, unregistered, nil
+}
+
+type builder struct {
+	schemas map[string]interface{}
+}
+
+func (b *builder) operation(path string, op Operation) map[string]interface{} {
+	status := op.Status
+	if status == 0 {
+		status = 200
+	}
+
+	params := make([]interface{}, 0, len(op.Params))
+	for _, p := range op.Params {
+		in := p.In
+		if in == "" {
+			in = "query"
+		}
+		typ := p.Type
+		if typ == "" {
+			typ = "string"
+		}
+		params = append(params, map[string]interface{}{
+			"name":        p.Name,
+			"in":          in,
+			"description": p.Description,
+			"required":    p.Required || in == "path",
+			"schema":      map[string]interface{}{"type": typ},
+		})
+	}
+
+	var content map[string]interface{}
+	if op.Response != nil {
+		content = map[string]interface{}{"application/json": map[string]interface{}{"schema": b.schemaOf(reflect.TypeOf(op.Response))}}
+	} else {
+		content = map[string]interface{}{"text/plain": map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}}
+	}
+
+	operation := map[string]interface{}{
+		"summary":    op.Summary,
+		"parameters": params,
+		"responses": map[string]interface{}{
+			fmt.Sprint(status): map[string]interface{}{"description": "ok", "content": content},
+		},
+	}
+	if op.RequestBody != nil {
+		operation["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": b.schemaOf(reflect.TypeOf(op.RequestBody))}},
+		}
+	}
+	return operation
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	rawType      = reflect.TypeOf(json.RawMessage{})
+	marshalerTyp = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// схема go-типа; именованные структуры уходят в components/schemas и подставляются ссылкой
+func (b *builder) schemaOf(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	// json.RawMessage - произвольный json
+	if t == rawType {
+		return map[string]interface{}{}
+	}
+	// типы со своим MarshalJSON (даты вида CastDate) отдаются строкой
+	if t.Kind() == reflect.Struct && (t.Implements(marshalerTyp) || reflect.PtrTo(t).Implements(marshalerTyp)) {
+		return map[string]interface{}{"type": "string", "format": "date"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": b.schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		if _, ok := b.schemas[t.Name()]; !ok {
+			b.schemas[t.Name()] = map[string]interface{}{} // заглушка от рекурсии (DepartamentNode.Children)
+			b.schemas[t.Name()] = b.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	// interface{} и прочее - любое значение
+	return map[string]interface{}{}
+}
+
+func (b *builder) structSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	b.addStructFields(t, properties)
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+// поля структуры по json-тэгам; поля встроенных структур поднимаются наверх, как это делает encoding/json
+func (b *builder) addStructFields(t reflect.Type, properties map[string]interface{}) {
+	for k := 0; k < t.NumField(); k++ {
+		field := t.Field(k)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			for embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				b.addStructFields(embedded, properties)
+				continue
+			}
+		}
+		if field.PkgPath != "" { // неэкспортируемое
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = b.schemaOf(field.Type)
+	}
+}
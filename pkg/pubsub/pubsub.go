@@ -0,0 +1,79 @@
+package pubsub
+
+// Рассылка сообщений внутри процесса всем подписчикам (для потоковой выдачи событий клиентам).
+// Publish не блокируется: подписчик, который не успевает читать, отключается (его канал закрывается) -
+// клиент переподключается и догоняет пропущенное по своему курсору.
+
+import "sync"
+
+const _defaultBufSize = 256
+
+// Hub -.
+type Hub struct {
+	bufSize int
+
+	mu   sync.Mutex
+	subs map[*Subscriber]struct{}
+}
+
+// Subscriber - C закрывается при Close или когда подписчик отстал
+type Subscriber struct {
+	C <-chan interface{}
+
+	ch  chan interface{}
+	hub *Hub
+}
+
+// New - bufSize - сколько сообщений подписчик может не прочитать, прежде чем будет отключен
+func New(bufSize int) *Hub {
+	if bufSize <= 0 {
+		bufSize = _defaultBufSize
+	}
+	return &Hub{bufSize: bufSize, subs: make(map[*Subscriber]struct{})}
+}
+
+// Subscribe -.
+func (h *Hub) Subscribe() *Subscriber {
+	ch := make(chan interface{}, h.bufSize)
+	s := &Subscriber{C: ch, ch: ch, hub: h}
+
+	h.mu.Lock()
+	h.subs[s] = struct{}{}
+	h.mu.Unlock()
+	return s
+}
+
+// Close - отписаться (можно вызывать повторно)
+func (s *Subscriber) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+// Publish - разослать сообщение всем подписчикам
+func (h *Hub) Publish(msg interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs {
+		select {
+		case s.ch <- msg:
+		default:
+			h.remove(s) // отстал
+		}
+	}
+}
+
+// Len - количество подписчиков
+func (h *Hub) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs)
+}
+
+// под h.mu
+func (h *Hub) remove(s *Subscriber) {
+	if _, ok := h.subs[s]; ok {
+		delete(h.subs, s)
+		close(s.ch)
+	}
+}
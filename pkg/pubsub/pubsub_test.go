@@ -0,0 +1,57 @@
+package pubsub
+
+import "testing"
+
+func TestPublishAllSubscribers(t *testing.T) {
+	h := New(4)
+	first, second := h.Subscribe(), h.Subscribe()
+	h.Publish(1)
+	h.Publish(2)
+	for k, s := range []*Subscriber{first, second} {
+		for _, want := range []int{1, 2} {
+			if got := <-s.C; got != want {
+				t.Errorf("subscriber %d: got %v, want %d", k, got, want)
+			}
+		}
+	}
+}
+
+// подписчик, не читающий канал, отключается при переполнении буфера; остальные получают всё
+func TestSlowSubscriberDropped(t *testing.T) {
+	h := New(2)
+	slow, fast := h.Subscribe(), h.Subscribe()
+
+	for msg := 1; msg <= 3; msg++ {
+		h.Publish(msg)
+		if got := <-fast.C; got != msg {
+			t.Errorf("fast: got %v, want %d", got, msg)
+		}
+	}
+	if got := h.Len(); got != 1 {
+		t.Errorf("Len = %d, want 1", got)
+	}
+	// прочитанное до переполнения отдаётся, потом канал закрыт
+	for _, want := range []int{1, 2} {
+		if got, ok := <-slow.C; !ok || got != want {
+			t.Errorf("slow: got %v, %v; want %d", got, ok, want)
+		}
+	}
+	if _, ok := <-slow.C; ok {
+		t.Error("slow: channel not closed")
+	}
+	slow.Close() // после отключения Close не паникует
+}
+
+func TestCloseTwice(t *testing.T) {
+	h := New(0)
+	s := h.Subscribe()
+	s.Close()
+	s.Close()
+	if _, ok := <-s.C; ok {
+		t.Error("channel not closed")
+	}
+	if got := h.Len(); got != 0 {
+		t.Errorf("Len = %d, want 0", got)
+	}
+	h.Publish(1) // отписанному не отправляется
+}
@@ -0,0 +1,137 @@
+package ratelimit
+
+// Ограничение частоты запросов от одного клиента: token bucket на каждого клиента.
+// Корзины клиентов хранятся в LRU ограниченного размера - память не растёт от количества клиентов.
+
+import (
+	"container/list"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const _defaultMaxClients = 10000
+
+// Limit - Rate запросов в секунду в среднем, Burst - сколько запросов можно сделать подряд. Rate <= 0 - без ограничения
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+type bucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// Limiter -.
+type Limiter struct {
+	limit      Limit
+	maxClients int
+	trustProxy bool
+
+	mu      sync.Mutex
+	buckets map[string]*list.Element
+	lru     *list.List // в начале - недавно обращавшиеся клиенты
+	now     func() time.Time
+}
+
+// New - maxClients - сколько клиентов помнить (самые давние вытесняются), trustProxy - брать адрес клиента из X-Forwarded-For
+func New(limit Limit, maxClients int, trustProxy bool) *Limiter {
+	if maxClients <= 0 {
+		maxClients = _defaultMaxClients
+	}
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	return &Limiter{
+		limit:      limit,
+		maxClients: maxClients,
+		trustProxy: trustProxy,
+		buckets:    make(map[string]*list.Element),
+		lru:        list.New(),
+		now:        time.Now,
+	}
+}
+
+// Allow - можно ли выполнить запрос клиента key; если нет - через сколько можно будет
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if l.limit.Rate <= 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	var b *bucket
+	if elem, ok := l.buckets[key]; ok {
+		l.lru.MoveToFront(elem)
+		b = elem.Value.(*bucket)
+		// пополним корзину за прошедшее время
+		b.tokens = math.Min(float64(l.limit.Burst), b.tokens+now.Sub(b.last).Seconds()*l.limit.Rate)
+		b.last = now
+	} else {
+		b = &bucket{key: key, tokens: float64(l.limit.Burst), last: now}
+		l.buckets[key] = l.lru.PushFront(b)
+		for l.lru.Len() > l.maxClients {
+			oldest := l.lru.Back()
+			l.lru.Remove(oldest)
+			delete(l.buckets, oldest.Value.(*bucket).key)
+		}
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.limit.Rate * float64(time.Second))
+	return false, wait
+}
+
+// Middleware - при превышении отвечаем 429 Too Many Requests с заголовком Retry-After (в секундах)
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	if l.limit.Rate <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed, wait := l.Allow(ClientKey(r, l.trustProxy))
+		if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "429 - Too many requests, please retry later", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ClientKey - идентификатор клиента по ip-адресу. IPv6-адреса объединяем по сети /64
+// (клиенту обычно выдаётся вся сеть, и адрес внутри неё он может менять)
+func ClientKey(r *http.Request, trustProxy bool) string {
+	addr := ""
+	if trustProxy {
+		// первый адрес в X-Forwarded-For - исходный клиент
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			addr = strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+	if addr == "" {
+		addr = r.RemoteAddr
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			addr = host
+		}
+	}
+
+	ip := net.ParseIP(strings.Trim(addr, "[]"))
+	if ip == nil {
+		return addr
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.String()
+	}
+	return ip.Mask(net.CIDRMask(64, 128)).String() + "/64"
+}
@@ -0,0 +1,169 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// часы для тестов: время идёт только по advance
+type testClock struct{ t time.Time }
+
+func (c *testClock) now() time.Time          { return c.t }
+func (c *testClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestLimiter(limit Limit, maxClients int) (*Limiter, *testClock) {
+	clock := &testClock{t: time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)}
+	l := New(limit, maxClients, false)
+	l.now = clock.now
+	return l, clock
+}
+
+func TestAllowTokenBucket(t *testing.T) {
+	type step struct {
+		advance     time.Duration
+		wantAllowed bool
+		wantWait    time.Duration
+	}
+	cases := []struct {
+		name  string
+		limit Limit
+		steps []step
+	}{
+		{"burst, потом по одному в 1/rate", Limit{Rate: 2, Burst: 3}, []step{
+			{0, true, 0},
+			{0, true, 0},
+			{0, true, 0},
+			{0, false, 500 * time.Millisecond},
+			{250 * time.Millisecond, false, 250 * time.Millisecond},
+			{250 * time.Millisecond, true, 0},
+			{0, false, 500 * time.Millisecond},
+		}},
+		{"пополнение не больше burst", Limit{Rate: 10, Burst: 2}, []step{
+			{0, true, 0},
+			{0, true, 0},
+			{time.Hour, true, 0},
+			{0, true, 0},
+			{0, false, 100 * time.Millisecond},
+		}},
+		{"burst меньше 1 - как 1", Limit{Rate: 1, Burst: 0}, []step{
+			{0, true, 0},
+			{0, false, time.Second},
+			{time.Second, true, 0},
+		}},
+		{"rate <= 0 - без ограничения", Limit{Rate: 0, Burst: 1}, []step{
+			{0, true, 0},
+			{0, true, 0},
+			{0, true, 0},
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			l, clock := newTestLimiter(c.limit, 0)
+			for k, s := range c.steps {
+				clock.advance(s.advance)
+				allowed, wait := l.Allow("10.0.0.1")
+				if allowed != s.wantAllowed || wait != s.wantWait {
+					t.Errorf("step %d: Allow = %v, %v; want %v, %v", k, allowed, wait, s.wantAllowed, s.wantWait)
+				}
+			}
+		})
+	}
+}
+
+// клиенты сверх maxClients вытесняют самого давнего: его корзина начинается заново (полной)
+func TestAllowLRUEviction(t *testing.T) {
+	l, _ := newTestLimiter(Limit{Rate: 1, Burst: 1}, 2)
+
+	for _, key := range []string{"a", "b"} {
+		if allowed, _ := l.Allow(key); !allowed {
+			t.Fatalf("first request of %s rejected", key)
+		}
+	}
+	// a - недавний, b - самый давний
+	if allowed, _ := l.Allow("a"); allowed {
+		t.Fatal("second request of a allowed")
+	}
+	l.Allow("c") // вытесняет b
+	if got := l.lru.Len(); got != 2 {
+		t.Errorf("lru len = %d, want 2", got)
+	}
+	if _, ok := l.buckets["b"]; ok {
+		t.Error("b not evicted")
+	}
+	if allowed, _ := l.Allow("b"); !allowed {
+		t.Error("evicted b: request rejected, fresh bucket expected")
+	}
+	// b вернулся и вытеснил a (c обращался позже a)
+	if _, ok := l.buckets["a"]; ok {
+		t.Error("a not evicted")
+	}
+	if allowed, _ := l.Allow("c"); allowed {
+		t.Error("c: bucket lost, second request allowed")
+	}
+}
+
+func TestClientKey(t *testing.T) {
+	cases := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		trustProxy bool
+		want       string
+	}{
+		{"ipv4", "192.168.1.10:51234", "", false, "192.168.1.10"},
+		{"X-Forwarded-For без доверия к прокси", "192.168.1.10:51234", "10.1.1.1", false, "192.168.1.10"},
+		{"X-Forwarded-For - первый адрес", "192.168.1.10:51234", " 10.1.1.1 , 172.16.0.1", true, "10.1.1.1"},
+		{"пустой X-Forwarded-For", "192.168.1.10:51234", "", true, "192.168.1.10"},
+		{"ipv6 - сеть /64", "[2001:db8:1:2:aaaa:bbbb:cccc:dddd]:443", "", false, "2001:db8:1:2::/64"},
+		{"ipv6 из X-Forwarded-For", "192.168.1.10:51234", "2001:db8:1:2::5", true, "2001:db8:1:2::/64"},
+		{"ipv4 в ipv6", "[::ffff:10.0.0.7]:80", "", false, "10.0.0.7"},
+		{"не ip", "unix-socket", "", false, "unix-socket"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = c.remoteAddr
+			if c.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", c.forwarded)
+			}
+			if got := ClientKey(r, c.trustProxy); got != c.want {
+				t.Errorf("ClientKey = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestMiddlewareTooManyRequests(t *testing.T) {
+	l, clock := newTestLimiter(Limit{Rate: 0.4, Burst: 1}, 0)
+	handler := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/get-act-employee", nil)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := request("10.0.0.1:1000"); w.Code != http.StatusNoContent {
+		t.Fatalf("first request: code %d, want %d", w.Code, http.StatusNoContent)
+	}
+	w := request("10.0.0.1:1001")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request: code %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	// 1 / 0.4 = 2.5 c - округляем вверх
+	if got := w.Header().Get("Retry-After"); got != "3" {
+		t.Errorf("Retry-After = %q, want 3", got)
+	}
+	if w := request("10.0.0.2:1000"); w.Code != http.StatusNoContent {
+		t.Errorf("other client: code %d, want %d", w.Code, http.StatusNoContent)
+	}
+	clock.advance(2500 * time.Millisecond)
+	if w := request("10.0.0.1:1002"); w.Code != http.StatusNoContent {
+		t.Errorf("after Retry-After: code %d, want %d", w.Code, http.StatusNoContent)
+	}
+}
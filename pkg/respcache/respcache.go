@@ -0,0 +1,237 @@
+package respcache
+
+// Кэш готовых (сериализованных) ответов GET-запросов в памяти.
+// Ответ отдаётся с ETag и Last-Modified, на условные запросы (If-None-Match, If-Modified-Since) - 304 Not Modified.
+// Invalidate() сбрасывает весь кэш - вызывается, когда загрузка из 1С или правка через api меняет данные.
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	_defaultMaxEntries = 500
+	_defaultMaxBytes   = 128 << 20
+)
+
+type entry struct {
+	key        string
+	generation uint64
+	created    time.Time
+	status     int
+	header     http.Header
+	body       []byte
+	etag       string
+}
+
+// Cache -.
+type Cache struct {
+	maxEntries int
+	maxBytes   int64
+	ttl        time.Duration
+
+	mu           sync.Mutex
+	entries      map[string]*list.Element
+	lru          *list.List // в начале - недавно запрошенные
+	bytes        int64      // сумма размеров тел ответов в кэше
+	generation   uint64     // версия данных, меняется при Invalidate
+	lastModified time.Time  // время последнего изменения данных
+	now          func() time.Time
+}
+
+// New - maxEntries - сколько ответов хранить, maxBytes - сколько байт тел ответов хранить всего
+// (давно не запрашиваемые вытесняются; ответ больше maxBytes не кэшируется), ttl - сколько хранить ответ (0 - пока не сброшен)
+func New(maxEntries int, maxBytes int64, ttl time.Duration) *Cache {
+	if maxEntries <= 0 {
+		maxEntries = _defaultMaxEntries
+	}
+	if maxBytes <= 0 {
+		maxBytes = _defaultMaxBytes
+	}
+	return &Cache{
+		maxEntries:   maxEntries,
+		maxBytes:     maxBytes,
+		ttl:          ttl,
+		entries:      make(map[string]*list.Element),
+		lru:          list.New(),
+		lastModified: time.Now().UTC().Truncate(time.Second),
+		now:          time.Now,
+	}
+}
+
+// Invalidate - данные изменились: сбрасываем все ответы
+func (c *Cache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.lastModified = c.now().UTC().Truncate(time.Second)
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.bytes = 0
+}
+
+// InvalidateAfter - middleware для запросов, меняющих данные: после обработки запроса сбрасываем кэш.
+// onlyChanging - сбрасывать только после не-GET запросов (PUT, POST, DELETE)
+func (c *Cache) InvalidateAfter(next http.Handler, onlyChanging bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		if !onlyChanging || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+			c.Invalidate()
+		}
+	})
+}
+
+// Middleware - кэширует успешные (200) ответы GET-запросов по URL и заголовку Accept
+func (c *Cache) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key := r.URL.RequestURI() + "\n" + r.Header.Get("Accept")
+
+		c.mu.Lock()
+		generation, lastModified := c.generation, c.lastModified
+		cached := c.get(key)
+		c.mu.Unlock()
+
+		if cached == nil {
+			rec := &recorder{header: make(http.Header), status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+
+			sum := sha1.Sum(rec.body.Bytes())
+			cached = &entry{
+				key:        key,
+				generation: generation,
+				created:    c.now(),
+				status:     rec.status,
+				header:     rec.header,
+				body:       rec.body.Bytes(),
+				etag:       `"` + hex.EncodeToString(sum[:]) + `"`,
+			}
+			if rec.status != http.StatusOK {
+				writeEntry(w, cached, false)
+				return
+			}
+			c.mu.Lock()
+			c.put(cached)
+			c.mu.Unlock()
+		}
+
+		for k, v := range cached.header {
+			w.Header()[k] = v
+		}
+		w.Header().Set("ETag", cached.etag)
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		w.Header().Add("Vary", "Accept")
+		writeEntry(w, cached, notModified(r, cached.etag, lastModified))
+	})
+}
+
+func writeEntry(w http.ResponseWriter, e *entry, isNotModified bool) {
+	if isNotModified {
+		w.Header().Del("Content-Type")
+		w.Header().Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if e.status != http.StatusOK {
+		for k, v := range e.header {
+			w.Header()[k] = v
+		}
+	}
+	w.WriteHeader(e.status)
+	w.Write(e.body)
+}
+
+// условный запрос: If-None-Match важнее If-Modified-Since
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == etag {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		t, err := http.ParseTime(ims)
+		if err == nil && !lastModified.After(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// get/put - под c.mu
+func (c *Cache) get(key string) *entry {
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	e := elem.Value.(*entry)
+	if e.generation != c.generation || (c.ttl > 0 && c.now().Sub(e.created) > c.ttl) {
+		c.remove(elem)
+		return nil
+	}
+	c.lru.MoveToFront(elem)
+	return e
+}
+
+func (c *Cache) put(e *entry) {
+	if e.generation != c.generation { // пока готовили ответ, данные изменились
+		return
+	}
+	if int64(len(e.body)) > c.maxBytes {
+		return
+	}
+	if elem, ok := c.entries[e.key]; ok {
+		c.remove(elem)
+	}
+	c.entries[e.key] = c.lru.PushFront(e)
+	c.bytes += int64(len(e.body))
+	for c.lru.Len() > c.maxEntries || c.bytes > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *Cache) remove(elem *list.Element) {
+	e := elem.Value.(*entry)
+	c.lru.Remove(elem)
+	delete(c.entries, e.key)
+	c.bytes -= int64(len(e.body))
+}
+
+// recorder - перехватываем ответ обработчика, чтобы положить его в кэш
+type recorder struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rec *recorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *recorder) WriteHeader(status int) {
+	if rec.wroteHeader {
+		return
+	}
+	rec.status = status
+	rec.wroteHeader = true
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+	return rec.body.Write(b)
+}
@@ -0,0 +1,245 @@
+package respcache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// часы для тестов: время идёт только по advance
+type testClock struct{ t time.Time }
+
+func (c *testClock) now() time.Time          { return c.t }
+func (c *testClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+// обработчик выгрузки: отдаёт "v<версия данных>:<путь>", считает вызовы
+type testHandler struct {
+	version int
+	calls   int
+	status  int
+	before  func() // вызывается посреди запроса - как загрузка из 1С во время выгрузки
+}
+
+func (h *testHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.calls++
+	if h.before != nil {
+		h.before()
+	}
+	status := h.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write([]byte("v" + strconv.Itoa(h.version) + ":" + r.URL.Path))
+}
+
+func newTestCache(maxEntries int, maxBytes int64, ttl time.Duration) (*Cache, *testClock) {
+	clock := &testClock{t: time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)}
+	c := New(maxEntries, maxBytes, ttl)
+	c.now = clock.now
+	c.Invalidate() // lastModified по тестовым часам
+	return c, clock
+}
+
+func doGet(h http.Handler, target string, header map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestMiddlewareCachesOK(t *testing.T) {
+	c, _ := newTestCache(0, 0, 0)
+	next := &testHandler{}
+	h := c.Middleware(next)
+
+	first := doGet(h, "/get-users", nil)
+	second := doGet(h, "/get-users", nil)
+	if next.calls != 1 {
+		t.Errorf("handler called %d times, want 1", next.calls)
+	}
+	if first.Body.String() != "v0:/get-users" || second.Body.String() != first.Body.String() {
+		t.Errorf("bodies = %q, %q", first.Body.String(), second.Body.String())
+	}
+	etag := first.Header().Get("ETag")
+	if etag == "" || second.Header().Get("ETag") != etag {
+		t.Errorf("ETag = %q, %q", etag, second.Header().Get("ETag"))
+	}
+	if got := second.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if got := second.Header().Get("Last-Modified"); got != "Fri, 01 Mar 2024 12:00:00 GMT" {
+		t.Errorf("Last-Modified = %q", got)
+	}
+
+	// другой Accept - другой ответ
+	doGet(h, "/get-users", map[string]string{"Accept": "application/xml"})
+	if next.calls != 2 {
+		t.Errorf("handler called %d times after other Accept, want 2", next.calls)
+	}
+}
+
+func TestMiddlewareNotModified(t *testing.T) {
+	c, _ := newTestCache(0, 0, 0)
+	h := c.Middleware(&testHandler{})
+	etag := doGet(h, "/get-users", nil).Header().Get("ETag")
+
+	cases := []struct {
+		name   string
+		header map[string]string
+		want   int
+	}{
+		{"If-None-Match совпадает", map[string]string{"If-None-Match": etag}, http.StatusNotModified},
+		{"If-None-Match - слабый и в списке", map[string]string{"If-None-Match": `"x", W/` + etag}, http.StatusNotModified},
+		{"If-None-Match - *", map[string]string{"If-None-Match": "*"}, http.StatusNotModified},
+		{"If-None-Match не совпадает", map[string]string{"If-None-Match": `"x"`}, http.StatusOK},
+		{"If-Modified-Since = Last-Modified", map[string]string{"If-Modified-Since": "Fri, 01 Mar 2024 12:00:00 GMT"}, http.StatusNotModified},
+		{"If-Modified-Since раньше", map[string]string{"If-Modified-Since": "Fri, 01 Mar 2024 11:59:59 GMT"}, http.StatusOK},
+		{"If-None-Match важнее If-Modified-Since", map[string]string{
+			"If-None-Match": `"x"`, "If-Modified-Since": "Fri, 01 Mar 2024 12:00:00 GMT"}, http.StatusOK},
+	}
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			w := doGet(h, "/get-users", cs.header)
+			if w.Code != cs.want {
+				t.Fatalf("code %d, want %d", w.Code, cs.want)
+			}
+			if cs.want == http.StatusNotModified {
+				if w.Body.Len() != 0 || w.Header().Get("Content-Type") != "" {
+					t.Errorf("304 with body %q, Content-Type %q", w.Body.String(), w.Header().Get("Content-Type"))
+				}
+				if w.Header().Get("ETag") != etag {
+					t.Errorf("304 ETag = %q, want %q", w.Header().Get("ETag"), etag)
+				}
+			}
+		})
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	c, clock := newTestCache(0, 0, 0)
+	next := &testHandler{}
+	h := c.Middleware(next)
+	first := doGet(h, "/get-users", nil)
+
+	next.version = 1
+	clock.advance(90 * time.Second)
+	change := c.InvalidateAfter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), true)
+	change.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/get-users", nil))
+	if got := doGet(h, "/get-users", nil).Body.String(); got != "v0:/get-users" {
+		t.Fatalf("GET через InvalidateAfter(onlyChanging) сбросил кэш: %q", got)
+	}
+	change.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/user", nil))
+
+	w := doGet(h, "/get-users", map[string]string{"If-None-Match": first.Header().Get("ETag")})
+	if w.Code != http.StatusOK || w.Body.String() != "v1:/get-users" {
+		t.Fatalf("after Invalidate: code %d, body %q", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Last-Modified"); got != "Fri, 01 Mar 2024 12:01:30 GMT" {
+		t.Errorf("Last-Modified = %q", got)
+	}
+	if next.calls != 2 {
+		t.Errorf("handler called %d times, want 2", next.calls)
+	}
+}
+
+// загрузка из 1С сбросила кэш, пока готовился ответ: ответ со старыми данными не кэшируется
+func TestMiddlewareGenerationRace(t *testing.T) {
+	c, _ := newTestCache(0, 0, 0)
+	next := &testHandler{}
+	next.before = func() {
+		next.before = nil
+		c.Invalidate()
+		next.version = 1
+	}
+	h := c.Middleware(next)
+
+	doGet(h, "/get-users", nil)
+	if got := doGet(h, "/get-users", nil).Body.String(); got != "v1:/get-users" {
+		t.Errorf("second body = %q, want v1:/get-users", got)
+	}
+	if next.calls != 2 {
+		t.Errorf("handler called %d times, want 2", next.calls)
+	}
+	if c.lru.Len() != 1 {
+		t.Errorf("cached %d entries, want 1", c.lru.Len())
+	}
+}
+
+func TestMiddlewareSkipsNotOK(t *testing.T) {
+	c, _ := newTestCache(0, 0, 0)
+	next := &testHandler{status: http.StatusInternalServerError}
+	h := c.Middleware(next)
+
+	for k := 0; k < 2; k++ {
+		w := doGet(h, "/get-users", nil)
+		if w.Code != http.StatusInternalServerError || w.Header().Get("ETag") != "" {
+			t.Errorf("request %d: code %d, ETag %q", k, w.Code, w.Header().Get("ETag"))
+		}
+	}
+	if next.calls != 2 || c.lru.Len() != 0 {
+		t.Errorf("handler called %d times, cached %d entries; want 2, 0", next.calls, c.lru.Len())
+	}
+}
+
+func TestTTL(t *testing.T) {
+	c, clock := newTestCache(0, 0, time.Minute)
+	next := &testHandler{}
+	h := c.Middleware(next)
+
+	doGet(h, "/get-users", nil)
+	clock.advance(time.Minute)
+	doGet(h, "/get-users", nil)
+	if next.calls != 1 {
+		t.Errorf("handler called %d times within ttl, want 1", next.calls)
+	}
+	clock.advance(time.Second)
+	doGet(h, "/get-users", nil)
+	if next.calls != 2 {
+		t.Errorf("handler called %d times after ttl, want 2", next.calls)
+	}
+}
+
+// вытесняются давно не запрашиваемые: по числу ответов и по сумме размеров тел
+func TestEviction(t *testing.T) {
+	// тело ответа "v0:/pN" - 6 байт
+	cases := []struct {
+		name       string
+		maxEntries int
+		maxBytes   int64
+		requests   []string
+		wantCached []string // от недавних к давним
+		wantBytes  int64
+	}{
+		{"по числу ответов", 2, 1000, []string{"/p1", "/p2", "/p1", "/p3"}, []string{"/p3", "/p1"}, 12},
+		{"по байтам", 10, 13, []string{"/p1", "/p2", "/p1", "/p3"}, []string{"/p3", "/p1"}, 12},
+		{"ответ больше бюджета не кэшируется", 10, 5, []string{"/p1", "/p2"}, []string{}, 0},
+		{"бюджет ровно по размеру", 10, 6, []string{"/p1", "/p2"}, []string{"/p2"}, 6},
+	}
+	for _, cs := range cases {
+		t.Run(cs.name, func(t *testing.T) {
+			c, _ := newTestCache(cs.maxEntries, cs.maxBytes, 0)
+			h := c.Middleware(&testHandler{})
+			for _, target := range cs.requests {
+				doGet(h, target, nil)
+			}
+			got := make([]string, 0)
+			for elem := c.lru.Front(); elem != nil; elem = elem.Next() {
+				got = append(got, strings.TrimSuffix(elem.Value.(*entry).key, "\n"))
+			}
+			if strings.Join(got, ",") != strings.Join(cs.wantCached, ",") || len(c.entries) != len(cs.wantCached) {
+				t.Errorf("cached %v (%d in map), want %v", got, len(c.entries), cs.wantCached)
+			}
+			if c.bytes != cs.wantBytes {
+				t.Errorf("bytes = %d, want %d", c.bytes, cs.wantBytes)
+			}
+		})
+	}
+}